@@ -9,42 +9,224 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
 	"snippy-server/internal/api"
+	"snippy-server/internal/api/handlers"
+	"snippy-server/internal/api/middleware"
 	"snippy-server/internal/auth"
+	"snippy-server/internal/cache"
+	"snippy-server/internal/collab"
 	"snippy-server/internal/config"
 	"snippy-server/internal/database"
+	"snippy-server/internal/events"
+	"snippy-server/internal/logging"
+	"snippy-server/internal/metrics"
+	"snippy-server/internal/notifications"
+	"snippy-server/internal/sandbox"
+	"snippy-server/internal/scanner"
+	"snippy-server/internal/tombstones"
+	"snippy-server/internal/webhooks"
 )
 
+const usage = `Usage: snippy-server [-config file] [command]
+
+Commands:
+  serve         Run the API server (default)
+  config print  Print the effective configuration with secrets redacted
+  config check  Validate the configuration and exit
+
+Settings are read from the YAML file given by -config or CONFIG_FILE, then
+overridden by environment variables.
+
+Flags:
+`
+
 func main() {
+	// Runs the sandbox setup when this binary was started as a sandbox init
+	sandbox.Init()
+
 	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Println("Warning: .env file not found, using system environment variables")
+	envErr := godotenv.Load()
+
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML configuration file")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// Load and validate configuration
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		var invalid *config.ValidationError
+		if errors.As(err, &invalid) {
+			fmt.Fprintln(os.Stderr, "invalid configuration:")
+			for _, problem := range invalid.Problems {
+				fmt.Fprintln(os.Stderr, "  "+problem)
+			}
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+
+	switch command := strings.Join(flag.Args(), " "); command {
+	case "", "serve":
+		serve(cfg, envErr)
+	case "config print":
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "config check":
+		fmt.Println("configuration is valid")
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", command)
+		flag.Usage()
+		os.Exit(2)
 	}
+}
 
-	// Load configuration
-	cfg := config.Load()
+// serve runs the API server until it receives SIGINT or SIGTERM
+func serve(cfg *config.Config, envErr error) {
+	// Set up structured logging before anything else logs
+	logging.Setup(logging.Config{Format: cfg.Logging.Format, Level: cfg.Logging.Level})
+	if envErr != nil {
+		slog.Warn(".env file not found, using system environment variables")
+	}
 
 	// Initialize database connection
-	if err := database.Connect(); err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+	db, err := database.Connect(cfg.Database)
+	if err != nil {
+		slog.Error("failed to connect to database", "error", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	// Verify session tokens with the keys of the Clerk JWKS endpoint
+	verifier, err := auth.NewVerifier(cfg.Auth)
+	if err != nil {
+		slog.Error("failed to initialize JWKS client", "error", err)
+		os.Exit(1)
+	}
+
+	// Start the webhook delivery worker
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	defer stopWorker()
+	go webhooks.NewWorker(db).Run(workerCtx)
+
+	// Scan public snippets published before secret scanning existed
+	go scanner.NewJob(db).Run(workerCtx)
+
+	// Serve the API from db, authenticating with verifier, with embed,
+	// share image and diagnostics settings from the configuration
+	h := handlers.New(db, verifier, cfg)
+	if len(cfg.Admin.UserIDs) == 0 {
+		slog.Info("no admin user IDs configured, admin API disabled")
+	}
+
+	// Configure the code execution sandbox
+	if cfg.Features.CodeExecution {
+		h.Sandbox = sandbox.NewRunner(sandbox.Config{
+			Limits: sandbox.Limits{
+				Timeout:     time.Duration(cfg.Sandbox.TimeoutSeconds) * time.Second,
+				CPUTime:     time.Duration(cfg.Sandbox.CPUSeconds) * time.Second,
+				MemoryBytes: int64(cfg.Sandbox.MemoryMB) << 20,
+				FileBytes:   sandbox.DefaultLimits.FileBytes,
+				Processes:   sandbox.DefaultLimits.Processes,
+				OutputBytes: cfg.Sandbox.OutputKB << 10,
+			},
+			MaxConcurrent: cfg.Sandbox.MaxConcurrent,
+			MaxPerUser:    cfg.Sandbox.MaxPerUser,
+			QueueTimeout:  time.Duration(cfg.Sandbox.QueueTimeoutSeconds) * time.Second,
+			CacheDir:      cfg.Sandbox.CacheDir,
+		})
+		go func() {
+			if err := h.Sandbox.WarmCache(workerCtx); err != nil {
+				slog.Warn("failed to warm sandbox build cache", "error", err)
+			}
+		}()
 	}
-	defer database.Close()
 
-	// Initialize JWKS client for JWT verification
-	if err := auth.InitializeJWKS(); err != nil {
-		log.Fatalf("Failed to initialize JWKS client: %v", err)
+	// Configure rate limits, shared across replicas when stored in Postgres
+	var rateLimitStore middleware.RateLimitStore = middleware.NewMemoryRateLimitStore()
+	if cfg.RateLimit.Store == "postgres" {
+		rateLimitStore = middleware.NewPostgresRateLimitStore(db)
 	}
+	limiter := middleware.NewRateLimiter(rateLimitStore, cfg.RateLimit)
 
-	// Setup routes
-	router := api.SetupRoutes()
+	// Stream change events to this replica's clients and keep the event log
+	// bounded
+	go func() {
+		if err := database.Listen(workerCtx, cfg.Database.ConnString(), events.Channel, h.Events.PublishPayload, h.Events.Resync); err != nil {
+			slog.Error("failed to listen for change events", "error", err)
+		}
+	}()
+	go events.NewPruner(db, cfg.Events.Retention).Run(workerCtx)
+
+	// Deliver notifications created on any replica to this replica's streams
+	go func() {
+		if err := database.Listen(workerCtx, cfg.Database.ConnString(), notifications.Channel, h.Notifications.PublishPayload, h.Notifications.Resync); err != nil {
+			slog.Error("failed to listen for notifications", "error", err)
+		}
+	}()
+
+	// Forget deletions once clients that have not synced since are better
+	// off starting over
+	go tombstones.NewPruner(db, cfg.Sync.TombstoneRetention).Run(workerCtx)
+
+	// Cache public snippet reads, dropping entries when any replica changes
+	// a snippet
+	if cfg.Cache.Size > 0 {
+		h.Cache = cache.New(cache.NewLRU(cfg.Cache.Size), cfg.Cache.TTL)
+		go func() {
+			invalidateAll := func() { h.InvalidatePublicSnippet(cache.All) }
+			if err := database.Listen(workerCtx, cfg.Database.ConnString(), handlers.SnippetChangesChannel, h.InvalidatePublicSnippet, invalidateAll); err != nil {
+				slog.Error("failed to listen for snippet changes; cached reads expire by TTL only", "error", err)
+			}
+		}()
+	}
+
+	// Run collaborative editing sessions, saving them through the snippet
+	// update path
+	if cfg.Features.Collab {
+		h.Collab = collab.NewManager(h.CollabStore(), cfg.Collab.SaveInterval, cfg.Collab.IdleTimeout)
+		go h.Collab.Run(workerCtx)
+	}
+
+	// Setup routes, trusting the configured web apps with the user's cookies
+	origins := middleware.NewOrigins(cfg.CORS.AllowedOrigins)
+	router := api.SetupRoutes(h, limiter, origins, cfg.Admin.UserIDs)
+
+	// Serve metrics on their own listener, and on the API port only to
+	// scrapers holding the token
+	metrics.RegisterDB(db)
+	if cfg.Metrics.Token != "" {
+		router.Handle("/metrics", metrics.Handler(cfg.Metrics.Token)).Methods("GET")
+	}
+	var metricsServer *http.Server
+	if cfg.Metrics.Addr != "off" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metrics.Handler(cfg.Metrics.Token))
+		metricsServer = &http.Server{Addr: cfg.Metrics.Addr, Handler: metricsMux, ReadHeaderTimeout: 5 * time.Second}
+		go func() {
+			slog.Info("serving metrics", "addr", cfg.Metrics.Addr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("failed to start metrics server", "error", err)
+			}
+		}()
+	}
 
 	// Create HTTP server
 	server := &http.Server{
@@ -57,12 +239,17 @@ func main() {
 
 	// Start server in a goroutine
 	go func() {
-		log.Printf("🚀 Starting Snippy API server on port %s", cfg.Server.Port)
-		log.Printf("📚 API endpoints available at http://localhost:%s/api", cfg.Server.Port)
-		log.Printf("🏥 Health check available at http://localhost:%s/health", cfg.Server.Port)
-		
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+		slog.Info("starting Snippy API server", "port", cfg.Server.Port, "tls", cfg.Server.TLS.Enabled())
+
+		var err error
+		if cfg.Server.TLS.Enabled() {
+			err = server.ListenAndServeTLS(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			slog.Error("failed to start server", "error", err)
+			os.Exit(1)
 		}
 	}()
 
@@ -71,16 +258,28 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("🛑 Shutting down server...")
+	slog.Info("shutting down server")
+
+	// Stop picking up new webhook deliveries
+	stopWorker()
 
 	// Create a deadline for server shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	// Attempt graceful shutdown
+	if metricsServer != nil {
+		metricsServer.Shutdown(ctx)
+	}
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		slog.Error("server forced to shutdown", "error", err)
+		os.Exit(1)
+	}
+
+	// Save collaborative sessions; their WebSockets outlive Shutdown
+	if h.Collab != nil {
+		h.Collab.Close(ctx)
 	}
 
-	log.Println("✅ Server exited gracefully")
+	slog.Info("server exited gracefully")
 }
@@ -1,14 +1,41 @@
 package main
 
 import (
-	"log"
+	"log/slog"
+	"os"
+
+	"snippy-server/internal/config"
 	"snippy-server/internal/database"
+	"snippy-server/internal/logging"
+
+	"github.com/joho/godotenv"
 )
 
 func main() {
-	if err := database.SeedUserData(); err != nil {
-		log.Fatalf("Failed to seed user data: %v", err)
+	// USER_ID and the database settings come from the .env file
+	if err := godotenv.Load(); err != nil {
+		slog.Error("failed to load .env file", "error", err)
+		os.Exit(1)
+	}
+
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		slog.Error("failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+	logging.Setup(logging.Config{Format: cfg.Logging.Format, Level: cfg.Logging.Level})
+
+	db, err := database.Connect(cfg.Database)
+	if err != nil {
+		slog.Error("failed to connect to database", "error", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	if err := database.SeedUserData(db); err != nil {
+		slog.Error("failed to seed user data", "error", err)
+		os.Exit(1)
 	}
 
-	log.Println("✅ Successfully seeded data for user from .env file")
+	slog.Info("seeded data for user from .env file")
 }
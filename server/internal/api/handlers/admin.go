@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	runtimepprof "runtime/pprof"
+	"strconv"
+	"time"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// startedAt is when the process started, for uptime
+var startedAt = time.Now()
+
+// GetDiagnostics reports the build, runtime, database and JWKS state of
+// this server instance
+func (h *Handler) GetDiagnostics(w http.ResponseWriter, r *http.Request) {
+	diagnostics := models.Diagnostics{
+		Build:     buildInfo(),
+		StartedAt: startedAt.UTC(),
+		Uptime:    time.Since(startedAt).Round(time.Second).String(),
+		Runtime:   runtimeStats(),
+		Database:  h.databaseStats(r),
+		JWKS:      h.Auth.JWKSStatus(),
+		Config:    h.settings,
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Diagnostics retrieved",
+		Data:    diagnostics,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// buildInfo reads the module version and VCS stamp embedded by go build
+func buildInfo() models.BuildInfo {
+	info := models.BuildInfo{GoVersion: runtime.Version()}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Module = build.Main.Path
+	info.Version = build.Main.Version
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.Time = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
+
+func runtimeStats() models.RuntimeStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return models.RuntimeStats{
+		Goroutines: runtime.NumGoroutine(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		NumCPU:     runtime.NumCPU(),
+		HeapAlloc:  mem.HeapAlloc,
+		HeapSys:    mem.HeapSys,
+		NumGC:      mem.NumGC,
+	}
+}
+
+// databaseStats reports the connection pool and the migration version
+// recorded by golang-migrate. Query failures are reported in the result
+// rather than failing the request, since diagnostics matter most when the
+// database is unwell.
+func (h *Handler) databaseStats(r *http.Request) models.DatabaseStats {
+	db := h.DB
+	pool := db.Stats()
+	stats := models.DatabaseStats{
+		MaxOpen:           pool.MaxOpenConnections,
+		Open:              pool.OpenConnections,
+		InUse:             pool.InUse,
+		Idle:              pool.Idle,
+		WaitCount:         pool.WaitCount,
+		WaitDuration:      pool.WaitDuration.String(),
+		MaxIdleClosed:     pool.MaxIdleClosed,
+		MaxLifetimeClosed: pool.MaxLifetimeClosed,
+	}
+
+	var version int64
+	err := db.QueryRowContext(r.Context(), "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &stats.MigrationDirty)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		stats.Error = err.Error()
+	default:
+		stats.MigrationVersion = &version
+	}
+	return stats
+}
+
+// profileWriteMargin is the time left to send a CPU profile or trace after
+// sampling ends
+const profileWriteMargin = 10 * time.Second
+
+// GetProfile serves the runtime profiles of net/http/pprof, such as heap,
+// goroutine, profile (CPU) and trace, for use with go tool pprof
+func (h *Handler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["profile"]
+	switch name {
+	case "profile":
+		extendWriteDeadline(w, r, 30*time.Second)
+		pprof.Profile(w, r)
+	case "trace":
+		extendWriteDeadline(w, r, time.Second)
+		pprof.Trace(w, r)
+	case "cmdline":
+		pprof.Cmdline(w, r)
+	case "symbol":
+		pprof.Symbol(w, r)
+	default:
+		if runtimepprof.Lookup(name) == nil {
+			sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "Unknown profile"))
+			return
+		}
+		pprof.Handler(name).ServeHTTP(w, r)
+	}
+}
+
+// extendWriteDeadline lets a profile sampling for the request's seconds
+// parameter, or for fallback without one, outlast the server's
+// WriteTimeout. Writers that cannot extend it are left as they are.
+func extendWriteDeadline(w http.ResponseWriter, r *http.Request, fallback time.Duration) {
+	duration := fallback
+	if seconds, err := strconv.ParseFloat(r.FormValue("seconds"), 64); err == nil && seconds > 0 {
+		duration = time.Duration(seconds * float64(time.Second))
+	}
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(duration + profileWriteMargin))
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"snippy-server/internal/api/middleware"
+	"snippy-server/internal/config"
+
+	"github.com/gorilla/mux"
+)
+
+func TestGetProfile(t *testing.T) {
+	h := New(nil, nil, config.Default())
+	serve := func(profile, query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/admin/pprof/"+profile+query, nil)
+		r = mux.SetURLVars(r, map[string]string{"profile": profile})
+		w := httptest.NewRecorder()
+		h.GetProfile(w, r)
+		return w
+	}
+
+	w := serve("goroutine", "?debug=1")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "TestGetProfile") {
+		t.Errorf("Goroutine profile: got %d\n%s", w.Code, w.Body.String())
+	}
+
+	if w := serve("nonexistent", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Unknown profile: got %d", w.Code)
+	}
+}
+
+// TestGetProfileOutlastsWriteTimeout samples a CPU profile for longer than
+// the server's WriteTimeout, through the middleware's wrapped writer
+func TestGetProfileOutlastsWriteTimeout(t *testing.T) {
+	h := New(nil, nil, config.Default())
+	router := mux.NewRouter()
+	router.HandleFunc("/api/admin/pprof/{profile}", h.GetProfile)
+	server := httptest.NewUnstartedServer(middleware.Logging(router))
+	server.Config.WriteTimeout = 500 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/admin/pprof/profile?seconds=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Reading the profile: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || len(body) == 0 {
+		t.Errorf("CPU profile: got %d with %d bytes\n%s", resp.StatusCode, len(body), body)
+	}
+}
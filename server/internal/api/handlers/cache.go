@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"context"
+
+	"snippy-server/internal/cache"
+)
+
+// SnippetChangesChannel is the Postgres notification channel on which
+// triggers announce changes to public snippets. The payload is the snippet
+// ID, or cache.All when any public snippet may have changed.
+const SnippetChangesChannel = "snippet_changes"
+
+// Cache namespaces for public snippet reads
+const (
+	cachePublicSnippet = "public_snippet" // GetPublicSnippet, by snippet ID
+	cachePublicList    = "public_list"    // GetPublicSnippets, by query string
+)
+
+// InvalidatePublicSnippet drops cached reads affected by a change announced
+// on SnippetChangesChannel. Any change can move a snippet between pages of
+// the public listing, so every cached page goes.
+func (h *Handler) InvalidatePublicSnippet(payload string) {
+	h.Cache.InvalidateAll(cachePublicList)
+	if payload == cache.All {
+		h.Cache.InvalidateAll(cachePublicSnippet)
+		return
+	}
+	h.Cache.Invalidate(context.Background(), cachePublicSnippet, payload)
+}
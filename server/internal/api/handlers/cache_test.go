@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"snippy-server/internal/cache"
+	"snippy-server/internal/config"
+	"snippy-server/internal/database"
+
+	"github.com/gorilla/mux"
+)
+
+// BenchmarkPublicReads compares public snippet reads with and without the
+// cache. It needs a database with at least one public snippet:
+//
+//	DATABASE_URL=postgres://... go test -run '^$' -bench PublicReads ./internal/api/handlers
+func BenchmarkPublicReads(b *testing.B) {
+	if os.Getenv("DATABASE_URL") == "" {
+		b.Skip("DATABASE_URL is not set")
+	}
+	dbConfig := config.Default().Database
+	dbConfig.URL = os.Getenv("DATABASE_URL")
+	db, err := database.Connect(dbConfig)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	h := New(db, nil, config.Default())
+
+	var snippetID string
+	if err := db.QueryRow("SELECT id FROM snippets WHERE is_public = true LIMIT 1").Scan(&snippetID); err != nil {
+		b.Skip("no public snippet to read")
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/snippets/public", h.GetPublicSnippets)
+	router.HandleFunc("/api/snippets/public/{id}", h.GetPublicSnippet)
+
+	for _, target := range []struct{ name, url string }{
+		{"snippet", "/api/snippets/public/" + snippetID},
+		{"list", "/api/snippets/public?sort=forks&limit=50"},
+	} {
+		for _, cached := range []bool{false, true} {
+			name := target.name + "/uncached"
+			h.Cache = nil
+			if cached {
+				name = target.name + "/cached"
+				h.Cache = cache.New(cache.NewLRU(1000), time.Minute)
+			}
+
+			b.Run(name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					w := httptest.NewRecorder()
+					router.ServeHTTP(w, httptest.NewRequest("GET", target.url, nil))
+					if w.Code != http.StatusOK {
+						b.Fatalf("Got status %d: %s", w.Code, w.Body.String())
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"snippy-server/internal/api/middleware"
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/collab"
+	"snippy-server/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// collabPingInterval keeps idle connections open through proxies and
+	// detects dead ones
+	collabPingInterval = 30 * time.Second
+	collabPongWait     = 2 * collabPingInterval
+	collabWriteWait    = 10 * time.Second
+	// collabMaxMessage bounds one message; edits carry the inserted text
+	collabMaxMessage = 4 << 20
+)
+
+// collabClientIDPattern limits client IDs to safe, loggable values
+var collabClientIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// collabUpgrader accepts WebSocket connections from this API's own origin
+// and from origins, the CORS allowlist. Browsers send cookies with
+// cross-site WebSocket requests and CORS does not apply to them, so the
+// origin is checked here.
+func collabUpgrader(origins *middleware.Origins) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		CheckOrigin: origins.Trusted,
+	}
+}
+
+// CollaborateOnSnippet returns a handler upgrading to a WebSocket that joins
+// the snippet's collaborative editing session, for pages from origins.
+// Access follows the REST API: the owner edits, and other users may follow
+// public snippets read-only. Clients reconnecting after a dropped
+// connection pass the session and revision they last saw to receive only
+// the edits they missed.
+func (h *Handler) CollaborateOnSnippet(origins *middleware.Origins) http.HandlerFunc {
+	upgrader := collabUpgrader(origins)
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.collaborateOnSnippet(w, r, upgrader)
+	}
+}
+
+func (h *Handler) collaborateOnSnippet(w http.ResponseWriter, r *http.Request, upgrader *websocket.Upgrader) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	if h.Collab == nil {
+		sendError(w, r, apierror.New(http.StatusServiceUnavailable, apierror.CodeUnavailable, "Collaborative editing is disabled"))
+		return
+	}
+
+	// Get snippet ID from URL parameters
+	vars := mux.Vars(r)
+	snippetID := vars["id"]
+
+	var ownerID string
+	var isPublic bool
+	err = h.DB.QueryRowContext(r.Context(),
+		`SELECT user_id, is_public FROM snippets WHERE id = $1`, snippetID).Scan(&ownerID, &isPublic)
+	if err == sql.ErrNoRows || (err == nil && ownerID != userID && !isPublic) {
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "Snippet not found"))
+		return
+	}
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch snippet"))
+		return
+	}
+
+	// Parse query parameters
+	query := r.URL.Query()
+	clientID := query.Get("client_id")
+	if clientID == "" {
+		clientID = uuid.New().String()
+	} else if !collabClientIDPattern.MatchString(clientID) {
+		sendError(w, r, apierror.Invalid("client_id", "client_id must be 1 to 64 letters, digits or ._:-"))
+		return
+	}
+	resume := collab.Resume{Session: query.Get("session")}
+	if revision := query.Get("revision"); revision != "" {
+		if resume.Revision, err = strconv.Atoi(revision); err != nil || resume.Revision < 0 {
+			sendError(w, r, apierror.Invalid("revision", "revision must be a non-negative integer"))
+			return
+		}
+	}
+
+	if !websocket.IsWebSocketUpgrade(r) {
+		sendError(w, r, apierror.New(http.StatusUpgradeRequired, apierror.CodeInvalidRequest, "Connect with a WebSocket"))
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already responded
+		return
+	}
+	defer conn.Close()
+
+	client := collab.NewClient(userID, clientID, ownerID == userID)
+	session, err := h.Collab.Join(r.Context(), snippetID, client, resume)
+	if err != nil {
+		reason := "Failed to open the session"
+		if errors.Is(err, collab.ErrNotFound) {
+			reason = "Snippet not found"
+		}
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, reason), time.Now().Add(collabWriteWait))
+		return
+	}
+	defer session.Leave(client)
+
+	go writeCollabMessages(conn, client)
+
+	conn.SetReadLimit(collabMaxMessage)
+	conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		session.Receive(r.Context(), client, data)
+	}
+}
+
+// writeCollabMessages sends the session's messages to the connection until
+// the client leaves, then closes it
+func writeCollabMessages(conn *websocket.Conn, client *collab.Client) {
+	ping := time.NewTicker(collabPingInterval)
+	defer ping.Stop()
+	defer conn.Close()
+
+	for {
+		select {
+		case message, ok := <-client.Messages():
+			conn.SetWriteDeadline(time.Now().Add(collabWriteWait))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(collabWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// CollabStore saves collaborative sessions through the same path as
+// PUT /api/snippets/{id}, so their edits are scanned, versioned and
+// announced like any other
+type CollabStore struct {
+	h *Handler
+}
+
+// CollabStore returns the store h's collaborative sessions save through
+func (h *Handler) CollabStore() CollabStore {
+	return CollabStore{h: h}
+}
+
+// Load reads the snippet's owner, content and visibility
+func (s CollabStore) Load(ctx context.Context, snippetID string) (collab.Document, error) {
+	doc := collab.Document{SnippetID: snippetID}
+	err := s.h.DB.QueryRowContext(ctx,
+		`SELECT user_id, content, is_public FROM snippets WHERE id = $1`, snippetID).
+		Scan(&doc.OwnerID, &doc.Content, &doc.Public)
+	if err == sql.ErrNoRows {
+		return doc, collab.ErrNotFound
+	}
+	return doc, err
+}
+
+// Save updates the content on behalf of the owner unless it changed since
+// the session last saw it
+func (s CollabStore) Save(ctx context.Context, doc collab.Document, base string, allowSecrets bool) error {
+	req := models.UpdateSnippetRequest{Content: &doc.Content, AllowSecrets: allowSecrets}
+	_, err := s.h.updateSnippet(ctx, doc.OwnerID, doc.SnippetID, req, func(_ *sql.Tx, existing models.Snippet) error {
+		if existing.Content != base {
+			return collab.ErrConflict
+		}
+		return nil
+	})
+
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) && apiErr.Code == apierror.CodeSnippetNotFound {
+		return collab.ErrNotFound
+	}
+	return err
+}
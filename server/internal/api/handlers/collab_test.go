@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"snippy-server/internal/api/middleware"
+)
+
+func TestCollabOriginCheck(t *testing.T) {
+	upgrader := collabUpgrader(middleware.NewOrigins([]string{"https://snippy.example"}))
+
+	for _, c := range []struct {
+		origin string
+		want   bool
+	}{
+		{"", true}, // Not a browser
+		{"https://api.snippy.example", true},
+		{"https://snippy.example", true},
+		{"https://evil.example", false},
+		{"https://snippy.example.evil.example", false},
+	} {
+		r := httptest.NewRequest("GET", "https://api.snippy.example/api/snippets/1/collab", nil)
+		if c.origin != "" {
+			r.Header.Set("Origin", c.origin)
+		}
+		if got := upgrader.CheckOrigin(r); got != c.want {
+			t.Errorf("%q: got %v", c.origin, got)
+		}
+	}
+}
@@ -1,84 +1,109 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
 
-	"snippy-server/internal/database"
+	"snippy-server/internal/apierror"
 	"snippy-server/internal/models"
+	"snippy-server/internal/webhooks"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
-// createCollection creates a new collection for the authenticated user
-func CreateCollection(w http.ResponseWriter, r *http.Request) {
+// CreateCollection creates a new collection for the authenticated user
+func (h *Handler) CreateCollection(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context (set by auth middleware)
 	userID := r.Context().Value("user_id").(string)
 
 	// Parse request body
 	var req models.CreateCollectionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		sendError(w, r, apierror.InvalidBody(err))
 		return
 	}
 
+	collection, err := h.createCollection(r.Context(), userID, uuid.New().String(), req)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", representationETag(collection))
+
+	response := models.Response{
+		Success: true,
+		Message: "Collection created successfully",
+		Data:    collection,
+	}
+
+	sendJSON(w, http.StatusCreated, response)
+}
+
+// createCollection validates req and creates it as collectionID for userID,
+// queueing webhooks in the same transaction
+func (h *Handler) createCollection(ctx context.Context, userID, collectionID string, req models.CreateCollectionRequest) (models.Collection, error) {
 	// Validate required fields
 	if req.Name == "" {
-		sendError(w, http.StatusBadRequest, "Collection name is required")
-		return
+		return models.Collection{}, apierror.Invalid("name", "Collection name is required")
 	}
 
 	if req.Color == "" {
 		req.Color = "#3b82f6" // Default blue color
 	}
 
-	// Generate UUID for collection
-	collectionID := uuid.New().String()
 	now := time.Now()
 
+	// Start transaction
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Collection{}, apierror.Wrap(err, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+
 	// Insert collection into database
-	_, err := database.GetDB().Exec(`
+	_, err = tx.ExecContext(ctx, `
 		INSERT INTO collections (id, user_id, name, color, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6)`,
 		collectionID, userID, req.Name, req.Color, now, now)
 
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to create collection: "+err.Error())
-		return
+		return models.Collection{}, apierror.Wrap(err, "Failed to create collection")
 	}
 
-	// Create response
-	collection := models.Collection{
-		ID:        collectionID,
-		UserID:    userID,
-		Name:      req.Name,
-		Color:     req.Color,
-		CreatedAt: now,
-		UpdatedAt: now,
+	// Read the collection back so the response matches what GET returns
+	collection, err := loadCollection(tx, collectionID, userID, false)
+	if err != nil {
+		return models.Collection{}, apierror.Wrap(err, "Failed to fetch created collection")
 	}
 
-	response := models.Response{
-		Success: true,
-		Message: "Collection created successfully",
-		Data:    collection,
+	// Queue webhook deliveries in the same transaction
+	if err = webhooks.Enqueue(tx, userID, webhooks.EventCollectionCreated, collection); err != nil {
+		return models.Collection{}, err
 	}
 
-	sendJSON(w, http.StatusCreated, response)
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return models.Collection{}, apierror.Wrap(err, "Failed to commit transaction")
+	}
+
+	return collection, nil
 }
 
 // getCollections retrieves all collections for the authenticated user
-func GetCollections(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetCollections(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
 	userID := r.Context().Value("user_id").(string)
 
 	// Query collections with snippet counts from database
-	rows, err := database.GetDB().Query(`
+	rows, err := h.DB.Query(`
 		SELECT 
 			c.id, 
 			c.user_id, 
@@ -96,7 +121,7 @@ func GetCollections(w http.ResponseWriter, r *http.Request) {
 		ORDER BY position ASC, c.created_at DESC`, userID)
 
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to fetch collections: "+err.Error())
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch collections"))
 		return
 	}
 	defer rows.Close()
@@ -109,7 +134,7 @@ func GetCollections(w http.ResponseWriter, r *http.Request) {
 		var position int
 		err := rows.Scan(&c.ID, &c.UserID, &c.Name, &c.Color, &c.CreatedAt, &c.UpdatedAt, &snippetCount, &position)
 		if err != nil {
-			sendError(w, http.StatusInternalServerError, "Failed to scan collection: "+err.Error())
+			sendError(w, r, apierror.Wrap(err, "Failed to scan collection"))
 			return
 		}
 		// Set the snippet count
@@ -119,6 +144,14 @@ func GetCollections(w http.ResponseWriter, r *http.Request) {
 		collections = append(collections, c)
 	}
 
+	if err := rows.Err(); err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch collections"))
+		return
+	}
+	if notModified(w, r, representationETag(collections), privateCacheControl) {
+		return
+	}
+
 	response := models.Response{
 		Success: true,
 		Message: "Collections retrieved successfully",
@@ -128,8 +161,40 @@ func GetCollections(w http.ResponseWriter, r *http.Request) {
 	sendJSON(w, http.StatusOK, response)
 }
 
-// updateCollection updates an existing collection
-func UpdateCollection(w http.ResponseWriter, r *http.Request) {
+// GetCollection retrieves one of the authenticated user's collections
+func (h *Handler) GetCollection(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID := r.Context().Value("user_id").(string)
+
+	// Get collection ID from URL parameters
+	vars := mux.Vars(r)
+	collectionID := vars["id"]
+
+	collection, err := loadCollection(h.DB, collectionID, userID, false)
+	if err == sql.ErrNoRows {
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeCollectionNotFound, "Collection not found"))
+		return
+	}
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch collection"))
+		return
+	}
+
+	if notModified(w, r, representationETag(collection), privateCacheControl) {
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Collection retrieved successfully",
+		Data:    collection,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// UpdateCollection updates an existing collection
+func (h *Handler) UpdateCollection(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
 	userID := r.Context().Value("user_id").(string)
 
@@ -140,27 +205,60 @@ func UpdateCollection(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
 	var req models.UpdateCollectionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		sendError(w, r, apierror.InvalidBody(err))
 		return
 	}
 
-	// Check if collection exists and belongs to user
-	var existingCollection models.Collection
-	err := database.GetDB().QueryRow(`
-		SELECT id, user_id, name, color, created_at, updated_at
-		FROM collections
-		WHERE id = $1 AND user_id = $2`,
-		collectionID, userID).Scan(
-		&existingCollection.ID, &existingCollection.UserID, &existingCollection.Name,
-		&existingCollection.Color, &existingCollection.CreatedAt, &existingCollection.UpdatedAt)
+	// Refuse to overwrite changes the client has not seen
+	updatedCollection, err := h.updateCollection(r.Context(), userID, collectionID, req, func(_ *sql.Tx, existing models.Collection) error {
+		if etag := representationETag(existing); preconditionFailed(r, etag) {
+			w.Header().Set("ETag", etag)
+			return apierror.New(http.StatusPreconditionFailed, apierror.CodePreconditionFailed,
+				"Collection has changed since it was fetched").WithData(existing)
+		}
+		return nil
+	})
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
 
+	w.Header().Set("ETag", representationETag(updatedCollection))
+
+	response := models.Response{
+		Success: true,
+		Message: "Collection updated successfully",
+		Data:    updatedCollection,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// updateCollection applies req to a collection of userID and queues
+// webhooks. The collection stays locked while precondition inspects the
+// current copy; an error from it aborts the update.
+func (h *Handler) updateCollection(ctx context.Context, userID, collectionID string, req models.UpdateCollectionRequest, precondition func(*sql.Tx, models.Collection) error) (models.Collection, error) {
+	// Start transaction
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Collection{}, apierror.Wrap(err, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+
+	// Check if collection exists and belongs to user, locking it until the
+	// update commits
+	existingCollection, err := loadCollection(tx, collectionID, userID, true)
 	if err == sql.ErrNoRows {
-		sendError(w, http.StatusNotFound, "Collection not found")
-		return
+		return models.Collection{}, apierror.New(http.StatusNotFound, apierror.CodeCollectionNotFound, "Collection not found")
 	}
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to fetch collection: "+err.Error())
-		return
+		return models.Collection{}, apierror.Wrap(err, "Failed to fetch collection")
+	}
+
+	if precondition != nil {
+		if err := precondition(tx, existingCollection); err != nil {
+			return models.Collection{}, err
+		}
 	}
 
 	// Build update query dynamically
@@ -184,38 +282,32 @@ func UpdateCollection(w http.ResponseWriter, r *http.Request) {
 	args = append(args, collectionID, userID)
 
 	// Execute update
-	_, err = database.GetDB().Exec(query, args...)
+	_, err = tx.ExecContext(ctx, query, args...)
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to update collection: "+err.Error())
-		return
+		return models.Collection{}, apierror.Wrap(err, "Failed to update collection")
 	}
 
 	// Fetch updated collection
-	var updatedCollection models.Collection
-	err = database.GetDB().QueryRow(`
-		SELECT id, user_id, name, color, created_at, updated_at
-		FROM collections
-		WHERE id = $1 AND user_id = $2`,
-		collectionID, userID).Scan(
-		&updatedCollection.ID, &updatedCollection.UserID, &updatedCollection.Name,
-		&updatedCollection.Color, &updatedCollection.CreatedAt, &updatedCollection.UpdatedAt)
-
+	updatedCollection, err := loadCollection(tx, collectionID, userID, false)
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to fetch updated collection: "+err.Error())
-		return
+		return models.Collection{}, apierror.Wrap(err, "Failed to fetch updated collection")
 	}
 
-	response := models.Response{
-		Success: true,
-		Message: "Collection updated successfully",
-		Data:    updatedCollection,
+	// Queue webhook deliveries in the same transaction
+	if err = webhooks.Enqueue(tx, userID, webhooks.EventCollectionUpdated, updatedCollection); err != nil {
+		return models.Collection{}, err
 	}
 
-	sendJSON(w, http.StatusOK, response)
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return models.Collection{}, apierror.Wrap(err, "Failed to commit transaction")
+	}
+
+	return updatedCollection, nil
 }
 
-// deleteCollection deletes a collection and its snippets
-func DeleteCollection(w http.ResponseWriter, r *http.Request) {
+// DeleteCollection deletes a collection and its snippets
+func (h *Handler) DeleteCollection(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
 	userID := r.Context().Value("user_id").(string)
 
@@ -223,78 +315,86 @@ func DeleteCollection(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	collectionID := vars["id"]
 
-	// Check if collection exists and belongs to user
-	var collection models.Collection
-	err := database.GetDB().QueryRow(`
-		SELECT id, user_id, name, color, created_at, updated_at
-		FROM collections
-		WHERE id = $1 AND user_id = $2`,
-		collectionID, userID).Scan(
-		&collection.ID, &collection.UserID, &collection.Name,
-		&collection.Color, &collection.CreatedAt, &collection.UpdatedAt)
-
-	if err == sql.ErrNoRows {
-		sendError(w, http.StatusNotFound, "Collection not found")
-		return
-	}
+	collection, err := h.deleteCollection(r.Context(), userID, collectionID, nil)
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to fetch collection: "+err.Error())
+		sendError(w, r, err)
 		return
 	}
 
+	response := models.Response{
+		Success: true,
+		Message: "Collection and all its snippets deleted successfully",
+		Data:    collection,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// deleteCollection deletes a collection of userID with its snippets and
+// positions, queueing webhooks. The collection stays locked while
+// precondition runs; an error from it aborts the deletion.
+func (h *Handler) deleteCollection(ctx context.Context, userID, collectionID string, precondition func(*sql.Tx) error) (models.Collection, error) {
 	// Start transaction
-	tx, err := database.GetDB().Begin()
+	tx, err := h.DB.BeginTx(ctx, nil)
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to start transaction: "+err.Error())
-		return
+		return models.Collection{}, apierror.Wrap(err, "Failed to start transaction")
 	}
 	defer tx.Rollback()
 
+	// Check if collection exists and belongs to user
+	collection, err := loadCollection(tx, collectionID, userID, true)
+	if err == sql.ErrNoRows {
+		return models.Collection{}, apierror.New(http.StatusNotFound, apierror.CodeCollectionNotFound, "Collection not found")
+	}
+	if err != nil {
+		return models.Collection{}, apierror.Wrap(err, "Failed to fetch collection")
+	}
+
+	if precondition != nil {
+		if err := precondition(tx); err != nil {
+			return models.Collection{}, err
+		}
+	}
+
 	// Delete collection position record
-	_, err = tx.Exec("DELETE FROM collection_positions WHERE collection_id = $1 AND user_id = $2", collectionID, userID)
+	_, err = tx.ExecContext(ctx, "DELETE FROM collection_positions WHERE collection_id = $1 AND user_id = $2", collectionID, userID)
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to delete collection position: "+err.Error())
-		return
+		return models.Collection{}, apierror.Wrap(err, "Failed to delete collection position")
 	}
 
 	// Delete snippet position records for this collection
-	_, err = tx.Exec("DELETE FROM collection_snippet_positions WHERE collection_id = $1 AND user_id = $2", collectionID, userID)
+	_, err = tx.ExecContext(ctx, "DELETE FROM collection_snippet_positions WHERE collection_id = $1 AND user_id = $2", collectionID, userID)
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to delete snippet positions: "+err.Error())
-		return
+		return models.Collection{}, apierror.Wrap(err, "Failed to delete snippet positions")
 	}
 
 	// Delete snippets in collection first
-	_, err = tx.Exec("DELETE FROM snippets WHERE collection_id = $1 AND user_id = $2", collectionID, userID)
+	_, err = tx.ExecContext(ctx, "DELETE FROM snippets WHERE $1 = ANY(collection_ids) AND user_id = $2", collectionID, userID)
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to delete snippets: "+err.Error())
-		return
+		return models.Collection{}, apierror.Wrap(err, "Failed to delete snippets")
 	}
 
 	// Delete collection
-	_, err = tx.Exec("DELETE FROM collections WHERE id = $1 AND user_id = $2", collectionID, userID)
+	_, err = tx.ExecContext(ctx, "DELETE FROM collections WHERE id = $1 AND user_id = $2", collectionID, userID)
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to delete collection: "+err.Error())
-		return
+		return models.Collection{}, apierror.Wrap(err, "Failed to delete collection")
 	}
 
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to commit transaction: "+err.Error())
-		return
+	// Queue webhook deliveries in the same transaction
+	if err = webhooks.Enqueue(tx, userID, webhooks.EventCollectionDeleted, collection); err != nil {
+		return models.Collection{}, err
 	}
 
-	response := models.Response{
-		Success: true,
-		Message: "Collection and all its snippets deleted successfully",
-		Data:    collection,
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return models.Collection{}, apierror.Wrap(err, "Failed to commit transaction")
 	}
 
-	sendJSON(w, http.StatusOK, response)
+	return collection, nil
 }
 
 // GetCollectionSnippets retrieves snippets for a specific collection with positions
-func GetCollectionSnippets(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetCollectionSnippets(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
 	userID := r.Context().Value("user_id").(string)
 
@@ -304,7 +404,7 @@ func GetCollectionSnippets(w http.ResponseWriter, r *http.Request) {
 
 	// Check if collection exists and belongs to user
 	var collection models.Collection
-	err := database.GetDB().QueryRow(`
+	err := h.DB.QueryRow(`
 		SELECT id, user_id, name, color, created_at, updated_at
 		FROM collections
 		WHERE id = $1 AND user_id = $2`,
@@ -313,16 +413,16 @@ func GetCollectionSnippets(w http.ResponseWriter, r *http.Request) {
 		&collection.Color, &collection.CreatedAt, &collection.UpdatedAt)
 
 	if err == sql.ErrNoRows {
-		sendError(w, http.StatusNotFound, "Collection not found")
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeCollectionNotFound, "Collection not found"))
 		return
 	}
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to fetch collection: "+err.Error())
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch collection"))
 		return
 	}
 
 	// Query snippets with positions for this collection
-	rows, err := database.GetDB().Query(`
+	rows, err := h.DB.Query(`
 		SELECT s.id, s.user_id, s.title, s.content, s.is_favorite, s.created_at,
 		       COALESCE(csp.position, 0) as position
 		FROM snippets s
@@ -331,7 +431,7 @@ func GetCollectionSnippets(w http.ResponseWriter, r *http.Request) {
 		ORDER BY COALESCE(csp.position, 0), s.created_at DESC`, collectionID, userID)
 
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to fetch snippets: "+err.Error())
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch snippets"))
 		return
 	}
 	defer rows.Close()
@@ -353,7 +453,7 @@ func GetCollectionSnippets(w http.ResponseWriter, r *http.Request) {
 		err := rows.Scan(&snippet.ID, &snippet.UserID, &snippet.Title, &snippet.Content,
 			&snippet.IsFavorite, &snippet.CreatedAt, &snippet.Position)
 		if err != nil {
-			sendError(w, http.StatusInternalServerError, "Failed to scan snippet: "+err.Error())
+			sendError(w, r, apierror.Wrap(err, "Failed to scan snippet"))
 			return
 		}
 		snippets = append(snippets, snippet)
@@ -372,38 +472,30 @@ func GetCollectionSnippets(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateCollectionPositions updates the positions of collections
-func UpdateCollectionPositions(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateCollectionPositions(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
 	userID := r.Context().Value("user_id").(string)
 
-	log.Printf("UpdateCollectionPositions called for user: %s", userID)
-
 	// Parse request body
-	var req struct {
-		Positions []struct {
-			ID       string `json:"id"`
-			Position int    `json:"position"`
-		} `json:"positions"`
-	}
+	var req models.UpdatePositionsRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Failed to decode request body: %v", err)
-		sendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		slog.DebugContext(r.Context(), "invalid collection positions body", "error", err)
+		sendError(w, r, apierror.InvalidBody(err))
 		return
 	}
 
-	log.Printf("Received positions update: %+v", req.Positions)
+	slog.DebugContext(r.Context(), "updating collection positions", "count", len(req.Positions))
 
 	if len(req.Positions) == 0 {
-		log.Printf("No positions provided")
-		sendError(w, http.StatusBadRequest, "No positions provided")
+		sendError(w, r, apierror.Invalid("positions", "No positions provided"))
 		return
 	}
 
 	// Start transaction
-	tx, err := database.GetDB().Begin()
+	tx, err := h.DB.Begin()
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to start transaction: "+err.Error())
+		sendError(w, r, apierror.Wrap(err, "Failed to start transaction"))
 		return
 	}
 	defer tx.Rollback()
@@ -412,8 +504,8 @@ func UpdateCollectionPositions(w http.ResponseWriter, r *http.Request) {
 	positionMap := make(map[int]string)
 	for _, pos := range req.Positions {
 		if existingID, exists := positionMap[pos.Position]; exists {
-			log.Printf("Duplicate position %d found for collections %s and %s", pos.Position, existingID, pos.ID)
-			sendError(w, http.StatusBadRequest, fmt.Sprintf("Duplicate position %d found for multiple collections", pos.Position))
+			slog.DebugContext(r.Context(), "duplicate collection position", "position", pos.Position, "collection_id", pos.ID, "existing_collection_id", existingID)
+			sendError(w, r, apierror.Invalid("positions", fmt.Sprintf("Duplicate position %d found for multiple collections", pos.Position)))
 			return
 		}
 		positionMap[pos.Position] = pos.ID
@@ -421,35 +513,15 @@ func UpdateCollectionPositions(w http.ResponseWriter, r *http.Request) {
 
 	// Update positions
 	for _, pos := range req.Positions {
-		// Check if collection belongs to user
-		var exists bool
-		err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM collections WHERE id = $1 AND user_id = $2)",
-			pos.ID, userID).Scan(&exists)
-		if err != nil {
-			sendError(w, http.StatusInternalServerError, "Failed to validate collection ownership: "+err.Error())
-			return
-		}
-		if !exists {
-			sendError(w, http.StatusForbidden, "Collection not found or access denied")
-			return
-		}
-
-		// Insert or update position
-		_, err = tx.Exec(`
-			INSERT INTO collection_positions (collection_id, user_id, position, created_at, updated_at)
-			VALUES ($1, $2, $3, now(), now())
-			ON CONFLICT (collection_id, user_id) 
-			DO UPDATE SET position = $3, updated_at = now()`,
-			pos.ID, userID, pos.Position)
-		if err != nil {
-			sendError(w, http.StatusInternalServerError, "Failed to update position: "+err.Error())
+		if _, err := setCollectionPosition(tx, userID, pos.ID, pos.Position); err != nil {
+			sendError(w, r, err)
 			return
 		}
 	}
 
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to commit transaction: "+err.Error())
+		sendError(w, r, apierror.Wrap(err, "Failed to commit transaction"))
 		return
 	}
 
@@ -462,7 +534,7 @@ func UpdateCollectionPositions(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateCollectionSnippetPositions updates the positions of snippets within a collection
-func UpdateCollectionSnippetPositions(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateCollectionSnippetPositions(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
 	userID := r.Context().Value("user_id").(string)
 
@@ -472,74 +544,49 @@ func UpdateCollectionSnippetPositions(w http.ResponseWriter, r *http.Request) {
 
 	// Check if collection exists and belongs to user
 	var exists bool
-	err := database.GetDB().QueryRow("SELECT EXISTS(SELECT 1 FROM collections WHERE id = $1 AND user_id = $2)",
+	err := h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM collections WHERE id = $1 AND user_id = $2)",
 		collectionID, userID).Scan(&exists)
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to validate collection ownership: "+err.Error())
+		sendError(w, r, apierror.Wrap(err, "Failed to validate collection ownership"))
 		return
 	}
 	if !exists {
-		sendError(w, http.StatusForbidden, "Collection not found or access denied")
+		sendError(w, r, apierror.New(http.StatusForbidden, apierror.CodeForbidden, "Collection not found or access denied"))
 		return
 	}
 
 	// Parse request body
-	var req struct {
-		Positions []struct {
-			ID       string `json:"id"`
-			Position int    `json:"position"`
-		} `json:"positions"`
-	}
+	var req models.UpdatePositionsRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		sendError(w, r, apierror.InvalidBody(err))
 		return
 	}
 
 	if len(req.Positions) == 0 {
-		sendError(w, http.StatusBadRequest, "No positions provided")
+		sendError(w, r, apierror.Invalid("positions", "No positions provided"))
 		return
 	}
 
 	// Start transaction
-	tx, err := database.GetDB().Begin()
+	tx, err := h.DB.Begin()
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to start transaction: "+err.Error())
+		sendError(w, r, apierror.Wrap(err, "Failed to start transaction"))
 		return
 	}
 	defer tx.Rollback()
 
 	// Update snippet positions
 	for _, pos := range req.Positions {
-		// Check if snippet belongs to user and is in this collection
-		var exists bool
-		err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM snippets WHERE id = $1 AND user_id = $2 AND $3 = ANY(collection_ids))",
-			pos.ID, userID, collectionID).Scan(&exists)
-		if err != nil {
-			sendError(w, http.StatusInternalServerError, "Failed to validate snippet ownership: "+err.Error())
-			return
-		}
-		if !exists {
-			sendError(w, http.StatusForbidden, "Snippet not found or not in collection")
-			return
-		}
-
-		// Insert or update position
-		_, err = tx.Exec(`
-			INSERT INTO collection_snippet_positions (collection_id, snippet_id, user_id, position, created_at, updated_at)
-			VALUES ($1, $2, $3, $4, now(), now())
-			ON CONFLICT (collection_id, snippet_id) 
-			DO UPDATE SET position = $4, updated_at = now()`,
-			collectionID, pos.ID, userID, pos.Position)
-		if err != nil {
-			sendError(w, http.StatusInternalServerError, "Failed to update snippet position: "+err.Error())
+		if _, err := setSnippetPosition(tx, userID, collectionID, pos.ID, pos.Position); err != nil {
+			sendError(w, r, err)
 			return
 		}
 	}
 
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to commit transaction: "+err.Error())
+		sendError(w, r, apierror.Wrap(err, "Failed to commit transaction"))
 		return
 	}
 
@@ -550,3 +597,77 @@ func UpdateCollectionSnippetPositions(w http.ResponseWriter, r *http.Request) {
 
 	sendJSON(w, http.StatusOK, response)
 }
+
+// setCollectionPosition places a collection of userID at position,
+// returning the ID of the position record
+func setCollectionPosition(tx *sql.Tx, userID, collectionID string, position int) (string, error) {
+	// Check if collection belongs to user
+	var exists bool
+	err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM collections WHERE id = $1 AND user_id = $2)",
+		collectionID, userID).Scan(&exists)
+	if err != nil {
+		return "", apierror.Wrap(err, "Failed to validate collection ownership")
+	}
+	if !exists {
+		return "", apierror.New(http.StatusForbidden, apierror.CodeForbidden, "Collection not found or access denied")
+	}
+
+	// Insert or update position
+	var positionID string
+	err = tx.QueryRow(`
+		INSERT INTO collection_positions (collection_id, user_id, position, created_at, updated_at)
+		VALUES ($1, $2, $3, now(), now())
+		ON CONFLICT (collection_id, user_id) 
+		DO UPDATE SET position = $3, updated_at = now()
+		RETURNING id`,
+		collectionID, userID, position).Scan(&positionID)
+	if err != nil {
+		return "", apierror.Wrap(err, "Failed to update position")
+	}
+	return positionID, nil
+}
+
+// setSnippetPosition places a snippet of userID at position within one of
+// the collections it belongs to, returning the ID of the position record
+func setSnippetPosition(tx *sql.Tx, userID, collectionID, snippetID string, position int) (string, error) {
+	// Check if snippet belongs to user and is in this collection
+	var exists bool
+	err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM snippets WHERE id = $1 AND user_id = $2 AND $3 = ANY(collection_ids))",
+		snippetID, userID, collectionID).Scan(&exists)
+	if err != nil {
+		return "", apierror.Wrap(err, "Failed to validate snippet ownership")
+	}
+	if !exists {
+		return "", apierror.New(http.StatusForbidden, apierror.CodeForbidden, "Snippet not found or not in collection")
+	}
+
+	// Insert or update position
+	var positionID string
+	err = tx.QueryRow(`
+		INSERT INTO collection_snippet_positions (collection_id, snippet_id, user_id, position, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, now(), now())
+		ON CONFLICT (collection_id, snippet_id) 
+		DO UPDATE SET position = $4, updated_at = now()
+		RETURNING id`,
+		collectionID, snippetID, userID, position).Scan(&positionID)
+	if err != nil {
+		return "", apierror.Wrap(err, "Failed to update snippet position")
+	}
+	return positionID, nil
+}
+
+// loadCollection fetches a collection owned by userID, optionally locking
+// it for the rest of the transaction
+func loadCollection(q rowQuerier, collectionID, userID string, forUpdate bool) (models.Collection, error) {
+	query := `
+		SELECT id, user_id, name, color, created_at, updated_at
+		FROM collections
+		WHERE id = $1 AND user_id = $2`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	var c models.Collection
+	err := q.QueryRow(query, collectionID, userID).Scan(&c.ID, &c.UserID, &c.Name, &c.Color, &c.CreatedAt, &c.UpdatedAt)
+	return c, err
+}
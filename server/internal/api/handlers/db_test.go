@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"snippy-server/internal/config"
+	"snippy-server/internal/database"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// testDB connects to the migrated database in DATABASE_URL, skipping the
+// test when it is not set:
+//
+//	DATABASE_URL=postgres://... go test ./internal/api/handlers
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	if os.Getenv("DATABASE_URL") == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	dbConfig := config.Default().Database
+	dbConfig.URL = os.Getenv("DATABASE_URL")
+	db, err := database.Connect(dbConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// testHandler serves from the database in DATABASE_URL with the default
+// configuration, skipping the test when it is not set
+func testHandler(t *testing.T) *Handler {
+	t.Helper()
+	return New(testDB(t), nil, config.Default())
+}
+
+// testUser returns a user ID no other test run uses, and deletes the
+// user's rows from tables when the test ends
+func testUser(t *testing.T, db *sql.DB, tables ...string) string {
+	t.Helper()
+	userID := "user_test_" + uuid.New().String()
+	t.Cleanup(func() {
+		for _, table := range tables {
+			if _, err := db.Exec("DELETE FROM "+table+" WHERE user_id = $1", userID); err != nil {
+				t.Errorf("Failed to clean up %s: %v", table, err)
+			}
+		}
+	})
+	return userID
+}
+
+// serveAs calls handler as userID, with vars as the route variables
+func serveAs(handler http.HandlerFunc, userID, method, target, body string, vars map[string]string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	r := httptest.NewRequest(method, target, reader)
+	r = r.WithContext(context.WithValue(r.Context(), "user_id", userID))
+	if vars != nil {
+		r = mux.SetURLVars(r, vars)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
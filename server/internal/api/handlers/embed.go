@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/config"
+	"snippy-server/internal/metrics"
+	"snippy-server/internal/models"
+	"snippy-server/internal/render"
+
+	"github.com/gorilla/mux"
+)
+
+// Embed frame sizes used for oEmbed responses
+const (
+	embedDefaultWidth  = 640
+	embedHeaderHeight  = 44
+	embedLineHeight    = 20
+	embedMaxAutoHeight = 600
+)
+
+// embedSettings normalises the public URLs used by the embed and oEmbed
+// endpoints
+func embedSettings(cfg config.EmbedConfig) config.EmbedConfig {
+	cfg.PublicURL = strings.TrimRight(cfg.PublicURL, "/")
+	cfg.AppURL = strings.TrimRight(cfg.AppURL, "/")
+	return cfg
+}
+
+// embedScript is the only script on embed pages. It is static so the CSP
+// can allow it by hash, which stays valid for cached pages.
+const embedScript = `
+(function () {
+  var button = document.getElementById('copy');
+  var source = document.getElementById('source');
+  button.addEventListener('click', function () {
+    navigator.clipboard.writeText(source.value).then(function () {
+      button.textContent = 'Copied';
+      setTimeout(function () { button.textContent = 'Copy'; }, 1500);
+    });
+  });
+  function resize() {
+    parent.postMessage({ type: 'snippy:resize', id: document.body.dataset.id, height: document.documentElement.scrollHeight }, '*');
+  }
+  window.addEventListener('load', resize);
+  window.addEventListener('resize', resize);
+})();
+`
+
+var embedScriptHash = func() string {
+	sum := sha256.Sum256([]byte(embedScript))
+	return "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+}()
+
+var embedPage = template.Must(template.New("embed").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Title}} - Snippy</title>
+<style>
+  body { margin: 0; font-family: system-ui, sans-serif; font-size: 13px; background: {{.Background}}; color: {{.Text}}; }
+  header { display: flex; align-items: center; gap: 8px; padding: 8px 12px; border-bottom: 1px solid {{.Border}}; }
+  header a { color: inherit; text-decoration: none; font-weight: 600; flex: 1; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+  header span { opacity: .6; }
+  button { font: inherit; color: inherit; background: transparent; border: 1px solid {{.Border}}; border-radius: 4px; padding: 2px 10px; cursor: pointer; }
+  main pre { margin: 0; padding: 12px; overflow: auto; font-size: 13px; line-height: 20px; }
+  #source { display: none; }
+</style>
+</head>
+<body data-id="{{.ID}}">
+<header>
+  <a href="{{.Link}}" target="_blank" rel="noopener">{{.Title}}</a>
+  <span>Snippy</span>
+  <button id="copy" type="button">Copy</button>
+</header>
+<main>{{.Code}}</main>
+<textarea id="source" readonly>{{.Content}}</textarea>
+<script>{{.Script}}</script>
+</body>
+</html>
+`))
+
+// embedLoader writes an iframe after the script tag that loaded it and
+// resizes it to fit its content. A relative frame URL is resolved against
+// the script's own URL.
+const embedLoader = `(function () {
+  var src = %s, id = %s, script = document.currentScript;
+  var frame = document.createElement('iframe');
+  frame.src = new URL(src, script.src).href;
+  frame.title = %s;
+  frame.loading = 'lazy';
+  frame.allow = 'clipboard-write';
+  frame.style.cssText = 'width:100%%;height:%dpx;border:0;border-radius:6px;';
+  script.parentNode.insertBefore(frame, script.nextSibling);
+  window.addEventListener('message', function (e) {
+    if (e.source === frame.contentWindow && e.data && e.data.type === 'snippy:resize' && e.data.id === id) {
+      frame.style.height = e.data.height + 'px';
+    }
+  });
+})();
+`
+
+// EmbedSnippet serves a public snippet as a read-only, highlighted page meant
+// to be shown in an iframe (no authentication required)
+func (h *Handler) EmbedSnippet(w http.ResponseWriter, r *http.Request) {
+	// Get snippet ID from URL parameters
+	vars := mux.Vars(r)
+	snippetID := vars["id"]
+
+	opts, ok := parseRenderOptions(w, r)
+	if !ok {
+		return
+	}
+
+	snippet, ok := h.loadEmbeddableSnippet(w, r, snippetID)
+	if !ok {
+		return
+	}
+	opts.Filename = snippet.Title
+	opts.Standalone = false
+	metrics.PublicReads.WithLabelValues("embed").Inc()
+
+	h.allowFraming(w)
+	etag := contentETag(snippet.ID, strconv.Itoa(snippet.Version), "embed", r.URL.RawQuery, h.embed.AppURL)
+	if notModified(w, r, etag, renderCacheControl) {
+		return
+	}
+
+	var code bytes.Buffer
+	if err := render.HTML(&code, snippet.Content, opts); err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to render snippet"))
+		return
+	}
+
+	palette := render.ThemePalette(render.Style(opts.Theme))
+	var page bytes.Buffer
+	err := embedPage.Execute(&page, map[string]interface{}{
+		"ID":         snippet.ID,
+		"Title":      snippet.Title,
+		"Link":       h.embed.AppURL + "/snippet/" + snippet.ID,
+		"Content":    snippet.Content,
+		"Code":       template.HTML(code.String()),
+		"Script":     template.JS(embedScript),
+		"Background": template.CSS(palette.Background.String()),
+		"Text":       template.CSS(palette.Text.String()),
+		"Border":     template.CSS(palette.Highlight.String()),
+	})
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to render embed"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(page.Bytes())
+}
+
+// EmbedSnippetScript serves a script that inserts the embed iframe where the
+// script tag is placed (no authentication required)
+func (h *Handler) EmbedSnippetScript(w http.ResponseWriter, r *http.Request) {
+	// Get snippet ID from URL parameters
+	vars := mux.Vars(r)
+	snippetID := vars["id"]
+
+	if _, ok := parseRenderOptions(w, r); !ok {
+		return
+	}
+
+	snippet, ok := h.loadEmbeddableSnippet(w, r, snippetID)
+	if !ok {
+		return
+	}
+
+	metrics.PublicReads.WithLabelValues("embed_script").Inc()
+
+	// Without a public URL the frame URL is left relative rather than built
+	// from the Host header, since the script is publicly cacheable
+	frameURL := h.embed.PublicURL + embedPath(snippet.ID, r.URL.RawQuery)
+	etag := contentETag(snippet.ID, strconv.Itoa(snippet.Version), "embed.js", frameURL)
+	if notModified(w, r, etag, renderCacheControl) {
+		return
+	}
+
+	src, _ := json.Marshal(frameURL)
+	id, _ := json.Marshal(snippet.ID)
+	title, _ := json.Marshal(snippet.Title)
+
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, embedLoader, src, id, title, embedHeight(snippet.Content, 0))
+}
+
+// embeddableURL matches the app and embed URLs of a snippet
+var embeddableURL = regexp.MustCompile(`^/(snippet|embed)/([0-9a-fA-F-]{36})(?:\.js)?/?$`)
+
+// OEmbed implements the oEmbed provider endpoint for snippet URLs
+// (no authentication required). See https://oembed.com.
+func (h *Handler) OEmbed(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if format := query.Get("format"); format != "" && format != "json" {
+		sendError(w, r, apierror.New(http.StatusNotImplemented, apierror.CodeNotImplemented, "Only the json format is supported"))
+		return
+	}
+
+	// The returned iframe must point at this API from anywhere, so the
+	// public URL has to be known
+	if h.embed.PublicURL == "" {
+		sendError(w, r, apierror.New(http.StatusNotImplemented, apierror.CodeNotImplemented, "oEmbed requires a configured public URL"))
+		return
+	}
+
+	target, err := url.Parse(query.Get("url"))
+	if err != nil || query.Get("url") == "" || (target.Scheme != "http" && target.Scheme != "https") {
+		sendError(w, r, apierror.Invalid("url", "A valid http(s) url parameter is required"))
+		return
+	}
+	snippetID, ok := h.embeddableSnippetID(target)
+	if !ok {
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "URL does not point to a snippet"))
+		return
+	}
+
+	snippet, ok := h.loadEmbeddableSnippet(w, r, snippetID)
+	if !ok {
+		return
+	}
+
+	width := embedDefaultWidth
+	if maxWidth, err := strconv.Atoi(query.Get("maxwidth")); err == nil && maxWidth > 0 && maxWidth < width {
+		width = maxWidth
+	}
+	maxHeight, _ := strconv.Atoi(query.Get("maxheight"))
+	height := embedHeight(snippet.Content, maxHeight)
+
+	// Carry display options such as theme and lines over from the embedded URL
+	frameURL := h.embed.PublicURL + embedPath(snippet.ID, target.RawQuery)
+	html := fmt.Sprintf(`<iframe src="%s" width="%d" height="%d" title="%s" loading="lazy" allow="clipboard-write" style="border:0;border-radius:6px;"></iframe>`,
+		template.HTMLEscapeString(frameURL), width, height, template.HTMLEscapeString(snippet.Title))
+
+	w.Header().Set("Cache-Control", renderCacheControl)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"version":       "1.0",
+		"type":          "rich",
+		"provider_name": "Snippy",
+		"provider_url":  h.embed.AppURL,
+		"title":         snippet.Title,
+		"author_name":   snippet.UserID,
+		"cache_age":     300,
+		"html":          html,
+		"width":         width,
+		"height":        height,
+	})
+}
+
+// loadEmbeddableSnippet fetches a public snippet for the embed endpoints. It
+// writes the error response and returns false on failure.
+func (h *Handler) loadEmbeddableSnippet(w http.ResponseWriter, r *http.Request, snippetID string) (models.Snippet, bool) {
+	snippet, err := loadPublicSnippet(h.DB, snippetID)
+	if err == sql.ErrNoRows {
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "Public snippet not found"))
+		return snippet, false
+	}
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch snippet"))
+		return snippet, false
+	}
+	return snippet, true
+}
+
+// allowFraming lets any page listed in the embed frame-ancestors policy show
+// the response in an iframe, and nothing else
+func (h *Handler) allowFraming(w http.ResponseWriter) {
+	w.Header().Del("X-Frame-Options")
+	w.Header().Set("Content-Security-Policy", fmt.Sprintf(
+		"default-src 'none'; style-src 'unsafe-inline'; script-src %s; base-uri 'none'; form-action 'none'; frame-ancestors %s",
+		embedScriptHash, h.embed.FrameAncestors))
+}
+
+// embeddableSnippetID returns the snippet ID of an app URL on the web
+// app's host or an embed URL on this API's host. URLs of other sites are
+// not ours to describe, even if their path looks like a snippet's.
+func (h *Handler) embeddableSnippetID(target *url.URL) (string, bool) {
+	m := embeddableURL.FindStringSubmatch(target.Path)
+	if m == nil {
+		return "", false
+	}
+	base := h.embed.PublicURL
+	if m[1] == "snippet" {
+		base = h.embed.AppURL
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil || !strings.EqualFold(baseURL.Host, target.Host) {
+		return "", false
+	}
+	return m[2], true
+}
+
+// embedPath returns the path of a snippet's embed page
+func embedPath(snippetID, rawQuery string) string {
+	path := "/embed/" + snippetID
+	if rawQuery != "" {
+		path += "?" + rawQuery
+	}
+	return path
+}
+
+// embedHeight estimates the frame height needed to show content without
+// scrolling, capped at maxHeight (or a default cap when zero)
+func embedHeight(content string, maxHeight int) int {
+	if maxHeight <= 0 {
+		maxHeight = embedMaxAutoHeight
+	}
+	lines := strings.Count(strings.TrimRight(content, "\n"), "\n") + 1
+	height := embedHeaderHeight + 24 + lines*embedLineHeight
+	if height > maxHeight {
+		height = maxHeight
+	}
+	return height
+}
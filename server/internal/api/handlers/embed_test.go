@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"snippy-server/internal/config"
+
+	"github.com/gorilla/mux"
+)
+
+// withEmbedSettings configures h's embed endpoints
+func withEmbedSettings(h *Handler, cfg config.EmbedConfig) {
+	h.embed = embedSettings(cfg)
+}
+
+// getPublic calls a public handler, with vars as the route variables
+func getPublic(handler http.HandlerFunc, target string, vars map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", target, nil)
+	if vars != nil {
+		r = mux.SetURLVars(r, vars)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func oEmbedRequest(snippetURL string) string {
+	return "/oembed?url=" + url.QueryEscape(snippetURL)
+}
+
+func TestOEmbedRejectsOtherHosts(t *testing.T) {
+	h := New(nil, nil, config.Default())
+	withEmbedSettings(h, config.EmbedConfig{PublicURL: "https://api.snippy.example", AppURL: "https://snippy.example"})
+	id := "0b9d4a0e-8b7c-4b9e-9d1a-2f6f3c1e5a7b"
+
+	for _, target := range []string{
+		"https://evil.example/snippet/" + id,
+		"https://evil.example/embed/" + id,
+		"https://snippy.example/embed/" + id,          // Embeds are served by the API
+		"https://api.snippy.example/snippet/" + id,    // Snippet pages by the app
+		"https://api.snippy.example.evil/embed/" + id, // Not a suffix match
+	} {
+		w := getPublic(h.OEmbed, oEmbedRequest(target), nil)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d: %s", target, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestOEmbedRequiresPublicURL(t *testing.T) {
+	h := New(nil, nil, config.Default())
+	withEmbedSettings(h, config.EmbedConfig{AppURL: "https://snippy.example"})
+
+	w := getPublic(h.OEmbed, oEmbedRequest("https://snippy.example/snippet/0b9d4a0e-8b7c-4b9e-9d1a-2f6f3c1e5a7b"), nil)
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestEmbedEndpoints(t *testing.T) {
+	h := testHandler(t)
+	db := h.DB
+	owner := testUser(t, db, ownerTables...)
+	publicID := testPublicSnippet(t, db, owner, "hello.sh", "echo hello\n")
+	var privateID string
+	err := db.QueryRow(`
+		INSERT INTO snippets (user_id, title, content, is_public)
+		VALUES ($1, 'secret.sh', 'echo secret', false)
+		RETURNING id`, owner).Scan(&privateID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withEmbedSettings(h, config.EmbedConfig{PublicURL: "https://api.snippy.example", AppURL: "https://snippy.example", FrameAncestors: "*"})
+
+	w := getPublic(h.EmbedSnippet, "/embed/"+publicID, map[string]string{"id": publicID})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "echo") {
+		t.Fatalf("Embed page: got %d: %s", w.Code, w.Body.String())
+	}
+	if csp := w.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "frame-ancestors *") {
+		t.Errorf("Embed page CSP is %q", csp)
+	}
+
+	w = getPublic(h.EmbedSnippetScript, "/embed/"+publicID+".js?theme=dracula", map[string]string{"id": publicID})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"https://api.snippy.example/embed/`+publicID+`?theme=dracula"`) {
+		t.Errorf("Embed script: got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = getPublic(h.OEmbed, oEmbedRequest("https://snippy.example/snippet/"+publicID), nil)
+	var oembed struct {
+		Type  string `json:"type"`
+		Title string `json:"title"`
+		HTML  string `json:"html"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &oembed); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("oEmbed: got %d: %s", w.Code, w.Body.String())
+	}
+	if oembed.Type != "rich" || oembed.Title != "hello.sh" || !strings.Contains(oembed.HTML, `src="https://api.snippy.example/embed/`+publicID+`"`) {
+		t.Errorf("Unexpected oEmbed response: %+v", oembed)
+	}
+
+	// Private snippets are not embeddable in any form
+	for name, w := range map[string]*httptest.ResponseRecorder{
+		"page":   getPublic(h.EmbedSnippet, "/embed/"+privateID, map[string]string{"id": privateID}),
+		"script": getPublic(h.EmbedSnippetScript, "/embed/"+privateID+".js", map[string]string{"id": privateID}),
+		"oEmbed": getPublic(h.OEmbed, oEmbedRequest("https://snippy.example/snippet/"+privateID), nil),
+	} {
+		if w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "secret") {
+			t.Errorf("Private snippet %s: got %d: %s", name, w.Code, w.Body.String())
+		}
+	}
+
+	// Without a public URL the script does not trust the Host header
+	withEmbedSettings(h, config.EmbedConfig{AppURL: "https://snippy.example"})
+	r := httptest.NewRequest("GET", "/embed/"+publicID+".js", nil)
+	r.Host = "evil.example"
+	w = httptest.NewRecorder()
+	h.EmbedSnippetScript(w, mux.SetURLVars(r, map[string]string{"id": publicID}))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "evil.example") || !strings.Contains(w.Body.String(), `"/embed/`+publicID+`"`) {
+		t.Errorf("Embed script without a public URL: got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"snippy-server/internal/models"
+)
+
+func TestSnippetETag(t *testing.T) {
+	snippet := models.Snippet{ID: "a", Title: "x", Version: 1}
+	etag := snippetETag(snippet)
+	if etag != snippetETag(snippet) {
+		t.Error("ETag should be stable")
+	}
+
+	edited := snippet
+	edited.Version = 2
+	if snippetETag(edited) == etag {
+		t.Error("ETag should change with the version")
+	}
+	renamed := snippet
+	renamed.TagNames = []string{"go"}
+	if snippetETag(renamed) == etag {
+		t.Error("ETag should change with the tag names")
+	}
+	forked := snippet
+	forked.ForkCount = 1
+	if snippetETag(forked) == etag {
+		t.Error("ETag should change with the fork count")
+	}
+	other := snippet
+	other.ID = "b"
+	if snippetETag(other) == etag {
+		t.Error("ETag should differ between snippets")
+	}
+}
+
+func TestPreconditionFailed(t *testing.T) {
+	etag := `"abc"`
+	tests := map[string]bool{
+		"":               false,
+		`"abc"`:          false,
+		`"old", "abc"`:   false,
+		"*":              false,
+		`"old"`:          true,
+		`W/"abc"`:        true, // If-Match uses strong comparison
+		`"abc-modified"`: true,
+	}
+	for header, want := range tests {
+		r := httptest.NewRequest("PUT", "/api/snippets/a", nil)
+		if header != "" {
+			r.Header.Set("If-Match", header)
+		}
+		if got := preconditionFailed(r, etag); got != want {
+			t.Errorf("If-Match %q: got %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	etag := `"abc"`
+	for header, want := range map[string]bool{"": false, `"abc"`: true, `W/"abc"`: true, `"old"`: false} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/collections", nil)
+		if header != "" {
+			r.Header.Set("If-None-Match", header)
+		}
+		if got := notModified(w, r, etag, privateCacheControl); got != want {
+			t.Errorf("If-None-Match %q: got %v, want %v", header, got, want)
+		}
+		if want && w.Code != http.StatusNotModified {
+			t.Errorf("If-None-Match %q: got status %d", header, w.Code)
+		}
+		if w.Header().Get("ETag") != etag || w.Header().Get("Cache-Control") != privateCacheControl {
+			t.Errorf("Caching headers missing: %v", w.Header())
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/events"
+	"snippy-server/internal/models"
+)
+
+const (
+	// eventHeartbeatInterval keeps idle event streams from being closed by
+	// proxies
+	eventHeartbeatInterval = 25 * time.Second
+	// eventCatchUpBatch is how many logged events are read at a time
+	eventCatchUpBatch = 500
+)
+
+// StreamEvents streams changes to the user's snippets, collections and tags
+// as Server-Sent Events. Clients resume after a disconnect by sending the
+// last event ID they received in Last-Event-ID (or last_event_id for the
+// first connection); events since then are replayed from the log. When the
+// log no longer reaches back that far a reset event tells the client to
+// reload everything.
+func (h *Handler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	lastID, resuming, err := parseLastEventID(r)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sendError(w, r, apierror.New(http.StatusInternalServerError, apierror.CodeInternal, "Streaming is not supported"))
+		return
+	}
+
+	// Subscribe before reading the log so no event falls between the two
+	sub, unsubscribe := h.Events.Subscribe(userID)
+	defer unsubscribe()
+
+	db := h.DB
+	oldest, newest, err := events.Bounds(r.Context(), db, userID)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to read events"))
+		return
+	}
+
+	// The stream outlives the server's write timeout
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// A user's event IDs become visible in order, so anything at or below
+	// lastID was sent already, by the catch-up or as a notification
+	send := func(e models.ChangeEvent) {
+		if e.ID <= lastID {
+			return
+		}
+		lastID = e.ID
+		writeChangeEvent(w, e)
+	}
+
+	// catchUp replays logged events after lastID
+	catchUp := func() error {
+		for {
+			logged, err := events.Since(r.Context(), db, userID, lastID, eventCatchUpBatch)
+			if err != nil {
+				return err
+			}
+			for _, e := range logged {
+				send(e)
+			}
+			flusher.Flush()
+			if len(logged) < eventCatchUpBatch {
+				return nil
+			}
+		}
+	}
+
+	switch {
+	case !resuming:
+		lastID = newest
+		fmt.Fprintf(w, "id: %d\nevent: ready\ndata: {}\n\n", newest)
+	case lastID+1 < oldest:
+		// Events after lastID may have been pruned
+		lastID = newest
+		fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {}\n\n", newest)
+	default:
+		if err := catchUp(); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case e := <-sub.Items:
+			if e.ID > lastID+1 {
+				// An earlier notification was missed; the log has both
+				if err := catchUp(); err != nil {
+					return
+				}
+				continue
+			}
+			send(e)
+			flusher.Flush()
+		case <-sub.Lagged:
+			if err := catchUp(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// parseLastEventID reads the ID to resume after from the Last-Event-ID
+// header, which browsers send when reconnecting, or the last_event_id
+// query parameter
+func parseLastEventID(r *http.Request) (int64, bool, error) {
+	value := r.Header.Get("Last-Event-ID")
+	field := "Last-Event-ID"
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+		field = "last_event_id"
+	}
+	if value == "" {
+		return 0, false, nil
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0, false, apierror.Invalid(field, field+" must be an event ID")
+	}
+	return id, true, nil
+}
+
+// writeChangeEvent writes e as an SSE message named after its type
+func writeChangeEvent(w http.ResponseWriter, e models.ChangeEvent) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, payload)
+}
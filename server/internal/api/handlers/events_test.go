@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"snippy-server/internal/events"
+)
+
+func TestChangeEventsAreNumberedPerUser(t *testing.T) {
+	db := testDB(t)
+	owner := testUser(t, db, ownerTables...)
+	other := testUser(t, db, ownerTables...)
+	ctx := context.Background()
+
+	snippetID := testPublicSnippet(t, db, owner, "Greeting", "hello\n")
+	testPublicSnippet(t, db, other, "Other", "other\n")
+	if _, err := db.Exec("UPDATE snippets SET content = 'hi' WHERE id = $1", snippetID); err != nil {
+		t.Fatal(err)
+	}
+
+	logged, err := events.Since(ctx, db, owner, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logged) != 2 || logged[0].ID != 1 || logged[0].Type != "snippet.created" ||
+		logged[1].ID != 2 || logged[1].Type != "snippet.updated" {
+		t.Fatalf("Unexpected events: %+v", logged)
+	}
+
+	if oldest, newest, err := events.Bounds(ctx, db, owner); err != nil || oldest != 1 || newest != 2 {
+		t.Errorf("Bounds = %d, %d, %v", oldest, newest, err)
+	}
+
+	// Once the log is pruned, resuming from any earlier event needs a reset
+	if _, err := db.Exec("DELETE FROM change_events WHERE user_id = $1", owner); err != nil {
+		t.Fatal(err)
+	}
+	if oldest, newest, err := events.Bounds(ctx, db, owner); err != nil || oldest != 3 || newest != 2 {
+		t.Errorf("Bounds after pruning = %d, %d, %v", oldest, newest, err)
+	}
+}
@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/diff"
+	"snippy-server/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// maxForkDepth bounds how far the lineage queries walk the fork graph
+const maxForkDepth = 20
+
+// GetSnippetForks returns the fork tree below a snippet and its ancestors.
+// Private forks of other users are left out together with their subtrees.
+func (h *Handler) GetSnippetForks(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get snippet ID from URL parameters
+	vars := mux.Vars(r)
+	snippetID := vars["id"]
+
+	// Collect the snippet and every fork below it
+	rows, err := h.DB.Query(`
+		WITH RECURSIVE lineage AS (
+			SELECT id, user_id, title, is_public, fork_count, forked_from, created_at, 0 AS depth
+			FROM snippets
+			WHERE id = $1 AND (is_public = true OR user_id = $2)
+			UNION ALL
+			SELECT s.id, s.user_id, s.title, s.is_public, s.fork_count, s.forked_from, s.created_at, l.depth + 1
+			FROM snippets s
+			JOIN lineage l ON s.forked_from = l.id
+			WHERE l.depth < $3
+		)
+		SELECT id, user_id, title, is_public, fork_count, forked_from, created_at
+		FROM lineage
+		ORDER BY depth, created_at`, snippetID, userID, maxForkDepth)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch forks"))
+		return
+	}
+	nodes, err := scanForkNodes(rows)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	if len(nodes) == 0 {
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "Snippet not found"))
+		return
+	}
+
+	// Rows come out breadth-first, so parents are always seen before children
+	root := nodes[0]
+	visible := map[string]*models.ForkNode{root.ID: root}
+	for _, node := range nodes[1:] {
+		parent, ok := visible[*node.ForkedFrom]
+		if !ok || (!node.IsPublic && node.UserID != userID) {
+			continue
+		}
+		parent.Forks = append(parent.Forks, node)
+		visible[node.ID] = node
+	}
+
+	// Walk up the forked_from chain for context
+	rows, err = h.DB.Query(`
+		WITH RECURSIVE ancestors AS (
+			SELECT p.id, p.user_id, p.title, p.is_public, p.fork_count, p.forked_from, p.created_at, 1 AS depth
+			FROM snippets p
+			JOIN snippets s ON s.forked_from = p.id
+			WHERE s.id = $1
+			UNION ALL
+			SELECT p.id, p.user_id, p.title, p.is_public, p.fork_count, p.forked_from, p.created_at, a.depth + 1
+			FROM snippets p
+			JOIN ancestors a ON a.forked_from = p.id
+			WHERE a.depth < $2
+		)
+		SELECT id, user_id, title, is_public, fork_count, forked_from, created_at
+		FROM ancestors
+		ORDER BY depth`, snippetID, maxForkDepth)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch ancestors"))
+		return
+	}
+	ancestors, err := scanForkNodes(rows)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	// Stop at the first ancestor the user may not see
+	visibleAncestors := make([]*models.ForkNode, 0, len(ancestors))
+	for _, node := range ancestors {
+		if !node.IsPublic && node.UserID != userID {
+			break
+		}
+		visibleAncestors = append(visibleAncestors, node)
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Fork tree retrieved successfully",
+		Data: map[string]interface{}{
+			"tree":      root,
+			"ancestors": visibleAncestors,
+		},
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// GetUpstreamDiff shows what changed upstream and locally since a fork was
+// created or last synced
+func (h *Handler) GetUpstreamDiff(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get snippet ID from URL parameters
+	vars := mux.Vars(r)
+	snippetID := vars["id"]
+
+	state, err := loadForkState(h.DB, snippetID, userID)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	result := models.UpstreamDiff{
+		SnippetID:       state.forkID,
+		UpstreamID:      state.upstreamID,
+		UpstreamChanged: state.upstreamContent != state.baseContent || state.upstreamTitle != state.baseTitle,
+		LocalChanged:    state.forkContent != state.baseContent || state.forkTitle != state.baseTitle,
+		UpstreamDiff:    diff.Unified("base", "upstream", state.baseContent, state.upstreamContent, 3),
+		LocalDiff:       diff.Unified("base", "fork", state.baseContent, state.forkContent, 3),
+		UpstreamTitle:   state.upstreamTitle,
+		SyncedAt:        state.syncedAt,
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Upstream diff retrieved successfully",
+		Data:    result,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// SyncSnippetFromUpstream merges upstream changes into a fork with a
+// three-way merge. Conflicting merges are rejected with 409 unless the
+// client allows conflict markers to be saved.
+func (h *Handler) SyncSnippetFromUpstream(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get snippet ID from URL parameters
+	vars := mux.Vars(r)
+	snippetID := vars["id"]
+
+	// The body is optional
+	var req models.SyncSnippetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		sendError(w, r, apierror.InvalidBody(err))
+		return
+	}
+
+	// Start transaction
+	tx, err := h.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to start transaction"))
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the fork so an edit made while merging cannot be overwritten
+	existing, err := lockOwnedSnippet(tx, snippetID, userID)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	state, err := loadForkState(tx, snippetID, userID)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	merged := diff.Merge3(state.baseContent, state.forkContent, state.upstreamContent, "fork", "upstream")
+
+	// Titles are merged as a single line: keep a local rename, otherwise follow upstream
+	title := state.forkTitle
+	if state.forkTitle == state.baseTitle {
+		title = state.upstreamTitle
+	}
+
+	if merged.Conflicts > 0 && !req.AllowConflicts {
+		conflict := apierror.New(http.StatusConflict, apierror.CodeMergeConflict, fmt.Sprintf("Merge has %d conflict(s)", merged.Conflicts))
+		sendError(w, r, conflict.WithData(merged))
+		return
+	}
+
+	// Record the new merge base
+	_, err = tx.Exec(`
+		UPDATE snippets
+		SET upstream_base_title = $1, upstream_base_content = $2, upstream_synced_at = $3
+		WHERE id = $4 AND user_id = $5`,
+		state.upstreamTitle, state.upstreamContent, time.Now(), snippetID, userID)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to sync snippet"))
+		return
+	}
+
+	// Save the merge like any other edit, so public forks are scanned for
+	// secrets and the version and ETag change
+	snippet, err := applySnippetUpdate(r.Context(), tx, userID, existing, models.UpdateSnippetRequest{
+		Title:        &title,
+		Content:      &merged.Content,
+		AllowSecrets: req.AllowSecrets,
+	})
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to commit transaction"))
+		return
+	}
+
+	w.Header().Set("ETag", snippetETag(snippet))
+	response := models.Response{
+		Success: true,
+		Message: "Snippet synced with upstream successfully",
+		Data: map[string]interface{}{
+			"snippet":   snippet,
+			"conflicts": merged.Conflicts,
+		},
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// forkState holds the three sides of a fork sync
+type forkState struct {
+	forkID          string
+	forkTitle       string
+	forkContent     string
+	upstreamID      string
+	upstreamTitle   string
+	upstreamContent string
+	baseTitle       string
+	baseContent     string
+	syncedAt        *time.Time
+}
+
+// loadForkState loads a fork owned by userID together with its upstream.
+// Failures are *apierror.Error values ready to send.
+func loadForkState(q rowQuerier, snippetID, userID string) (*forkState, error) {
+	state := &forkState{}
+	var forkedFrom *string
+	var baseTitle, baseContent *string
+
+	err := q.QueryRow(`
+		SELECT id, title, content, forked_from, upstream_base_title, upstream_base_content, upstream_synced_at
+		FROM snippets
+		WHERE id = $1 AND user_id = $2`,
+		snippetID, userID).Scan(
+		&state.forkID, &state.forkTitle, &state.forkContent, &forkedFrom,
+		&baseTitle, &baseContent, &state.syncedAt)
+	if err == sql.ErrNoRows {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "Snippet not found")
+	}
+	if err != nil {
+		return nil, apierror.Wrap(err, "Failed to fetch snippet")
+	}
+	if forkedFrom == nil {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeValidationFailed, "Snippet is not a fork")
+	}
+
+	// Forks created before upstream tracking have no known ancestor, so an
+	// empty base makes every differing region a conflict instead of losing edits
+	if baseTitle != nil {
+		state.baseTitle = *baseTitle
+	}
+	if baseContent != nil {
+		state.baseContent = *baseContent
+	}
+
+	err = q.QueryRow(`
+		SELECT id, title, content
+		FROM snippets
+		WHERE id = $1 AND (is_public = true OR user_id = $2)`,
+		*forkedFrom, userID).Scan(&state.upstreamID, &state.upstreamTitle, &state.upstreamContent)
+	if err == sql.ErrNoRows {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "Upstream snippet not found or no longer public")
+	}
+	if err != nil {
+		return nil, apierror.Wrap(err, "Failed to fetch upstream snippet")
+	}
+
+	return state, nil
+}
+
+// scanForkNodes reads lineage rows into fork nodes and closes rows
+func scanForkNodes(rows *sql.Rows) ([]*models.ForkNode, error) {
+	defer rows.Close()
+
+	var nodes []*models.ForkNode
+	for rows.Next() {
+		node := &models.ForkNode{Forks: []*models.ForkNode{}}
+		err := rows.Scan(&node.ID, &node.UserID, &node.Title, &node.IsPublic, &node.ForkCount, &node.ForkedFrom, &node.CreatedAt)
+		if err != nil {
+			return nil, apierror.Wrap(err, "Failed to scan fork")
+		}
+		nodes = append(nodes, node)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, apierror.Wrap(err, "Failed to iterate forks")
+	}
+	return nodes, nil
+}
+
+// mapTagsToUser finds or creates tags owned by userID with the same names
+// as sourceTagIDs, preserving their order
+func mapTagsToUser(tx *sql.Tx, sourceTagIDs []string, userID string) ([]string, []string, error) {
+	tagIDs := []string{}
+	tagNames := []string{}
+	if len(sourceTagIDs) == 0 {
+		return tagIDs, tagNames, nil
+	}
+
+	rows, err := tx.Query(`
+		SELECT name FROM tags
+		WHERE id::text = ANY($1)
+		ORDER BY array_position($1, id::text)`, pq.Array(sourceTagIDs))
+	if err != nil {
+		return nil, nil, apierror.Wrap(err, "Failed to fetch original tags")
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, nil, apierror.Wrap(err, "Failed to scan tag")
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, apierror.Wrap(err, "Failed to iterate tags")
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range names {
+		// Same normalization as CreateTag
+		tagName := strings.TrimSpace(strings.ToLower(name))
+		if tagName == "" || seen[tagName] {
+			continue
+		}
+		seen[tagName] = true
+
+		var tagID string
+		err := tx.QueryRow(`
+			SELECT id FROM tags
+			WHERE LOWER(name) = LOWER($1) AND user_id = $2`,
+			tagName, userID).Scan(&tagID)
+		if err == sql.ErrNoRows {
+			tagID = uuid.New().String()
+			now := time.Now()
+			_, err = tx.Exec(`
+				INSERT INTO tags (id, name, user_id, color, created_at, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6)`,
+				tagID, tagName, userID, "#3b82f6", now, now)
+		}
+		if err != nil {
+			return nil, nil, apierror.Wrap(err, fmt.Sprintf("Failed to map tag %q", tagName))
+		}
+
+		tagIDs = append(tagIDs, tagID)
+		tagNames = append(tagNames, tagName)
+	}
+
+	return tagIDs, tagNames, nil
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"database/sql"
+	"log/slog"
+
+	"snippy-server/internal/auth"
+	"snippy-server/internal/cache"
+	"snippy-server/internal/collab"
+	"snippy-server/internal/config"
+	"snippy-server/internal/events"
+	"snippy-server/internal/notifications"
+	"snippy-server/internal/render"
+	"snippy-server/internal/sandbox"
+)
+
+// Handler serves the API endpoints with the services they share. main
+// creates it with New and sets the optional services of enabled features.
+type Handler struct {
+	DB            *sql.DB
+	Auth          *auth.Verifier     // Verifies session tokens
+	Events        *events.Hub        // Fans change events out to this replica's streams
+	Notifications *notifications.Hub // Fans new notifications out to this replica's streams
+	Images        *render.ImageCache // Rendered share images
+	Sandbox       *sandbox.Runner    // Runs code; nil disables code execution
+	Cache         *cache.Cache       // Caches public reads; nil disables caching
+	Collab        *collab.Manager    // Runs collaborative sessions; nil disables them
+
+	embed    config.EmbedConfig     // Public URLs and framing policy for embeds
+	settings map[string]interface{} // Redacted configuration shown in diagnostics
+}
+
+// New creates a Handler using db and verifier, with the embed, image and
+// diagnostics settings from cfg
+func New(db *sql.DB, verifier *auth.Verifier, cfg *config.Config) *Handler {
+	settings, err := cfg.Settings()
+	if err != nil {
+		slog.Error("failed to encode configuration for diagnostics", "error", err)
+	}
+
+	return &Handler{
+		DB:            db,
+		Auth:          verifier,
+		Events:        events.NewHub(),
+		Notifications: notifications.NewHub(),
+		Images:        render.NewImageCache(cfg.Render.ImageCacheDir, int64(cfg.Render.ImageCacheMB)<<20),
+		embed:         embedSettings(cfg.Embed),
+		settings:      settings,
+	}
+}
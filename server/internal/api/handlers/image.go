@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+// imageCacheControl lets social previews and CDNs keep share images longer
+// than rendered pages; the ETag still changes with every edit
+const imageCacheControl = "public, max-age=3600"
+
+// GetSnippetImage renders a public snippet as a PNG share image
+// (no authentication required)
+func (h *Handler) GetSnippetImage(w http.ResponseWriter, r *http.Request) {
+	// Get snippet ID from URL parameters
+	vars := mux.Vars(r)
+	snippetID := vars["id"]
+
+	opts, ok := parseRenderOptions(w, r)
+	if !ok {
+		return
+	}
+
+	snippet, ok := h.loadEmbeddableSnippet(w, r, snippetID)
+	if !ok {
+		return
+	}
+	opts.Filename = snippet.Title
+	metrics.PublicReads.WithLabelValues("image").Inc()
+
+	etag := contentETag(snippet.ID, strconv.Itoa(snippet.Version), "png", r.URL.RawQuery)
+	if notModified(w, r, etag, imageCacheControl) {
+		return
+	}
+
+	data, err := h.Images.PNG(snippet.Content, opts)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to render image"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(data)
+	}
+}
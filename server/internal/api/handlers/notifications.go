@@ -0,0 +1,432 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/models"
+	"snippy-server/internal/notifications"
+
+	"github.com/gorilla/mux"
+)
+
+// notificationHeartbeatInterval keeps idle notification streams from being
+// closed by proxies
+const notificationHeartbeatInterval = 25 * time.Second
+
+// notificationOrders are the sort orders of the notification list
+var notificationOrders = map[string]keyset[models.Notification]{
+	"created": {
+		columns: []string{"created_at", "id"}, types: []string{"timestamp", "uuid"}, desc: true,
+		values: func(n models.Notification) []string { return []string{cursorTime(n.CreatedAt), n.ID} },
+	},
+}
+
+// GetNotifications retrieves the authenticated user's notifications with the unread count
+func (h *Handler) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	p, err := parsePage(r, notificationOrders, "created")
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	from := "FROM notifications WHERE user_id = $1"
+	if r.URL.Query().Get("unread") == "true" {
+		from += " AND read_at IS NULL"
+	}
+	args := []interface{}{userID}
+
+	query := "SELECT " + notificationColumns + " " + from
+	if after, afterArgs := p.where(2); after != "" {
+		query += " AND " + after
+		args = append(args, afterArgs...)
+	}
+	query += p.orderBy()
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch notifications"))
+		return
+	}
+	defer rows.Close()
+
+	// initialize as empty slice to avoid null in JSON
+	list := make([]models.Notification, 0)
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			sendError(w, r, apierror.Wrap(err, "Failed to scan notification"))
+			return
+		}
+		list = append(list, n)
+	}
+
+	if err = rows.Err(); err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to iterate notifications"))
+		return
+	}
+
+	list, info := p.finish(list)
+	if err := p.count(h.DB, info, from, []interface{}{userID}); err != nil {
+		sendError(w, r, err)
+		return
+	}
+	setPageLinks(w, r, info)
+
+	unreadCount, err := h.countUnreadNotifications(userID)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Notifications retrieved successfully",
+		Data: map[string]interface{}{
+			"notifications": list,
+			"unread_count":  unreadCount,
+		},
+		Page: info,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// GetUnreadNotificationCount returns only the unread count, for badge polling
+func (h *Handler) GetUnreadNotificationCount(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	unreadCount, err := h.countUnreadNotifications(userID)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Unread notification count retrieved successfully",
+		Data:    map[string]int{"unread_count": unreadCount},
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// MarkNotificationRead marks a single notification as read
+func (h *Handler) MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get notification ID from URL parameters
+	vars := mux.Vars(r)
+	notificationID := vars["id"]
+
+	// COALESCE keeps the original read time when marking twice
+	var readAt time.Time
+	err = h.DB.QueryRow(`
+		UPDATE notifications SET read_at = COALESCE(read_at, now())
+		WHERE id = $1 AND user_id = $2
+		RETURNING read_at`,
+		notificationID, userID).Scan(&readAt)
+
+	if err == sql.ErrNoRows {
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeNotificationNotFound, "Notification not found"))
+		return
+	}
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to mark notification as read"))
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Notification marked as read",
+		Data: map[string]interface{}{
+			"id":      notificationID,
+			"read_at": readAt,
+		},
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// MarkAllNotificationsRead marks every unread notification of the user as read
+func (h *Handler) MarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	result, err := h.DB.Exec(`
+		UPDATE notifications SET read_at = now()
+		WHERE user_id = $1 AND read_at IS NULL`, userID)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to mark notifications as read"))
+		return
+	}
+
+	updated, _ := result.RowsAffected()
+
+	response := models.Response{
+		Success: true,
+		Message: "All notifications marked as read",
+		Data:    map[string]int64{"updated": updated},
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// GetNotificationPreferences returns the enabled state of every notification type
+func (h *Handler) GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	preferences, err := h.loadNotificationPreferences(userID)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Notification preferences retrieved successfully",
+		Data:    preferences,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// UpdateNotificationPreferences enables or disables notification types for the user
+func (h *Handler) UpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Parse request body
+	var req models.UpdateNotificationPreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, apierror.InvalidBody(err))
+		return
+	}
+
+	if len(req.Preferences) == 0 {
+		sendError(w, r, apierror.Invalid("preferences", "No preferences provided"))
+		return
+	}
+
+	for _, p := range req.Preferences {
+		if !notifications.IsValidType(p.Type) {
+			sendError(w, r, apierror.Invalid("preferences", fmt.Sprintf("Unknown notification type: %s", p.Type)))
+			return
+		}
+	}
+
+	// Start transaction
+	tx, err := h.DB.Begin()
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to start transaction"))
+		return
+	}
+	defer tx.Rollback()
+
+	for _, p := range req.Preferences {
+		_, err = tx.Exec(`
+			INSERT INTO notification_preferences (user_id, type, enabled, created_at, updated_at)
+			VALUES ($1, $2, $3, now(), now())
+			ON CONFLICT (user_id, type)
+			DO UPDATE SET enabled = $3`,
+			userID, p.Type, p.Enabled)
+		if err != nil {
+			sendError(w, r, apierror.Wrap(err, "Failed to update notification preference"))
+			return
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to commit transaction"))
+		return
+	}
+
+	preferences, err := h.loadNotificationPreferences(userID)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Notification preferences updated successfully",
+		Data:    preferences,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// StreamNotifications pushes new notifications to the client as Server-Sent
+// Events. Notifications are announced through Postgres, so they reach the
+// stream whichever replica created them. When announcements may have been
+// missed the stream sends the current unread count again; clients refetch
+// the list when it changes.
+func (h *Handler) StreamNotifications(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sendError(w, r, apierror.New(http.StatusInternalServerError, apierror.CodeInternal, "Streaming is not supported"))
+		return
+	}
+
+	// The stream outlives the server's write timeout
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// Subscribe before counting so no notification falls between the two
+	sub, unsubscribe := h.Notifications.Subscribe(userID)
+	defer unsubscribe()
+
+	// Send the current unread count so the badge is correct right away
+	sendUnreadCount := func() {
+		if unreadCount, err := h.countUnreadNotifications(userID); err == nil {
+			fmt.Fprintf(w, "event: unread_count\ndata: {\"unread_count\":%d}\n\n", unreadCount)
+		}
+		flusher.Flush()
+	}
+	sendUnreadCount()
+
+	heartbeat := time.NewTicker(notificationHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case id := <-sub.Items:
+			n, err := h.loadNotification(r, userID, id)
+			if err != nil {
+				// Deleted or unreadable; the list still shows what exists
+				continue
+			}
+			payload, err := json.Marshal(n)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %s\nevent: notification\ndata: %s\n\n", n.ID, payload)
+			flusher.Flush()
+		case <-sub.Lagged:
+			sendUnreadCount()
+		}
+	}
+}
+
+// notificationColumns are read by scanNotification
+const notificationColumns = "id, user_id, actor_id, type, snippet_id, data, read_at, created_at"
+
+// scanNotification reads a row of notificationColumns
+func scanNotification(row interface{ Scan(...interface{}) error }) (models.Notification, error) {
+	var n models.Notification
+	var data []byte
+	if err := row.Scan(&n.ID, &n.UserID, &n.ActorID, &n.Type, &n.SnippetID, &data, &n.ReadAt, &n.CreatedAt); err != nil {
+		return n, err
+	}
+	if err := json.Unmarshal(data, &n.Data); err != nil {
+		n.Data = map[string]interface{}{}
+	}
+	n.IsRead = n.ReadAt != nil
+	return n, nil
+}
+
+// loadNotification reads one of the user's notifications
+func (h *Handler) loadNotification(r *http.Request, userID, id string) (models.Notification, error) {
+	row := h.DB.QueryRowContext(r.Context(),
+		"SELECT "+notificationColumns+" FROM notifications WHERE id = $1 AND user_id = $2", id, userID)
+	return scanNotification(row)
+}
+
+// countUnreadNotifications counts the user's unread notifications
+func (h *Handler) countUnreadNotifications(userID string) (int, error) {
+	var count int
+	err := h.DB.QueryRow(`
+		SELECT COUNT(*) FROM notifications
+		WHERE user_id = $1 AND read_at IS NULL`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+// loadNotificationPreferences returns one entry per notification type,
+// defaulting to enabled when the user has no stored preference
+func (h *Handler) loadNotificationPreferences(userID string) ([]models.NotificationPreference, error) {
+	rows, err := h.DB.Query(`
+		SELECT type, enabled FROM notification_preferences
+		WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch notification preferences: %w", err)
+	}
+	defer rows.Close()
+
+	stored := make(map[string]bool)
+	for rows.Next() {
+		var t string
+		var enabled bool
+		if err := rows.Scan(&t, &enabled); err != nil {
+			return nil, fmt.Errorf("failed to scan notification preference: %w", err)
+		}
+		stored[t] = enabled
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate notification preferences: %w", err)
+	}
+
+	preferences := make([]models.NotificationPreference, 0, len(notifications.Types))
+	for _, t := range notifications.Types {
+		enabled, ok := stored[t]
+		if !ok {
+			enabled = true
+		}
+		preferences = append(preferences, models.NotificationPreference{Type: t, Enabled: enabled})
+	}
+	return preferences, nil
+}
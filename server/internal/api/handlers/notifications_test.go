@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"snippy-server/internal/database"
+	"snippy-server/internal/models"
+	"snippy-server/internal/notifications"
+
+	"github.com/google/uuid"
+)
+
+func TestNotificationPreferencesFilter(t *testing.T) {
+	h := testHandler(t)
+	db := h.DB
+	recipient := testUser(t, db, "notifications", "notification_preferences")
+	actor := "user_test_actor"
+
+	w := serveAs(h.UpdateNotificationPreferences, recipient, "PUT", "/api/notifications/preferences",
+		`{"preferences":[{"type":"suggestion.created","enabled":false}]}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Got %d: %s", w.Code, w.Body.String())
+	}
+	var prefs struct {
+		Data []models.NotificationPreference `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &prefs); err != nil {
+		t.Fatal(err)
+	}
+	if len(prefs.Data) != len(notifications.Types) {
+		t.Errorf("Got %d preferences, want one per type", len(prefs.Data))
+	}
+	for _, p := range prefs.Data {
+		if p.Enabled != (p.Type != notifications.TypeSuggestionCreated) {
+			t.Errorf("%s: enabled = %v", p.Type, p.Enabled)
+		}
+	}
+
+	for _, c := range []struct {
+		name, recipient, actor, typ string
+		want                        bool
+	}{
+		{"disabled type", recipient, actor, notifications.TypeSuggestionCreated, false},
+		{"enabled by default", recipient, actor, notifications.TypeSnippetForked, true},
+		{"own action", recipient, recipient, notifications.TypeSnippetForked, false},
+	} {
+		n, err := notifications.Create(db, c.recipient, c.actor, c.typ, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if (n != nil) != c.want {
+			t.Errorf("%s: created = %v, want %v", c.name, n != nil, c.want)
+		}
+	}
+
+	w = serveAs(h.UpdateNotificationPreferences, recipient, "PUT", "/api/notifications/preferences",
+		`{"preferences":[{"type":"snippet.starred","enabled":false}]}`, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Unknown type: got %d", w.Code)
+	}
+}
+
+func TestNotificationReadState(t *testing.T) {
+	h := testHandler(t)
+	db := h.DB
+	userID := testUser(t, db, "notifications")
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		n, err := notifications.Create(db, userID, "user_test_actor", notifications.TypeSnippetForked, nil, nil)
+		if err != nil || n == nil {
+			t.Fatalf("Create: %v %v", n, err)
+		}
+		ids = append(ids, n.ID)
+	}
+
+	unread := func() int {
+		t.Helper()
+		w := serveAs(h.GetUnreadNotificationCount, userID, "GET", "/api/notifications/unread-count", "", nil)
+		var body struct {
+			Data struct {
+				UnreadCount int `json:"unread_count"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Got %d: %s", w.Code, w.Body.String())
+		}
+		return body.Data.UnreadCount
+	}
+	if got := unread(); got != 2 {
+		t.Fatalf("Unread = %d, want 2", got)
+	}
+
+	for i := 0; i < 2; i++ { // Marking twice is harmless
+		w := serveAs(h.MarkNotificationRead, userID, "PUT", "/api/notifications/"+ids[0]+"/read", "", map[string]string{"id": ids[0]})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	if got := unread(); got != 1 {
+		t.Errorf("Unread = %d, want 1", got)
+	}
+
+	w := serveAs(h.GetNotifications, userID, "GET", "/api/notifications?unread=true", "", nil)
+	var list struct {
+		Data struct {
+			Notifications []models.Notification `json:"notifications"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Data.Notifications) != 1 || list.Data.Notifications[0].ID != ids[1] || list.Data.Notifications[0].IsRead {
+		t.Errorf("Unread list: %+v", list.Data.Notifications)
+	}
+
+	// Other users cannot mark the notification
+	other := uuid.New().String()
+	w = serveAs(h.MarkNotificationRead, "user_test_other", "PUT", "/api/notifications/"+ids[1]+"/read", "", map[string]string{"id": ids[1]})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Other user: got %d", w.Code)
+	}
+	w = serveAs(h.MarkNotificationRead, userID, "PUT", "/api/notifications/"+other+"/read", "", map[string]string{"id": other})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Unknown notification: got %d", w.Code)
+	}
+
+	serveAs(h.MarkAllNotificationsRead, userID, "PUT", "/api/notifications/read-all", "", nil)
+	if got := unread(); got != 0 {
+		t.Errorf("Unread = %d after marking all", got)
+	}
+}
+
+// TestNotificationStream checks that a notification reaches the stream
+// through Postgres, as it would from another replica
+func TestNotificationStream(t *testing.T) {
+	h := testHandler(t)
+	db := h.DB
+	userID := testUser(t, db, "notifications")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	connStr := os.Getenv("DATABASE_URL")
+	go database.Listen(ctx, connStr, notifications.Channel, h.Notifications.PublishPayload, h.Notifications.Resync)
+	waitForListener(t, ctx, db, h.Notifications)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.StreamNotifications(w, r.WithContext(context.WithValue(r.Context(), "user_id", userID)))
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	events := bufio.NewScanner(resp.Body)
+
+	if name, data := readSSE(t, events); name != "unread_count" || data != `{"unread_count":0}` {
+		t.Fatalf("First event: %s %s", name, data)
+	}
+
+	n, err := notifications.Create(db, userID, "user_test_actor", notifications.TypeSnippetForked, nil, map[string]interface{}{"fork_id": "f1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, data := readSSE(t, events)
+	var got models.Notification
+	if err := json.Unmarshal([]byte(data), &got); err != nil || name != "notification" {
+		t.Fatalf("Got %s %s", name, data)
+	}
+	if got.ID != n.ID || got.Data["fork_id"] != "f1" {
+		t.Errorf("Got %+v, want %+v", got, n)
+	}
+}
+
+// waitForListener announces probes until hub receives one, as the listener
+// connects in the background
+func waitForListener(t *testing.T, ctx context.Context, db *sql.DB, hub *notifications.Hub) {
+	t.Helper()
+	probeUser := "user_test_" + uuid.New().String()
+	probe, unsubscribe := hub.Subscribe(probeUser)
+	defer unsubscribe()
+
+	payload := fmt.Sprintf(`{"id":"probe","user_id":%q}`, probeUser)
+	for {
+		if _, err := db.Exec(`SELECT pg_notify($1, $2)`, notifications.Channel, payload); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-probe.Items:
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("Notification listener did not start")
+		}
+	}
+}
+
+// readSSE returns the name and data of the next event, skipping comments
+func readSSE(t *testing.T, events *bufio.Scanner) (name, data string) {
+	t.Helper()
+	for events.Scan() {
+		line := events.Text()
+		switch {
+		case line == "" && name != "":
+			return name, data
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	t.Fatalf("Stream ended: %v", events.Err())
+	return "", ""
+}
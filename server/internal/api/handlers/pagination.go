@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/models"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// keyset is a sort order paged by comparing the sort columns with those of
+// the last item already seen, so rows inserted mid-scroll neither shift nor
+// repeat later pages. The last column must be unique to make the order total.
+type keyset[T any] struct {
+	columns []string         // Sort columns, ending with a unique one
+	types   []string         // Postgres type of each column, for casting cursor values
+	desc    bool             // Default direction
+	values  func(T) []string // The item's column values as cursor strings
+}
+
+// cursor is the decoded form of the opaque cursor parameter
+type cursor struct {
+	Sort   string   `json:"s"`
+	Desc   bool     `json:"d"`
+	Values []string `json:"v"`
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+// cursorTime formats a TIMESTAMP column value without a zone, so casting it
+// back in Postgres yields the same wall-clock time
+func cursorTime(t time.Time) string {
+	return t.Format("2006-01-02T15:04:05.999999")
+}
+
+// page is a request for one page of a list, parsed from the limit, cursor,
+// sort, order and include_total query parameters
+type page[T any] struct {
+	sort  string
+	order keyset[T]
+	desc  bool
+	limit int
+	after []string // Sort values of the last item of the previous page
+	total bool
+}
+
+// parsePage reads the pagination parameters of r. orders lists the sort
+// orders the endpoint supports.
+func parsePage[T any](r *http.Request, orders map[string]keyset[T], defaultSort string) (*page[T], error) {
+	query := r.URL.Query()
+	p := &page[T]{sort: defaultSort, limit: defaultPageSize, total: query.Get("include_total") == "true"}
+
+	if s := query.Get("sort"); s != "" {
+		p.sort = s
+	}
+	order, ok := orders[p.sort]
+	if !ok {
+		names := make([]string, 0, len(orders))
+		for name := range orders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, apierror.Invalid("sort", "sort must be one of "+strings.Join(names, ", "))
+	}
+	p.order = order
+	p.desc = order.desc
+
+	switch query.Get("order") {
+	case "":
+	case "asc":
+		p.desc = false
+	case "desc":
+		p.desc = true
+	default:
+		return nil, apierror.Invalid("order", "order must be asc or desc")
+	}
+
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			return nil, apierror.Invalid("limit", "limit must be a positive integer")
+		}
+		p.limit = min(n, maxPageSize)
+	}
+
+	if c := query.Get("cursor"); c != "" {
+		cur, err := decodeCursor(c)
+		if err != nil || cur.Sort != p.sort || cur.Desc != p.desc || len(cur.Values) != len(order.columns) {
+			return nil, apierror.Invalid("cursor", "cursor is invalid or belongs to a different sort order")
+		}
+		p.after = cur.Values
+	}
+
+	return p, nil
+}
+
+// where returns the condition selecting rows after the cursor, with
+// placeholders numbered from argIndex. It is empty on the first page.
+func (p *page[T]) where(argIndex int) (string, []interface{}) {
+	if p.after == nil {
+		return "", nil
+	}
+
+	placeholders := make([]string, len(p.after))
+	args := make([]interface{}, len(p.after))
+	for i, value := range p.after {
+		placeholders[i] = "$" + strconv.Itoa(argIndex+i) + "::" + p.order.types[i]
+		args[i] = value
+	}
+
+	op := " > "
+	if p.desc {
+		op = " < "
+	}
+	return "(" + strings.Join(p.order.columns, ", ") + ")" + op + "(" + strings.Join(placeholders, ", ") + ")", args
+}
+
+// orderBy returns the ORDER BY and LIMIT clauses. One row more than the
+// page size is fetched to tell whether another page follows.
+func (p *page[T]) orderBy() string {
+	direction := " ASC"
+	if p.desc {
+		direction = " DESC"
+	}
+	columns := make([]string, len(p.order.columns))
+	for i, column := range p.order.columns {
+		columns[i] = column + direction
+	}
+	return " ORDER BY " + strings.Join(columns, ", ") + " LIMIT " + strconv.Itoa(p.limit+1)
+}
+
+// finish drops the extra row fetched by orderBy and describes the page
+func (p *page[T]) finish(items []T) ([]T, *models.PageInfo) {
+	info := &models.PageInfo{Limit: p.limit}
+	if len(items) > p.limit {
+		items = items[:p.limit]
+		next := encodeCursor(cursor{Sort: p.sort, Desc: p.desc, Values: p.order.values(items[len(items)-1])})
+		info.HasMore = true
+		info.NextCursor = &next
+	}
+	return items, info
+}
+
+// count fills in the total number of matching rows when the client asked
+// for it. from is the FROM and WHERE part of the list query, without the
+// cursor condition.
+func (p *page[T]) count(db *sql.DB, info *models.PageInfo, from string, args []interface{}) error {
+	if !p.total {
+		return nil
+	}
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) "+from, args...).Scan(&total); err != nil {
+		return apierror.Wrap(err, "Failed to count results")
+	}
+	info.Total = &total
+	return nil
+}
+
+// setPageLinks writes RFC 8288 Link headers pointing at the first and, if
+// there is one, the next page
+func setPageLinks(w http.ResponseWriter, r *http.Request, info *models.PageInfo) {
+	link := func(cursor, rel string) string {
+		query := r.URL.Query()
+		query.Del("cursor")
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		u := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+		return "<" + u.String() + `>; rel="` + rel + `"`
+	}
+
+	links := []string{link("", "first")}
+	if info.NextCursor != nil {
+		links = append(links, link(*info.NextCursor, "next"))
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
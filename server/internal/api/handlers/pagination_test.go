@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/models"
+)
+
+func TestParsePageDefaults(t *testing.T) {
+	p, err := parsePage(httptest.NewRequest("GET", "/api/snippets", nil), snippetOrders, "created")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.limit != defaultPageSize || !p.desc || p.after != nil {
+		t.Errorf("Unexpected defaults %+v", p)
+	}
+	if where, _ := p.where(2); where != "" {
+		t.Errorf("First page should have no cursor condition, got %q", where)
+	}
+	if got := p.orderBy(); got != " ORDER BY created_at DESC, id DESC LIMIT 51" {
+		t.Errorf("Got %q", got)
+	}
+}
+
+func TestParsePageClampsLimit(t *testing.T) {
+	p, err := parsePage(httptest.NewRequest("GET", "/api/snippets?limit=5000", nil), snippetOrders, "created")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.limit != maxPageSize {
+		t.Errorf("Got limit %d, want %d", p.limit, maxPageSize)
+	}
+}
+
+func TestParsePageErrors(t *testing.T) {
+	other := encodeCursor(cursor{Sort: "title", Values: []string{"a", "b"}})
+	for _, query := range []string{
+		"limit=0",
+		"limit=ten",
+		"sort=size",
+		"order=up",
+		"cursor=not-a-cursor",
+		"cursor=" + other, // Issued for another sort order
+		"sort=title&order=desc&cursor=" + other,
+	} {
+		_, err := parsePage(httptest.NewRequest("GET", "/api/snippets?"+query, nil), snippetOrders, "created")
+		var apiErr *apierror.Error
+		if !errors.As(err, &apiErr) || apiErr.Code != apierror.CodeValidationFailed {
+			t.Errorf("%s: expected a validation error, got %v", query, err)
+		}
+	}
+}
+
+func TestPageCursorRoundTrip(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC)
+	items := []models.Snippet{
+		{ID: "a", ForkCount: 3, CreatedAt: created},
+		{ID: "b", ForkCount: 2, CreatedAt: created},
+		{ID: "c", ForkCount: 1, CreatedAt: created},
+	}
+
+	first, err := parsePage(httptest.NewRequest("GET", "/api/snippets/public?sort=forks&limit=2", nil), snippetOrders, "forks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, info := first.finish(items)
+	if len(got) != 2 || !info.HasMore || info.NextCursor == nil {
+		t.Fatalf("Expected a full page with a cursor, got %d items and %+v", len(got), info)
+	}
+
+	next, err := parsePage(httptest.NewRequest("GET", "/api/snippets/public?sort=forks&limit=2&cursor="+*info.NextCursor, nil), snippetOrders, "forks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	where, args := next.where(3)
+	if where != "(fork_count, created_at, id) < ($3::int, $4::timestamp, $5::uuid)" {
+		t.Errorf("Got %q", where)
+	}
+	want := []interface{}{"2", "2024-05-01T12:30:00.123456", "b"}
+	for i := range want {
+		if args[i] != want[i] {
+			t.Errorf("Arg %d: got %v, want %v", i, args[i], want[i])
+		}
+	}
+
+	last, info := next.finish(items[2:])
+	if len(last) != 1 || info.HasMore || info.NextCursor != nil {
+		t.Errorf("Last page should have no cursor, got %+v", info)
+	}
+}
+
+func TestSetPageLinks(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/snippets?limit=2&search=go&cursor=old", nil)
+	next := "abc"
+	setPageLinks(w, r, &models.PageInfo{Limit: 2, HasMore: true, NextCursor: &next})
+
+	link := w.Header().Get("Link")
+	if !strings.Contains(link, `</api/snippets?limit=2&search=go>; rel="first"`) ||
+		!strings.Contains(link, `</api/snippets?cursor=abc&limit=2&search=go>; rel="next"`) {
+		t.Errorf("Unexpected Link header %q", link)
+	}
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/metrics"
+	"snippy-server/internal/models"
+	"snippy-server/internal/render"
+
+	"github.com/gorilla/mux"
+)
+
+// Cache policies for snippet content and data. Private snippets must never
+// be stored by shared caches.
+const (
+	publicCacheControl  = "public, max-age=60"
+	privateCacheControl = "private, no-cache"
+)
+
+// rawUnsafeTypes are served as plain text so raw content can never run as a
+// page on this origin
+var rawUnsafeTypes = map[string]bool{
+	"text/html":             true,
+	"application/xhtml+xml": true,
+	"image/svg+xml":         true,
+	"text/xml":              true,
+	"application/xml":       true,
+}
+
+// sendRawError logs err like sendError but answers in plain text, which is
+// what clients of the raw endpoint such as curl expect
+func sendRawError(w http.ResponseWriter, r *http.Request, err error) {
+	problem := apierror.Describe(r, err)
+	http.Error(w, problem.Detail, problem.Status)
+}
+
+// GetRawSnippet serves a snippet's content as a plain file for curl and
+// scripts. Public snippets need no authentication; private snippets are
+// served to their owner when a bearer token is sent.
+func (h *Handler) GetRawSnippet(w http.ResponseWriter, r *http.Request) {
+	// Get snippet ID and optional filename from URL parameters
+	vars := mux.Vars(r)
+	snippetID := vars["id"]
+	filename := vars["filename"]
+
+	var snippet models.Snippet
+	err := h.DB.QueryRow(`
+		SELECT id, user_id, title, content, is_public, version
+		FROM snippets
+		WHERE id = $1`,
+		snippetID).Scan(&snippet.ID, &snippet.UserID, &snippet.Title, &snippet.Content, &snippet.IsPublic, &snippet.Version)
+	if err != nil && err != sql.ErrNoRows {
+		sendRawError(w, r, apierror.Wrap(err, "Failed to fetch snippet"))
+		return
+	}
+
+	// Private snippets are indistinguishable from missing ones to other users
+	if err == sql.ErrNoRows || (!snippet.IsPublic && h.bearerUserID(r) != snippet.UserID) {
+		sendRawError(w, r, apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "Snippet not found"))
+		return
+	}
+
+	if filename == "" {
+		filename = rawFilename(snippet.Title)
+	}
+	if snippet.IsPublic {
+		metrics.PublicReads.WithLabelValues("raw").Inc()
+	}
+
+	cacheControl := publicCacheControl
+	if !snippet.IsPublic {
+		cacheControl = privateCacheControl
+		w.Header().Set("Vary", "Authorization")
+	}
+	etag := contentETag(snippet.ID, strconv.Itoa(snippet.Version), "raw")
+	if notModified(w, r, etag, cacheControl) {
+		return
+	}
+
+	disposition := "inline"
+	if r.URL.Query().Get("download") == "true" {
+		disposition = "attachment"
+	}
+
+	w.Header().Set("Content-Type", rawContentType(filename))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(snippet.Content)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write([]byte(snippet.Content))
+	}
+}
+
+// bearerUserID returns the user authenticated by an Authorization bearer
+// token, or "" when there is none or it is invalid
+func (h *Handler) bearerUserID(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		return ""
+	}
+	userID, err := h.Auth.ValidateToken(strings.TrimSpace(token))
+	if err != nil {
+		return ""
+	}
+	return userID
+}
+
+// rawFilename derives a download name from a snippet title, keeping the
+// extension when the title looks like a filename
+func rawFilename(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == '"' || r < 0x20 {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(title))
+
+	if name == "" {
+		return "snippet.txt"
+	}
+	if path.Ext(name) == "" {
+		name += ".txt"
+	}
+	return name
+}
+
+// rawContentType picks the MIME type for a raw file from its extension.
+// Only textual types are kept: system tables map many source extensions to
+// unrelated binary types (.ts is video/mp2t), so everything else is plain text.
+func rawContentType(filename string) string {
+	mediaType, _, err := mime.ParseMediaType(mime.TypeByExtension(path.Ext(filename)))
+	if err != nil || rawUnsafeTypes[mediaType] {
+		return "text/plain; charset=utf-8"
+	}
+	if mediaType == "application/json" {
+		return mediaType
+	}
+	if !strings.HasPrefix(mediaType, "text/") {
+		return "text/plain; charset=utf-8"
+	}
+	return mediaType + "; charset=utf-8"
+}
+
+// snippetMediaTypes are the representations GetSnippet can produce, in
+// order of preference when the client has no preference
+var snippetMediaTypes = []string{"application/json", "text/plain", "text/markdown", "text/html"}
+
+// negotiateSnippetType picks the best representation for the Accept header
+func negotiateSnippetType(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return snippetMediaTypes[0]
+	}
+
+	type candidate struct {
+		mediaType string
+		q         float64
+		order     int
+	}
+	var candidates []candidate
+
+	for i, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		for _, supported := range snippetMediaTypes {
+			if mediaType == supported || mediaType == "*/*" ||
+				(strings.HasSuffix(mediaType, "/*") && strings.HasPrefix(supported, strings.TrimSuffix(mediaType, "*"))) {
+				candidates = append(candidates, candidate{supported, q, i})
+				break
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].q != candidates[j].q {
+			return candidates[i].q > candidates[j].q
+		}
+		return candidates[i].order < candidates[j].order
+	})
+	return candidates[0].mediaType
+}
+
+// sendSnippetAs writes a snippet in a non-JSON representation
+func sendSnippetAs(w http.ResponseWriter, r *http.Request, snippet models.Snippet, mediaType string) {
+	var body bytes.Buffer
+
+	switch mediaType {
+	case "text/plain":
+		body.WriteString(snippet.Content)
+	case "text/markdown":
+		body.WriteString(snippetMarkdown(snippet))
+	case "text/html":
+		opts, ok := parseRenderOptions(w, r)
+		if !ok {
+			return
+		}
+		opts.Filename = snippet.Title
+		opts.Standalone = true
+		if err := render.HTML(&body, snippet.Content, opts); err != nil {
+			sendError(w, r, apierror.Wrap(err, "Failed to render snippet"))
+			return
+		}
+		w.Header().Set("Content-Security-Policy", renderPageCSP)
+	}
+
+	w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
+
+// snippetMarkdown formats a snippet as a heading and a fenced code block
+func snippetMarkdown(snippet models.Snippet) string {
+	lexer := render.Lexer("", snippet.Title, snippet.Content)
+	language := ""
+	if aliases := lexer.Config().Aliases; len(aliases) > 0 {
+		language = aliases[0]
+	}
+
+	// The fence must be longer than any backtick run in the content
+	fence := "```"
+	for strings.Contains(snippet.Content, fence) {
+		fence += "`"
+	}
+
+	content := snippet.Content
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return fmt.Sprintf("# %s\n\n%s%s\n%s%s\n", snippet.Title, fence, language, content, fence)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"snippy-server/internal/models"
+)
+
+func TestNegotiateSnippetType(t *testing.T) {
+	cases := map[string]string{
+		"":                                      "application/json",
+		"*/*":                                   "application/json",
+		"text/plain":                            "text/plain",
+		"text/markdown, application/json;q=0.5": "text/markdown",
+		"application/json;q=0.1, text/*":        "text/plain",
+		"text/html;q=0.9, text/plain;q=0.2":     "text/html",
+		"image/png":                             "",
+	}
+	for accept, want := range cases {
+		if got := negotiateSnippetType(accept); got != want {
+			t.Errorf("negotiateSnippetType(%q) = %q, want %q", accept, got, want)
+		}
+	}
+}
+
+func TestRawContentType(t *testing.T) {
+	cases := map[string]string{
+		"install.sh":   "text/plain; charset=utf-8",
+		"data.json":    "application/json",
+		"page.html":    "text/plain; charset=utf-8",
+		"logo.svg":     "text/plain; charset=utf-8",
+		"styles.css":   "text/css; charset=utf-8",
+		"no-extension": "text/plain; charset=utf-8",
+	}
+	for filename, want := range cases {
+		if got := rawContentType(filename); got != want {
+			t.Errorf("rawContentType(%q) = %q, want %q", filename, got, want)
+		}
+	}
+}
+
+func TestRawFilename(t *testing.T) {
+	cases := map[string]string{
+		"install.sh":    "install.sh",
+		"Array Shuffle": "Array Shuffle.txt",
+		"a/b\"c.py":     "a-b-c.py",
+		"  ":            "snippet.txt",
+	}
+	for title, want := range cases {
+		if got := rawFilename(title); got != want {
+			t.Errorf("rawFilename(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
+
+func TestSnippetMarkdown(t *testing.T) {
+	md := snippetMarkdown(models.Snippet{Title: "main.go", Content: "// ```\npackage main"})
+	if !strings.HasPrefix(md, "# main.go\n\n````go\n") || !strings.HasSuffix(md, "package main\n````\n") {
+		t.Errorf("Unexpected markdown:\n%s", md)
+	}
+}
+
+func TestSendSnippetAsHTMLAllowsInlineStyles(t *testing.T) {
+	snippet := models.Snippet{Title: "main.go", Content: "package main\n"}
+	w := httptest.NewRecorder()
+	sendSnippetAs(w, httptest.NewRequest("GET", "/api/snippets/1", nil), snippet, "text/html")
+
+	if !strings.Contains(w.Body.String(), "style=") {
+		t.Fatalf("Expected inline styles:\n%s", w.Body.String())
+	}
+	if csp := w.Header().Get("Content-Security-Policy"); csp != renderPageCSP {
+		t.Errorf("Got CSP %q", csp)
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/metrics"
+	"snippy-server/internal/models"
+	"snippy-server/internal/render"
+
+	"github.com/gorilla/mux"
+)
+
+// renderCacheControl lets browsers and proxies reuse rendered output briefly;
+// the ETag changes whenever the snippet or the options change
+const renderCacheControl = "public, max-age=300"
+
+// renderPageCSP replaces the default policy for highlighted HTML, which
+// styles every token with inline style attributes
+const renderPageCSP = "default-src 'none'; style-src 'unsafe-inline'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'"
+
+// RenderPublicSnippet renders a public snippet as highlighted HTML or SVG
+// (no authentication required)
+func (h *Handler) RenderPublicSnippet(w http.ResponseWriter, r *http.Request) {
+	// Get snippet ID from URL parameters
+	vars := mux.Vars(r)
+	snippetID := vars["id"]
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "html"
+	}
+	if format != "html" && format != "svg" {
+		sendError(w, r, apierror.Invalid("format", "format must be html or svg"))
+		return
+	}
+
+	opts, ok := parseRenderOptions(w, r)
+	if !ok {
+		return
+	}
+
+	snippet, err := loadPublicSnippet(h.DB, snippetID)
+	if err == sql.ErrNoRows {
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "Public snippet not found"))
+		return
+	}
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch snippet"))
+		return
+	}
+	opts.Filename = snippet.Title
+	metrics.PublicReads.WithLabelValues(format).Inc()
+
+	etag := contentETag(snippet.ID, strconv.Itoa(snippet.Version), "render", format, r.URL.RawQuery)
+	if notModified(w, r, etag, renderCacheControl) {
+		return
+	}
+
+	var buf bytes.Buffer
+	contentType := "text/html; charset=utf-8"
+	if format == "svg" {
+		contentType = "image/svg+xml"
+		err = render.SVG(&buf, snippet.Content, opts)
+	} else {
+		err = render.HTML(&buf, snippet.Content, opts)
+		w.Header().Set("Content-Security-Policy", renderPageCSP)
+	}
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to render snippet"))
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// GetRenderThemes lists the themes accepted by the render endpoints
+func (h *Handler) GetRenderThemes(w http.ResponseWriter, r *http.Request) {
+	response := models.Response{
+		Success: true,
+		Message: "Themes retrieved successfully",
+		Data: map[string]interface{}{
+			"themes":  render.Themes(),
+			"default": render.DefaultTheme,
+		},
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// parseRenderOptions reads theme, lines, lang, line_numbers and standalone
+// from the query string. It writes the error response and returns false on failure.
+func parseRenderOptions(w http.ResponseWriter, r *http.Request) (render.Options, bool) {
+	query := r.URL.Query()
+	opts := render.Options{
+		Language:    query.Get("lang"),
+		Theme:       query.Get("theme"),
+		LineNumbers: query.Get("line_numbers") != "false",
+		Standalone:  query.Get("standalone") == "true",
+	}
+
+	if opts.Theme == "" {
+		opts.Theme = render.DefaultTheme
+	}
+	if !render.IsValidTheme(opts.Theme) {
+		sendError(w, r, apierror.Invalid("theme", "Unknown theme: "+opts.Theme))
+		return opts, false
+	}
+
+	ranges, err := render.ParseLineRanges(query.Get("lines"))
+	if err != nil {
+		sendError(w, r, apierror.Invalid("lines", err.Error()))
+		return opts, false
+	}
+	opts.Highlight = ranges
+
+	return opts, true
+}
+
+// contentETag derives a strong ETag from the parts that determine a response
+func contentETag(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// snippetETag derives a snippet's strong ETag from its id and version, and
+// from tag_names and fork_count, which change without a version bump but
+// are part of every snippet response
+func snippetETag(snippet models.Snippet) string {
+	tagNames, _ := json.Marshal(snippet.TagNames)
+	return contentETag(snippet.ID, strconv.Itoa(snippet.Version), string(tagNames), strconv.Itoa(snippet.ForkCount))
+}
+
+// representationETag derives a strong ETag from the JSON encoding of v, so
+// it changes whenever any field the client sees does
+func representationETag(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return contentETag(string(data))
+}
+
+// preconditionFailed reports whether r has an If-Match header that does not
+// match etag, meaning the client is changing an outdated copy. If-Match uses
+// strong comparison, so weak tags never match.
+func preconditionFailed(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == etag || candidate == "*" {
+			return false
+		}
+	}
+	return true
+}
+
+// notModified sets the caching headers and answers 304 when the client
+// already has this version. It returns true if the response was written.
+func notModified(w http.ResponseWriter, r *http.Request, etag, cacheControl string) bool {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControl)
+
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == etag || candidate == "*" || candidate == "W/"+etag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRenderPublicSnippetCSP(t *testing.T) {
+	h := testHandler(t)
+	owner := testUser(t, h.DB, ownerTables...)
+	id := testPublicSnippet(t, h.DB, owner, "main.go", "package main\n")
+
+	w := getPublic(h.RenderPublicSnippet, "/api/snippets/public/"+id+"/render", map[string]string{"id": id})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "style=") {
+		t.Fatalf("HTML render: got %d: %s", w.Code, w.Body.String())
+	}
+	if csp := w.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "style-src 'unsafe-inline'") {
+		t.Errorf("HTML render CSP is %q", csp)
+	}
+}
@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/models"
+	"snippy-server/internal/sandbox"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// maxStoredRuns is how many runs of a snippet are kept per user
+const maxStoredRuns = 50
+
+// RunSnippet executes a snippet the user owns or that is public and stores
+// the result in the user's run history for that snippet
+func (h *Handler) RunSnippet(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get snippet ID from URL parameters
+	vars := mux.Vars(r)
+	snippetID := vars["id"]
+
+	var req models.RunSnippetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, apierror.InvalidBody(err))
+		return
+	}
+
+	var content string
+	err = h.DB.QueryRow(`
+		SELECT content FROM snippets
+		WHERE id = $1 AND (user_id = $2 OR is_public = true)`,
+		snippetID, userID).Scan(&content)
+	if err == sql.ErrNoRows {
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "Snippet not found"))
+		return
+	}
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch snippet"))
+		return
+	}
+
+	result, ok := h.runCode(w, r, userID, sandbox.Request{Language: req.Language, Code: content, Stdin: req.Stdin})
+	if !ok {
+		return
+	}
+
+	run := models.SnippetRun{
+		ID:              uuid.New().String(),
+		SnippetID:       snippetID,
+		UserID:          userID,
+		Language:        result.Language,
+		Stdin:           req.Stdin,
+		Stdout:          result.Stdout,
+		Stderr:          result.Stderr,
+		ExitCode:        result.ExitCode,
+		Phase:           result.Phase,
+		DurationMs:      result.DurationMs,
+		TimedOut:        result.TimedOut,
+		OutputTruncated: result.OutputTruncated,
+		CreatedAt:       time.Now(),
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to start transaction"))
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO snippet_runs (id, snippet_id, user_id, language, stdin, stdout, stderr, exit_code, phase,
+		                          duration_ms, timed_out, output_truncated, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		run.ID, run.SnippetID, run.UserID, run.Language, run.Stdin, run.Stdout, run.Stderr, run.ExitCode, run.Phase,
+		run.DurationMs, run.TimedOut, run.OutputTruncated, run.CreatedAt)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to store run"))
+		return
+	}
+
+	// Keep only the most recent runs
+	_, err = tx.Exec(`
+		DELETE FROM snippet_runs
+		WHERE snippet_id = $1 AND user_id = $2 AND id NOT IN (
+			SELECT id FROM snippet_runs
+			WHERE snippet_id = $1 AND user_id = $2
+			ORDER BY created_at DESC
+			LIMIT $3
+		)`,
+		snippetID, userID, maxStoredRuns)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to prune run history"))
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to commit transaction"))
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Snippet executed successfully",
+		Data:    run,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// RunCode executes ad-hoc code without storing the result
+func (h *Handler) RunCode(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	var req models.RunCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, apierror.InvalidBody(err))
+		return
+	}
+
+	if req.Code == "" {
+		sendError(w, r, apierror.Invalid("code", "Code is required"))
+		return
+	}
+
+	result, ok := h.runCode(w, r, userID, sandbox.Request{Language: req.Language, Code: req.Code, Stdin: req.Stdin})
+	if !ok {
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Code executed successfully",
+		Data:    result,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// GetSnippetRuns lists the user's past runs of a snippet, newest first
+func (h *Handler) GetSnippetRuns(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get snippet ID from URL parameters
+	vars := mux.Vars(r)
+	snippetID := vars["id"]
+
+	limit := 20
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= maxStoredRuns {
+			limit = l
+		}
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT id, snippet_id, user_id, language, stdin, stdout, stderr, exit_code, phase,
+		       duration_ms, timed_out, output_truncated, created_at
+		FROM snippet_runs
+		WHERE snippet_id = $1 AND user_id = $2
+		ORDER BY created_at DESC
+		LIMIT $3`,
+		snippetID, userID, limit)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch runs"))
+		return
+	}
+	defer rows.Close()
+
+	// initialize as empty slice to avoid null in JSON
+	runs := make([]models.SnippetRun, 0)
+	for rows.Next() {
+		var run models.SnippetRun
+		err := rows.Scan(&run.ID, &run.SnippetID, &run.UserID, &run.Language, &run.Stdin, &run.Stdout, &run.Stderr,
+			&run.ExitCode, &run.Phase, &run.DurationMs, &run.TimedOut, &run.OutputTruncated, &run.CreatedAt)
+		if err != nil {
+			sendError(w, r, apierror.Wrap(err, "Failed to scan run"))
+			return
+		}
+		runs = append(runs, run)
+	}
+
+	if err = rows.Err(); err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to iterate runs"))
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Runs retrieved successfully",
+		Data:    runs,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// GetSandboxLanguages lists the languages that can be executed on this server
+func (h *Handler) GetSandboxLanguages(w http.ResponseWriter, r *http.Request) {
+	languages := []string{}
+	if h.Sandbox != nil {
+		languages = sandbox.Available()
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Languages retrieved successfully",
+		Data: map[string]interface{}{
+			"languages": languages,
+		},
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// runCode executes req in the default sandbox, mapping sandbox errors to
+// HTTP statuses. It writes the error response and returns false on failure.
+func (h *Handler) runCode(w http.ResponseWriter, r *http.Request, userID string, req sandbox.Request) (*sandbox.Result, bool) {
+	if h.Sandbox == nil {
+		sendError(w, r, apierror.New(http.StatusServiceUnavailable, apierror.CodeUnavailable, "Code execution is disabled"))
+		return nil, false
+	}
+
+	// Compiling and running may take longer than the server write timeout
+	deadline := time.Now().Add(h.Sandbox.MaxDuration() + 5*time.Second)
+	http.NewResponseController(w).SetWriteDeadline(deadline)
+
+	result, err := h.Sandbox.Run(r.Context(), userID, req)
+	switch {
+	case err == nil:
+		return result, true
+	case errors.Is(err, sandbox.ErrUserBusy):
+		sendError(w, r, apierror.New(http.StatusTooManyRequests, apierror.CodeQuotaExceeded, err.Error()))
+	case errors.Is(err, sandbox.ErrBusy):
+		w.Header().Set("Retry-After", "5")
+		sendError(w, r, apierror.New(http.StatusServiceUnavailable, apierror.CodeUnavailable, err.Error()))
+	case errors.Is(err, sandbox.ErrIsolationUnavailable):
+		sendError(w, r, apierror.New(http.StatusServiceUnavailable, apierror.CodeUnavailable, err.Error()))
+	case errors.Is(err, sandbox.ErrUnsupportedLanguage), errors.Is(err, sandbox.ErrTooLarge):
+		sendError(w, r, apierror.New(http.StatusBadRequest, apierror.CodeValidationFailed, err.Error()))
+	case r.Context().Err() != nil:
+		// The client went away; there is nobody to respond to
+	default:
+		sendError(w, r, apierror.Wrap(err, "Failed to run code"))
+	}
+	return nil, false
+}
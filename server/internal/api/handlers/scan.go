@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/models"
+	"snippy-server/internal/scanner"
+
+	"github.com/gorilla/mux"
+)
+
+// GetSnippetScan scans a snippet the user owns or that is public for secrets
+func (h *Handler) GetSnippetScan(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get snippet ID from URL parameters
+	vars := mux.Vars(r)
+	snippetID := vars["id"]
+
+	var content string
+	err = h.DB.QueryRow(`
+		SELECT content FROM snippets
+		WHERE id = $1 AND (user_id = $2 OR is_public = true)`,
+		snippetID, userID).Scan(&content)
+	if err == sql.ErrNoRows {
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "Snippet not found"))
+		return
+	}
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch snippet"))
+		return
+	}
+
+	findings := scanner.Scan(content)
+
+	response := models.Response{
+		Success: true,
+		Message: "Snippet scanned successfully",
+		Data: map[string]interface{}{
+			"clean":    len(findings) == 0,
+			"findings": findings,
+		},
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// checkSecrets scans content that is about to be published or forked. Unless
+// the caller set allow_secrets, findings are refused with 422 and their
+// locations. It writes the error response and returns false on refusal.
+func checkSecrets(w http.ResponseWriter, r *http.Request, content string, allow bool) ([]scanner.Finding, bool) {
+	findings, err := scanSecrets(content, allow)
+	if err != nil {
+		sendError(w, r, err)
+		return nil, false
+	}
+	return findings, true
+}
+
+// scanSecrets is checkSecrets for callers that report errors themselves
+func scanSecrets(content string, allow bool) ([]scanner.Finding, error) {
+	findings := scanner.Scan(content)
+	if len(findings) == 0 || allow {
+		return findings, nil
+	}
+
+	refused := apierror.New(http.StatusUnprocessableEntity, apierror.CodeSecretsDetected,
+		"Snippet appears to contain secrets; remove them or set allow_secrets to continue anyway")
+	return nil, refused.WithData(map[string]interface{}{
+		"findings": findings,
+	})
+}
@@ -1,15 +1,22 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
-	"snippy-server/internal/database"
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/cache"
+	"snippy-server/internal/metrics"
 	"snippy-server/internal/models"
+	"snippy-server/internal/notifications"
+	"snippy-server/internal/scanner"
+	"snippy-server/internal/webhooks"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -31,12 +38,12 @@ func getUserIDFromContext(r *http.Request) (string, error) {
 	return userID, nil
 }
 
-// createSnippet creates a new snippet for the authenticated user
-func CreateSnippet(w http.ResponseWriter, r *http.Request) {
+// CreateSnippet creates a new snippet for the authenticated user
+func (h *Handler) CreateSnippet(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
 	userID, err := getUserIDFromContext(r)
 	if err != nil {
-		sendError(w, http.StatusUnauthorized, err.Error())
+		sendError(w, r, apierror.Unauthorized(err))
 		return
 	}
 
@@ -45,30 +52,54 @@ func CreateSnippet(w http.ResponseWriter, r *http.Request) {
 
 	// Parse request body
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		sendError(w, r, apierror.InvalidBody(err))
 		return
 	}
 
+	snippet, err := h.createSnippet(r.Context(), userID, uuid.New().String(), req)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", snippetETag(snippet))
+
+	response := models.Response{
+		Success: true,
+		Message: "Snippet created successfully",
+		Data:    snippet,
+	}
+
+	sendJSON(w, http.StatusCreated, response)
+}
+
+// createSnippet validates req and creates it as snippetID for userID in one
+// transaction, scanning public content and queueing webhooks. Offline
+// clients pushing through POST /api/sync choose their own IDs.
+func (h *Handler) createSnippet(ctx context.Context, userID, snippetID string, req models.CreateSnippetRequest) (models.Snippet, error) {
 	// Validate required fields
 	if req.Title == "" {
-		sendError(w, http.StatusBadRequest, "Snippet title is required")
-		return
+		return models.Snippet{}, apierror.Invalid("title", "Snippet title is required")
 	}
 
 	if req.Content == "" {
-		sendError(w, http.StatusBadRequest, "Snippet content is required")
-		return
+		return models.Snippet{}, apierror.Invalid("content", "Snippet content is required")
+	}
+
+	// Public snippets must not leak credentials
+	var findings []scanner.Finding
+	if req.IsPublic {
+		var err error
+		if findings, err = scanSecrets(req.Content, req.AllowSecrets); err != nil {
+			return models.Snippet{}, err
+		}
 	}
 
-	// Generate UUID for snippet
-	snippetID := uuid.New().String()
 	now := time.Now()
 
 	// Start transaction
-	tx, err := database.GetDB().Begin()
+	tx, err := h.DB.BeginTx(ctx, nil)
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to start transaction: "+err.Error())
-		return
+		return models.Snippet{}, apierror.Wrap(err, "Failed to start transaction")
 	}
 	defer tx.Rollback()
 
@@ -84,7 +115,7 @@ func CreateSnippet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Insert snippet into database with new schema
-	_, err = tx.Exec(`
+	_, err = tx.ExecContext(ctx, `
 		INSERT INTO snippets (id, user_id, title, content, collection_ids, tag_ids, is_public, is_favorite, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
 		snippetID, userID, req.Title, req.Content,
@@ -93,162 +124,60 @@ func CreateSnippet(w http.ResponseWriter, r *http.Request) {
 		req.IsPublic, req.IsFavorite, now, now)
 
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to create snippet: "+err.Error())
-		return
+		return models.Snippet{}, apierror.Wrap(err, "Failed to create snippet")
 	}
 
 	// Fetch the created snippet WITHIN THE TRANSACTION
-	var snippet models.Snippet
-	var fetchedCollectionIDs pq.StringArray
-	var fetchedTagIDs pq.StringArray
-
-	err = tx.QueryRow(`
-		SELECT s.id, s.user_id, s.title, s.content, s.collection_ids, s.tag_ids, s.is_public, s.is_favorite, s.fork_count, s.forked_from, s.created_at, s.updated_at
-		FROM snippets s
-		WHERE s.id = $1`, snippetID).Scan(
-		&snippet.ID, &snippet.UserID, &snippet.Title, &snippet.Content,
-		&fetchedCollectionIDs, &fetchedTagIDs, &snippet.IsPublic, &snippet.IsFavorite, &snippet.ForkCount,
-		&snippet.ForkedFrom, &snippet.CreatedAt, &snippet.UpdatedAt)
-
-	// Convert pq.StringArray to []string, handling nil cases
-	if fetchedCollectionIDs == nil {
-		snippet.CollectionIDs = []string{}
-	} else {
-		snippet.CollectionIDs = []string(fetchedCollectionIDs)
+	snippet, err := loadSnippetDetails(tx, "s.id = $1", snippetID)
+	if err != nil {
+		return models.Snippet{}, apierror.Wrap(err, "Failed to fetch created snippet")
 	}
 
-	if fetchedTagIDs == nil {
-		snippet.TagIDs = []string{}
-	} else {
-		snippet.TagIDs = []string(fetchedTagIDs)
+	if snippet.IsPublic {
+		if err = scanner.Record(tx, snippetID, findings, len(findings) > 0); err != nil {
+			return models.Snippet{}, err
+		}
 	}
 
-	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to fetch created snippet: "+err.Error())
-		return
+	// Queue webhook deliveries in the same transaction
+	if err = webhooks.Enqueue(tx, userID, webhooks.EventSnippetCreated, snippet); err != nil {
+		return models.Snippet{}, err
 	}
 
 	// Commit transaction
 	if err = tx.Commit(); err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to commit transaction: "+err.Error())
-		return
-	}
-
-	response := models.Response{
-		Success: true,
-		Message: "Snippet created successfully",
-		Data:    snippet,
+		return models.Snippet{}, apierror.Wrap(err, "Failed to commit transaction")
 	}
+	metrics.SnippetsCreated.WithLabelValues("api").Inc()
 
-	sendJSON(w, http.StatusCreated, response)
+	return snippet, nil
 }
 
-// getSnippets retrieves all snippets for the authenticated user
-func GetSnippets(w http.ResponseWriter, r *http.Request) {
+// GetSnippets retrieves one page of the authenticated user's snippets
+func (h *Handler) GetSnippets(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
 	userID, err := getUserIDFromContext(r)
 	if err != nil {
-		sendError(w, http.StatusUnauthorized, err.Error())
+		sendError(w, r, apierror.Unauthorized(err))
 		return
 	}
 
-	// Get query parameters
-	collectionID := r.URL.Query().Get("collection_id")
-	search := r.URL.Query().Get("search")
-	limitStr := r.URL.Query().Get("limit")
-	offsetStr := r.URL.Query().Get("offset")
-
-	// Set default values
-	limit := 50
-	offset := 0
-
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
-		}
-	}
-
-	if offsetStr != "" {
-		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
-			offset = o
-		}
-	}
-
-	// Build query
-	query := `
-		SELECT s.id, s.user_id, s.title, s.content, s.collection_ids::text[], s.tag_ids::text[], s.is_public, s.is_favorite, s.fork_count, s.forked_from, s.created_at, s.updated_at
-		FROM snippets s
-		WHERE s.user_id = $1`
-
+	filter := "user_id = $1"
 	args := []interface{}{userID}
-	argIndex := 2
-
-	if collectionID != "" {
-		query += " AND $" + strconv.Itoa(argIndex) + " = ANY(collection_ids)"
+	if collectionID := r.URL.Query().Get("collection_id"); collectionID != "" {
+		filter += " AND $2 = ANY(collection_ids)"
 		args = append(args, collectionID)
-		argIndex++
-	}
-
-	if search != "" {
-		query += " AND (title ILIKE $" + strconv.Itoa(argIndex) + " OR content ILIKE $" + strconv.Itoa(argIndex) + ")"
-		searchTerm := "%" + search + "%"
-		args = append(args, searchTerm, searchTerm)
-		argIndex++
-	}
-
-	query += " ORDER BY created_at DESC LIMIT $" + strconv.Itoa(argIndex) + " OFFSET $" + strconv.Itoa(argIndex+1)
-	args = append(args, limit, offset)
-
-	// Execute query
-	rows, err := database.GetDB().Query(query, args...)
-	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to fetch snippets: "+err.Error())
-		return
 	}
-	defer rows.Close()
 
-	var snippets []models.Snippet
-	for rows.Next() {
-		var s models.Snippet
-		var colIDs pq.StringArray
-		var tagIDs pq.StringArray
-		err := rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &colIDs, &tagIDs, &s.IsPublic, &s.IsFavorite, &s.ForkCount, &s.ForkedFrom, &s.CreatedAt, &s.UpdatedAt)
-		if err != nil {
-			sendError(w, http.StatusInternalServerError, "Failed to scan snippet: "+err.Error())
-			return
-		}
-
-		// Convert pq.StringArray to []string, handling nil cases
-		if colIDs == nil {
-			s.CollectionIDs = []string{}
-		} else {
-			s.CollectionIDs = []string(colIDs)
-		}
-
-		if tagIDs == nil {
-			s.TagIDs = []string{}
-		} else {
-			s.TagIDs = []string(tagIDs)
-		}
-
-		snippets = append(snippets, s)
-	}
-
-	response := models.Response{
-		Success: true,
-		Message: "Snippets retrieved successfully",
-		Data:    snippets,
-	}
-
-	sendJSON(w, http.StatusOK, response)
+	h.listSnippets(w, r, filter, args, "created", "Snippets retrieved successfully")
 }
 
 // getSnippet retrieves a specific snippet by ID
-func GetSnippet(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetSnippet(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
 	userID, err := getUserIDFromContext(r)
 	if err != nil {
-		sendError(w, http.StatusUnauthorized, err.Error())
+		sendError(w, r, apierror.Unauthorized(err))
 		return
 	}
 
@@ -256,52 +185,35 @@ func GetSnippet(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	snippetID := vars["id"]
 
-	// Query snippet from database with tag names
-	var snippet models.Snippet
-	var collectionIDs pq.StringArray
-	var tagIDs pq.StringArray
-	var tagNames pq.StringArray
-
-	err = database.GetDB().QueryRow(`
-		SELECT s.id, s.user_id, s.title, s.content, s.collection_ids::text[], s.tag_ids::text[], 
-		       COALESCE(array_agg(t.name ORDER BY array_position(s.tag_ids::text[], t.id::text)) FILTER (WHERE t.name IS NOT NULL), '{}') as tag_names,
-		       s.is_public, s.is_favorite, s.fork_count, s.forked_from, s.created_at, s.updated_at
-		FROM snippets s
-		LEFT JOIN LATERAL unnest(s.tag_ids::text[]) WITH ORDINALITY AS tag_id(id, ord) ON true
-		LEFT JOIN tags t ON t.id::text = tag_id.id
-		WHERE s.id = $1 AND s.user_id = $2
-		GROUP BY s.id, s.user_id, s.title, s.content, s.collection_ids, s.tag_ids, s.is_public, s.is_favorite, s.fork_count, s.forked_from, s.created_at, s.updated_at`,
-		snippetID, userID).Scan(
-		&snippet.ID, &snippet.UserID, &snippet.Title, &snippet.Content,
-		&collectionIDs, &tagIDs, &tagNames, &snippet.IsPublic, &snippet.IsFavorite,
-		&snippet.ForkCount, &snippet.ForkedFrom, &snippet.CreatedAt, &snippet.UpdatedAt)
-
-	// Convert pq.StringArray to []string, handling nil cases
-	if collectionIDs == nil {
-		snippet.CollectionIDs = []string{}
-	} else {
-		snippet.CollectionIDs = []string(collectionIDs)
+	snippet, err := loadSnippetDetails(h.DB, "s.id = $1 AND s.user_id = $2", snippetID, userID)
+	if err == sql.ErrNoRows {
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "Snippet not found"))
+		return
 	}
-
-	if tagIDs == nil {
-		snippet.TagIDs = []string{}
-	} else {
-		snippet.TagIDs = []string(tagIDs)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch snippet"))
+		return
 	}
 
-	// Add tag names to snippet
-	if tagNames == nil {
-		snippet.TagNames = []string{}
-	} else {
-		snippet.TagNames = []string(tagNames)
+	// Honor Accept for plain text, Markdown and HTML representations
+	w.Header().Set("Vary", "Accept")
+	mediaType := negotiateSnippetType(r.Header.Get("Accept"))
+	if mediaType == "" {
+		sendError(w, r, apierror.New(http.StatusNotAcceptable, apierror.CodeNotAcceptable, "Supported types: "+strings.Join(snippetMediaTypes, ", ")))
+		return
 	}
 
-	if err == sql.ErrNoRows {
-		sendError(w, http.StatusNotFound, "Snippet not found")
+	// The JSON ETag is the one PUT checks If-Match against; other
+	// representations also depend on the type and render options
+	etag := snippetETag(snippet)
+	if mediaType != "application/json" {
+		etag = contentETag(etag, mediaType, r.URL.RawQuery)
+	}
+	if notModified(w, r, etag, privateCacheControl) {
 		return
 	}
-	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to fetch snippet: "+err.Error())
+	if mediaType != "application/json" {
+		sendSnippetAs(w, r, snippet, mediaType)
 		return
 	}
 
@@ -314,12 +226,12 @@ func GetSnippet(w http.ResponseWriter, r *http.Request) {
 	sendJSON(w, http.StatusOK, response)
 }
 
-// updateSnippet updates an existing snippet
-func UpdateSnippet(w http.ResponseWriter, r *http.Request) {
+// UpdateSnippet updates an existing snippet
+func (h *Handler) UpdateSnippet(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
 	userID, err := getUserIDFromContext(r)
 	if err != nil {
-		sendError(w, http.StatusUnauthorized, err.Error())
+		sendError(w, r, apierror.Unauthorized(err))
 		return
 	}
 
@@ -330,45 +242,111 @@ func UpdateSnippet(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
 	var req models.UpdateSnippetRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		sendError(w, r, apierror.InvalidBody(err))
 		return
 	}
 
-	// Check if snippet exists and belongs to user
-	var existingSnippet models.Snippet
-	var existingCollectionIDs pq.StringArray
-	var existingTagIDs pq.StringArray
+	// Refuse to overwrite changes the client has not seen
+	updatedSnippet, err := h.updateSnippet(r.Context(), userID, snippetID, req, func(_ *sql.Tx, existing models.Snippet) error {
+		if etag := snippetETag(existing); preconditionFailed(r, etag) {
+			w.Header().Set("ETag", etag)
+			return apierror.New(http.StatusPreconditionFailed, apierror.CodePreconditionFailed,
+				"Snippet has changed since it was fetched").WithData(existing)
+		}
+		return nil
+	})
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
 
-	err = database.GetDB().QueryRow(`
-		SELECT id, user_id, title, content, collection_ids, tag_ids, is_public, is_favorite, fork_count, forked_from, created_at, updated_at
-		FROM snippets
-		WHERE id = $1 AND user_id = $2`,
-		snippetID, userID).Scan(
-		&existingSnippet.ID, &existingSnippet.UserID, &existingSnippet.Title,
-		&existingSnippet.Content, &existingCollectionIDs, &existingTagIDs, &existingSnippet.IsPublic, &existingSnippet.IsFavorite,
-		&existingSnippet.ForkCount, &existingSnippet.ForkedFrom,
-		&existingSnippet.CreatedAt, &existingSnippet.UpdatedAt)
+	w.Header().Set("ETag", snippetETag(updatedSnippet))
+	response := models.Response{
+		Success: true,
+		Message: "Snippet updated successfully",
+		Data:    updatedSnippet,
+	}
 
-	// Convert pq.StringArray to []string, handling nil cases
-	if existingCollectionIDs == nil {
-		existingSnippet.CollectionIDs = []string{}
-	} else {
-		existingSnippet.CollectionIDs = []string(existingCollectionIDs)
+	sendJSON(w, http.StatusOK, response)
+}
+
+// updateSnippet applies req to a snippet of userID in one transaction,
+// scanning content that will be public and queueing webhooks. The snippet
+// stays locked while precondition inspects the current copy, so a
+// concurrent edit cannot slip past it; an error from precondition aborts
+// the update. Collaborative editing sessions save through here too.
+func (h *Handler) updateSnippet(ctx context.Context, userID, snippetID string, req models.UpdateSnippetRequest, precondition func(*sql.Tx, models.Snippet) error) (models.Snippet, error) {
+	// Start transaction
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Snippet{}, apierror.Wrap(err, "Failed to start transaction")
 	}
+	defer tx.Rollback()
 
-	if existingTagIDs == nil {
-		existingSnippet.TagIDs = []string{}
-	} else {
-		existingSnippet.TagIDs = []string(existingTagIDs)
+	// Check if snippet exists and belongs to user, locking it until the
+	// update commits
+	existingSnippet, err := lockOwnedSnippet(tx, snippetID, userID)
+	if err != nil {
+		return models.Snippet{}, err
+	}
+
+	if precondition != nil {
+		if err := precondition(tx, existingSnippet); err != nil {
+			return models.Snippet{}, err
+		}
+	}
+
+	updatedSnippet, err := applySnippetUpdate(ctx, tx, userID, existingSnippet, req)
+	if err != nil {
+		return models.Snippet{}, err
 	}
 
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return models.Snippet{}, apierror.Wrap(err, "Failed to commit transaction")
+	}
+
+	return updatedSnippet, nil
+}
+
+// lockOwnedSnippet loads a snippet of userID and locks it until tx ends.
+// Failures are *apierror.Error values ready to send.
+func lockOwnedSnippet(tx *sql.Tx, snippetID, userID string) (models.Snippet, error) {
+	snippet, err := loadSnippetDetails(tx, "s.id = $1 AND s.user_id = $2 FOR UPDATE", snippetID, userID)
 	if err == sql.ErrNoRows {
-		sendError(w, http.StatusNotFound, "Snippet not found")
-		return
+		return models.Snippet{}, apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "Snippet not found")
 	}
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to fetch snippet: "+err.Error())
-		return
+		return models.Snippet{}, apierror.Wrap(err, "Failed to fetch snippet")
+	}
+	return snippet, nil
+}
+
+// applySnippetUpdate applies req to existingSnippet, which tx must have
+// locked with lockOwnedSnippet, scanning content that will be public and
+// queueing webhooks. Every change to a snippet's fields goes through here,
+// so the checks and side effects are the same whichever endpoint makes it.
+func applySnippetUpdate(ctx context.Context, tx *sql.Tx, userID string, existingSnippet models.Snippet, req models.UpdateSnippetRequest) (models.Snippet, error) {
+	snippetID := existingSnippet.ID
+	var err error
+
+	// Scan content that will be public after this update. Only publishing it
+	// or changing it is refused; other edits to an already flagged public
+	// snippet still go through.
+	willBePublic := existingSnippet.IsPublic
+	if req.IsPublic != nil {
+		willBePublic = *req.IsPublic
+	}
+	newContent := existingSnippet.Content
+	if req.Content != nil {
+		newContent = *req.Content
+	}
+	var findings []scanner.Finding
+	if willBePublic {
+		publishing := !existingSnippet.IsPublic || newContent != existingSnippet.Content
+		if findings, err = scanSecrets(newContent, req.AllowSecrets || !publishing); err != nil {
+			return models.Snippet{}, err
+		}
 	}
 
 	// Build update query dynamically
@@ -426,117 +404,129 @@ func UpdateSnippet(w http.ResponseWriter, r *http.Request) {
 	args = append(args, snippetID, userID)
 
 	// Execute update
-	_, err = database.GetDB().Exec(query, args...)
+	_, err = tx.ExecContext(ctx, query, args...)
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to update snippet: "+err.Error())
-		return
+		return models.Snippet{}, apierror.Wrap(err, "Failed to update snippet")
 	}
 
 	// Fetch updated snippet
-	var updatedSnippet models.Snippet
-	var updatedCollectionIDs pq.StringArray
-	var updatedTagIDs pq.StringArray
-
-	err = database.GetDB().QueryRow(`
-		SELECT id, user_id, title, content, collection_ids, tag_ids, is_public, is_favorite, fork_count, forked_from, created_at, updated_at
-		FROM snippets
-		WHERE id = $1 AND user_id = $2`,
-		snippetID, userID).Scan(
-		&updatedSnippet.ID, &updatedSnippet.UserID, &updatedSnippet.Title,
-		&updatedSnippet.Content, &updatedCollectionIDs, &updatedTagIDs, &updatedSnippet.IsPublic, &updatedSnippet.IsFavorite,
-		&updatedSnippet.ForkCount, &updatedSnippet.ForkedFrom,
-		&updatedSnippet.CreatedAt, &updatedSnippet.UpdatedAt)
+	updatedSnippet, err := loadSnippetDetails(tx, "s.id = $1 AND s.user_id = $2", snippetID, userID)
+	if err != nil {
+		return models.Snippet{}, apierror.Wrap(err, "Failed to fetch updated snippet")
+	}
 
-	// Convert pq.StringArray to []string, handling nil cases
-	if updatedCollectionIDs == nil {
-		updatedSnippet.CollectionIDs = []string{}
-	} else {
-		updatedSnippet.CollectionIDs = []string(updatedCollectionIDs)
+	if updatedSnippet.IsPublic {
+		if err = scanner.Record(tx, snippetID, findings, req.AllowSecrets && len(findings) > 0); err != nil {
+			return models.Snippet{}, err
+		}
 	}
 
-	if updatedTagIDs == nil {
-		updatedSnippet.TagIDs = []string{}
-	} else {
-		updatedSnippet.TagIDs = []string(updatedTagIDs)
+	// Queue webhook deliveries in the same transaction
+	if err = webhooks.Enqueue(tx, userID, webhooks.EventSnippetUpdated, updatedSnippet); err != nil {
+		return models.Snippet{}, err
 	}
 
+	return updatedSnippet, nil
+}
+
+// DeleteSnippet deletes a snippet
+func (h *Handler) DeleteSnippet(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to fetch updated snippet: "+err.Error())
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get snippet ID from URL parameters
+	vars := mux.Vars(r)
+	snippetID := vars["id"]
+
+	if err := h.deleteSnippet(r.Context(), userID, snippetID, nil); err != nil {
+		sendError(w, r, err)
 		return
 	}
 
 	response := models.Response{
 		Success: true,
-		Message: "Snippet updated successfully",
-		Data:    updatedSnippet,
+		Message: "Snippet deleted successfully",
+		Data:    map[string]string{"id": snippetID},
 	}
 
 	sendJSON(w, http.StatusOK, response)
 }
 
-// deleteSnippet deletes a snippet
-func DeleteSnippet(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context
-	userID, err := getUserIDFromContext(r)
+// deleteSnippet deletes a snippet of userID and queues webhooks. The
+// snippet stays locked while precondition runs; an error from it aborts the
+// deletion.
+func (h *Handler) deleteSnippet(ctx context.Context, userID, snippetID string, precondition func(*sql.Tx) error) error {
+	// Start transaction
+	tx, err := h.DB.BeginTx(ctx, nil)
 	if err != nil {
-		sendError(w, http.StatusUnauthorized, err.Error())
-		return
+		return apierror.Wrap(err, "Failed to start transaction")
 	}
+	defer tx.Rollback()
 
-	// Get snippet ID from URL parameters
-	vars := mux.Vars(r)
-	snippetID := vars["id"]
-
-	// First, check if snippet exists and belongs to user
+	// Check if snippet exists and belongs to user
 	var snippetIDCheck string
-	err = database.GetDB().QueryRow(`
-		SELECT id FROM snippets WHERE id = $1 AND user_id = $2`,
+	err = tx.QueryRowContext(ctx, `
+		SELECT id FROM snippets WHERE id = $1 AND user_id = $2 FOR UPDATE`,
 		snippetID, userID).Scan(&snippetIDCheck)
 
 	if err == sql.ErrNoRows {
-		sendError(w, http.StatusNotFound, "Snippet not found")
-		return
+		return apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "Snippet not found")
 	}
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to check snippet: "+err.Error())
-		return
+		return apierror.Wrap(err, "Failed to check snippet")
+	}
+
+	if precondition != nil {
+		if err := precondition(tx); err != nil {
+			return err
+		}
 	}
 
-	// Simple delete without transaction for now
-	_, err = database.GetDB().Exec("DELETE FROM snippets WHERE id = $1 AND user_id = $2", snippetID, userID)
+	_, err = tx.ExecContext(ctx, "DELETE FROM snippets WHERE id = $1 AND user_id = $2", snippetID, userID)
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to delete snippet: "+err.Error())
-		return
+		return apierror.Wrap(err, "Failed to delete snippet")
 	}
 
-	response := models.Response{
-		Success: true,
-		Message: "Snippet deleted successfully",
-		Data:    map[string]string{"id": snippetID},
+	// Queue webhook deliveries in the same transaction
+	if err = webhooks.Enqueue(tx, userID, webhooks.EventSnippetDeleted, map[string]string{"id": snippetID}); err != nil {
+		return err
 	}
 
-	sendJSON(w, http.StatusOK, response)
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return apierror.Wrap(err, "Failed to commit transaction")
+	}
+	return nil
 }
 
-// forkSnippet forks a public snippet to the user's collection
-func ForkSnippet(w http.ResponseWriter, r *http.Request) {
+// ForkSnippet forks a public snippet into one of the user's collections.
+// Tags are mapped by name onto the forker's own tags.
+func (h *Handler) ForkSnippet(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
 	userID, err := getUserIDFromContext(r)
 	if err != nil {
-		sendError(w, http.StatusUnauthorized, err.Error())
+		sendError(w, r, apierror.Unauthorized(err))
 		return
 	}
 
-	// Get snippet ID from URL parameters
+	// Get snippet ID and optional target collection from URL parameters
 	vars := mux.Vars(r)
 	snippetID := vars["id"]
+	collectionID := vars["collection_id"]
+	if collectionID == "" {
+		collectionID = r.URL.Query().Get("collection_id")
+	}
 
 	// Check if snippet exists and is public
 	var originalSnippet models.Snippet
 	var originalCollectionIDs pq.StringArray
 	var originalTagIDs pq.StringArray
 
-	err = database.GetDB().QueryRow(`
+	err = h.DB.QueryRow(`
 		SELECT id, user_id, title, content, collection_ids, tag_ids, is_public, is_favorite, fork_count, forked_from, created_at, updated_at
 		FROM snippets
 		WHERE id = $1 AND is_public = true`,
@@ -560,26 +550,56 @@ func ForkSnippet(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err == sql.ErrNoRows {
-		sendError(w, http.StatusNotFound, "Public snippet not found")
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "Public snippet not found"))
 		return
 	}
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to fetch snippet: "+err.Error())
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch snippet"))
 		return
 	}
 
+	// Don't spread leaked credentials into more copies
+	allowSecrets := vars["allow_secrets"] == "true" || r.URL.Query().Get("allow_secrets") == "true"
+	if _, ok := checkSecrets(w, r, originalSnippet.Content, allowSecrets); !ok {
+		return
+	}
+
+	// The fork lands in one of the forker's collections, never the original owner's
+	forkedCollectionIDs := []string{}
+	if collectionID != "" {
+		var exists bool
+		err = h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM collections WHERE id = $1 AND user_id = $2)",
+			collectionID, userID).Scan(&exists)
+		if err != nil {
+			sendError(w, r, apierror.Wrap(err, "Failed to validate collection ownership"))
+			return
+		}
+		if !exists {
+			sendError(w, r, apierror.New(http.StatusForbidden, apierror.CodeForbidden, "Collection not found or access denied"))
+			return
+		}
+		forkedCollectionIDs = []string{collectionID}
+	}
+
 	// Start transaction
-	tx, err := database.GetDB().Begin()
+	tx, err := h.DB.Begin()
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to start transaction: "+err.Error())
+		sendError(w, r, apierror.Wrap(err, "Failed to start transaction"))
 		return
 	}
 	defer tx.Rollback()
 
+	// Map the original tags by name onto the forker's own tags
+	forkedTagIDs, forkedTagNames, err := mapTagsToUser(tx, originalSnippet.TagIDs, userID)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
 	// Increment fork count on original snippet
 	_, err = tx.Exec("UPDATE snippets SET fork_count = fork_count + 1 WHERE id = $1", snippetID)
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to update fork count: "+err.Error())
+		sendError(w, r, apierror.Wrap(err, "Failed to update fork count"))
 		return
 	}
 
@@ -587,42 +607,58 @@ func ForkSnippet(w http.ResponseWriter, r *http.Request) {
 	forkedSnippetID := uuid.New().String()
 	now := time.Now()
 
-	// Ensure we have empty arrays instead of nil
-	forkedCollectionIDs := originalSnippet.CollectionIDs
-	if forkedCollectionIDs == nil {
-		forkedCollectionIDs = []string{}
-	}
+	// The original content is the common ancestor for later upstream syncs
+	_, err = tx.Exec(`
+		INSERT INTO snippets (id, user_id, title, content, collection_ids, tag_ids, is_public, is_favorite, fork_count, forked_from,
+		                      upstream_base_title, upstream_base_content, upstream_synced_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+		forkedSnippetID, userID, originalSnippet.Title, originalSnippet.Content,
+		pq.Array(forkedCollectionIDs), pq.Array(forkedTagIDs), false, false, 0, &snippetID,
+		originalSnippet.Title, originalSnippet.Content, now, now, now)
 
-	forkedTagIDs := originalSnippet.TagIDs
-	if forkedTagIDs == nil {
-		forkedTagIDs = []string{}
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to create forked snippet"))
+		return
 	}
 
-	_, err = tx.Exec(`
-		INSERT INTO snippets (id, user_id, title, content, collection_ids, tag_ids, is_public, is_favorite, fork_count, forked_from, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
-		forkedSnippetID, userID, originalSnippet.Title, originalSnippet.Content,
-		pq.Array(forkedCollectionIDs), pq.Array(forkedTagIDs), false, false, 0, &snippetID, now, now)
+	// Let the original author know their snippet was forked
+	_, err = notifications.Create(tx, originalSnippet.UserID, userID, notifications.TypeSnippetForked, &snippetID, map[string]interface{}{
+		"snippet_title": originalSnippet.Title,
+		"fork_id":       forkedSnippetID,
+	})
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
 
+	// Tell the original author's integrations about the fork
+	err = webhooks.Enqueue(tx, originalSnippet.UserID, webhooks.EventSnippetForked, map[string]string{
+		"snippet_id": snippetID,
+		"fork_id":    forkedSnippetID,
+		"forked_by":  userID,
+	})
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to create forked snippet: "+err.Error())
+		sendError(w, r, err)
 		return
 	}
 
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to commit transaction: "+err.Error())
+		sendError(w, r, apierror.Wrap(err, "Failed to commit transaction"))
 		return
 	}
 
+	metrics.SnippetForks.Inc()
+
 	// Create response
 	forkedSnippet := models.Snippet{
 		ID:            forkedSnippetID,
 		UserID:        userID,
-		CollectionIDs: originalSnippet.CollectionIDs,
+		CollectionIDs: forkedCollectionIDs,
 		Title:         originalSnippet.Title,
 		Content:       originalSnippet.Content,
-		TagIDs:        originalSnippet.TagIDs,
+		TagIDs:        forkedTagIDs,
+		TagNames:      forkedTagNames,
 		IsPublic:      false,
 		IsFavorite:    false,
 
@@ -641,251 +677,233 @@ func ForkSnippet(w http.ResponseWriter, r *http.Request) {
 	sendJSON(w, http.StatusCreated, response)
 }
 
-// ForkSnippetByBody supports POST /api/snippets/fork with JSON body {"id": "<snippet_id>"}
-func ForkSnippetByBody(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		ID string `json:"id"`
-	}
+// ForkSnippetByBody supports POST /api/snippets/fork with JSON body
+// {"id": "<snippet_id>", "collection_id": "<optional target collection>"}
+func (h *Handler) ForkSnippetByBody(w http.ResponseWriter, r *http.Request) {
+	var req models.ForkSnippetRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
-		sendError(w, http.StatusBadRequest, "snippet id is required")
+		sendError(w, r, apierror.Invalid("id", "snippet id is required"))
 		return
 	}
 	// Re-route to path param variant for reuse
-	r = mux.SetURLVars(r, map[string]string{"id": req.ID})
-	ForkSnippet(w, r)
+	r = mux.SetURLVars(r, map[string]string{"id": req.ID, "collection_id": req.CollectionID, "allow_secrets": strconv.FormatBool(req.AllowSecrets)})
+	h.ForkSnippet(w, r)
 }
 
-// GetPublicSnippets retrieves all public snippets (no authentication required)
-func GetPublicSnippets(w http.ResponseWriter, r *http.Request) {
-	// Get query parameters
-	search := r.URL.Query().Get("search")
-	limitStr := r.URL.Query().Get("limit")
-	offsetStr := r.URL.Query().Get("offset")
-	shuffleStr := r.URL.Query().Get("shuffle")
-	userID := r.URL.Query().Get("user_id")
-
-	// Set default values
-	limit := 50
-	offset := 0
-
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
-		}
-	}
-
-	if offsetStr != "" {
-		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
-			offset = o
-		}
-	}
-
-	// Build query
-	query := `
-		SELECT id, user_id, title, content, collection_ids::text[], tag_ids::text[], is_public, is_favorite, fork_count, forked_from, created_at, updated_at
-		FROM snippets
-		WHERE is_public = true`
-
+// GetPublicSnippets retrieves one page of public snippets (no authentication
+// required), most forked first by default
+func (h *Handler) GetPublicSnippets(w http.ResponseWriter, r *http.Request) {
+	filter := "is_public = true"
 	args := []interface{}{}
-	argIndex := 1
-
-	if userID != "" {
-		query += " AND user_id = $" + strconv.Itoa(argIndex)
+	if userID := r.URL.Query().Get("user_id"); userID != "" {
+		filter += " AND user_id = $1"
 		args = append(args, userID)
-		argIndex++
 	}
 
-	if search != "" {
-		query += " AND (title ILIKE $" + strconv.Itoa(argIndex) + " OR content ILIKE $" + strconv.Itoa(argIndex) + ")"
-		searchTerm := "%" + search + "%"
-		args = append(args, searchTerm, searchTerm)
-		argIndex += 2
+	if r.URL.Query().Get("shuffle") == "true" {
+		h.sendShuffledSnippets(w, r, filter, args)
+		return
 	}
 
-	// Add ordering
-	if shuffleStr == "true" {
-		query += " ORDER BY RANDOM()"
-	} else {
-		query += " ORDER BY fork_count DESC, created_at DESC"
-	}
+	h.listSnippets(w, r, filter, args, "forks", "Public snippets retrieved successfully")
+}
 
-	query += " LIMIT $" + strconv.Itoa(argIndex) + " OFFSET $" + strconv.Itoa(argIndex+1)
-	args = append(args, limit, offset)
+// GetPublicSnippet retrieves a specific public snippet by ID (no authentication required)
+func (h *Handler) GetPublicSnippet(w http.ResponseWriter, r *http.Request) {
+	// Get snippet ID from URL parameters
+	vars := mux.Vars(r)
+	snippetID := vars["id"]
 
-	// Execute query
-	rows, err := database.GetDB().Query(query, args...)
+	snippet, err := cache.Fetch(r.Context(), h.Cache, cachePublicSnippet, snippetID, func() (models.Snippet, error) {
+		return loadSnippetDetails(h.DB, "s.id = $1 AND s.is_public = true", snippetID)
+	})
+	if err == sql.ErrNoRows {
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "Public snippet not found"))
+		return
+	}
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to fetch public snippets: "+err.Error())
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch snippet"))
 		return
 	}
-	defer rows.Close()
-
-	var snippets []models.Snippet
-	for rows.Next() {
-		var s models.Snippet
-		var colIDs pq.StringArray
-		var tagIDs pq.StringArray
-		err := rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &colIDs, &tagIDs, &s.IsPublic, &s.IsFavorite, &s.ForkCount, &s.ForkedFrom, &s.CreatedAt, &s.UpdatedAt)
-		if err != nil {
-			sendError(w, http.StatusInternalServerError, "Failed to scan snippet: "+err.Error())
-			return
-		}
-
-		// Convert pq.StringArray to []string, handling nil cases
-		if colIDs == nil {
-			s.CollectionIDs = []string{}
-		} else {
-			s.CollectionIDs = []string(colIDs)
-		}
-
-		if tagIDs == nil {
-			s.TagIDs = []string{}
-		} else {
-			s.TagIDs = []string(tagIDs)
-		}
-
-		snippets = append(snippets, s)
+	metrics.PublicReads.WithLabelValues("json").Inc()
+	if notModified(w, r, snippetETag(snippet), publicCacheControl) {
+		return
 	}
 
 	response := models.Response{
 		Success: true,
-		Message: "Public snippets retrieved successfully",
-		Data:    snippets,
+		Message: "Public snippet retrieved successfully",
+		Data:    snippet,
 	}
 
 	sendJSON(w, http.StatusOK, response)
 }
 
-// GetPublicSnippet retrieves a specific public snippet by ID (no authentication required)
-func GetPublicSnippet(w http.ResponseWriter, r *http.Request) {
-	// Get snippet ID from URL parameters
-	vars := mux.Vars(r)
-	snippetID := vars["id"]
+// GetUserPublicSnippets retrieves one page of the authenticated user's public snippets
+func (h *Handler) GetUserPublicSnippets(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
 
-	// Query snippet from database with tag names
-	var snippet models.Snippet
-	var collectionIDs pq.StringArray
-	var tagIDs pq.StringArray
-	var tagNames pq.StringArray
-
-	err := database.GetDB().QueryRow(`
-		SELECT s.id, s.user_id, s.title, s.content, s.collection_ids::text[], s.tag_ids::text[], 
-		       COALESCE(array_agg(t.name ORDER BY array_position(s.tag_ids::text[], t.id::text)) FILTER (WHERE t.name IS NOT NULL), '{}') as tag_names,
-		       s.is_public, s.is_favorite, s.fork_count, s.forked_from, s.created_at, s.updated_at
-		FROM snippets s
-		LEFT JOIN LATERAL unnest(s.tag_ids::text[]) WITH ORDINALITY AS tag_id(id, ord) ON true
-		LEFT JOIN tags t ON t.id::text = tag_id.id
-		WHERE s.id = $1 AND s.is_public = true
-		GROUP BY s.id, s.user_id, s.title, s.content, s.collection_ids, s.tag_ids, s.is_public, s.is_favorite, s.fork_count, s.forked_from, s.created_at, s.updated_at`,
-		snippetID).Scan(
-		&snippet.ID, &snippet.UserID, &snippet.Title, &snippet.Content,
-		&collectionIDs, &tagIDs, &tagNames, &snippet.IsPublic, &snippet.IsFavorite,
-		&snippet.ForkCount, &snippet.ForkedFrom, &snippet.CreatedAt, &snippet.UpdatedAt)
+	h.listSnippets(w, r, "user_id = $1 AND is_public = true", []interface{}{userID}, "created", "User public snippets retrieved successfully")
+}
 
-	// Convert pq.StringArray to []string, handling nil cases
-	if collectionIDs == nil {
-		snippet.CollectionIDs = []string{}
-	} else {
-		snippet.CollectionIDs = []string(collectionIDs)
-	}
+// snippetListColumns are the snippet fields read by scanSnippetRows
+const snippetListColumns = `id, user_id, title, content, collection_ids::text[], tag_ids::text[], is_public, is_favorite, fork_count, forked_from, created_at, updated_at`
+
+// snippetOrders are the sort orders of snippet lists
+var snippetOrders = map[string]keyset[models.Snippet]{
+	"created": {
+		columns: []string{"created_at", "id"}, types: []string{"timestamp", "uuid"}, desc: true,
+		values: func(s models.Snippet) []string { return []string{cursorTime(s.CreatedAt), s.ID} },
+	},
+	"updated": {
+		columns: []string{"updated_at", "id"}, types: []string{"timestamp", "uuid"}, desc: true,
+		values: func(s models.Snippet) []string { return []string{cursorTime(s.UpdatedAt), s.ID} },
+	},
+	"title": {
+		columns: []string{"title", "id"}, types: []string{"text", "uuid"},
+		values: func(s models.Snippet) []string { return []string{s.Title, s.ID} },
+	},
+	"forks": {
+		columns: []string{"fork_count", "created_at", "id"}, types: []string{"int", "timestamp", "uuid"}, desc: true,
+		values: func(s models.Snippet) []string {
+			return []string{strconv.Itoa(s.ForkCount), cursorTime(s.CreatedAt), s.ID}
+		},
+	},
+}
 
-	if tagIDs == nil {
-		snippet.TagIDs = []string{}
-	} else {
-		snippet.TagIDs = []string(tagIDs)
+// listSnippets writes one page of the snippets matching filter, a WHERE
+// condition over args. The search parameter and the cursor narrow it further.
+func (h *Handler) listSnippets(w http.ResponseWriter, r *http.Request, filter string, args []interface{}, defaultSort, message string) {
+	p, err := parsePage(r, snippetOrders, defaultSort)
+	if err != nil {
+		sendError(w, r, err)
+		return
 	}
 
-	// Add tag names to snippet
-	if tagNames == nil {
-		snippet.TagNames = []string{}
-	} else {
-		snippet.TagNames = []string(tagNames)
+	if search := r.URL.Query().Get("search"); search != "" {
+		placeholder := "$" + strconv.Itoa(len(args)+1)
+		filter += " AND (title ILIKE " + placeholder + " OR content ILIKE " + placeholder + ")"
+		args = append(args, "%"+search+"%")
 	}
 
-	if err == sql.ErrNoRows {
-		sendError(w, http.StatusNotFound, "Public snippet not found")
-		return
+	// The anonymous public listing is the same for everyone, so it is
+	// cached under its query string and may be kept by shared caches
+	_, authenticated := r.Context().Value("user_id").(string)
+	load := func() (snippetPage, error) {
+		return h.loadSnippetPage(p, filter, args)
+	}
+	var result snippetPage
+	if authenticated {
+		result, err = load()
+	} else {
+		result, err = cache.Fetch(r.Context(), h.Cache, cachePublicList, r.URL.Query().Encode(), load)
 	}
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to fetch snippet: "+err.Error())
+		sendError(w, r, err)
 		return
 	}
+	setPageLinks(w, r, result.Page)
 
 	response := models.Response{
 		Success: true,
-		Message: "Public snippet retrieved successfully",
-		Data:    snippet,
+		Message: message,
+		Data:    result.Snippets,
+		Page:    result.Page,
+	}
+
+	cacheControl := publicCacheControl
+	if authenticated {
+		cacheControl = privateCacheControl
+	}
+	if notModified(w, r, representationETag(response), cacheControl) {
+		return
 	}
 
 	sendJSON(w, http.StatusOK, response)
 }
 
-// GetUserPublicSnippets retrieves public snippets for the authenticated user
-func GetUserPublicSnippets(w http.ResponseWriter, r *http.Request) {
-	// Get user ID from context
-	userID, err := getUserIDFromContext(r)
-	if err != nil {
-		sendError(w, http.StatusUnauthorized, err.Error())
-		return
-	}
+// snippetPage is one page of a snippet list
+type snippetPage struct {
+	Snippets []models.Snippet `json:"snippets"`
+	Page     *models.PageInfo `json:"page"`
+}
 
-	// Get query parameters
-	search := r.URL.Query().Get("search")
-	limitStr := r.URL.Query().Get("limit")
-	offsetStr := r.URL.Query().Get("offset")
+// loadSnippetPage queries the page p of the snippets matching filter
+func (h *Handler) loadSnippetPage(p *page[models.Snippet], filter string, args []interface{}) (snippetPage, error) {
+	from := "FROM snippets WHERE " + filter
 
-	// Set default values
-	limit := 50
-	offset := 0
+	query := "SELECT " + snippetListColumns + " " + from
+	queryArgs := args
+	if after, afterArgs := p.where(len(args) + 1); after != "" {
+		query += " AND " + after
+		queryArgs = append(append([]interface{}{}, args...), afterArgs...)
+	}
+	query += p.orderBy()
 
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
-		}
+	snippets, err := h.querySnippets(query, queryArgs...)
+	if err != nil {
+		return snippetPage{}, err
 	}
 
-	if offsetStr != "" {
-		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
-			offset = o
-		}
+	snippets, info := p.finish(snippets)
+	if err := p.count(h.DB, info, from, args); err != nil {
+		return snippetPage{}, err
 	}
+	return snippetPage{Snippets: snippets, Page: info}, nil
+}
 
-	// Build query
-	query := `
-		SELECT id, user_id, title, content, collection_ids::text[], tag_ids::text[], is_public, is_favorite, fork_count, forked_from, created_at, updated_at
-		FROM snippets
-		WHERE user_id = $1 AND is_public = true`
+// sendShuffledSnippets writes a random sample of the snippets matching
+// filter. A shuffled list has no stable order, so it is a single page.
+func (h *Handler) sendShuffledSnippets(w http.ResponseWriter, r *http.Request, filter string, args []interface{}) {
+	limit := defaultPageSize
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			sendError(w, r, apierror.Invalid("limit", "limit must be a positive integer"))
+			return
+		}
+		limit = min(n, maxPageSize)
+	}
 
-	args := []interface{}{userID}
-	argIndex := 2
+	query := "SELECT " + snippetListColumns + " FROM snippets WHERE " + filter + " ORDER BY RANDOM() LIMIT " + strconv.Itoa(limit)
+	snippets, err := h.querySnippets(query, args...)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
 
-	if search != "" {
-		query += " AND (title ILIKE $" + strconv.Itoa(argIndex) + " OR content ILIKE $" + strconv.Itoa(argIndex) + ")"
-		searchTerm := "%" + search + "%"
-		args = append(args, searchTerm)
-		argIndex++
+	response := models.Response{
+		Success: true,
+		Message: "Public snippets retrieved successfully",
+		Data:    snippets,
+		Page:    &models.PageInfo{Limit: limit},
 	}
 
-	query += " ORDER BY created_at DESC LIMIT $" + strconv.Itoa(argIndex) + " OFFSET $" + strconv.Itoa(argIndex+1)
-	args = append(args, limit, offset)
+	sendJSON(w, http.StatusOK, response)
+}
 
-	// Execute query
-	rows, err := database.GetDB().Query(query, args...)
+// querySnippets runs a query selecting snippetListColumns
+func (h *Handler) querySnippets(query string, args ...interface{}) ([]models.Snippet, error) {
+	rows, err := h.DB.Query(query, args...)
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to fetch user public snippets: "+err.Error())
-		return
+		return nil, apierror.Wrap(err, "Failed to fetch snippets")
 	}
 	defer rows.Close()
 
-	var snippets []models.Snippet
+	// initialize as empty slice to avoid null in JSON
+	snippets := make([]models.Snippet, 0)
 	for rows.Next() {
 		var s models.Snippet
 		var colIDs pq.StringArray
 		var tagIDs pq.StringArray
 		err := rows.Scan(&s.ID, &s.UserID, &s.Title, &s.Content, &colIDs, &tagIDs, &s.IsPublic, &s.IsFavorite, &s.ForkCount, &s.ForkedFrom, &s.CreatedAt, &s.UpdatedAt)
 		if err != nil {
-			sendError(w, http.StatusInternalServerError, "Failed to scan snippet: "+err.Error())
-			return
+			return nil, apierror.Wrap(err, "Failed to scan snippet")
 		}
 
 		// Convert pq.StringArray to []string, handling nil cases
@@ -903,22 +921,21 @@ func GetUserPublicSnippets(w http.ResponseWriter, r *http.Request) {
 
 		snippets = append(snippets, s)
 	}
-
-	response := models.Response{
-		Success: true,
-		Message: "User public snippets retrieved successfully",
-		Data:    snippets,
+	if err := rows.Err(); err != nil {
+		return nil, apierror.Wrap(err, "Failed to iterate snippets")
 	}
 
-	sendJSON(w, http.StatusOK, response)
+	return snippets, nil
 }
 
 // HealthCheck provides a simple health check endpoint
-func HealthCheck(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	// Test database connection
-	err := database.GetDB().Ping()
+	err := h.DB.Ping()
 	if err != nil {
-		sendError(w, http.StatusServiceUnavailable, "Database connection failed: "+err.Error())
+		unavailable := apierror.New(http.StatusServiceUnavailable, apierror.CodeUnavailable, "Database connection failed")
+		unavailable.Err = err
+		sendError(w, r, unavailable)
 		return
 	}
 
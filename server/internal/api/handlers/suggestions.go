@@ -0,0 +1,631 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/diff"
+	"snippy-server/internal/models"
+	"snippy-server/internal/notifications"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// suggestionColumns selects a suggestion together with the snippet's
+// current title and content, which are needed to detect stale proposals
+const suggestionColumns = `
+	SELECT sg.id, sg.snippet_id, sg.owner_id, sg.proposer_id, sg.title, sg.content, sg.message,
+	       sg.base_version, sg.base_title, sg.base_content, sg.status, sg.response_message,
+	       sg.resolved_at, sg.created_at, sg.updated_at, s.title, s.content
+	FROM snippet_suggestions sg
+	JOIN snippets s ON s.id = sg.snippet_id`
+
+// suggestionRow is a suggestion with the fields needed to apply it
+type suggestionRow struct {
+	models.Suggestion
+	baseTitle      string
+	baseContent    string
+	currentTitle   string
+	currentContent string
+}
+
+// CreateSuggestion proposes an edit to someone else's public snippet
+func (h *Handler) CreateSuggestion(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get snippet ID from URL parameters
+	vars := mux.Vars(r)
+	snippetID := vars["id"]
+
+	// Parse request body
+	var req models.CreateSuggestionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, apierror.InvalidBody(err))
+		return
+	}
+
+	if req.BaseVersion <= 0 {
+		sendError(w, r, apierror.Invalid("base_version", "base_version is required"))
+		return
+	}
+
+	// Check the snippet exists and is public
+	var ownerID, title, content string
+	var version int
+	err = h.DB.QueryRow(`
+		SELECT user_id, title, content, version
+		FROM snippets
+		WHERE id = $1 AND is_public = true`,
+		snippetID).Scan(&ownerID, &title, &content, &version)
+
+	if err == sql.ErrNoRows {
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "Public snippet not found"))
+		return
+	}
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch snippet"))
+		return
+	}
+
+	if ownerID == userID {
+		sendError(w, r, apierror.New(http.StatusBadRequest, apierror.CodeValidationFailed, "You cannot suggest edits to your own snippet"))
+		return
+	}
+
+	if req.BaseVersion != version {
+		sendError(w, r, apierror.New(http.StatusConflict, apierror.CodeConflict, fmt.Sprintf("Snippet has changed since version %d (current version is %d)", req.BaseVersion, version)))
+		return
+	}
+
+	// Omitted fields keep their current value
+	proposedTitle := title
+	if req.Title != nil {
+		proposedTitle = strings.TrimSpace(*req.Title)
+	}
+	proposedContent := content
+	if req.Content != nil {
+		proposedContent = *req.Content
+	}
+
+	if proposedTitle == "" {
+		sendError(w, r, apierror.Invalid("title", "Snippet title is required"))
+		return
+	}
+	if proposedContent == "" {
+		sendError(w, r, apierror.Invalid("content", "Snippet content is required"))
+		return
+	}
+	if proposedTitle == title && proposedContent == content {
+		sendError(w, r, apierror.New(http.StatusBadRequest, apierror.CodeValidationFailed, "Suggestion does not change the snippet"))
+		return
+	}
+
+	suggestionID := uuid.New().String()
+	now := time.Now()
+
+	// Start transaction
+	tx, err := h.DB.Begin()
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to start transaction"))
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO snippet_suggestions (id, snippet_id, owner_id, proposer_id, title, content, message,
+		                                 base_version, base_title, base_content, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		suggestionID, snippetID, ownerID, userID, proposedTitle, proposedContent, req.Message,
+		version, title, content, now, now)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to create suggestion"))
+		return
+	}
+
+	// Let the owner know about the proposal
+	_, err = notifications.Create(tx, ownerID, userID, notifications.TypeSuggestionCreated, &snippetID, map[string]interface{}{
+		"snippet_title": title,
+		"suggestion_id": suggestionID,
+	})
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to commit transaction"))
+		return
+	}
+
+	suggestion := models.Suggestion{
+		ID:          suggestionID,
+		SnippetID:   snippetID,
+		OwnerID:     ownerID,
+		ProposerID:  userID,
+		Title:       proposedTitle,
+		Content:     proposedContent,
+		Message:     req.Message,
+		BaseVersion: version,
+		Diff:        diff.Unified("a/"+title, "b/"+proposedTitle, content, proposedContent, 3),
+		Status:      "open",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Suggestion created successfully",
+		Data:    suggestion,
+	}
+
+	sendJSON(w, http.StatusCreated, response)
+}
+
+// GetSnippetSuggestions lists suggestions on a snippet. The owner sees all of
+// them; other users only see their own.
+func (h *Handler) GetSnippetSuggestions(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get snippet ID from URL parameters
+	vars := mux.Vars(r)
+	snippetID := vars["id"]
+
+	query := suggestionColumns + `
+		WHERE sg.snippet_id = $1 AND (sg.owner_id = $2 OR sg.proposer_id = $2)`
+	args := []interface{}{snippetID, userID}
+
+	if status := r.URL.Query().Get("status"); status != "" {
+		query += " AND sg.status = $3"
+		args = append(args, status)
+	}
+	query += " ORDER BY sg.created_at DESC"
+
+	h.sendSuggestionList(w, r, query, args...)
+}
+
+// GetSuggestions lists suggestions the user received on their snippets
+// (role=received, the default) or sent to others (role=sent)
+func (h *Handler) GetSuggestions(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	column := "sg.owner_id"
+	switch r.URL.Query().Get("role") {
+	case "", "received":
+	case "sent":
+		column = "sg.proposer_id"
+	default:
+		sendError(w, r, apierror.Invalid("role", "role must be 'received' or 'sent'"))
+		return
+	}
+
+	query := suggestionColumns + " WHERE " + column + " = $1"
+	args := []interface{}{userID}
+
+	if status := r.URL.Query().Get("status"); status != "" {
+		query += " AND sg.status = $2"
+		args = append(args, status)
+	}
+	query += " ORDER BY sg.created_at DESC"
+
+	h.sendSuggestionList(w, r, query, args...)
+}
+
+// AcceptSuggestion applies a suggestion to the snippet and credits the
+// proposer. Stale suggestions are three-way merged with the current content
+// and rejected with 409 if they conflict.
+func (h *Handler) AcceptSuggestion(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get suggestion ID from URL parameters
+	vars := mux.Vars(r)
+	suggestionID := vars["id"]
+
+	req, ok := decodeResolveSuggestionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	// Start transaction
+	tx, err := h.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to start transaction"))
+		return
+	}
+	defer tx.Rollback()
+
+	sg, ok := lockOpenSuggestion(w, r, tx, suggestionID, "sg.owner_id", userID)
+	if !ok {
+		return
+	}
+
+	// Lock the snippet too, so it cannot change between the staleness check
+	// and the update
+	existing, err := lockOwnedSnippet(tx, sg.SnippetID, userID)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	sg.currentTitle, sg.currentContent = existing.Title, existing.Content
+	sg.IsStale = existing.Version != sg.BaseVersion
+
+	newTitle, newContent := sg.Title, sg.Content
+	if sg.IsStale {
+		merged := diff.Merge3(sg.baseContent, sg.currentContent, sg.Content, "current", "suggestion")
+		newContent = merged.Content
+
+		// Titles are merged as a single line
+		switch {
+		case sg.currentTitle == sg.baseTitle:
+			newTitle = sg.Title
+		case sg.Title == sg.baseTitle || sg.Title == sg.currentTitle:
+			newTitle = sg.currentTitle
+		default:
+			merged.Conflicts++
+		}
+
+		if merged.Conflicts > 0 {
+			conflict := apierror.New(http.StatusConflict, apierror.CodeMergeConflict, "Suggestion conflicts with changes made since it was proposed")
+			sendError(w, r, conflict.WithData(map[string]interface{}{
+				"suggestion": sg.Suggestion,
+				"merge":      merged,
+			}))
+			return
+		}
+	}
+
+	// Accepting publishes the proposed content under the owner's name, so it
+	// is saved like the owner's own edit: scanned, versioned and announced
+	snippet, err := applySnippetUpdate(r.Context(), tx, userID, existing, models.UpdateSnippetRequest{
+		Title:        &newTitle,
+		Content:      &newContent,
+		AllowSecrets: req.AllowSecrets,
+	})
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	if err := resolveSuggestion(tx, &sg.Suggestion, "accepted", req.Message); err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	// Credit the proposer
+	_, err = tx.Exec(`
+		INSERT INTO snippet_contributors (snippet_id, user_id, suggestion_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`,
+		sg.SnippetID, sg.ProposerID, sg.ID)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to credit contributor"))
+		return
+	}
+
+	_, err = notifications.Create(tx, sg.ProposerID, userID, notifications.TypeSuggestionAccepted, &sg.SnippetID, map[string]interface{}{
+		"snippet_title": snippet.Title,
+		"suggestion_id": sg.ID,
+	})
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to commit transaction"))
+		return
+	}
+
+	w.Header().Set("ETag", snippetETag(snippet))
+	response := models.Response{
+		Success: true,
+		Message: "Suggestion accepted successfully",
+		Data: map[string]interface{}{
+			"suggestion": sg.Suggestion,
+			"snippet":    snippet,
+		},
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// RejectSuggestion closes a suggestion without applying it
+func (h *Handler) RejectSuggestion(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get suggestion ID from URL parameters
+	vars := mux.Vars(r)
+	suggestionID := vars["id"]
+
+	req, ok := decodeResolveSuggestionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	// Start transaction
+	tx, err := h.DB.Begin()
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to start transaction"))
+		return
+	}
+	defer tx.Rollback()
+
+	sg, ok := lockOpenSuggestion(w, r, tx, suggestionID, "sg.owner_id", userID)
+	if !ok {
+		return
+	}
+
+	if err := resolveSuggestion(tx, &sg.Suggestion, "rejected", req.Message); err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	_, err = notifications.Create(tx, sg.ProposerID, userID, notifications.TypeSuggestionRejected, &sg.SnippetID, map[string]interface{}{
+		"snippet_title": sg.currentTitle,
+		"suggestion_id": sg.ID,
+		"message":       req.Message,
+	})
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to commit transaction"))
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Suggestion rejected successfully",
+		Data:    sg.Suggestion,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// WithdrawSuggestion lets the proposer close their own open suggestion
+func (h *Handler) WithdrawSuggestion(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get suggestion ID from URL parameters
+	vars := mux.Vars(r)
+	suggestionID := vars["id"]
+
+	// Start transaction
+	tx, err := h.DB.Begin()
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to start transaction"))
+		return
+	}
+	defer tx.Rollback()
+
+	sg, ok := lockOpenSuggestion(w, r, tx, suggestionID, "sg.proposer_id", userID)
+	if !ok {
+		return
+	}
+
+	if err := resolveSuggestion(tx, &sg.Suggestion, "withdrawn", ""); err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to commit transaction"))
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Suggestion withdrawn successfully",
+		Data:    sg.Suggestion,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// GetSnippetContributors lists users credited on a public snippet (no authentication required)
+func (h *Handler) GetSnippetContributors(w http.ResponseWriter, r *http.Request) {
+	// Get snippet ID from URL parameters
+	vars := mux.Vars(r)
+	snippetID := vars["id"]
+
+	var exists bool
+	err := h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM snippets WHERE id = $1 AND is_public = true)",
+		snippetID).Scan(&exists)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch snippet"))
+		return
+	}
+	if !exists {
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "Public snippet not found"))
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT user_id, suggestion_id, created_at
+		FROM snippet_contributors
+		WHERE snippet_id = $1
+		ORDER BY created_at`, snippetID)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch contributors"))
+		return
+	}
+	defer rows.Close()
+
+	// initialize as empty slice to avoid null in JSON
+	contributors := make([]models.Contributor, 0)
+	for rows.Next() {
+		var c models.Contributor
+		if err := rows.Scan(&c.UserID, &c.SuggestionID, &c.CreatedAt); err != nil {
+			sendError(w, r, apierror.Wrap(err, "Failed to scan contributor"))
+			return
+		}
+		contributors = append(contributors, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to iterate contributors"))
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Contributors retrieved successfully",
+		Data:    contributors,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// sendSuggestionList runs a suggestion query and writes the result
+func (h *Handler) sendSuggestionList(w http.ResponseWriter, r *http.Request, query string, args ...interface{}) {
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch suggestions"))
+		return
+	}
+	defer rows.Close()
+
+	// initialize as empty slice to avoid null in JSON
+	suggestions := make([]models.Suggestion, 0)
+	for rows.Next() {
+		sg, err := scanSuggestion(rows)
+		if err != nil {
+			sendError(w, r, apierror.Wrap(err, "Failed to scan suggestion"))
+			return
+		}
+		suggestions = append(suggestions, sg.Suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to iterate suggestions"))
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Suggestions retrieved successfully",
+		Data:    suggestions,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSuggestion reads a row selected with suggestionColumns and computes
+// the diff and staleness
+func scanSuggestion(row rowScanner) (suggestionRow, error) {
+	var sg suggestionRow
+	err := row.Scan(&sg.ID, &sg.SnippetID, &sg.OwnerID, &sg.ProposerID, &sg.Title, &sg.Content, &sg.Message,
+		&sg.BaseVersion, &sg.baseTitle, &sg.baseContent, &sg.Status, &sg.ResponseMessage,
+		&sg.ResolvedAt, &sg.CreatedAt, &sg.UpdatedAt, &sg.currentTitle, &sg.currentContent)
+	if err != nil {
+		return sg, err
+	}
+
+	sg.Diff = diff.Unified("a/"+sg.baseTitle, "b/"+sg.Title, sg.baseContent, sg.Content, 3)
+	sg.IsStale = sg.Status == "open" && (sg.currentTitle != sg.baseTitle || sg.currentContent != sg.baseContent)
+	return sg, nil
+}
+
+// lockOpenSuggestion loads an open suggestion where column matches userID
+// and locks it for the rest of the transaction. It writes the error
+// response and returns false on failure.
+func lockOpenSuggestion(w http.ResponseWriter, r *http.Request, tx *sql.Tx, suggestionID, column, userID string) (suggestionRow, bool) {
+	sg, err := scanSuggestion(tx.QueryRow(suggestionColumns+`
+		WHERE sg.id = $1 AND `+column+` = $2
+		FOR UPDATE OF sg`, suggestionID, userID))
+
+	if err == sql.ErrNoRows {
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeSuggestionNotFound, "Suggestion not found"))
+		return sg, false
+	}
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch suggestion"))
+		return sg, false
+	}
+	if sg.Status != "open" {
+		sendError(w, r, apierror.New(http.StatusConflict, apierror.CodeConflict, "Suggestion is already "+sg.Status))
+		return sg, false
+	}
+	return sg, true
+}
+
+// resolveSuggestion closes a suggestion with the given status
+func resolveSuggestion(tx *sql.Tx, sg *models.Suggestion, status, message string) error {
+	now := time.Now()
+	var responseMessage *string
+	if message != "" {
+		responseMessage = &message
+	}
+
+	_, err := tx.Exec(`
+		UPDATE snippet_suggestions
+		SET status = $1, response_message = $2, resolved_at = $3
+		WHERE id = $4`,
+		status, responseMessage, now, sg.ID)
+	if err != nil {
+		return apierror.Wrap(err, "Failed to update suggestion")
+	}
+
+	sg.Status = status
+	sg.ResponseMessage = responseMessage
+	sg.ResolvedAt = &now
+	sg.IsStale = false
+	return nil
+}
+
+// decodeResolveSuggestionRequest parses the optional accept/reject body
+func decodeResolveSuggestionRequest(w http.ResponseWriter, r *http.Request) (models.ResolveSuggestionRequest, bool) {
+	var req models.ResolveSuggestionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		sendError(w, r, apierror.InvalidBody(err))
+		return req, false
+	}
+	return req, true
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"snippy-server/internal/models"
+)
+
+// ownerTables are the rows left behind by a snippet owner in these tests
+var ownerTables = []string{"snippets", "change_events", "change_event_counters", "sync_tombstones", "sync_counters", "notifications"}
+
+// testPublicSnippet creates a public snippet owned by userID
+func testPublicSnippet(t *testing.T, db *sql.DB, userID, title, content string) string {
+	t.Helper()
+	var id string
+	err := db.QueryRow(`
+		INSERT INTO snippets (user_id, title, content, is_public)
+		VALUES ($1, $2, $3, true)
+		RETURNING id`, userID, title, content).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// suggest proposes content as proposer and returns the suggestion
+func suggest(t *testing.T, h *Handler, snippetID, proposer string, baseVersion int, content string) models.Suggestion {
+	t.Helper()
+	body, _ := json.Marshal(models.CreateSuggestionRequest{BaseVersion: baseVersion, Content: &content})
+	w := serveAs(h.CreateSuggestion, proposer, "POST", "/api/snippets/"+snippetID+"/suggestions", string(body), map[string]string{"id": snippetID})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("CreateSuggestion: got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data models.Suggestion `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.Data
+}
+
+// resolve calls an accept/reject/withdraw handler for a suggestion
+func resolve(handler http.HandlerFunc, userID, suggestionID, action string) (int, string) {
+	w := serveAs(handler, userID, "POST", "/api/suggestions/"+suggestionID+"/"+action, "", map[string]string{"id": suggestionID})
+	return w.Code, w.Body.String()
+}
+
+func snippetState(t *testing.T, db *sql.DB, snippetID string) (content string, version int) {
+	t.Helper()
+	if err := db.QueryRow("SELECT content, version FROM snippets WHERE id = $1", snippetID).Scan(&content, &version); err != nil {
+		t.Fatal(err)
+	}
+	return content, version
+}
+
+func TestAcceptSuggestion(t *testing.T) {
+	h := testHandler(t)
+	db := h.DB
+	owner := testUser(t, db, ownerTables...)
+	proposer := testUser(t, db, "notifications")
+	snippetID := testPublicSnippet(t, db, owner, "Greeting", "hello\n")
+
+	sg := suggest(t, h, snippetID, proposer, 1, "hello, world\n")
+
+	// Only the owner may accept
+	if code, body := resolve(h.AcceptSuggestion, proposer, sg.ID, "accept"); code != http.StatusNotFound {
+		t.Errorf("Proposer accepting: got %d: %s", code, body)
+	}
+
+	code, body := resolve(h.AcceptSuggestion, owner, sg.ID, "accept")
+	if code != http.StatusOK {
+		t.Fatalf("Got %d: %s", code, body)
+	}
+	content, version := snippetState(t, db, snippetID)
+	if content != "hello, world\n" || version != 2 {
+		t.Errorf("Snippet is %q at version %d", content, version)
+	}
+
+	var credited bool
+	db.QueryRow("SELECT EXISTS(SELECT 1 FROM snippet_contributors WHERE snippet_id = $1 AND user_id = $2)",
+		snippetID, proposer).Scan(&credited)
+	if !credited {
+		t.Error("Proposer was not credited")
+	}
+
+	if code, _ := resolve(h.AcceptSuggestion, owner, sg.ID, "accept"); code != http.StatusConflict {
+		t.Errorf("Accepting twice: got %d", code)
+	}
+}
+
+func TestAcceptStaleSuggestion(t *testing.T) {
+	h := testHandler(t)
+	db := h.DB
+	owner := testUser(t, db, ownerTables...)
+	proposer := testUser(t, db, "notifications")
+	snippetID := testPublicSnippet(t, db, owner, "Lines", "one\ntwo\nthree\n")
+
+	merges := suggest(t, h, snippetID, proposer, 1, "one\ntwo\nthree, proposed\n")
+	conflicts := suggest(t, h, snippetID, proposer, 1, "one, proposed\ntwo\nthree\n")
+
+	// The owner edits the first line after both suggestions were made
+	if _, err := db.Exec("UPDATE snippets SET content = $1 WHERE id = $2", "one, edited\ntwo\nthree\n", snippetID); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, body := resolve(h.AcceptSuggestion, owner, conflicts.ID, "accept"); code != http.StatusConflict {
+		t.Errorf("Conflicting suggestion: got %d: %s", code, body)
+	}
+	if content, _ := snippetState(t, db, snippetID); content != "one, edited\ntwo\nthree\n" {
+		t.Errorf("Conflicting suggestion changed the snippet to %q", content)
+	}
+
+	if code, body := resolve(h.AcceptSuggestion, owner, merges.ID, "accept"); code != http.StatusOK {
+		t.Fatalf("Mergeable suggestion: got %d: %s", code, body)
+	}
+	content, version := snippetState(t, db, snippetID)
+	if content != "one, edited\ntwo\nthree, proposed\n" {
+		t.Errorf("Merged content is %q", content)
+	}
+	if version != 3 {
+		t.Errorf("Version = %d, want 3", version)
+	}
+}
+
+func TestRejectAndWithdrawSuggestion(t *testing.T) {
+	h := testHandler(t)
+	db := h.DB
+	owner := testUser(t, db, ownerTables...)
+	proposer := testUser(t, db, "notifications")
+	other := testUser(t, db)
+	snippetID := testPublicSnippet(t, db, owner, "Greeting", "hello\n")
+
+	rejected := suggest(t, h, snippetID, proposer, 1, "hi\n")
+	withdrawn := suggest(t, h, snippetID, proposer, 1, "hey\n")
+
+	for _, c := range []struct {
+		name    string
+		handler http.HandlerFunc
+		userID  string
+		id      string
+		action  string
+	}{
+		{"proposer rejecting", h.RejectSuggestion, proposer, rejected.ID, "reject"},
+		{"other user rejecting", h.RejectSuggestion, other, rejected.ID, "reject"},
+		{"owner withdrawing", h.WithdrawSuggestion, owner, withdrawn.ID, "withdraw"},
+		{"other user withdrawing", h.WithdrawSuggestion, other, withdrawn.ID, "withdraw"},
+	} {
+		if code, body := resolve(c.handler, c.userID, c.id, c.action); code != http.StatusNotFound {
+			t.Errorf("%s: got %d: %s", c.name, code, body)
+		}
+	}
+
+	if code, body := resolve(h.RejectSuggestion, owner, rejected.ID, "reject"); code != http.StatusOK {
+		t.Errorf("Reject: got %d: %s", code, body)
+	}
+	if code, body := resolve(h.WithdrawSuggestion, proposer, withdrawn.ID, "withdraw"); code != http.StatusOK {
+		t.Errorf("Withdraw: got %d: %s", code, body)
+	}
+
+	// Closed suggestions can no longer be accepted
+	for _, id := range []string{rejected.ID, withdrawn.ID} {
+		if code, _ := resolve(h.AcceptSuggestion, owner, id, "accept"); code != http.StatusConflict {
+			t.Errorf("Accepting a closed suggestion: got %d", code)
+		}
+	}
+	if content, version := snippetState(t, db, snippetID); content != "hello\n" || version != 1 {
+		t.Errorf("Snippet changed to %q at version %d", content, version)
+	}
+}
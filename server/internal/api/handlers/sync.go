@@ -0,0 +1,714 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/models"
+	"snippy-server/internal/tombstones"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultSyncLimit = 500
+	maxSyncLimit     = 1000
+	// maxSyncMutations bounds one push; each mutation is its own transaction
+	maxSyncMutations = 100
+	// conflictedCopySuffix marks copies made with keep_both
+	conflictedCopySuffix = " (conflicted copy)"
+)
+
+// Entity types reported by delta sync
+const (
+	syncSnippet            = "snippet"
+	syncCollection         = "collection"
+	syncTag                = "tag"
+	syncCollectionPosition = "collection_position"
+	syncSnippetPosition    = "snippet_position"
+)
+
+// Mutation actions, outcomes and conflict resolutions
+const (
+	syncCreate = "create"
+	syncUpdate = "update"
+	syncDelete = "delete"
+
+	syncApplied  = "applied"
+	syncConflict = "conflict"
+	syncFailed   = "failed"
+
+	resolveServerWins = "server_wins"
+	resolveClientWins = "client_wins"
+	resolveKeepBoth   = "keep_both"
+)
+
+// syncTables maps entity types to the tables stamped with sync_seq
+var syncTables = map[string]string{
+	syncSnippet:            "snippets",
+	syncCollection:         "collections",
+	syncTag:                "tags",
+	syncCollectionPosition: "collection_positions",
+	syncSnippetPosition:    "collection_snippet_positions",
+}
+
+// errSyncConflict aborts a mutation whose entity changed after its base_seq
+var errSyncConflict = errors.New("entity changed since base_seq")
+
+// syncQuerier is implemented by both *sql.DB and *sql.Tx
+type syncQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// GetSyncChanges returns what changed for the user after the since token:
+// the current state of created and updated entities and tombstones for
+// deleted ones, ordered by a per-user change sequence rather than clocks.
+// Without a token, or with one older than the retained tombstones, the
+// response starts a full snapshot instead and sets reset.
+func (h *Handler) GetSyncChanges(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Parse query parameters
+	query := r.URL.Query()
+	since, err := parseSyncToken(query.Get("since"))
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+	limit := defaultSyncLimit
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			sendError(w, r, apierror.Invalid("limit", "limit must be a positive integer"))
+			return
+		}
+		limit = min(n, maxSyncLimit)
+	}
+
+	// Read everything from one snapshot so entities match their sequence
+	// numbers
+	tx, err := h.DB.BeginTx(r.Context(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to start transaction"))
+		return
+	}
+	defer tx.Rollback()
+
+	current, pruned, err := tombstones.Bounds(r.Context(), tx, userID)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to read changes"))
+		return
+	}
+
+	result := models.SyncChanges{}
+	if since == 0 || since < pruned || since > current {
+		// Deletions after since may have been pruned, or the token is not
+		// from this server; start over
+		since = 0
+		result.Reset = true
+	}
+
+	changes, err := listSyncChanges(r.Context(), tx, userID, since, limit+1)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to read changes"))
+		return
+	}
+	result.Token = formatSyncToken(current)
+	if len(changes) > limit {
+		changes = changes[:limit]
+		result.HasMore = true
+		result.Token = formatSyncToken(changes[limit-1].Seq)
+	}
+	if err := loadSyncEntities(r.Context(), tx, userID, changes); err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to read changes"))
+		return
+	}
+	result.Changes = changes
+
+	response := models.Response{
+		Success: true,
+		Message: "Changes retrieved successfully",
+		Data:    result,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// PushSyncChanges applies changes made offline in order, each in its own
+// transaction, and reports the outcome of every one. Updates and deletes
+// name the seq they were made against; if the entity changed since, the
+// mutation's on_conflict decides whether the server's version stays, the
+// client's overwrites it, or both are kept as separate entities.
+func (h *Handler) PushSyncChanges(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Parse request body
+	var req models.PushSyncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, apierror.InvalidBody(err))
+		return
+	}
+
+	if len(req.Mutations) == 0 {
+		sendError(w, r, apierror.Invalid("mutations", "No mutations provided"))
+		return
+	}
+	if len(req.Mutations) > maxSyncMutations {
+		sendError(w, r, apierror.Invalid("mutations", fmt.Sprintf("At most %d mutations can be pushed at once", maxSyncMutations)))
+		return
+	}
+
+	results := make([]models.SyncResult, 0, len(req.Mutations))
+	for _, m := range req.Mutations {
+		results = append(results, h.applySyncMutation(r, userID, m))
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Changes pushed successfully",
+		Data:    results,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// parseSyncToken decodes the since parameter; an empty token is zero
+func parseSyncToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+	seq, err := strconv.ParseInt(token, 10, 64)
+	if err != nil || seq < 0 {
+		return 0, apierror.Invalid("since", "since must be a token returned by GET /api/sync")
+	}
+	return seq, nil
+}
+
+// formatSyncToken encodes a sequence number as a token. Clients treat
+// tokens as opaque.
+func formatSyncToken(seq int64) string {
+	return strconv.FormatInt(seq, 10)
+}
+
+// listSyncChanges returns up to limit of userID's changes after since,
+// oldest first, without their entities
+func listSyncChanges(ctx context.Context, q syncQuerier, userID string, since int64, limit int) ([]models.SyncChange, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT entity_type, entity_id, seq, deleted FROM (
+			SELECT 'snippet' AS entity_type, id AS entity_id, sync_seq AS seq, false AS deleted
+			FROM snippets WHERE user_id = $1 AND sync_seq > $2
+			UNION ALL
+			SELECT 'collection', id, sync_seq, false FROM collections WHERE user_id = $1 AND sync_seq > $2
+			UNION ALL
+			SELECT 'tag', id, sync_seq, false FROM tags WHERE user_id = $1 AND sync_seq > $2
+			UNION ALL
+			SELECT 'collection_position', id, sync_seq, false FROM collection_positions WHERE user_id = $1 AND sync_seq > $2
+			UNION ALL
+			SELECT 'snippet_position', id, sync_seq, false FROM collection_snippet_positions WHERE user_id = $1 AND sync_seq > $2
+			UNION ALL
+			SELECT entity_type, entity_id, seq, true FROM sync_tombstones WHERE user_id = $1 AND seq > $2
+		) changes
+		ORDER BY seq
+		LIMIT $3`, userID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := make([]models.SyncChange, 0)
+	for rows.Next() {
+		var c models.SyncChange
+		if err := rows.Scan(&c.EntityType, &c.EntityID, &c.Seq, &c.Deleted); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// loadSyncEntities fills in the entity of every change that is not a
+// deletion
+func loadSyncEntities(ctx context.Context, q syncQuerier, userID string, changes []models.SyncChange) error {
+	ids := make(map[string][]string)
+	index := make(map[string]int)
+	for i, c := range changes {
+		if !c.Deleted {
+			ids[c.EntityType] = append(ids[c.EntityType], c.EntityID)
+			index[c.EntityType+"/"+c.EntityID] = i
+		}
+	}
+	change := func(entityType, id string) *models.SyncChange {
+		return &changes[index[entityType+"/"+id]]
+	}
+
+	for entityType, list := range ids {
+		var err error
+		switch entityType {
+		case syncSnippet:
+			err = eachSyncRow(ctx, q, snippetDetailQuery+"s.user_id = $1 AND s.id = ANY($2::uuid[])", userID, list, func(rows *sql.Rows) error {
+				snippet, err := scanSnippetDetails(rows)
+				change(entityType, snippet.ID).Snippet = &snippet
+				return err
+			})
+		case syncCollection:
+			err = eachSyncRow(ctx, q, `
+				SELECT id, user_id, name, color, created_at, updated_at
+				FROM collections WHERE user_id = $1 AND id = ANY($2::uuid[])`, userID, list, func(rows *sql.Rows) error {
+				var c models.Collection
+				err := rows.Scan(&c.ID, &c.UserID, &c.Name, &c.Color, &c.CreatedAt, &c.UpdatedAt)
+				change(entityType, c.ID).Collection = &c
+				return err
+			})
+		case syncTag:
+			err = eachSyncRow(ctx, q, `
+				SELECT id, name, user_id, created_at, updated_at
+				FROM tags WHERE user_id = $1 AND id = ANY($2::uuid[])`, userID, list, func(rows *sql.Rows) error {
+				var t models.Tag
+				err := rows.Scan(&t.ID, &t.Name, &t.UserID, &t.CreatedAt, &t.UpdatedAt)
+				change(entityType, t.ID).Tag = &t
+				return err
+			})
+		case syncCollectionPosition, syncSnippetPosition:
+			snippetColumn := "NULL"
+			if entityType == syncSnippetPosition {
+				snippetColumn = "snippet_id"
+			}
+			err = eachSyncRow(ctx, q, `
+				SELECT id, collection_id, `+snippetColumn+`, position
+				FROM `+syncTables[entityType]+` WHERE user_id = $1 AND id = ANY($2::uuid[])`, userID, list, func(rows *sql.Rows) error {
+				var id string
+				var p models.SyncPosition
+				err := rows.Scan(&id, &p.CollectionID, &p.SnippetID, &p.Position)
+				change(entityType, id).Position = &p
+				return err
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachSyncRow runs query with userID and ids and calls scan for every row
+func eachSyncRow(ctx context.Context, q syncQuerier, query, userID string, ids []string, scan func(*sql.Rows) error) error {
+	rows, err := q.QueryContext(ctx, query, userID, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// currentSyncChange returns the entity's latest change: its current state,
+// its tombstone, or nil if the user has neither
+func (h *Handler) currentSyncChange(ctx context.Context, userID, entityType, id string) (*models.SyncChange, error) {
+	tx, err := h.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	change := models.SyncChange{EntityType: entityType, EntityID: id}
+	err = tx.QueryRowContext(ctx, `SELECT sync_seq FROM `+syncTables[entityType]+` WHERE id = $1 AND user_id = $2`,
+		id, userID).Scan(&change.Seq)
+	if err == sql.ErrNoRows {
+		change.Deleted = true
+		err = tx.QueryRowContext(ctx, `
+			SELECT seq FROM sync_tombstones
+			WHERE user_id = $1 AND entity_type = $2 AND entity_id = $3`,
+			userID, entityType, id).Scan(&change.Seq)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []models.SyncChange{change}
+	if err := loadSyncEntities(ctx, tx, userID, changes); err != nil {
+		return nil, err
+	}
+	return &changes[0], nil
+}
+
+// checkBaseSeq reports errSyncConflict if the locked row changed after base
+func checkBaseSeq(tx *sql.Tx, table, id string, base int64) error {
+	var seq int64
+	if err := tx.QueryRow(`SELECT sync_seq FROM `+table+` WHERE id = $1`, id).Scan(&seq); err != nil {
+		return apierror.Wrap(err, "Failed to check for conflicts")
+	}
+	if seq > base {
+		return errSyncConflict
+	}
+	return nil
+}
+
+// syncEntity adapts one entity type's create, update and delete paths to
+// mutations. copy, when set, keeps the client's side of an update conflict
+// as a new entity and returns its ID.
+type syncEntity struct {
+	notFound apierror.Code
+	create   func(ctx context.Context, userID, id string, data json.RawMessage) error
+	update   func(ctx context.Context, userID, id string, data json.RawMessage, precondition func(*sql.Tx) error) error
+	remove   func(ctx context.Context, userID, id string, precondition func(*sql.Tx) error) error
+	copy     func(ctx context.Context, userID, id string, data json.RawMessage) (string, error)
+}
+
+// syncEntities returns the paths each entity type's mutations take
+func (h *Handler) syncEntities() map[string]syncEntity {
+	return map[string]syncEntity{
+		syncSnippet: {
+			notFound: apierror.CodeSnippetNotFound,
+			create: func(ctx context.Context, userID, id string, data json.RawMessage) error {
+				var req models.CreateSnippetRequest
+				if err := decodeSyncData(data, &req); err != nil {
+					return err
+				}
+				_, err := h.createSnippet(ctx, userID, id, req)
+				return err
+			},
+			update: func(ctx context.Context, userID, id string, data json.RawMessage, precondition func(*sql.Tx) error) error {
+				var req models.UpdateSnippetRequest
+				if err := decodeSyncData(data, &req); err != nil {
+					return err
+				}
+				_, err := h.updateSnippet(ctx, userID, id, req, func(tx *sql.Tx, _ models.Snippet) error {
+					return precondition(tx)
+				})
+				return err
+			},
+			remove: h.deleteSnippet,
+			copy:   h.copySnippetForSync,
+		},
+		syncCollection: {
+			notFound: apierror.CodeCollectionNotFound,
+			create: func(ctx context.Context, userID, id string, data json.RawMessage) error {
+				var req models.CreateCollectionRequest
+				if err := decodeSyncData(data, &req); err != nil {
+					return err
+				}
+				_, err := h.createCollection(ctx, userID, id, req)
+				return err
+			},
+			update: func(ctx context.Context, userID, id string, data json.RawMessage, precondition func(*sql.Tx) error) error {
+				var req models.UpdateCollectionRequest
+				if err := decodeSyncData(data, &req); err != nil {
+					return err
+				}
+				_, err := h.updateCollection(ctx, userID, id, req, func(tx *sql.Tx, _ models.Collection) error {
+					return precondition(tx)
+				})
+				return err
+			},
+			remove: func(ctx context.Context, userID, id string, precondition func(*sql.Tx) error) error {
+				_, err := h.deleteCollection(ctx, userID, id, precondition)
+				return err
+			},
+			copy: h.copyCollectionForSync,
+		},
+		syncTag: {
+			notFound: apierror.CodeTagNotFound,
+			create: func(ctx context.Context, userID, id string, data json.RawMessage) error {
+				var req models.CreateTagRequest
+				if err := decodeSyncData(data, &req); err != nil {
+					return err
+				}
+				_, err := h.createTag(ctx, userID, id, req)
+				return err
+			},
+			update: func(ctx context.Context, userID, id string, data json.RawMessage, precondition func(*sql.Tx) error) error {
+				var req models.UpdateTagRequest
+				if err := decodeSyncData(data, &req); err != nil {
+					return err
+				}
+				_, err := h.updateTag(ctx, userID, id, req, func(tx *sql.Tx, _ models.Tag) error {
+					return precondition(tx)
+				})
+				return err
+			},
+			remove: func(ctx context.Context, userID, id string, precondition func(*sql.Tx) error) error {
+				_, err := h.deleteTag(ctx, userID, id, precondition)
+				return err
+			},
+			// Tag names are unique, so a copy would only clash with the original
+		},
+	}
+}
+
+// decodeSyncData decodes a mutation's data into the request model of its
+// entity
+func decodeSyncData(data json.RawMessage, v interface{}) error {
+	if len(data) == 0 {
+		return apierror.Invalid("data", "data is required")
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return apierror.Invalid("data", "Invalid data: "+err.Error())
+	}
+	return nil
+}
+
+// applySyncMutation applies one mutation and describes the outcome
+func (h *Handler) applySyncMutation(r *http.Request, userID string, m models.SyncMutation) models.SyncResult {
+	ctx := r.Context()
+	result := models.SyncResult{EntityType: m.EntityType, EntityID: m.EntityID, Status: syncApplied}
+	fail := func(err error) models.SyncResult {
+		problem := apierror.Describe(r, err)
+		result.Status = syncFailed
+		result.Error = &problem
+		return result
+	}
+
+	onConflict := m.OnConflict
+	switch onConflict {
+	case "":
+		onConflict = resolveServerWins
+	case resolveServerWins, resolveClientWins, resolveKeepBoth:
+	default:
+		return fail(apierror.Invalid("on_conflict", "on_conflict must be server_wins, client_wins or keep_both"))
+	}
+
+	if m.EntityType == syncCollectionPosition || m.EntityType == syncSnippetPosition {
+		return h.applyPositionMutation(r, userID, m, result, fail)
+	}
+	entity, ok := h.syncEntities()[m.EntityType]
+	if !ok {
+		return fail(apierror.Invalid("entity_type", "Unknown entity_type "+strconv.Quote(m.EntityType)))
+	}
+	if _, err := uuid.Parse(m.EntityID); err != nil {
+		return fail(apierror.Invalid("entity_id", "entity_id must be a UUID"))
+	}
+
+	// Entities changed after base_seq conflict; client_wins goes ahead
+	// anyway but still reports the conflict
+	overridden := false
+	precondition := func(tx *sql.Tx) error {
+		err := checkBaseSeq(tx, syncTables[m.EntityType], m.EntityID, m.BaseSeq)
+		if err == errSyncConflict && onConflict == resolveClientWins {
+			overridden = true
+			return nil
+		}
+		return err
+	}
+
+	var err error
+	switch m.Action {
+	case syncCreate:
+		current, err := h.currentSyncChange(ctx, userID, m.EntityType, m.EntityID)
+		if err != nil {
+			return fail(apierror.Wrap(err, "Failed to check for conflicts"))
+		}
+		if current != nil && !current.Deleted {
+			// Created by an earlier push whose response was lost
+			result.Change = current
+			return result
+		}
+		if current != nil {
+			// Deleted on another device after an earlier push created it
+			result.Status = syncConflict
+			result.Resolution = resolveServerWins
+			result.Change = current
+			return result
+		}
+		if err := entity.create(ctx, userID, m.EntityID, m.Data); err != nil {
+			return fail(err)
+		}
+	case syncUpdate:
+		err = entity.update(ctx, userID, m.EntityID, m.Data, precondition)
+	case syncDelete:
+		err = entity.remove(ctx, userID, m.EntityID, precondition)
+	default:
+		return fail(apierror.Invalid("action", "action must be create, update or delete"))
+	}
+
+	var apiErr *apierror.Error
+	var missing error
+	switch {
+	case errors.Is(err, errSyncConflict):
+		result.Status = syncConflict
+		result.Resolution = resolveServerWins
+		if onConflict == resolveKeepBoth && m.Action == syncUpdate && entity.copy != nil {
+			copyID, err := entity.copy(ctx, userID, m.EntityID, m.Data)
+			if err != nil {
+				return fail(err)
+			}
+			if result.Copy, err = h.currentSyncChange(ctx, userID, m.EntityType, copyID); err != nil {
+				return fail(apierror.Wrap(err, "Failed to fetch the copy"))
+			}
+			result.Resolution = resolveKeepBoth
+		}
+	case errors.As(err, &apiErr) && apiErr.Code == entity.notFound && m.Action == syncDelete:
+		// Already deleted
+	case errors.As(err, &apiErr) && apiErr.Code == entity.notFound:
+		// Updates to entities deleted elsewhere cannot recreate them,
+		// as they may only carry some fields
+		result.Status = syncConflict
+		result.Resolution = resolveServerWins
+		missing = err
+	case err != nil:
+		return fail(err)
+	case overridden:
+		result.Status = syncConflict
+		result.Resolution = resolveClientWins
+	}
+
+	result.Change, err = h.currentSyncChange(ctx, userID, m.EntityType, m.EntityID)
+	if err != nil {
+		return fail(apierror.Wrap(err, "Failed to fetch the result"))
+	}
+	if result.Change == nil && missing != nil {
+		// Not deleted elsewhere, just never there
+		return fail(missing)
+	}
+	return result
+}
+
+// applyPositionMutation places a collection or a snippet within a
+// collection. Positions are always applied, the last push winning.
+func (h *Handler) applyPositionMutation(r *http.Request, userID string, m models.SyncMutation, result models.SyncResult, fail func(error) models.SyncResult) models.SyncResult {
+	if m.Action != syncCreate && m.Action != syncUpdate {
+		return fail(apierror.Invalid("action", "Positions can only be created or updated"))
+	}
+	var pos models.SyncPosition
+	if err := decodeSyncData(m.Data, &pos); err != nil {
+		return fail(err)
+	}
+	if m.EntityType == syncSnippetPosition && pos.SnippetID == nil {
+		return fail(apierror.Invalid("data.snippet_id", "snippet_id is required for snippet positions"))
+	}
+
+	// Start transaction
+	tx, err := h.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		return fail(apierror.Wrap(err, "Failed to start transaction"))
+	}
+	defer tx.Rollback()
+
+	if m.EntityType == syncCollectionPosition {
+		result.EntityID, err = setCollectionPosition(tx, userID, pos.CollectionID, pos.Position)
+	} else {
+		result.EntityID, err = setSnippetPosition(tx, userID, pos.CollectionID, *pos.SnippetID, pos.Position)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return fail(apierror.Wrap(err, "Failed to commit transaction"))
+	}
+
+	if result.Change, err = h.currentSyncChange(r.Context(), userID, m.EntityType, result.EntityID); err != nil {
+		return fail(apierror.Wrap(err, "Failed to fetch the result"))
+	}
+	return result
+}
+
+// copySnippetForSync saves the client's side of a conflicting snippet
+// update as a new private snippet: the server's copy with the update
+// applied
+func (h *Handler) copySnippetForSync(ctx context.Context, userID, snippetID string, data json.RawMessage) (string, error) {
+	var req models.UpdateSnippetRequest
+	if err := decodeSyncData(data, &req); err != nil {
+		return "", err
+	}
+	existing, err := loadSnippetDetails(h.DB, "s.id = $1 AND s.user_id = $2", snippetID, userID)
+	if err == sql.ErrNoRows {
+		return "", apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "Snippet not found")
+	}
+	if err != nil {
+		return "", apierror.Wrap(err, "Failed to fetch snippet")
+	}
+
+	copied := snippetCopyRequest(existing, req)
+	copyID := uuid.New().String()
+	if _, err := h.createSnippet(ctx, userID, copyID, copied); err != nil {
+		return "", err
+	}
+	return copyID, nil
+}
+
+// snippetCopyRequest overlays update on the server's snippet, marking the
+// title. Copies start private so a conflict cannot publish anything.
+func snippetCopyRequest(existing models.Snippet, update models.UpdateSnippetRequest) models.CreateSnippetRequest {
+	req := models.CreateSnippetRequest{
+		Title:         existing.Title,
+		Content:       existing.Content,
+		CollectionIDs: existing.CollectionIDs,
+		TagIDs:        existing.TagIDs,
+		IsFavorite:    existing.IsFavorite,
+	}
+	if update.Title != nil {
+		req.Title = *update.Title
+	}
+	if update.Content != nil {
+		req.Content = *update.Content
+	}
+	if update.CollectionIDs != nil {
+		req.CollectionIDs = update.CollectionIDs
+	}
+	if update.TagIDs != nil {
+		req.TagIDs = update.TagIDs
+	}
+	if update.IsFavorite != nil {
+		req.IsFavorite = *update.IsFavorite
+	}
+	req.Title += conflictedCopySuffix
+	return req
+}
+
+// copyCollectionForSync saves the client's side of a conflicting collection
+// update as a new collection
+func (h *Handler) copyCollectionForSync(ctx context.Context, userID, collectionID string, data json.RawMessage) (string, error) {
+	var req models.UpdateCollectionRequest
+	if err := decodeSyncData(data, &req); err != nil {
+		return "", err
+	}
+	existing, err := loadCollection(h.DB, collectionID, userID, false)
+	if err == sql.ErrNoRows {
+		return "", apierror.New(http.StatusNotFound, apierror.CodeCollectionNotFound, "Collection not found")
+	}
+	if err != nil {
+		return "", apierror.Wrap(err, "Failed to fetch collection")
+	}
+
+	copied := models.CreateCollectionRequest{Name: existing.Name, Color: existing.Color}
+	if req.Name != nil {
+		copied.Name = *req.Name
+	}
+	if req.Color != nil {
+		copied.Color = *req.Color
+	}
+	copied.Name += conflictedCopySuffix
+
+	copyID := uuid.New().String()
+	if _, err := h.createCollection(ctx, userID, copyID, copied); err != nil {
+		return "", err
+	}
+	return copyID, nil
+}
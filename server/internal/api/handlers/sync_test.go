@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"snippy-server/internal/config"
+	"snippy-server/internal/models"
+)
+
+func TestParseSyncToken(t *testing.T) {
+	if seq, err := parseSyncToken(""); err != nil || seq != 0 {
+		t.Errorf("An empty token should start over: got %d %v", seq, err)
+	}
+	if seq, err := parseSyncToken(formatSyncToken(42)); err != nil || seq != 42 {
+		t.Errorf("Got %d %v", seq, err)
+	}
+	for _, bad := range []string{"abc", "-1", "1.5"} {
+		if _, err := parseSyncToken(bad); err == nil {
+			t.Errorf("%q should be rejected", bad)
+		}
+	}
+}
+
+func TestSnippetCopyRequest(t *testing.T) {
+	existing := models.Snippet{
+		Title: "Server", Content: "server content", IsPublic: true,
+		CollectionIDs: []string{"c1"}, TagIDs: []string{"t1"},
+	}
+	title, favorite := "Client", true
+	req := snippetCopyRequest(existing, models.UpdateSnippetRequest{Title: &title, IsFavorite: &favorite})
+
+	if req.Title != "Client"+conflictedCopySuffix {
+		t.Errorf("Got title %q", req.Title)
+	}
+	if req.Content != "server content" || len(req.CollectionIDs) != 1 || len(req.TagIDs) != 1 {
+		t.Errorf("Fields the client did not change should come from the server: %+v", req)
+	}
+	if !req.IsFavorite {
+		t.Error("The client's changes should apply")
+	}
+	if req.IsPublic {
+		t.Error("Copies should start private")
+	}
+}
+
+func TestApplySyncMutationRejectsInvalidMutations(t *testing.T) {
+	const id = "6f1c2a8e-3b4d-4c5e-8f90-1a2b3c4d5e6f"
+	h := New(nil, nil, config.Default())
+	for _, c := range []struct {
+		name     string
+		mutation models.SyncMutation
+		field    string
+	}{
+		{"unknown entity", models.SyncMutation{EntityType: "user", EntityID: id, Action: syncUpdate}, "entity_type"},
+		{"bad id", models.SyncMutation{EntityType: syncSnippet, EntityID: "1", Action: syncUpdate}, "entity_id"},
+		{"bad action", models.SyncMutation{EntityType: syncTag, EntityID: id, Action: "rename"}, "action"},
+		{"bad resolution", models.SyncMutation{EntityType: syncSnippet, EntityID: id, Action: syncDelete, OnConflict: "merge"}, "on_conflict"},
+		{"deleting a position", models.SyncMutation{EntityType: syncCollectionPosition, Action: syncDelete}, "action"},
+		{"snippet position without snippet", models.SyncMutation{
+			EntityType: syncSnippetPosition, Action: syncUpdate,
+			Data: json.RawMessage(`{"collection_id":"` + id + `","position":1}`),
+		}, "data.snippet_id"},
+	} {
+		r := httptest.NewRequest("POST", "/api/sync", nil)
+		result := h.applySyncMutation(r, "user-1", c.mutation)
+		if result.Status != syncFailed || result.Error == nil {
+			t.Errorf("%s: got %+v", c.name, result)
+			continue
+		}
+		if len(result.Error.Details) != 1 || result.Error.Details[0].Field != c.field {
+			t.Errorf("%s: got details %+v", c.name, result.Error.Details)
+		}
+		if result.EntityType != c.mutation.EntityType {
+			t.Errorf("%s: the result should name the mutation's entity", c.name)
+		}
+	}
+}
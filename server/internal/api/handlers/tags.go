@@ -1,109 +1,113 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"snippy-server/internal/database"
+	"snippy-server/internal/apierror"
 	"snippy-server/internal/models"
 )
 
 // CreateTag creates a new tag for the authenticated user
-func CreateTag(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateTag(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
 	userID := r.Context().Value("user_id").(string)
 
 	// Parse request body
 	var req models.CreateTagRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		sendError(w, r, apierror.InvalidBody(err))
 		return
 	}
 
+	tag, err := h.createTag(r.Context(), userID, uuid.New().String(), req)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Tag created successfully",
+		Data:    tag,
+	}
+
+	slog.DebugContext(r.Context(), "tag created", "tag_id", tag.ID)
+	sendJSON(w, http.StatusCreated, response)
+}
+
+// createTag validates req and creates it as tagID for userID. Names are
+// unique per user, ignoring case.
+func (h *Handler) createTag(ctx context.Context, userID, tagID string, req models.CreateTagRequest) (models.Tag, error) {
 	// Validate required fields
 	if req.Name == "" {
-		sendError(w, http.StatusBadRequest, "Tag name is required")
-		return
+		return models.Tag{}, apierror.Invalid("name", "Tag name is required")
 	}
 
 	// Normalize tag name (trim whitespace, convert to lowercase)
 	tagName := strings.TrimSpace(strings.ToLower(req.Name))
 	if tagName == "" {
-		sendError(w, http.StatusBadRequest, "Tag name cannot be empty")
-		return
+		return models.Tag{}, apierror.Invalid("name", "Tag name cannot be empty")
 	}
 
 	// Check if tag already exists for this user (case-insensitive)
 	var existingTagID string
-	err := database.GetDB().QueryRow(`
+	err := h.DB.QueryRowContext(ctx, `
 		SELECT id FROM tags 
 		WHERE LOWER(name) = LOWER($1) AND user_id = $2`,
 		tagName, userID).Scan(&existingTagID)
 
 	if err == nil {
 		// Tag already exists
-		sendError(w, http.StatusConflict, "Tag with this name already exists")
-		return
+		return models.Tag{}, apierror.New(http.StatusConflict, apierror.CodeConflict, "Tag with this name already exists")
 	} else if err != sql.ErrNoRows {
 		// Database error
-		sendError(w, http.StatusInternalServerError, "Failed to check tag existence: "+err.Error())
-		return
+		return models.Tag{}, apierror.Wrap(err, "Failed to check tag existence")
 	}
 
-	// Generate UUID for tag
-	tagID := uuid.New().String()
 	now := time.Now()
 
 	// Insert tag into database (provide default color)
-	_, err = database.GetDB().Exec(`
+	_, err = h.DB.ExecContext(ctx, `
 		INSERT INTO tags (id, name, user_id, color, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6)`,
 		tagID, tagName, userID, "#3b82f6", now, now)
 
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to create tag: "+err.Error())
-		return
+		return models.Tag{}, apierror.Wrap(err, "Failed to create tag")
 	}
 
 	// Create response
-	tag := models.Tag{
+	return models.Tag{
 		ID:        tagID,
 		Name:      tagName,
 		UserID:    userID,
 		CreatedAt: now,
 		UpdatedAt: now,
-	}
-
-	response := models.Response{
-		Success: true,
-		Message: "Tag created successfully",
-		Data:    tag,
-	}
-
-	log.Printf("✅ Tag created: %s (ID: %s) for user: %s", tagName, tagID, userID)
-	sendJSON(w, http.StatusCreated, response)
+	}, nil
 }
 
 // GetTags retrieves all tags for the authenticated user
-func GetTags(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetTags(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
 	userID := r.Context().Value("user_id").(string)
 
 	// Query tags from database
-	rows, err := database.GetDB().Query(`
+	rows, err := h.DB.Query(`
 		SELECT id, name, user_id, created_at, updated_at
 		FROM tags
 		WHERE user_id = $1`, userID)
 
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to fetch tags: "+err.Error())
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch tags"))
 		return
 	}
 	defer rows.Close()
@@ -114,18 +118,17 @@ func GetTags(w http.ResponseWriter, r *http.Request) {
 		var t models.Tag
 		err := rows.Scan(&t.ID, &t.Name, &t.UserID, &t.CreatedAt, &t.UpdatedAt)
 		if err != nil {
-			sendError(w, http.StatusInternalServerError, "Failed to scan tag: "+err.Error())
+			sendError(w, r, apierror.Wrap(err, "Failed to scan tag"))
 			return
 		}
 		tags = append(tags, t)
 	}
 
 	if err = rows.Err(); err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to iterate tags: "+err.Error())
+		sendError(w, r, apierror.Wrap(err, "Failed to iterate tags"))
 		return
 	}
 
-	log.Println("tags: ", tags)
 	response := models.Response{
 		Success: true,
 		Message: "Tags retrieved successfully",
@@ -136,7 +139,7 @@ func GetTags(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateTag updates an existing tag
-func UpdateTag(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateTag(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
 	userID := r.Context().Value("user_id").(string)
 
@@ -147,90 +150,113 @@ func UpdateTag(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
 	var req models.UpdateTagRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		sendError(w, r, apierror.InvalidBody(err))
+		return
+	}
+
+	updatedTag, err := h.updateTag(r.Context(), userID, tagID, req, nil)
+	if err != nil {
+		sendError(w, r, err)
 		return
 	}
 
+	response := models.Response{
+		Success: true,
+		Message: "Tag updated successfully",
+		Data:    updatedTag,
+	}
+
+	slog.DebugContext(r.Context(), "tag updated", "tag_id", tagID)
+	sendJSON(w, http.StatusOK, response)
+}
+
+// updateTag renames a tag of userID. The tag stays locked while
+// precondition inspects the current copy; an error from it aborts the
+// update.
+func (h *Handler) updateTag(ctx context.Context, userID, tagID string, req models.UpdateTagRequest, precondition func(*sql.Tx, models.Tag) error) (models.Tag, error) {
 	// Validate required fields
 	if req.Name == "" {
-		sendError(w, http.StatusBadRequest, "Tag name is required")
-		return
+		return models.Tag{}, apierror.Invalid("name", "Tag name is required")
 	}
 
 	// Normalize tag name
 	tagName := strings.TrimSpace(strings.ToLower(req.Name))
 	if tagName == "" {
-		sendError(w, http.StatusBadRequest, "Tag name cannot be empty")
-		return
+		return models.Tag{}, apierror.Invalid("name", "Tag name cannot be empty")
 	}
 
+	// Start transaction
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Tag{}, apierror.Wrap(err, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+
 	// Check if tag exists and belongs to user
 	var existingTag models.Tag
-	err := database.GetDB().QueryRow(`
+	err = tx.QueryRowContext(ctx, `
 		SELECT id, name, user_id, created_at, updated_at
 		FROM tags
-		WHERE id = $1 AND user_id = $2`,
+		WHERE id = $1 AND user_id = $2
+		FOR UPDATE`,
 		tagID, userID).Scan(&existingTag.ID, &existingTag.Name, &existingTag.UserID, &existingTag.CreatedAt, &existingTag.UpdatedAt)
 
 	if err == sql.ErrNoRows {
-		sendError(w, http.StatusNotFound, "Tag not found")
-		return
+		return models.Tag{}, apierror.New(http.StatusNotFound, apierror.CodeTagNotFound, "Tag not found")
 	} else if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to fetch tag: "+err.Error())
-		return
+		return models.Tag{}, apierror.Wrap(err, "Failed to fetch tag")
+	}
+
+	if precondition != nil {
+		if err := precondition(tx, existingTag); err != nil {
+			return models.Tag{}, err
+		}
 	}
 
 	// Check if new name conflicts with existing tag (case-insensitive)
 	var conflictingTagID string
-	err = database.GetDB().QueryRow(`
+	err = tx.QueryRowContext(ctx, `
 		SELECT id FROM tags 
 		WHERE LOWER(name) = LOWER($1) AND user_id = $2 AND id != $3`,
 		tagName, userID, tagID).Scan(&conflictingTagID)
 
 	if err == nil {
 		// Tag name conflicts with another tag
-		sendError(w, http.StatusConflict, "Tag with this name already exists")
-		return
+		return models.Tag{}, apierror.New(http.StatusConflict, apierror.CodeConflict, "Tag with this name already exists")
 	} else if err != sql.ErrNoRows {
 		// Database error
-		sendError(w, http.StatusInternalServerError, "Failed to check tag name conflict: "+err.Error())
-		return
+		return models.Tag{}, apierror.Wrap(err, "Failed to check tag name conflict")
 	}
 
 	// Update tag in database
 	now := time.Now()
-	_, err = database.GetDB().Exec(`
+	_, err = tx.ExecContext(ctx, `
 		UPDATE tags 
 		SET name = $1, updated_at = $2
 		WHERE id = $3 AND user_id = $4`,
 		tagName, now, tagID, userID)
 
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to update tag: "+err.Error())
-		return
+		return models.Tag{}, apierror.Wrap(err, "Failed to update tag")
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		return models.Tag{}, apierror.Wrap(err, "Failed to commit transaction")
 	}
 
 	// Create response
-	updatedTag := models.Tag{
+	return models.Tag{
 		ID:        tagID,
 		Name:      tagName,
 		UserID:    userID,
 		CreatedAt: existingTag.CreatedAt,
 		UpdatedAt: now,
-	}
-
-	response := models.Response{
-		Success: true,
-		Message: "Tag updated successfully",
-		Data:    updatedTag,
-	}
-
-	log.Printf("✅ Tag updated: %s (ID: %s) for user: %s", tagName, tagID, userID)
-	sendJSON(w, http.StatusOK, response)
+	}, nil
 }
 
 // DeleteTag deletes a tag and removes it from all snippets
-func DeleteTag(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteTag(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
 	userID := r.Context().Value("user_id").(string)
 
@@ -238,64 +264,80 @@ func DeleteTag(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	tagID := vars["id"]
 
+	tagName, err := h.deleteTag(r.Context(), userID, tagID, nil)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Tag deleted successfully",
+		Data: map[string]interface{}{
+			"deleted_tag_id":   tagID,
+			"deleted_tag_name": tagName,
+		},
+	}
+
+	slog.DebugContext(r.Context(), "tag deleted", "tag_id", tagID)
+	sendJSON(w, http.StatusOK, response)
+}
+
+// deleteTag deletes a tag of userID and removes it from their snippets,
+// returning its name. The tag stays locked while precondition runs; an
+// error from it aborts the deletion.
+func (h *Handler) deleteTag(ctx context.Context, userID, tagID string, precondition func(*sql.Tx) error) (string, error) {
+	// Start transaction
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", apierror.Wrap(err, "Failed to start transaction")
+	}
+	defer tx.Rollback()
+
 	// Check if tag exists and belongs to user
 	var tagName string
-	err := database.GetDB().QueryRow(`
+	err = tx.QueryRowContext(ctx, `
 		SELECT name FROM tags
-		WHERE id = $1 AND user_id = $2`,
+		WHERE id = $1 AND user_id = $2
+		FOR UPDATE`,
 		tagID, userID).Scan(&tagName)
 
 	if err == sql.ErrNoRows {
-		sendError(w, http.StatusNotFound, "Tag not found")
-		return
+		return "", apierror.New(http.StatusNotFound, apierror.CodeTagNotFound, "Tag not found")
 	} else if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to fetch tag: "+err.Error())
-		return
+		return "", apierror.Wrap(err, "Failed to fetch tag")
 	}
 
-	// Start transaction
-	tx, err := database.GetDB().Begin()
-	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to start transaction: "+err.Error())
-		return
+	if precondition != nil {
+		if err := precondition(tx); err != nil {
+			return "", err
+		}
 	}
-	defer tx.Rollback()
 
-	// Delete tag from all snippets (snippet_tags table)
-	_, err = tx.Exec(`DELETE FROM snippet_tags WHERE tag_id = $1`, tagID)
+	// Remove the tag from the user's snippets
+	_, err = tx.ExecContext(ctx, `
+		UPDATE snippets SET tag_ids = array_remove(tag_ids, $1::uuid)
+		WHERE user_id = $2 AND $1::uuid = ANY(tag_ids)`, tagID, userID)
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to remove tag from snippets: "+err.Error())
-		return
+		return "", apierror.Wrap(err, "Failed to remove tag from snippets")
 	}
 
 	// Delete the tag
-	_, err = tx.Exec(`DELETE FROM tags WHERE id = $1 AND user_id = $2`, tagID, userID)
+	_, err = tx.ExecContext(ctx, `DELETE FROM tags WHERE id = $1 AND user_id = $2`, tagID, userID)
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to delete tag: "+err.Error())
-		return
+		return "", apierror.Wrap(err, "Failed to delete tag")
 	}
 
 	// Commit transaction
 	if err = tx.Commit(); err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to commit transaction: "+err.Error())
-		return
+		return "", apierror.Wrap(err, "Failed to commit transaction")
 	}
 
-	response := models.Response{
-		Success: true,
-		Message: "Tag deleted successfully",
-		Data: map[string]interface{}{
-			"deleted_tag_id":   tagID,
-			"deleted_tag_name": tagName,
-		},
-	}
-
-	log.Printf("🗑️ Tag deleted: %s (ID: %s) for user: %s", tagName, tagID, userID)
-	sendJSON(w, http.StatusOK, response)
+	return tagName, nil
 }
 
 // AssignTagsToSnippet assigns tags to a snippet
-func AssignTagsToSnippet(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AssignTagsToSnippet(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context
 	userID := r.Context().Value("user_id").(string)
 
@@ -306,29 +348,29 @@ func AssignTagsToSnippet(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
 	var req models.AssignTagsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		sendError(w, r, apierror.InvalidBody(err))
 		return
 	}
 
 	// Check if snippet exists and belongs to user
 	var snippetTitle string
-	err := database.GetDB().QueryRow(`
+	err := h.DB.QueryRow(`
 		SELECT title FROM snippets
 		WHERE id = $1 AND user_id = $2`,
 		snippetID, userID).Scan(&snippetTitle)
 
 	if err == sql.ErrNoRows {
-		sendError(w, http.StatusNotFound, "Snippet not found")
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "Snippet not found"))
 		return
 	} else if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to fetch snippet: "+err.Error())
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch snippet"))
 		return
 	}
 
 	// Start transaction
-	tx, err := database.GetDB().Begin()
+	tx, err := h.DB.Begin()
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to start transaction: "+err.Error())
+		sendError(w, r, apierror.Wrap(err, "Failed to start transaction"))
 		return
 	}
 	defer tx.Rollback()
@@ -336,7 +378,7 @@ func AssignTagsToSnippet(w http.ResponseWriter, r *http.Request) {
 	// Remove existing tag assignments
 	_, err = tx.Exec(`DELETE FROM snippet_tags WHERE snippet_id = $1`, snippetID)
 	if err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to remove existing tag assignments: "+err.Error())
+		sendError(w, r, apierror.Wrap(err, "Failed to remove existing tag assignments"))
 		return
 	}
 
@@ -358,7 +400,7 @@ func AssignTagsToSnippet(w http.ResponseWriter, r *http.Request) {
 
 		rows, err := tx.Query(query, args...)
 		if err != nil {
-			sendError(w, http.StatusInternalServerError, "Failed to verify tags: "+err.Error())
+			sendError(w, r, apierror.Wrap(err, "Failed to verify tags"))
 			return
 		}
 		defer rows.Close()
@@ -367,7 +409,7 @@ func AssignTagsToSnippet(w http.ResponseWriter, r *http.Request) {
 		for rows.Next() {
 			var tagID string
 			if err := rows.Scan(&tagID); err != nil {
-				sendError(w, http.StatusInternalServerError, "Failed to scan tag ID: "+err.Error())
+				sendError(w, r, apierror.Wrap(err, "Failed to scan tag ID"))
 				return
 			}
 			validTagIDs = append(validTagIDs, tagID)
@@ -380,7 +422,7 @@ func AssignTagsToSnippet(w http.ResponseWriter, r *http.Request) {
 				VALUES ($1, $2, $3)`,
 				snippetID, tagID, time.Now())
 			if err != nil {
-				sendError(w, http.StatusInternalServerError, "Failed to assign tag: "+err.Error())
+				sendError(w, r, apierror.Wrap(err, "Failed to assign tag"))
 				return
 			}
 		}
@@ -388,7 +430,7 @@ func AssignTagsToSnippet(w http.ResponseWriter, r *http.Request) {
 
 	// Commit transaction
 	if err = tx.Commit(); err != nil {
-		sendError(w, http.StatusInternalServerError, "Failed to commit transaction: "+err.Error())
+		sendError(w, r, apierror.Wrap(err, "Failed to commit transaction"))
 		return
 	}
 
@@ -401,6 +443,6 @@ func AssignTagsToSnippet(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	log.Printf("🏷️ Tags assigned to snippet: %s (ID: %s) for user: %s", snippetTitle, snippetID, userID)
+	slog.DebugContext(r.Context(), "tags assigned", "snippet_id", snippetID, "tags", len(req.TagIDs))
 	sendJSON(w, http.StatusOK, response)
 }
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+// TestRenamingTagChangesSnippetETag checks that a snippet's ETag follows
+// its tag names, which change without a version bump
+func TestRenamingTagChangesSnippetETag(t *testing.T) {
+	h := testHandler(t)
+	owner := testUser(t, h.DB, append(ownerTables, "tags")...)
+	var tagID, snippetID string
+	if err := h.DB.QueryRow("INSERT INTO tags (name, user_id) VALUES ('golang', $1) RETURNING id", owner).Scan(&tagID); err != nil {
+		t.Fatal(err)
+	}
+	err := h.DB.QueryRow(`
+		INSERT INTO snippets (user_id, title, content, is_public, tag_ids)
+		VALUES ($1, 'main.go', 'package main', true, ARRAY[$2::uuid])
+		RETURNING id`, owner, tagID).Scan(&snippetID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]string{"id": snippetID}
+
+	before := getPublic(h.GetPublicSnippet, "/api/snippets/public/"+snippetID, vars).Header().Get("ETag")
+	w := serveAs(h.UpdateTag, owner, "PUT", "/api/tags/"+tagID, `{"name":"go"}`, map[string]string{"id": tagID})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Renaming the tag: got %d: %s", w.Code, w.Body.String())
+	}
+
+	after := getPublic(h.GetPublicSnippet, "/api/snippets/public/"+snippetID, vars).Header().Get("ETag")
+	if after == "" || after == before {
+		t.Errorf("ETag %q did not change after renaming a tag", after)
+	}
+}
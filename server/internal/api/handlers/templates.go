@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/metrics"
+	"snippy-server/internal/models"
+	"snippy-server/internal/scanner"
+	"snippy-server/internal/templates"
+	"snippy-server/internal/webhooks"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// GetSnippetPlaceholders lists the placeholders declared in a snippet the
+// user owns or that is public
+func (h *Handler) GetSnippetPlaceholders(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get snippet ID from URL parameters
+	vars := mux.Vars(r)
+	snippetID := vars["id"]
+
+	source, tmpl, ok := h.loadTemplate(w, r, snippetID, userID)
+	if !ok {
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Placeholders retrieved successfully",
+		Data: map[string]interface{}{
+			"snippet_id":   source.ID,
+			"placeholders": placeholderList(tmpl),
+		},
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// RenderSnippet validates the supplied values and returns the expanded
+// snippet content without storing anything
+func (h *Handler) RenderSnippet(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get snippet ID from URL parameters
+	vars := mux.Vars(r)
+	snippetID := vars["id"]
+
+	var req models.RenderTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, apierror.InvalidBody(err))
+		return
+	}
+
+	_, tmpl, ok := h.loadTemplate(w, r, snippetID, userID)
+	if !ok {
+		return
+	}
+
+	content, ok := renderTemplate(w, r, tmpl, req.Values, req.Language)
+	if !ok {
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Snippet rendered successfully",
+		Data: map[string]interface{}{
+			"content":      content,
+			"placeholders": placeholderList(tmpl),
+		},
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// CreateSnippetFromTemplate renders a template and stores the result as a
+// new snippet owned by the user and linked to the template
+func (h *Handler) CreateSnippetFromTemplate(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get template ID from URL parameters
+	vars := mux.Vars(r)
+	templateID := vars["id"]
+
+	var req models.CreateFromTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, apierror.InvalidBody(err))
+		return
+	}
+
+	source, tmpl, ok := h.loadTemplate(w, r, templateID, userID)
+	if !ok {
+		return
+	}
+
+	content, ok := renderTemplate(w, r, tmpl, req.Values, req.Language)
+	if !ok {
+		return
+	}
+
+	title := req.Title
+	if title == "" {
+		title = source.Title
+	}
+
+	// Public snippets must not leak credentials
+	var findings []scanner.Finding
+	if req.IsPublic {
+		if findings, ok = checkSecrets(w, r, content, req.AllowSecrets); !ok {
+			return
+		}
+	}
+
+	// The new snippet lands in one of the caller's collections
+	collectionIDs := []string{}
+	if req.CollectionID != "" {
+		var exists bool
+		err = h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM collections WHERE id = $1 AND user_id = $2)",
+			req.CollectionID, userID).Scan(&exists)
+		if err != nil {
+			sendError(w, r, apierror.Wrap(err, "Failed to validate collection ownership"))
+			return
+		}
+		if !exists {
+			sendError(w, r, apierror.New(http.StatusForbidden, apierror.CodeForbidden, "Collection not found or access denied"))
+			return
+		}
+		collectionIDs = []string{req.CollectionID}
+	}
+
+	// Start transaction
+	tx, err := h.DB.Begin()
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to start transaction"))
+		return
+	}
+	defer tx.Rollback()
+
+	// Map the template tags by name onto the caller's own tags
+	tagIDs, tagNames, err := mapTagsToUser(tx, source.TagIDs, userID)
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	snippetID := uuid.New().String()
+	now := time.Now()
+
+	_, err = tx.Exec(`
+		INSERT INTO snippets (id, user_id, title, content, collection_ids, tag_ids, is_public, is_favorite, template_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		snippetID, userID, title, content, pq.Array(collectionIDs), pq.Array(tagIDs),
+		req.IsPublic, false, templateID, now, now)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to create snippet"))
+		return
+	}
+
+	snippet, err := loadOwnedSnippet(tx, snippetID, userID)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch created snippet"))
+		return
+	}
+	snippet.TagNames = tagNames
+
+	if snippet.IsPublic {
+		if err = scanner.Record(tx, snippetID, findings, len(findings) > 0); err != nil {
+			sendError(w, r, err)
+			return
+		}
+	}
+
+	// Queue webhook deliveries in the same transaction
+	if err = webhooks.Enqueue(tx, userID, webhooks.EventSnippetCreated, snippet); err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	// Commit transaction
+	if err = tx.Commit(); err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to commit transaction"))
+		return
+	}
+	metrics.SnippetsCreated.WithLabelValues("template").Inc()
+
+	response := models.Response{
+		Success: true,
+		Message: "Snippet created from template successfully",
+		Data:    snippet,
+	}
+
+	sendJSON(w, http.StatusCreated, response)
+}
+
+// loadTemplate fetches a snippet the user owns or that is public and parses
+// its placeholders. It writes the error response and returns false on failure.
+func (h *Handler) loadTemplate(w http.ResponseWriter, r *http.Request, snippetID, userID string) (models.Snippet, *templates.Template, bool) {
+	var source models.Snippet
+	var tagIDs pq.StringArray
+
+	err := h.DB.QueryRow(`
+		SELECT id, user_id, title, content, tag_ids
+		FROM snippets
+		WHERE id = $1 AND (user_id = $2 OR is_public = true)`,
+		snippetID, userID).Scan(&source.ID, &source.UserID, &source.Title, &source.Content, &tagIDs)
+	if err == sql.ErrNoRows {
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeSnippetNotFound, "Snippet not found"))
+		return source, nil, false
+	}
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch snippet"))
+		return source, nil, false
+	}
+	source.TagIDs = []string(tagIDs)
+
+	tmpl, err := templates.Parse(source.Content)
+	if err != nil {
+		sendError(w, r, apierror.New(http.StatusBadRequest, apierror.CodeValidationFailed, "Snippet is not a valid template: "+err.Error()))
+		return source, nil, false
+	}
+
+	return source, tmpl, true
+}
+
+// renderTemplate expands tmpl, reporting rejected values per placeholder.
+// It writes the error response and returns false on failure.
+func renderTemplate(w http.ResponseWriter, r *http.Request, tmpl *templates.Template, values map[string]interface{}, language string) (string, bool) {
+	content, err := tmpl.Render(values, language)
+
+	var verr *templates.ValidationError
+	if errors.As(err, &verr) {
+		invalid := apierror.New(http.StatusBadRequest, apierror.CodeValidationFailed, verr.Error())
+		for name, message := range verr.Fields {
+			invalid.Details = append(invalid.Details, models.FieldError{Field: "values." + name, Message: message})
+		}
+		sort.Slice(invalid.Details, func(i, j int) bool { return invalid.Details[i].Field < invalid.Details[j].Field })
+		sendError(w, r, invalid.WithData(verr))
+		return "", false
+	}
+	if err != nil {
+		sendError(w, r, apierror.New(http.StatusBadRequest, apierror.CodeValidationFailed, err.Error()))
+		return "", false
+	}
+
+	return content, true
+}
+
+// placeholderList returns the template placeholders, never nil
+func placeholderList(tmpl *templates.Template) []*templates.Placeholder {
+	if tmpl.Placeholders == nil {
+		return []*templates.Placeholder{}
+	}
+	return tmpl.Placeholders
+}
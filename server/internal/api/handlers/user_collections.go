@@ -3,13 +3,12 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"snippy-server/internal/database"
 )
 
 type UserCollection struct {
@@ -32,7 +31,7 @@ type UpdateUserCollectionRequest struct {
 }
 
 // CreateUserCollection creates a new collection for a user
-func CreateUserCollection(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateUserCollection(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(string)
 	if userID == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -64,7 +63,7 @@ func CreateUserCollection(w http.ResponseWriter, r *http.Request) {
 	`
 
 	var collection UserCollection
-	err := database.GetDB().QueryRow(
+	err := h.DB.QueryRow(
 		query,
 		collectionID,
 		userID,
@@ -82,7 +81,7 @@ func CreateUserCollection(w http.ResponseWriter, r *http.Request) {
 	)
 
 	if err != nil {
-		log.Printf("Error creating user collection: %v", err)
+		slog.ErrorContext(r.Context(), "error creating user collection", "error", err)
 		http.Error(w, "Failed to create collection", http.StatusInternalServerError)
 		return
 	}
@@ -96,7 +95,7 @@ func CreateUserCollection(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetUserCollections fetches all collections for a user
-func GetUserCollections(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetUserCollections(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(string)
 	if userID == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -110,9 +109,9 @@ func GetUserCollections(w http.ResponseWriter, r *http.Request) {
 		ORDER BY name ASC
 	`
 
-	rows, err := database.GetDB().Query(query, userID)
+	rows, err := h.DB.Query(query, userID)
 	if err != nil {
-		log.Printf("Error fetching user collections: %v", err)
+		slog.ErrorContext(r.Context(), "error fetching user collections", "error", err)
 		http.Error(w, "Failed to fetch collections", http.StatusInternalServerError)
 		return
 	}
@@ -130,7 +129,7 @@ func GetUserCollections(w http.ResponseWriter, r *http.Request) {
 			&collection.UpdatedAt,
 		)
 		if err != nil {
-			log.Printf("Error scanning collection: %v", err)
+			slog.ErrorContext(r.Context(), "error scanning collection", "error", err)
 			continue
 		}
 		collections = append(collections, collection)
@@ -144,7 +143,7 @@ func GetUserCollections(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetUserCollection fetches a specific collection by ID
-func GetUserCollection(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetUserCollection(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(string)
 	if userID == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -161,7 +160,7 @@ func GetUserCollection(w http.ResponseWriter, r *http.Request) {
 	`
 
 	var collection UserCollection
-	err := database.GetDB().QueryRow(query, collectionID, userID).Scan(
+	err := h.DB.QueryRow(query, collectionID, userID).Scan(
 		&collection.ID,
 		&collection.UserID,
 		&collection.Name,
@@ -176,7 +175,7 @@ func GetUserCollection(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err != nil {
-		log.Printf("Error fetching user collection: %v", err)
+		slog.ErrorContext(r.Context(), "error fetching user collection", "error", err)
 		http.Error(w, "Failed to fetch collection", http.StatusInternalServerError)
 		return
 	}
@@ -189,7 +188,7 @@ func GetUserCollection(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateUserCollection updates a collection for a user
-func UpdateUserCollection(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateUserCollection(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(string)
 	if userID == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -222,7 +221,7 @@ func UpdateUserCollection(w http.ResponseWriter, r *http.Request) {
 	`
 
 	var collection UserCollection
-	err := database.GetDB().QueryRow(
+	err := h.DB.QueryRow(
 		query,
 		req.Name,
 		req.Color,
@@ -244,7 +243,7 @@ func UpdateUserCollection(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err != nil {
-		log.Printf("Error updating user collection: %v", err)
+		slog.ErrorContext(r.Context(), "error updating user collection", "error", err)
 		http.Error(w, "Failed to update collection", http.StatusInternalServerError)
 		return
 	}
@@ -257,7 +256,7 @@ func UpdateUserCollection(w http.ResponseWriter, r *http.Request) {
 }
 
 // DeleteUserCollection deletes a collection for a user
-func DeleteUserCollection(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteUserCollection(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(string)
 	if userID == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -268,9 +267,9 @@ func DeleteUserCollection(w http.ResponseWriter, r *http.Request) {
 	collectionID := vars["id"]
 
 	// Start a transaction to handle the deletion
-	tx, err := database.GetDB().Begin()
+	tx, err := h.DB.Begin()
 	if err != nil {
-		log.Printf("Error starting transaction: %v", err)
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
 		http.Error(w, "Failed to delete collection", http.StatusInternalServerError)
 		return
 	}
@@ -284,7 +283,7 @@ func DeleteUserCollection(w http.ResponseWriter, r *http.Request) {
 	`
 	_, err = tx.Exec(updateQuery, collectionID, userID)
 	if err != nil {
-		log.Printf("Error updating snippets: %v", err)
+		slog.ErrorContext(r.Context(), "error updating snippets", "error", err)
 		http.Error(w, "Failed to delete collection", http.StatusInternalServerError)
 		return
 	}
@@ -296,14 +295,14 @@ func DeleteUserCollection(w http.ResponseWriter, r *http.Request) {
 	`
 	result, err := tx.Exec(deleteQuery, collectionID, userID)
 	if err != nil {
-		log.Printf("Error deleting user collection: %v", err)
+		slog.ErrorContext(r.Context(), "error deleting user collection", "error", err)
 		http.Error(w, "Failed to delete collection", http.StatusInternalServerError)
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
+		slog.ErrorContext(r.Context(), "error getting rows affected", "error", err)
 		http.Error(w, "Failed to delete collection", http.StatusInternalServerError)
 		return
 	}
@@ -315,7 +314,7 @@ func DeleteUserCollection(w http.ResponseWriter, r *http.Request) {
 
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
-		log.Printf("Error committing transaction: %v", err)
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
 		http.Error(w, "Failed to delete collection", http.StatusInternalServerError)
 		return
 	}
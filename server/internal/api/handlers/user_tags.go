@@ -3,13 +3,12 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"snippy-server/internal/database"
 )
 
 type UserTag struct {
@@ -32,7 +31,7 @@ type UpdateUserTagRequest struct {
 }
 
 // CreateUserTag creates a new tag for a user
-func CreateUserTag(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateUserTag(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(string)
 	if userID == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -64,7 +63,7 @@ func CreateUserTag(w http.ResponseWriter, r *http.Request) {
 	`
 
 	var tag UserTag
-	err := database.GetDB().QueryRow(
+	err := h.DB.QueryRow(
 		query,
 		tagID,
 		userID,
@@ -82,7 +81,7 @@ func CreateUserTag(w http.ResponseWriter, r *http.Request) {
 	)
 
 	if err != nil {
-		log.Printf("Error creating user tag: %v", err)
+		slog.ErrorContext(r.Context(), "error creating user tag", "error", err)
 		http.Error(w, "Failed to create tag", http.StatusInternalServerError)
 		return
 	}
@@ -96,7 +95,7 @@ func CreateUserTag(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetUserTags fetches all tags for a user
-func GetUserTags(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetUserTags(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(string)
 	if userID == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -110,9 +109,9 @@ func GetUserTags(w http.ResponseWriter, r *http.Request) {
 		ORDER BY name ASC
 	`
 
-	rows, err := database.GetDB().Query(query, userID)
+	rows, err := h.DB.Query(query, userID)
 	if err != nil {
-		log.Printf("Error fetching user tags: %v", err)
+		slog.ErrorContext(r.Context(), "error fetching user tags", "error", err)
 		http.Error(w, "Failed to fetch tags", http.StatusInternalServerError)
 		return
 	}
@@ -130,7 +129,7 @@ func GetUserTags(w http.ResponseWriter, r *http.Request) {
 			&tag.UpdatedAt,
 		)
 		if err != nil {
-			log.Printf("Error scanning tag: %v", err)
+			slog.ErrorContext(r.Context(), "error scanning tag", "error", err)
 			continue
 		}
 		tags = append(tags, tag)
@@ -144,7 +143,7 @@ func GetUserTags(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetUserTag fetches a specific tag by ID
-func GetUserTag(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetUserTag(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(string)
 	if userID == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -161,7 +160,7 @@ func GetUserTag(w http.ResponseWriter, r *http.Request) {
 	`
 
 	var tag UserTag
-	err := database.GetDB().QueryRow(query, tagID, userID).Scan(
+	err := h.DB.QueryRow(query, tagID, userID).Scan(
 		&tag.ID,
 		&tag.UserID,
 		&tag.Name,
@@ -176,7 +175,7 @@ func GetUserTag(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err != nil {
-		log.Printf("Error fetching user tag: %v", err)
+		slog.ErrorContext(r.Context(), "error fetching user tag", "error", err)
 		http.Error(w, "Failed to fetch tag", http.StatusInternalServerError)
 		return
 	}
@@ -189,7 +188,7 @@ func GetUserTag(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpdateUserTag updates a tag for a user
-func UpdateUserTag(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateUserTag(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(string)
 	if userID == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -222,7 +221,7 @@ func UpdateUserTag(w http.ResponseWriter, r *http.Request) {
 	`
 
 	var tag UserTag
-	err := database.GetDB().QueryRow(
+	err := h.DB.QueryRow(
 		query,
 		req.Name,
 		req.Color,
@@ -244,7 +243,7 @@ func UpdateUserTag(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err != nil {
-		log.Printf("Error updating user tag: %v", err)
+		slog.ErrorContext(r.Context(), "error updating user tag", "error", err)
 		http.Error(w, "Failed to update tag", http.StatusInternalServerError)
 		return
 	}
@@ -257,7 +256,7 @@ func UpdateUserTag(w http.ResponseWriter, r *http.Request) {
 }
 
 // DeleteUserTag deletes a tag for a user
-func DeleteUserTag(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteUserTag(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("user_id").(string)
 	if userID == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -268,9 +267,9 @@ func DeleteUserTag(w http.ResponseWriter, r *http.Request) {
 	tagID := vars["id"]
 
 	// Start a transaction to handle the deletion
-	tx, err := database.GetDB().Begin()
+	tx, err := h.DB.Begin()
 	if err != nil {
-		log.Printf("Error starting transaction: %v", err)
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
 		http.Error(w, "Failed to delete tag", http.StatusInternalServerError)
 		return
 	}
@@ -284,7 +283,7 @@ func DeleteUserTag(w http.ResponseWriter, r *http.Request) {
 	`
 	_, err = tx.Exec(updateQuery, tagID, userID)
 	if err != nil {
-		log.Printf("Error updating snippets: %v", err)
+		slog.ErrorContext(r.Context(), "error updating snippets", "error", err)
 		http.Error(w, "Failed to delete tag", http.StatusInternalServerError)
 		return
 	}
@@ -296,14 +295,14 @@ func DeleteUserTag(w http.ResponseWriter, r *http.Request) {
 	`
 	result, err := tx.Exec(deleteQuery, tagID, userID)
 	if err != nil {
-		log.Printf("Error deleting user tag: %v", err)
+		slog.ErrorContext(r.Context(), "error deleting user tag", "error", err)
 		http.Error(w, "Failed to delete tag", http.StatusInternalServerError)
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
+		slog.ErrorContext(r.Context(), "error getting rows affected", "error", err)
 		http.Error(w, "Failed to delete tag", http.StatusInternalServerError)
 		return
 	}
@@ -315,7 +314,7 @@ func DeleteUserTag(w http.ResponseWriter, r *http.Request) {
 
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
-		log.Printf("Error committing transaction: %v", err)
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
 		http.Error(w, "Failed to delete tag", http.StatusInternalServerError)
 		return
 	}
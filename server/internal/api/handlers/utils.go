@@ -1,24 +1,106 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"net/http"
+
+	"snippy-server/internal/apierror"
 	"snippy-server/internal/models"
+
+	"github.com/lib/pq"
 )
 
+// rowQuerier is implemented by both *sql.DB and *sql.Tx
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 // sendJSON sends a JSON response with the specified status code
 func sendJSON(w http.ResponseWriter, status int, response models.Response) {
+	if !response.Success {
+		response.RequestID = w.Header().Get("X-Request-ID")
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(response)
 }
 
-// sendError sends an error response with the specified status code
-func sendError(w http.ResponseWriter, status int, message string) {
-	response := models.Response{
-		Success: false,
-		Message: "Error",
-		Error:   message,
+// sendError sends err to the client with its status and code. Errors that
+// are not an *apierror.Error are logged and reported as internal errors.
+func sendError(w http.ResponseWriter, r *http.Request, err error) {
+	apierror.Write(w, r, err)
+}
+
+// snippetColumns are the snippet fields read by scanSnippet
+const snippetColumns = `id, user_id, title, content, collection_ids, tag_ids, is_public, is_favorite, fork_count, forked_from, version, template_id, created_at, updated_at`
+
+// loadOwnedSnippet fetches a snippet owned by userID without tag names
+func loadOwnedSnippet(q rowQuerier, snippetID, userID string) (models.Snippet, error) {
+	return scanSnippet(q.QueryRow(`SELECT `+snippetColumns+` FROM snippets WHERE id = $1 AND user_id = $2`,
+		snippetID, userID))
+}
+
+// loadPublicSnippet fetches a public snippet without tag names
+func loadPublicSnippet(q rowQuerier, snippetID string) (models.Snippet, error) {
+	return scanSnippet(q.QueryRow(`SELECT `+snippetColumns+` FROM snippets WHERE id = $1 AND is_public = true`,
+		snippetID))
+}
+
+// snippetDetailQuery selects snippetColumns followed by the snippet's tag
+// names in tag order. It has no GROUP BY, so callers may lock with FOR UPDATE.
+const snippetDetailQuery = `
+	SELECT ` + snippetColumns + `,
+	       COALESCE((SELECT array_agg(t.name ORDER BY array_position(s.tag_ids::text[], t.id::text))
+	                 FROM tags t WHERE t.id::text = ANY(s.tag_ids::text[])), '{}')
+	FROM snippets s
+	WHERE `
+
+// loadSnippetDetails fetches a snippet with its tag names. where is the
+// condition, optionally followed by FOR UPDATE.
+func loadSnippetDetails(q rowQuerier, where string, args ...interface{}) (models.Snippet, error) {
+	return scanSnippetDetails(q.QueryRow(snippetDetailQuery+where, args...))
+}
+
+// scanSnippetDetails scans a row selected with snippetDetailQuery
+func scanSnippetDetails(row rowScanner) (models.Snippet, error) {
+	var tagNames pq.StringArray
+	snippet, err := scanSnippet(row, &tagNames)
+	if err != nil {
+		return snippet, err
+	}
+	snippet.TagNames = []string(tagNames)
+	if snippet.TagNames == nil {
+		snippet.TagNames = []string{}
+	}
+	return snippet, nil
+}
+
+// scanSnippet scans a row selected with snippetColumns, followed by any
+// extra columns
+func scanSnippet(row rowScanner, extra ...interface{}) (models.Snippet, error) {
+	var snippet models.Snippet
+	var collectionIDs pq.StringArray
+	var tagIDs pq.StringArray
+
+	dest := []interface{}{
+		&snippet.ID, &snippet.UserID, &snippet.Title, &snippet.Content,
+		&collectionIDs, &tagIDs, &snippet.IsPublic, &snippet.IsFavorite,
+		&snippet.ForkCount, &snippet.ForkedFrom, &snippet.Version, &snippet.TemplateID, &snippet.CreatedAt, &snippet.UpdatedAt}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return snippet, err
+	}
+
+	// Convert pq.StringArray to []string, handling nil cases
+	snippet.CollectionIDs = []string(collectionIDs)
+	if snippet.CollectionIDs == nil {
+		snippet.CollectionIDs = []string{}
+	}
+	snippet.TagIDs = []string(tagIDs)
+	if snippet.TagIDs == nil {
+		snippet.TagIDs = []string{}
 	}
-	sendJSON(w, status, response)
+
+	return snippet, nil
 }
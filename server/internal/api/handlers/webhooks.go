@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/models"
+	"snippy-server/internal/webhooks"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// GetWebhooks retrieves all webhooks registered by the authenticated user
+func (h *Handler) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT id, user_id, url, events, is_active, failure_count, disabled_at, created_at, updated_at
+		FROM webhooks
+		WHERE user_id = $1
+		ORDER BY created_at DESC`, userID)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch webhooks"))
+		return
+	}
+	defer rows.Close()
+
+	// initialize as empty slice to avoid null in JSON
+	list := make([]models.Webhook, 0)
+	for rows.Next() {
+		var wh models.Webhook
+		var events pq.StringArray
+		err := rows.Scan(&wh.ID, &wh.UserID, &wh.URL, &events, &wh.IsActive, &wh.FailureCount, &wh.DisabledAt, &wh.CreatedAt, &wh.UpdatedAt)
+		if err != nil {
+			sendError(w, r, apierror.Wrap(err, "Failed to scan webhook"))
+			return
+		}
+		wh.Events = []string(events)
+		list = append(list, wh)
+	}
+
+	if err = rows.Err(); err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to iterate webhooks"))
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Webhooks retrieved successfully",
+		Data:    list,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// CreateWebhook registers a webhook endpoint. The signing secret is only
+// returned in this response.
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Parse request body
+	var req models.CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, apierror.InvalidBody(err))
+		return
+	}
+
+	if err := webhooks.ValidateURL(r.Context(), req.URL); err != nil {
+		sendError(w, r, apierror.Invalid("url", err.Error()))
+		return
+	}
+	if err := validateWebhookEvents(req.Events); err != nil {
+		sendError(w, r, apierror.Invalid("events", err.Error()))
+		return
+	}
+
+	secret, err := webhooks.GenerateSecret()
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	webhookID := uuid.New().String()
+	now := time.Now()
+
+	_, err = h.DB.Exec(`
+		INSERT INTO webhooks (id, user_id, url, secret, events, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		webhookID, userID, req.URL, secret, pq.Array(req.Events), now, now)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to create webhook"))
+		return
+	}
+
+	webhook := models.Webhook{
+		ID:        webhookID,
+		UserID:    userID,
+		URL:       req.URL,
+		Secret:    secret,
+		Events:    req.Events,
+		IsActive:  true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Webhook created successfully",
+		Data:    webhook,
+	}
+
+	sendJSON(w, http.StatusCreated, response)
+}
+
+// UpdateWebhook updates a webhook's URL, events or active state
+func (h *Handler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get webhook ID from URL parameters
+	vars := mux.Vars(r)
+	webhookID := vars["id"]
+
+	// Parse request body
+	var req models.UpdateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, apierror.InvalidBody(err))
+		return
+	}
+
+	// Build update query dynamically
+	query := "UPDATE webhooks SET updated_at = $1"
+	args := []interface{}{time.Now()}
+	argIndex := 2
+
+	if req.URL != nil {
+		if err := webhooks.ValidateURL(r.Context(), *req.URL); err != nil {
+			sendError(w, r, apierror.Invalid("url", err.Error()))
+			return
+		}
+		query += ", url = $" + strconv.Itoa(argIndex)
+		args = append(args, *req.URL)
+		argIndex++
+	}
+
+	if req.Events != nil {
+		if err := validateWebhookEvents(req.Events); err != nil {
+			sendError(w, r, apierror.Invalid("events", err.Error()))
+			return
+		}
+		query += ", events = $" + strconv.Itoa(argIndex)
+		args = append(args, pq.Array(req.Events))
+		argIndex++
+	}
+
+	if req.IsActive != nil {
+		query += ", is_active = $" + strconv.Itoa(argIndex)
+		args = append(args, *req.IsActive)
+		argIndex++
+		// Re-enabling gives the endpoint a fresh failure budget
+		if *req.IsActive {
+			query += ", failure_count = 0, disabled_at = NULL"
+		}
+	}
+
+	query += " WHERE id = $" + strconv.Itoa(argIndex) + " AND user_id = $" + strconv.Itoa(argIndex+1)
+	query += " RETURNING id, user_id, url, events, is_active, failure_count, disabled_at, created_at, updated_at"
+	args = append(args, webhookID, userID)
+
+	var webhook models.Webhook
+	var events pq.StringArray
+	err = h.DB.QueryRow(query, args...).Scan(
+		&webhook.ID, &webhook.UserID, &webhook.URL, &events, &webhook.IsActive,
+		&webhook.FailureCount, &webhook.DisabledAt, &webhook.CreatedAt, &webhook.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeWebhookNotFound, "Webhook not found"))
+		return
+	}
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to update webhook"))
+		return
+	}
+	webhook.Events = []string(events)
+
+	response := models.Response{
+		Success: true,
+		Message: "Webhook updated successfully",
+		Data:    webhook,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// DeleteWebhook deletes a webhook and its delivery history
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get webhook ID from URL parameters
+	vars := mux.Vars(r)
+	webhookID := vars["id"]
+
+	result, err := h.DB.Exec("DELETE FROM webhooks WHERE id = $1 AND user_id = $2", webhookID, userID)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to delete webhook"))
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeWebhookNotFound, "Webhook not found"))
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Webhook deleted successfully",
+		Data:    map[string]string{"id": webhookID},
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// deliveryOrders are the sort orders of a webhook's delivery log
+var deliveryOrders = map[string]keyset[models.WebhookDelivery]{
+	"created": {
+		columns: []string{"created_at", "id"}, types: []string{"timestamp", "uuid"}, desc: true,
+		values: func(d models.WebhookDelivery) []string { return []string{cursorTime(d.CreatedAt), d.ID} },
+	},
+}
+
+// GetWebhookDeliveries retrieves one page of a webhook's deliveries, newest first
+func (h *Handler) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get webhook ID from URL parameters
+	vars := mux.Vars(r)
+	webhookID := vars["id"]
+
+	if !h.webhookBelongsToUser(w, r, webhookID, userID) {
+		return
+	}
+
+	p, err := parsePage(r, deliveryOrders, "created")
+	if err != nil {
+		sendError(w, r, err)
+		return
+	}
+
+	from := "FROM webhook_deliveries WHERE webhook_id = $1"
+	query := `SELECT id, webhook_id, event, payload, status, attempts, next_attempt_at,
+		       last_status_code, last_error, delivered_at, created_at ` + from
+	args := []interface{}{webhookID}
+	if after, afterArgs := p.where(2); after != "" {
+		query += " AND " + after
+		args = append(args, afterArgs...)
+	}
+	query += p.orderBy()
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to fetch deliveries"))
+		return
+	}
+	defer rows.Close()
+
+	// initialize as empty slice to avoid null in JSON
+	deliveries := make([]models.WebhookDelivery, 0)
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var payload []byte
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.LastStatusCode, &d.LastError, &d.DeliveredAt, &d.CreatedAt)
+		if err != nil {
+			sendError(w, r, apierror.Wrap(err, "Failed to scan delivery"))
+			return
+		}
+		d.Payload = json.RawMessage(payload)
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to iterate deliveries"))
+		return
+	}
+
+	deliveries, info := p.finish(deliveries)
+	if err := p.count(h.DB, info, from, []interface{}{webhookID}); err != nil {
+		sendError(w, r, err)
+		return
+	}
+	setPageLinks(w, r, info)
+
+	response := models.Response{
+		Success: true,
+		Message: "Webhook deliveries retrieved successfully",
+		Data:    deliveries,
+		Page:    info,
+	}
+
+	sendJSON(w, http.StatusOK, response)
+}
+
+// RedeliverWebhookDelivery queues an existing delivery to be sent again
+func (h *Handler) RedeliverWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	// Get user ID from context
+	userID, err := getUserIDFromContext(r)
+	if err != nil {
+		sendError(w, r, apierror.Unauthorized(err))
+		return
+	}
+
+	// Get webhook and delivery IDs from URL parameters
+	vars := mux.Vars(r)
+	webhookID := vars["id"]
+	deliveryID := vars["delivery_id"]
+
+	if !h.webhookBelongsToUser(w, r, webhookID, userID) {
+		return
+	}
+
+	// Attempts restart from zero so the full retry schedule applies again
+	result, err := h.DB.Exec(`
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, next_attempt_at = now()
+		WHERE id = $1 AND webhook_id = $2`, deliveryID, webhookID)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to queue redelivery"))
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeDeliveryNotFound, "Delivery not found"))
+		return
+	}
+
+	response := models.Response{
+		Success: true,
+		Message: "Delivery queued for redelivery",
+		Data:    map[string]string{"id": deliveryID},
+	}
+
+	sendJSON(w, http.StatusAccepted, response)
+}
+
+// webhookBelongsToUser writes a 404 and returns false unless the webhook is owned by userID
+func (h *Handler) webhookBelongsToUser(w http.ResponseWriter, r *http.Request, webhookID, userID string) bool {
+	var exists bool
+	err := h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM webhooks WHERE id = $1 AND user_id = $2)",
+		webhookID, userID).Scan(&exists)
+	if err != nil {
+		sendError(w, r, apierror.Wrap(err, "Failed to validate webhook ownership"))
+		return false
+	}
+	if !exists {
+		sendError(w, r, apierror.New(http.StatusNotFound, apierror.CodeWebhookNotFound, "Webhook not found"))
+		return false
+	}
+	return true
+}
+
+// validateWebhookEvents requires at least one known event or wildcard
+func validateWebhookEvents(events []string) error {
+	if len(events) == 0 {
+		return fmt.Errorf("At least one event is required")
+	}
+	for _, event := range events {
+		if !webhooks.IsValidSubscription(event) {
+			return fmt.Errorf("Unknown webhook event: %s", event)
+		}
+	}
+	return nil
+}
@@ -1,88 +1,226 @@
 package middleware
 
 import (
+	"bufio"
 	"context"
-	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
 
+	"snippy-server/internal/apierror"
 	"snippy-server/internal/auth"
-	"snippy-server/internal/models"
+	"snippy-server/internal/logging"
+	"snippy-server/internal/metrics"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
-// CORS middleware to handle cross-origin requests
-func CORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		origin := r.Header.Get("Origin")
-		if origin == "" {
-			origin = "*"
-		}
+// requestIDPattern limits propagated request IDs to safe, loggable values
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
 
-		// Allow specific origins in production - for now allowing all for development
-		w.Header().Set("Access-Control-Allow-Origin", origin)
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Max-Age", "3600")
-
-		// Handle preflight OPTIONS request
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+// RequestID propagates the caller's X-Request-ID or generates one. The ID is
+// echoed in the response and attached to every log line of the request.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.New().String()
 		}
 
-		next.ServeHTTP(w, r)
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
 	})
 }
 
-// Logging middleware - Logs all HTTP requests for debugging
+// Logging middleware - writes one access log line per request with the
+// status code, response size and duration
 func Logging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		next.ServeHTTP(w, r)
-		log.Printf("[%s] %s - %v", r.Method, r.URL.Path, time.Since(start))
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+
+		level := slog.LevelInfo
+		if rw.status >= 500 {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(r.Context(), level, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rw.status),
+			slog.Int64("bytes", rw.bytes),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("remote_addr", r.RemoteAddr),
+			slog.String("user_agent", r.UserAgent()),
+		)
 	})
 }
 
-// Authentication middleware - wraps handlers to require authentication
-func Auth(next http.Handler) http.Handler {
+// Metrics middleware - counts requests and observes latency per route
+// template, so /snippets/{id} is one series rather than one per snippet
+func Metrics(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Handle preflight OPTIONS request - skip authentication
-		if r.Method == "OPTIONS" {
-			next.ServeHTTP(w, r)
-			return
+		rw, ok := w.(*responseWriter)
+		if !ok {
+			rw = &responseWriter{ResponseWriter: w, status: http.StatusOK}
 		}
 
-		// Set response type to JSON
-		w.Header().Set("Content-Type", "application/json")
+		start := time.Now()
+		next.ServeHTTP(rw, r)
 
-		// Extract and validate user ID from token
-		userID, err := auth.GetUserIDFromContext(r)
-		if err != nil {
-			sendUnauthorized(w, "Authentication failed: "+err.Error())
-			return
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
 		}
+		metrics.HTTPRequests.WithLabelValues(r.Method, route, strconv.Itoa(rw.status)).Inc()
+		metrics.HTTPDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
 
-		// Add user ID to request context for handlers to use
-		ctx := r.Context()
-		ctx = context.WithValue(ctx, "user_id", userID)
-		r = r.WithContext(ctx)
+// Recover middleware - turns a panicking handler into a 500 response and logs
+// the panic with its stack trace instead of dropping the connection
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw, ok := w.(*responseWriter)
+		if !ok {
+			rw = &responseWriter{ResponseWriter: w, status: http.StatusOK}
+		}
+
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				// Deliberate abort; let net/http close the connection quietly
+				panic(err)
+			}
+
+			slog.ErrorContext(r.Context(), "panic serving request",
+				"panic", fmt.Sprint(err),
+				"stack", string(debug.Stack()))
+
+			if !rw.wroteHeader {
+				apierror.Write(rw, r, apierror.New(http.StatusInternalServerError, apierror.CodeInternal, "Internal server error"))
+			} else {
+				// The response is already partly written; record the failure in
+				// the access log
+				rw.status = http.StatusInternalServerError
+			}
+		}()
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(rw, r)
 	})
 }
 
-// sendUnauthorized sends an unauthorized response
-func sendUnauthorized(w http.ResponseWriter, message string) {
-	w.WriteHeader(http.StatusUnauthorized)
-	response := models.Response{
-		Success: false,
-		Message: "Unauthorized",
-		Error:   message,
+// responseWriter records the status code and body size for the access log
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status = status
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Flush keeps streaming responses (server-sent events) working
+func (rw *responseWriter) Flush() {
+	rw.wroteHeader = true
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets protocol upgrades take over the connection
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
 	}
-	json.NewEncoder(w).Encode(response)
+	rw.wroteHeader = true
+	rw.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
 }
 
+// Authentication middleware - wraps handlers to require a token verified
+// by verifier
+func Auth(verifier *auth.Verifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Handle preflight OPTIONS request - skip authentication
+			if r.Method == "OPTIONS" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Set response type to JSON
+			w.Header().Set("Content-Type", "application/json")
+
+			// Extract and validate user ID from token
+			userID, err := verifier.GetUserIDFromContext(r)
+			if err != nil {
+				slog.DebugContext(r.Context(), "authentication failed", "error", err)
+				reason := auth.FailureReason(err)
+				metrics.AuthFailures.WithLabelValues(reason).Inc()
+				apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized,
+					"Authentication failed: "+strings.ReplaceAll(reason, "_", " ")))
+				return
+			}
 
+			// Add user ID to request context for handlers to use
+			ctx := r.Context()
+			logging.SetUserID(ctx, userID)
+			ctx = context.WithValue(ctx, "user_id", userID)
+			r = r.WithContext(ctx)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAdmin middleware - allows only the listed user IDs and must run
+// after Auth. With no admins configured every request is refused, so the
+// admin API is off unless explicitly enabled.
+func RequireAdmin(userIDs []string) func(http.Handler) http.Handler {
+	admins := make(map[string]bool, len(userIDs))
+	for _, id := range userIDs {
+		admins[id] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := r.Context().Value("user_id").(string)
+			if userID == "" || !admins[userID] {
+				apierror.Write(w, r, apierror.New(http.StatusForbidden, apierror.CodeForbidden, "Admin access required"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
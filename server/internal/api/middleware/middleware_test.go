@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"snippy-server/internal/logging"
+	"snippy-server/internal/metrics"
+	"snippy-server/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRequestIDGenerated(t *testing.T) {
+	var seen string
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logging.RequestID(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+
+	id := w.Header().Get("X-Request-ID")
+	if id == "" || id != seen {
+		t.Errorf("Header %q and context %q should match and be set", id, seen)
+	}
+}
+
+func TestRequestIDPropagated(t *testing.T) {
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		incoming string
+		keep     bool
+	}{
+		{"abc-123.trace_1", true},
+		{"bad id with spaces", false},
+		{strings.Repeat("a", 129), false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/health", nil)
+		r.Header.Set("X-Request-ID", tt.incoming)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		got := w.Header().Get("X-Request-ID")
+		if (got == tt.incoming) != tt.keep {
+			t.Errorf("Incoming %q: got %q, keep = %v", tt.incoming, got, tt.keep)
+		}
+	}
+}
+
+func TestRecoverReturnsJSONError(t *testing.T) {
+	h := RequestID(Logging(Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/snippets", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Status %d, want 500", w.Code)
+	}
+
+	var resp models.Response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Body is not JSON: %v", err)
+	}
+	if resp.Success || resp.RequestID == "" || resp.RequestID != w.Header().Get("X-Request-ID") {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+}
+
+func TestRecoverRepanicsOnAbort(t *testing.T) {
+	h := Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if recover() != http.ErrAbortHandler {
+			t.Error("Expected http.ErrAbortHandler to propagate")
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestLoggingRecordsStatusAndBytes(t *testing.T) {
+	rw := &responseWriter{ResponseWriter: httptest.NewRecorder(), status: http.StatusOK}
+	rw.WriteHeader(http.StatusCreated)
+	rw.Write([]byte("hello"))
+	rw.WriteHeader(http.StatusTeapot)
+
+	if rw.status != http.StatusCreated || rw.bytes != 5 {
+		t.Errorf("status = %d, bytes = %d; want 201, 5", rw.status, rw.bytes)
+	}
+}
+
+func TestMetricsUsesRouteTemplate(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(Metrics)
+	router.HandleFunc("/api/snippets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/snippets/1234", nil))
+
+	w := httptest.NewRecorder()
+	metrics.Handler("").ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	want := `snippy_http_requests_total{method="GET",route="/api/snippets/{id}",status="204"} 1`
+	if !strings.Contains(w.Body.String(), want) {
+		t.Errorf("Missing %s in output", want)
+	}
+	if strings.Contains(w.Body.String(), "/api/snippets/1234") {
+		t.Error("Raw path used as a label")
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		admins []string
+		userID string
+		want   int
+	}{
+		{[]string{"user_admin"}, "user_admin", http.StatusNoContent},
+		{[]string{"user_admin"}, "user_other", http.StatusForbidden},
+		{[]string{"user_admin"}, "", http.StatusForbidden},
+		{nil, "user_admin", http.StatusForbidden},
+		{[]string{""}, "", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/api/admin/diagnostics", nil)
+		if tt.userID != "" {
+			r = r.WithContext(context.WithValue(r.Context(), "user_id", tt.userID))
+		}
+		w := httptest.NewRecorder()
+		RequireAdmin(tt.admins)(ok).ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("Admins %v, user %q: got %d, want %d", tt.admins, tt.userID, w.Code, tt.want)
+		}
+	}
+}
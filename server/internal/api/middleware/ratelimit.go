@@ -0,0 +1,245 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/config"
+)
+
+// Route groups that share a rate limit
+const (
+	GroupPublic        = "public"        // Anonymous routes, per client IP
+	GroupPublicList    = "public_list"   // Public snippet listing, search and shuffle, per client IP
+	GroupRender        = "render"        // Server-side rendering and images, per client IP
+	GroupAuthenticated = "authenticated" // Every authenticated route, per user
+	GroupWrite         = "write"         // Creating snippets, forks and suggestions, per user
+	GroupRun           = "run"           // Sandboxed code execution, per user
+)
+
+// RateLimitStore keeps token buckets. Implementations must be safe for
+// concurrent use; a shared store enforces limits across replicas.
+type RateLimitStore interface {
+	// Take refills the bucket for key and removes one token if available. It
+	// returns the tokens left and whether the request is allowed.
+	Take(ctx context.Context, key string, limit config.RateLimit) (tokens float64, allowed bool, err error)
+}
+
+// RateLimiter applies per-group token bucket limits
+type RateLimiter struct {
+	Store      RateLimitStore
+	Limits     map[string]config.RateLimit
+	TrustProxy bool // Take the client IP from the last X-Forwarded-For entry
+}
+
+// NewRateLimiter creates a limiter for the groups configured in cfg
+func NewRateLimiter(store RateLimitStore, cfg config.RateLimitConfig) *RateLimiter {
+	limits := map[string]config.RateLimit{}
+	if cfg.Enabled {
+		limits = map[string]config.RateLimit{
+			GroupPublic:        cfg.Public,
+			GroupPublicList:    cfg.PublicList,
+			GroupRender:        cfg.Render,
+			GroupAuthenticated: cfg.Authenticated,
+			GroupWrite:         cfg.Write,
+			GroupRun:           cfg.Run,
+		}
+	}
+	return &RateLimiter{Store: store, Limits: limits, TrustProxy: cfg.TrustProxy}
+}
+
+// Limit is middleware limiting requests in a route group. Authenticated
+// requests are counted per user, others per client IP.
+func (rl *RateLimiter) Limit(group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rl.serve(group, next, w, r)
+		})
+	}
+}
+
+// serve applies the group limit to a single request
+func (rl *RateLimiter) serve(group string, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	limit, ok := rl.Limits[group]
+	if !ok || limit.Requests <= 0 || limit.Period <= 0 || r.Method == http.MethodOptions {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	key := group + ":ip:" + rl.clientIP(r)
+	if userID, ok := r.Context().Value("user_id").(string); ok && userID != "" {
+		key = group + ":user:" + userID
+	}
+
+	tokens, allowed, err := rl.Store.Take(r.Context(), key, limit)
+	if err != nil {
+		// An unavailable store must not take the API down with it
+		slog.WarnContext(r.Context(), "rate limit store unavailable", "error", err)
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	// Headers follow the IETF RateLimit header fields draft
+	rate := limit.Rate()
+	reset := time.Duration((float64(limit.Requests) - tokens) / rate * float64(time.Second))
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, int(limit.Period.Seconds())))
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Requests))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(int(math.Floor(tokens))))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(reset)))
+
+	if !allowed {
+		retryAfter := time.Duration((1 - tokens) / rate * float64(time.Second))
+		w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+		apierror.Write(w, r, apierror.New(http.StatusTooManyRequests, apierror.CodeRateLimited, "Rate limit exceeded, try again later"))
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+// clientIP returns the address the request came from
+func (rl *RateLimiter) clientIP(r *http.Request) string {
+	if rl.TrustProxy {
+		// The proxy appends the address it saw; earlier entries are client-controlled
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			parts := strings.Split(forwarded, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ceilSeconds rounds d up to whole seconds, at least one when positive
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
+
+// MemoryRateLimitStore keeps buckets in process memory. Limits are per
+// replica, which is fine for a single instance and for tests.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	period  time.Duration
+}
+
+// NewMemoryRateLimitStore creates an empty in-memory store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*memoryBucket), now: time.Now}
+}
+
+// Take implements RateLimitStore
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit config.RateLimit) (float64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	capacity := float64(limit.Requests)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: capacity, updated: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*limit.Rate())
+	b.updated = now
+	b.period = limit.Period
+
+	if b.tokens < 1 {
+		return b.tokens, false, nil
+	}
+	b.tokens--
+	return b.tokens, true, nil
+}
+
+// sweep drops buckets that have refilled completely, at most once a minute
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) > b.period {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// PostgresRateLimitStore keeps buckets in the rate_limit_buckets table so all
+// replicas share them. Each Take is a single atomic upsert.
+type PostgresRateLimitStore struct {
+	DB *sql.DB
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewPostgresRateLimitStore creates a store backed by db
+func NewPostgresRateLimitStore(db *sql.DB) *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{DB: db}
+}
+
+// Take implements RateLimitStore. The database clock is used so replicas
+// with skewed clocks agree on refills.
+func (s *PostgresRateLimitStore) Take(ctx context.Context, key string, limit config.RateLimit) (float64, bool, error) {
+	s.sweep(ctx)
+
+	var tokens float64
+	var allowed bool
+	err := s.DB.QueryRowContext(ctx, `
+		INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+		VALUES ($1, $2::float8 - 1, true, now())
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $3::float8)
+			       - CASE WHEN LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $3::float8) >= 1 THEN 1 ELSE 0 END,
+			allowed = LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $3::float8) >= 1,
+			updated_at = now()
+		RETURNING tokens, allowed`,
+		key, limit.Requests, limit.Rate()).Scan(&tokens, &allowed)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to take rate limit token: %v", err)
+	}
+	return tokens, allowed, nil
+}
+
+// sweep deletes buckets idle for a day, at most every ten minutes. A full
+// bucket and a missing one behave the same.
+func (s *PostgresRateLimitStore) sweep(ctx context.Context) {
+	s.mu.Lock()
+	if time.Since(s.lastSweep) < 10*time.Minute {
+		s.mu.Unlock()
+		return
+	}
+	s.lastSweep = time.Now()
+	s.mu.Unlock()
+
+	if _, err := s.DB.ExecContext(ctx, "DELETE FROM rate_limit_buckets WHERE updated_at < now() - interval '1 day'"); err != nil {
+		slog.WarnContext(ctx, "failed to delete idle rate limit buckets", "error", err)
+	}
+}
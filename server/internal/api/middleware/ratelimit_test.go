@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"snippy-server/internal/config"
+)
+
+func newTestLimiter(limit config.RateLimit) (*RateLimiter, *MemoryRateLimitStore, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+	rl := &RateLimiter{Store: store, Limits: map[string]config.RateLimit{GroupPublic: limit}}
+	return rl, store, &now
+}
+
+func serveLimited(rl *RateLimiter, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	rl.serve(GroupPublic, ok, w, r)
+	return w
+}
+
+func TestRateLimitBurstAndRefill(t *testing.T) {
+	rl, _, now := newTestLimiter(config.RateLimit{Requests: 3, Period: 3 * time.Second})
+	req := httptest.NewRequest("GET", "/api/snippets/public", nil)
+
+	for i := 0; i < 3; i++ {
+		if w := serveLimited(rl, req); w.Code != http.StatusOK {
+			t.Fatalf("Request %d: status %d, want 200", i+1, w.Code)
+		}
+	}
+
+	w := serveLimited(rl, req)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Status %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want 1", got)
+	}
+	if got := w.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Errorf("RateLimit-Remaining = %q, want 0", got)
+	}
+
+	// One token per second comes back
+	*now = now.Add(time.Second)
+	if w := serveLimited(rl, req); w.Code != http.StatusOK {
+		t.Errorf("Status %d after refill, want 200", w.Code)
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	rl, _, _ := newTestLimiter(config.RateLimit{Requests: 60, Period: time.Minute})
+	w := serveLimited(rl, httptest.NewRequest("GET", "/", nil))
+
+	want := map[string]string{
+		"RateLimit-Policy":    "60;w=60",
+		"RateLimit-Limit":     "60",
+		"RateLimit-Remaining": "59",
+		"RateLimit-Reset":     "1",
+	}
+	for header, value := range want {
+		if got := w.Header().Get(header); got != value {
+			t.Errorf("%s = %q, want %q", header, got, value)
+		}
+	}
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	rl, _, _ := newTestLimiter(config.RateLimit{Requests: 1, Period: time.Minute})
+
+	first := httptest.NewRequest("GET", "/", nil)
+	first.RemoteAddr = "10.0.0.1:1234"
+	other := httptest.NewRequest("GET", "/", nil)
+	other.RemoteAddr = "10.0.0.2:1234"
+
+	serveLimited(rl, first)
+	if w := serveLimited(rl, other); w.Code != http.StatusOK {
+		t.Errorf("Other IP was limited: %d", w.Code)
+	}
+
+	// Authenticated requests are counted per user, not per IP
+	user := first.WithContext(context.WithValue(first.Context(), "user_id", "user_1"))
+	if w := serveLimited(rl, user); w.Code != http.StatusOK {
+		t.Errorf("User sharing a limited IP was limited: %d", w.Code)
+	}
+	if w := serveLimited(rl, user); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Second request of user: %d, want 429", w.Code)
+	}
+}
+
+func TestRateLimitClientIPFromProxy(t *testing.T) {
+	rl, _, _ := newTestLimiter(config.RateLimit{Requests: 1, Period: time.Minute})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "1.1.1.1, 203.0.113.7")
+
+	if ip := rl.clientIP(req); ip != "10.0.0.1" {
+		t.Errorf("Untrusted proxy: client IP %s, want the peer address", ip)
+	}
+	rl.TrustProxy = true
+	if ip := rl.clientIP(req); ip != "203.0.113.7" {
+		t.Errorf("Trusted proxy: client IP %s, want the address the proxy appended", ip)
+	}
+}
+
+func TestRateLimitDisabledGroup(t *testing.T) {
+	rl := NewRateLimiter(NewMemoryRateLimitStore(), config.RateLimitConfig{Enabled: false})
+	for i := 0; i < 5; i++ {
+		if w := serveLimited(rl, httptest.NewRequest("GET", "/", nil)); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("Disabled limiter interfered with request %d", i+1)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/auth"
+)
+
+// Origins is the allowlist of browser origins trusted to call the API with
+// the user's cookies. Entries look like https://snippy.dev; a host starting
+// with "*." matches any of its subdomains but not the domain itself.
+type Origins struct {
+	exact     map[string]bool
+	wildcards []wildcardOrigin
+}
+
+// wildcardOrigin matches hosts ending in suffix, which starts with a dot
+type wildcardOrigin struct {
+	scheme, suffix string
+}
+
+// NewOrigins builds an allowlist. Entries that are not origins are ignored;
+// config.Validate reports them at startup.
+func NewOrigins(allowed []string) *Origins {
+	o := &Origins{exact: make(map[string]bool)}
+	for _, entry := range allowed {
+		scheme, host, ok := splitOrigin(entry)
+		if !ok {
+			continue
+		}
+		if domain, wildcard := strings.CutPrefix(host, "*."); wildcard {
+			o.wildcards = append(o.wildcards, wildcardOrigin{scheme: scheme, suffix: "." + domain})
+		} else {
+			o.exact[scheme+"://"+host] = true
+		}
+	}
+	return o
+}
+
+// splitOrigin returns the lowercase scheme and host of an origin, dropping
+// the scheme's default port the way browsers do
+func splitOrigin(origin string) (scheme, host string, ok bool) {
+	u, err := url.Parse(strings.ToLower(strings.TrimRight(origin, "/")))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+		return "", "", false
+	}
+	host = u.Host
+	if (u.Scheme == "https" && u.Port() == "443") || (u.Scheme == "http" && u.Port() == "80") {
+		host = strings.TrimSuffix(host, ":"+u.Port())
+	}
+	return u.Scheme, host, true
+}
+
+// Allowed reports whether origin is on the allowlist
+func (o *Origins) Allowed(origin string) bool {
+	scheme, host, ok := splitOrigin(origin)
+	if !ok {
+		return false
+	}
+	if o.exact[scheme+"://"+host] {
+		return true
+	}
+	for _, w := range o.wildcards {
+		if scheme == w.scheme && len(host) > len(w.suffix) && strings.HasSuffix(host, w.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Trusted reports whether a request may act with the user's cookies: it
+// comes from outside a browser, from the API's own origin, or from an
+// allowed origin
+func (o *Origins) Trusted(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// Browsers send Origin with every unsafe and cross-origin request
+		// they make; Sec-Fetch-Site still catches ones that left it out
+		switch r.Header.Get("Sec-Fetch-Site") {
+		case "cross-site", "same-site":
+			return false
+		}
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return o.Allowed(origin)
+}
+
+// CORS middleware - lets allowed origins call the API with credentials.
+// Requests from other origins still reach the handlers, as they would
+// without CORS, but their responses cannot be read by the calling page.
+func CORS(origins *Origins) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Origin")
+			origin := r.Header.Get("Origin")
+			allowed := origin != "" && origins.Allowed(origin)
+
+			if allowed {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+				w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, ETag, Link, RateLimit-Policy, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After")
+			}
+
+			// Handle preflight OPTIONS request
+			if r.Method == "OPTIONS" {
+				if !allowed {
+					apierror.Write(w, r, apierror.New(http.StatusForbidden, apierror.CodeForbidden, "Origin not allowed"))
+					return
+				}
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Requested-With, If-Match, If-None-Match, Last-Event-ID")
+				w.Header().Set("Access-Control-Max-Age", "3600")
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CSRF middleware - rejects unsafe requests carrying a session cookie
+// unless they come from a trusted origin. Browsers attach cookies to
+// cross-site form posts and fetches, so without this check any site could
+// act as the signed-in user. Bearer tokens are never sent automatically
+// and need no check.
+func CSRF(origins *Origins) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case "GET", "HEAD", "OPTIONS":
+			default:
+				if auth.HasSessionCookie(r) && !origins.Trusted(r) {
+					apierror.Write(w, r, apierror.New(http.StatusForbidden, apierror.CodeForbidden,
+						"Cross-site request rejected; call the API from an allowed origin or with a bearer token"))
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SecurityHeaders middleware - sets restrictive defaults for every
+// response. Handlers serving pages replace the Content-Security-Policy,
+// and embeds drop X-Frame-Options to allow framing.
+func SecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+		// Browsers ignore HSTS received over plain HTTP, so trusting the
+		// proxy's word for the scheme is harmless
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			h.Set("Strict-Transport-Security", "max-age=31536000")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
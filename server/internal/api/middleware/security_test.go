@@ -0,0 +1,175 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var testOrigins = NewOrigins([]string{"https://snippy.dev", "https://*.snippy.dev", "http://localhost:3000", "https://app.example:443"})
+
+func TestOriginsAllowed(t *testing.T) {
+	for _, c := range []struct {
+		origin string
+		want   bool
+	}{
+		{"https://snippy.dev", true},
+		{"https://SNIPPY.dev", true},
+		{"https://app.snippy.dev", true},
+		{"https://a.b.snippy.dev", true},
+		{"http://localhost:3000", true},
+		{"https://app.example", true}, // Default port dropped
+		{"http://snippy.dev", false},  // Scheme must match
+		{"http://app.snippy.dev", false},
+		{"https://evilsnippy.dev", false},
+		{"https://snippy.dev.evil.example", false},
+		{"https://app.snippy.dev:8443", false},
+		{"http://localhost:3001", false},
+		{"null", false},
+		{"", false},
+	} {
+		if got := testOrigins.Allowed(c.origin); got != c.want {
+			t.Errorf("%q: got %v", c.origin, got)
+		}
+	}
+}
+
+func serveCORS(method, origin string) *httptest.ResponseRecorder {
+	h := CORS(testOrigins)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	r := httptest.NewRequest(method, "https://api.snippy.dev/api/snippets", nil)
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestCORSAllowedOrigin(t *testing.T) {
+	w := serveCORS("GET", "https://app.snippy.dev")
+	if w.Code != http.StatusTeapot {
+		t.Errorf("Got status %d", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.snippy.dev" {
+		t.Errorf("Got Access-Control-Allow-Origin %q", got)
+	}
+	if w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Error("Allowed origins should be able to send cookies")
+	}
+	if w.Header().Get("Vary") != "Origin" {
+		t.Error("Responses depend on the origin and must say so to caches")
+	}
+
+	w = serveCORS("OPTIONS", "https://snippy.dev")
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Errorf("Preflight: got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestCORSBlockedOrigin(t *testing.T) {
+	w := serveCORS("GET", "https://evil.example")
+	if w.Code != http.StatusTeapot {
+		t.Errorf("The request should still be served, got %d", w.Code)
+	}
+	for _, header := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Credentials"} {
+		if got := w.Header().Get(header); got != "" {
+			t.Errorf("Got %s %q", header, got)
+		}
+	}
+
+	w = serveCORS("OPTIONS", "https://evil.example")
+	if w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Errorf("Preflight: got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestCORSWithoutOrigin(t *testing.T) {
+	w := serveCORS("GET", "")
+	if w.Code != http.StatusTeapot || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	h := CSRF(testOrigins)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, c := range []struct {
+		name          string
+		method        string
+		cookie        bool
+		origin        string
+		secFetchSite  string
+		authorization string
+		want          int
+	}{
+		{"safe method from another site", "GET", true, "https://evil.example", "cross-site", "", http.StatusNoContent},
+		{"cookie from another site", "POST", true, "https://evil.example", "cross-site", "", http.StatusForbidden},
+		{"cookie from a sibling subdomain not allowed", "DELETE", true, "https://snippy.dev.evil.example", "cross-site", "", http.StatusForbidden},
+		{"cookie from an opaque origin", "PUT", true, "null", "cross-site", "", http.StatusForbidden},
+		{"cookie from the web app", "POST", true, "https://snippy.dev", "same-site", "", http.StatusNoContent},
+		{"cookie from a wildcard subdomain", "PUT", true, "https://beta.snippy.dev", "same-site", "", http.StatusNoContent},
+		{"cookie from the API's own origin", "POST", true, "https://api.snippy.dev", "same-origin", "", http.StatusNoContent},
+		{"cookie without Origin from another site", "POST", true, "", "cross-site", "", http.StatusForbidden},
+		{"cookie outside a browser", "POST", true, "", "", "", http.StatusNoContent},
+		{"bearer token from another site", "POST", false, "https://evil.example", "cross-site", "Bearer a.b.c", http.StatusNoContent},
+		{"bearer token alongside a cookie", "POST", true, "https://evil.example", "cross-site", "Bearer a.b.c", http.StatusForbidden},
+	} {
+		r := httptest.NewRequest(c.method, "https://api.snippy.dev/api/snippets/create", nil)
+		if c.cookie {
+			r.AddCookie(&http.Cookie{Name: "__session", Value: "token"})
+		}
+		if c.origin != "" {
+			r.Header.Set("Origin", c.origin)
+		}
+		if c.secFetchSite != "" {
+			r.Header.Set("Sec-Fetch-Site", c.secFetchSite)
+		}
+		if c.authorization != "" {
+			r.Header.Set("Authorization", c.authorization)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != c.want {
+			t.Errorf("%s: got %d, want %d", c.name, w.Code, c.want)
+		}
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	h := SecurityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/embed" {
+			// Embeds replace the defaults to allow framing
+			w.Header().Del("X-Frame-Options")
+			w.Header().Set("Content-Security-Policy", "frame-ancestors *")
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "http://api.snippy.dev/api/snippets", nil))
+	for header, want := range map[string]string{
+		"Content-Security-Policy": "default-src 'none'; frame-ancestors 'none'; base-uri 'none'; form-action 'none'",
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "DENY",
+		"Referrer-Policy":         "strict-origin-when-cross-origin",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("Got %s %q, want %q", header, got, want)
+		}
+	}
+	if w.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("HSTS should only be sent over HTTPS")
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "https://api.snippy.dev/embed", nil))
+	if w.Header().Get("Strict-Transport-Security") == "" {
+		t.Error("HSTS should be sent over HTTPS")
+	}
+	if w.Header().Get("X-Frame-Options") != "" || w.Header().Get("Content-Security-Policy") != "frame-ancestors *" {
+		t.Errorf("Handlers should be able to allow framing: %v", w.Header())
+	}
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/models"
+	"snippy-server/internal/openapi"
+
+	"github.com/gorilla/mux"
+)
+
+// maxRequestBody bounds the JSON bodies read for validation
+const maxRequestBody = 10 << 20
+
+// ValidateRequest rejects JSON bodies that do not match the request schema
+// of the matched route in the OpenAPI document. Handlers still check rules
+// the schema cannot express, such as ownership or secret scanning.
+func ValidateRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op := matchedOperation(r)
+		if op == nil || op.RequestBody == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				apierror.Write(w, r, apierror.New(http.StatusRequestEntityTooLarge, apierror.CodeBodyTooLarge, "Request body too large"))
+				return
+			}
+			apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to read request body"))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if len(bytes.TrimSpace(body)) == 0 {
+			if op.RequestBody.Required {
+				apierror.Write(w, r, apierror.Invalid("", "Request body is required"))
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(body, &value); err != nil {
+			apierror.Write(w, r, apierror.InvalidBody(err))
+			return
+		}
+		if errs := openapi.Spec().Validate(op.RequestSchema(), value); len(errs) > 0 {
+			apierror.Write(w, r, schemaMismatch(errs))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// matchedOperation returns the OpenAPI operation of the route mux matched
+func matchedOperation(r *http.Request) *openapi.Operation {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return nil
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return nil
+	}
+	return openapi.Spec().Operation(r.Method, openapi.PathFromTemplate(template))
+}
+
+// schemaMismatch reports schema violations as a validation error, with the
+// first one in the message and all of them in the details
+func schemaMismatch(errs []openapi.ValidationError) *apierror.Error {
+	invalid := apierror.New(http.StatusBadRequest, apierror.CodeValidationFailed, "Invalid request body: "+errs[0].Error())
+	for _, e := range errs {
+		invalid.Details = append(invalid.Details, models.FieldError{Field: apierror.FieldPath(e.Path), Message: e.Message})
+	}
+	return invalid
+}
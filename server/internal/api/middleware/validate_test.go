@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"snippy-server/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+func TestValidateRequest(t *testing.T) {
+	var received string
+	r := mux.NewRouter()
+	r.Use(ValidateRequest)
+	r.HandleFunc("/api/tags/create", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+	}).Methods("POST")
+	r.HandleFunc("/api/suggestions/{id}/accept", func(w http.ResponseWriter, r *http.Request) {}).Methods("POST")
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{"valid", "/api/tags/create", `{"name":"go"}`, http.StatusOK},
+		{"schema mismatch", "/api/tags/create", `{"name":""}`, http.StatusBadRequest},
+		{"malformed json", "/api/tags/create", `{"name":`, http.StatusBadRequest},
+		{"missing body", "/api/tags/create", ``, http.StatusBadRequest},
+		{"optional body", "/api/suggestions/1/accept", ``, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body)))
+			if w.Code != tt.status {
+				t.Errorf("Got status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+
+	if received != `{"name":"go"}` {
+		t.Errorf("Handler should receive the original body, got %q", received)
+	}
+}
+
+func TestValidateRequestErrors(t *testing.T) {
+	r := mux.NewRouter()
+	r.Use(ValidateRequest)
+	r.HandleFunc("/api/snippets/create", func(w http.ResponseWriter, r *http.Request) {}).Methods("POST")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/api/snippets/create", strings.NewReader(`{"title":1}`)))
+
+	var resp models.Response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []models.FieldError{
+		{Field: "content", Message: "is required"},
+		{Field: "title", Message: "expected string, got number"},
+	}
+	if resp.Success || resp.Code != "validation_failed" || !reflect.DeepEqual(resp.Details, want) {
+		t.Errorf("Expected two validation errors, got %s", w.Body.String())
+	}
+}
@@ -1,78 +1,159 @@
 package api
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"snippy-server/internal/api/handlers"
 	"snippy-server/internal/api/middleware"
-	"snippy-server/internal/models"
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/openapi"
 
 	"github.com/gorilla/mux"
 )
 
-// SetupRoutes configures all the API routes and middleware
-func SetupRoutes() *mux.Router {
+// SetupRoutes configures all the API routes and middleware. h serves the
+// endpoints and limiter enforces the rate limits of their groups. origins
+// lists the web apps allowed to call the API with the user's cookies, and
+// admins the user IDs allowed to use the admin API.
+func SetupRoutes(h *handlers.Handler, limiter *middleware.RateLimiter, origins *middleware.Origins, admins []string) *mux.Router {
 	r := mux.NewRouter()
 
-	// Apply global middleware
-	r.Use(middleware.CORS)
+	// Apply global middleware. Recover sits inside Logging so a panicking
+	// request is still logged, with its 500 status.
+	r.Use(middleware.RequestID)
 	r.Use(middleware.Logging)
+	r.Use(middleware.Metrics)
+	r.Use(middleware.Recover)
+	r.Use(middleware.SecurityHeaders)
+	r.Use(middleware.CORS(origins))
+	r.Use(middleware.CSRF(origins))
+
+	// limited wraps a handler in the rate limit of its route group
+	limited := func(group string, handler http.HandlerFunc) http.Handler {
+		return limiter.Limit(group)(handler)
+	}
 
 	// Health check endpoint (no auth required)
-	r.HandleFunc("/health", handlers.HealthCheck).Methods("GET")
+	r.HandleFunc("/health", h.HealthCheck).Methods("GET")
 
-	// Debug endpoint (no auth required)
-	r.HandleFunc("/debug", handlers.DebugAuth).Methods("GET")
+	// API description and reference (no auth required)
+	r.Handle("/openapi.json", openapi.Handler()).Methods("GET")
+	r.Handle("/docs", openapi.DocsHandler()).Methods("GET")
 
 	// Public endpoints (no auth required)
 	// ai-keep-in-mind endpoints
-	r.HandleFunc("/api/snippets/public", handlers.GetPublicSnippets).Methods("GET")
-	r.HandleFunc("/api/snippets/public/{id}", handlers.GetPublicSnippet).Methods("GET")
+	r.Handle("/api/snippets/public", limited(middleware.GroupPublicList, h.GetPublicSnippets)).Methods("GET")
+	r.Handle("/api/snippets/public/{id}", limited(middleware.GroupPublic, h.GetPublicSnippet)).Methods("GET")
+	r.Handle("/api/snippets/public/{id}/contributors", limited(middleware.GroupPublic, h.GetSnippetContributors)).Methods("GET")
+	r.Handle("/api/snippets/public/{id}/render", limited(middleware.GroupRender, h.RenderPublicSnippet)).Methods("GET")
+	r.Handle("/api/render/themes", limited(middleware.GroupPublic, h.GetRenderThemes)).Methods("GET")
+
+	// Embeddable widgets and oEmbed (no auth required, may be framed by other sites)
+	r.Handle("/embed/{id:[0-9a-fA-F-]+}.js", limited(middleware.GroupRender, h.EmbedSnippetScript)).Methods("GET")
+	r.Handle("/embed/{id:[0-9a-fA-F-]+}", limited(middleware.GroupRender, h.EmbedSnippet)).Methods("GET")
+	r.Handle("/oembed", limited(middleware.GroupRender, h.OEmbed)).Methods("GET")
+
+	// Raw content (public, or private with a bearer token)
+	r.Handle("/raw/{id:[0-9a-fA-F-]+}", limited(middleware.GroupPublic, h.GetRawSnippet)).Methods("GET", "HEAD")
+	r.Handle("/raw/{id:[0-9a-fA-F-]+}/{filename}", limited(middleware.GroupPublic, h.GetRawSnippet)).Methods("GET", "HEAD")
+
+	// Share images (public, no authentication required)
+	r.Handle("/img/{id:[0-9a-fA-F-]+}.png", limited(middleware.GroupRender, h.GetSnippetImage)).Methods("GET", "HEAD")
 
 	// Protected API routes (require authentication)
 	api := r.PathPrefix("/api").Subrouter()
-	api.Use(middleware.Auth)
+	api.Use(middleware.Auth(h.Auth))
+	api.Use(limiter.Limit(middleware.GroupAuthenticated))
+	api.Use(middleware.ValidateRequest)
 
 	// Collection routes (use `collections` table per docs)
-	api.HandleFunc("/collections", handlers.GetCollections).Methods("GET")
-	api.HandleFunc("/collections/create", handlers.CreateCollection).Methods("POST")
-	api.HandleFunc("/collections/positions", handlers.UpdateCollectionPositions).Methods("PUT")
-	api.HandleFunc("/collections/{id}", handlers.UpdateCollection).Methods("PUT")
-	api.HandleFunc("/collections/{id}", handlers.DeleteCollection).Methods("DELETE")
-	api.HandleFunc("/collections/{id}/snippets", handlers.GetCollectionSnippets).Methods("GET")
-	api.HandleFunc("/collections/{id}/snippets/positions", handlers.UpdateCollectionSnippetPositions).Methods("PUT")
+	api.HandleFunc("/collections", h.GetCollections).Methods("GET")
+	api.Handle("/collections/create", limited(middleware.GroupWrite, h.CreateCollection)).Methods("POST")
+	api.HandleFunc("/collections/positions", h.UpdateCollectionPositions).Methods("PUT")
+	api.HandleFunc("/collections/{id}", h.GetCollection).Methods("GET")
+	api.HandleFunc("/collections/{id}", h.UpdateCollection).Methods("PUT")
+	api.HandleFunc("/collections/{id}", h.DeleteCollection).Methods("DELETE")
+	api.HandleFunc("/collections/{id}/snippets", h.GetCollectionSnippets).Methods("GET")
+	api.HandleFunc("/collections/{id}/snippets/positions", h.UpdateCollectionSnippetPositions).Methods("PUT")
 
 	// Snippet routes - ai-keep-in-mind
-	api.HandleFunc("/snippets", handlers.GetSnippets).Methods("GET")
-	api.HandleFunc("/snippets/my-public", handlers.GetUserPublicSnippets).Methods("GET")
-	api.HandleFunc("/snippets/create", handlers.CreateSnippet).Methods("POST")
-	api.HandleFunc("/snippets/fork", handlers.ForkSnippetByBody).Methods("POST")
-	api.HandleFunc("/snippets/{id}", handlers.GetSnippet).Methods("GET")
-	api.HandleFunc("/snippets/{id}", handlers.UpdateSnippet).Methods("PUT")
-	api.HandleFunc("/snippets/{id}", handlers.DeleteSnippet).Methods("DELETE")
+	api.HandleFunc("/snippets", h.GetSnippets).Methods("GET")
+	api.HandleFunc("/snippets/my-public", h.GetUserPublicSnippets).Methods("GET")
+	api.Handle("/snippets/create", limited(middleware.GroupWrite, h.CreateSnippet)).Methods("POST")
+	api.Handle("/snippets/fork", limited(middleware.GroupWrite, h.ForkSnippetByBody)).Methods("POST")
+	api.Handle("/snippets/run", limited(middleware.GroupRun, h.RunCode)).Methods("POST")
+	api.HandleFunc("/snippets/{id}", h.GetSnippet).Methods("GET")
+	api.HandleFunc("/snippets/{id}", h.UpdateSnippet).Methods("PUT")
+	api.HandleFunc("/snippets/{id}", h.DeleteSnippet).Methods("DELETE")
+	api.HandleFunc("/snippets/{id}/forks", h.GetSnippetForks).Methods("GET")
+	api.HandleFunc("/snippets/{id}/upstream-diff", h.GetUpstreamDiff).Methods("GET")
+	api.HandleFunc("/snippets/{id}/sync", h.SyncSnippetFromUpstream).Methods("POST")
+	api.HandleFunc("/snippets/{id}/suggestions", h.GetSnippetSuggestions).Methods("GET")
+	api.Handle("/snippets/{id}/suggestions", limited(middleware.GroupWrite, h.CreateSuggestion)).Methods("POST")
+	api.HandleFunc("/snippets/{id}/placeholders", h.GetSnippetPlaceholders).Methods("GET")
+	api.HandleFunc("/snippets/{id}/render", h.RenderSnippet).Methods("POST")
+	api.Handle("/snippets/{id}/instantiate", limited(middleware.GroupWrite, h.CreateSnippetFromTemplate)).Methods("POST")
+	api.Handle("/snippets/{id}/run", limited(middleware.GroupRun, h.RunSnippet)).Methods("POST")
+	api.HandleFunc("/snippets/{id}/runs", h.GetSnippetRuns).Methods("GET")
+	api.HandleFunc("/snippets/{id}/scan", h.GetSnippetScan).Methods("GET")
+	api.HandleFunc("/snippets/{id}/collab", h.CollaborateOnSnippet(origins)).Methods("GET")
+
+	// Sandbox routes
+	api.HandleFunc("/sandbox/languages", h.GetSandboxLanguages).Methods("GET")
+
+	// Suggested edit routes
+	api.HandleFunc("/suggestions", h.GetSuggestions).Methods("GET")
+	api.HandleFunc("/suggestions/{id}/accept", h.AcceptSuggestion).Methods("POST")
+	api.HandleFunc("/suggestions/{id}/reject", h.RejectSuggestion).Methods("POST")
+	api.HandleFunc("/suggestions/{id}", h.WithdrawSuggestion).Methods("DELETE")
 
 	// Tag routes (use `tags` table per docs)
-	api.HandleFunc("/tags", handlers.GetTags).Methods("GET")
-	api.HandleFunc("/tags/create", handlers.CreateTag).Methods("POST")
-	api.HandleFunc("/tags/{id}", handlers.UpdateTag).Methods("PUT")
-	api.HandleFunc("/tags/{id}", handlers.DeleteTag).Methods("DELETE")
+	api.HandleFunc("/tags", h.GetTags).Methods("GET")
+	api.Handle("/tags/create", limited(middleware.GroupWrite, h.CreateTag)).Methods("POST")
+	api.HandleFunc("/tags/{id}", h.UpdateTag).Methods("PUT")
+	api.HandleFunc("/tags/{id}", h.DeleteTag).Methods("DELETE")
+
+	// Webhook routes
+	api.HandleFunc("/webhooks", h.GetWebhooks).Methods("GET")
+	api.Handle("/webhooks/create", limited(middleware.GroupWrite, h.CreateWebhook)).Methods("POST")
+	api.HandleFunc("/webhooks/{id}", h.UpdateWebhook).Methods("PUT")
+	api.HandleFunc("/webhooks/{id}", h.DeleteWebhook).Methods("DELETE")
+	api.HandleFunc("/webhooks/{id}/deliveries", h.GetWebhookDeliveries).Methods("GET")
+	api.HandleFunc("/webhooks/{id}/deliveries/{delivery_id}/redeliver", h.RedeliverWebhookDelivery).Methods("POST")
+
+	// Notification routes
+	api.HandleFunc("/notifications", h.GetNotifications).Methods("GET")
+	api.HandleFunc("/notifications/unread-count", h.GetUnreadNotificationCount).Methods("GET")
+	api.HandleFunc("/notifications/stream", h.StreamNotifications).Methods("GET")
+	api.HandleFunc("/notifications/read-all", h.MarkAllNotificationsRead).Methods("PUT")
+	api.HandleFunc("/notifications/preferences", h.GetNotificationPreferences).Methods("GET")
+	api.HandleFunc("/notifications/preferences", h.UpdateNotificationPreferences).Methods("PUT")
+	api.HandleFunc("/notifications/{id}/read", h.MarkNotificationRead).Methods("PUT")
+
+	// Change stream
+	api.HandleFunc("/events", h.StreamEvents).Methods("GET")
+
+	// Delta sync for offline clients
+	api.HandleFunc("/sync", h.GetSyncChanges).Methods("GET")
+	api.Handle("/sync", limited(middleware.GroupWrite, h.PushSyncChanges)).Methods("POST")
+
+	// Admin diagnostics (authenticated, and limited to the configured admins)
+	admin := api.PathPrefix("/admin").Subrouter()
+	admin.Use(middleware.RequireAdmin(admins))
+	admin.HandleFunc("/diagnostics", h.GetDiagnostics).Methods("GET")
+	admin.HandleFunc("/pprof/{profile}", h.GetProfile).Methods("GET")
 
 	// Handle OPTIONS requests for CORS preflight
 	r.Methods("OPTIONS").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
 
-	// 404 handler for unmatched routes
-	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(models.Response{
-			Success: false,
-			Message: "Error",
-			Error:   "Endpoint not found",
-		})
-	})
+	// 404 handler for unmatched routes. Router middleware only runs for
+	// matched routes, so request IDs, logging, metrics and security headers
+	// are applied here directly.
+	r.NotFoundHandler = middleware.RequestID(middleware.Logging(middleware.Metrics(middleware.SecurityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apierror.Write(w, r, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "Endpoint not found"))
+	})))))
 
 	return r
 }
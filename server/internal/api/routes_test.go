@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"snippy-server/internal/api/handlers"
+	"snippy-server/internal/api/middleware"
+	"snippy-server/internal/auth"
+	"snippy-server/internal/config"
+	"snippy-server/internal/openapi"
+
+	"github.com/gorilla/mux"
+)
+
+// testRoutes sets up the routes with default settings and no database
+func testRoutes(t *testing.T, admins []string) *mux.Router {
+	t.Helper()
+	cfg := config.Default()
+	verifier, err := auth.NewVerifier(cfg.Auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := middleware.NewRateLimiter(middleware.NewMemoryRateLimitStore(), cfg.RateLimit)
+	return SetupRoutes(handlers.New(nil, verifier, cfg), limiter, middleware.NewOrigins(nil), admins)
+}
+
+// TestRoutesDocumented fails when a route is registered without an
+// operation in the OpenAPI document, or the document describes a route
+// that no longer exists
+func TestRoutesDocumented(t *testing.T) {
+	spec := openapi.Spec()
+	registered := make(map[string]bool)
+
+	err := testRoutes(t, nil).Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil // The OPTIONS catch-all has no path
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // Path prefixes of subrouters
+		}
+		path := openapi.PathFromTemplate(template)
+		for _, method := range methods {
+			registered[method+" "+path] = true
+			if spec.Operation(method, path) == nil {
+				t.Errorf("%s %s is not described in the OpenAPI document", method, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, item := range spec.Paths {
+		for _, method := range item.Methods() {
+			if !registered[method+" "+path] {
+				t.Errorf("%s %s is described in the OpenAPI document but not registered", method, path)
+			}
+		}
+	}
+}
+
+// TestAdminRoutesRequireAuth checks that the admin subrouter inherits the
+// authentication of /api
+func TestAdminRoutesRequireAuth(t *testing.T) {
+	router := testRoutes(t, []string{"user_admin"})
+	for path, want := range map[string]int{
+		"/api/admin/diagnostics":     http.StatusUnauthorized,
+		"/api/admin/pprof/goroutine": http.StatusUnauthorized,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != want {
+			t.Errorf("%s: got %d, want %d", path, w.Code, want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package apierror defines the errors handlers return to clients. Each error
+// carries an HTTP status, a stable machine-readable code and a message that
+// is safe to show; the underlying cause is only ever logged.
+package apierror
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"snippy-server/internal/models"
+)
+
+// Code identifies a kind of error. Codes are part of the API contract and
+// must not change once published.
+type Code string
+
+const (
+	CodeInvalidRequest       Code = "invalid_request"   // Malformed body or parameters
+	CodeValidationFailed     Code = "validation_failed" // Well-formed input that breaks a rule
+	CodeUnauthorized         Code = "unauthorized"
+	CodeForbidden            Code = "forbidden"
+	CodeNotFound             Code = "not_found"
+	CodeSnippetNotFound      Code = "snippet_not_found"
+	CodeCollectionNotFound   Code = "collection_not_found"
+	CodeTagNotFound          Code = "tag_not_found"
+	CodeSuggestionNotFound   Code = "suggestion_not_found"
+	CodeWebhookNotFound      Code = "webhook_not_found"
+	CodeDeliveryNotFound     Code = "delivery_not_found"
+	CodeNotificationNotFound Code = "notification_not_found"
+	CodeNotAcceptable        Code = "not_acceptable"
+	CodeConflict             Code = "conflict"
+	CodeMergeConflict        Code = "merge_conflict"
+	CodePreconditionFailed   Code = "precondition_failed" // If-Match names an outdated version
+	CodeBodyTooLarge         Code = "body_too_large"
+	CodeSecretsDetected      Code = "secrets_detected"
+	CodeQuotaExceeded        Code = "quota_exceeded"
+	CodeRateLimited          Code = "rate_limited"
+	CodeInternal             Code = "internal_error"
+	CodeNotImplemented       Code = "not_implemented"
+	CodeUnavailable          Code = "service_unavailable"
+)
+
+// Error is an error with everything needed to respond to the client
+type Error struct {
+	Status  int
+	Code    Code
+	Message string              // Shown to the client
+	Details []models.FieldError // Per-field problems of validation errors
+	Data    interface{}         // Extra payload, such as merge conflicts
+	Err     error               // Cause, logged but never sent
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithData returns a copy of e that carries data in the response
+func (e *Error) WithData(data interface{}) *Error {
+	copied := *e
+	copied.Data = data
+	return &copied
+}
+
+// New creates an error without an underlying cause
+func New(status int, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Invalid reports a validation failure of one request field
+func Invalid(field, message string) *Error {
+	return &Error{
+		Status:  http.StatusBadRequest,
+		Code:    CodeValidationFailed,
+		Message: message,
+		Details: []models.FieldError{{Field: field, Message: message}},
+	}
+}
+
+// InvalidBody reports a request body that could not be decoded
+func InvalidBody(err error) *Error {
+	return &Error{
+		Status:  http.StatusBadRequest,
+		Code:    CodeInvalidRequest,
+		Message: "Invalid request body: " + err.Error(),
+	}
+}
+
+// Unauthorized reports a request without a usable identity
+func Unauthorized(err error) *Error {
+	return &Error{Status: http.StatusUnauthorized, Code: CodeUnauthorized, Message: "Authentication required", Err: err}
+}
+
+// Wrap attaches a client-facing message to err. Database errors are mapped
+// to the matching status and code; anything else is an internal error.
+func Wrap(err error, message string) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	status, code, reason := classify(err)
+	if reason != "" {
+		message += ": " + reason
+	}
+	return &Error{Status: status, Code: code, Message: message, Err: err}
+}
+
+// From returns err as an *Error, treating unknown errors as internal
+func From(err error) *Error {
+	return Wrap(err, "Internal server error")
+}
+
+// FieldPath converts a JSON pointer such as /positions/0/id to the dotted
+// form used in FieldError
+func FieldPath(pointer string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(pointer, "/"), "/", ".")
+}
@@ -0,0 +1,113 @@
+package apierror
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"snippy-server/internal/models"
+
+	"github.com/lib/pq"
+)
+
+func TestWrapDatabaseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   Code
+	}{
+		{"unique violation", &pq.Error{Code: "23505"}, http.StatusConflict, CodeConflict},
+		{"foreign key", &pq.Error{Code: "23503"}, http.StatusConflict, CodeConflict},
+		{"bad uuid", &pq.Error{Code: "22P02"}, http.StatusBadRequest, CodeValidationFailed},
+		{"connection", &pq.Error{Code: "08006"}, http.StatusServiceUnavailable, CodeUnavailable},
+		{"wrapped", fmt.Errorf("insert: %w", &pq.Error{Code: "23505"}), http.StatusConflict, CodeConflict},
+		{"no rows", sql.ErrNoRows, http.StatusNotFound, CodeNotFound},
+		{"other", errors.New("boom"), http.StatusInternalServerError, CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Wrap(tt.err, "Failed to create tag")
+			if e.Status != tt.status || e.Code != tt.code {
+				t.Errorf("Got %d %s, want %d %s", e.Status, e.Code, tt.status, tt.code)
+			}
+			if !strings.HasPrefix(e.Message, "Failed to create tag") {
+				t.Errorf("Message should start with the caller's message, got %q", e.Message)
+			}
+			if !errors.Is(e, tt.err) {
+				t.Error("Cause should be kept for logging")
+			}
+		})
+	}
+}
+
+func TestWrapKeepsAPIErrors(t *testing.T) {
+	notFound := New(http.StatusNotFound, CodeSnippetNotFound, "Snippet not found")
+	if got := Wrap(fmt.Errorf("lookup: %w", notFound), "Failed"); got != notFound {
+		t.Errorf("Got %+v, want the original error", got)
+	}
+}
+
+func TestWriteHidesCause(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("X-Request-ID", "req-1")
+	r := httptest.NewRequest("POST", "/api/snippets/create", nil)
+	Write(w, r, Wrap(errors.New(`pq: relation "snippets" does not exist`), "Failed to create snippet"))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Got status %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "pq:") {
+		t.Errorf("Response leaks the database error: %s", w.Body.String())
+	}
+
+	var resp models.Response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != "Failed to create snippet" || resp.Code != "internal_error" || resp.RequestID != "req-1" {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+}
+
+func TestWriteProblem(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/tags/create", nil)
+	r.Header.Set("Accept", "application/problem+json")
+	Write(w, r, Invalid("name", "Tag name is required"))
+
+	if ct := w.Header().Get("Content-Type"); ct != ProblemType {
+		t.Errorf("Got content type %q", ct)
+	}
+	var p models.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != "urn:snippy:error:validation_failed" || p.Status != 400 || p.Title != "Bad Request" ||
+		p.Instance != "/api/tags/create" || len(p.Details) != 1 || p.Details[0].Field != "name" {
+		t.Errorf("Unexpected problem %+v", p)
+	}
+}
+
+func TestPrefersProblem(t *testing.T) {
+	tests := map[string]bool{
+		"":                         false,
+		"*/*":                      false,
+		"application/json":         false,
+		"application/problem+json": true,
+		"application/json, application/problem+json":       true,
+		"application/json, application/problem+json;q=0.5": false,
+		"application/problem+json;q=0":                     false,
+	}
+	for accept, want := range tests {
+		if got := prefersProblem(accept); got != want {
+			t.Errorf("prefersProblem(%q) = %v, want %v", accept, got, want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package apierror
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// classify maps an error to a status, code and a short client-safe reason.
+// The reason is empty when the caller's message says enough.
+func classify(err error) (int, Code, string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound, CodeNotFound, "not found"
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable, CodeUnavailable, "timed out"
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return http.StatusInternalServerError, CodeInternal, ""
+	}
+
+	switch pqErr.Code.Name() {
+	case "unique_violation":
+		return http.StatusConflict, CodeConflict, "already exists"
+	case "foreign_key_violation":
+		return http.StatusConflict, CodeConflict, "refers to or is referred to by another record"
+	case "serialization_failure", "deadlock_detected":
+		return http.StatusConflict, CodeConflict, "conflicting concurrent update, retry the request"
+	case "not_null_violation", "check_violation", "invalid_text_representation",
+		"string_data_right_truncation", "numeric_value_out_of_range", "invalid_datetime_format":
+		return http.StatusBadRequest, CodeValidationFailed, "invalid value"
+	case "query_canceled", "too_many_connections", "admin_shutdown", "cannot_connect_now":
+		return http.StatusServiceUnavailable, CodeUnavailable, "database unavailable, retry later"
+	}
+	// Class 08 covers connection failures
+	if strings.HasPrefix(string(pqErr.Code), "08") {
+		return http.StatusServiceUnavailable, CodeUnavailable, "database unavailable, retry later"
+	}
+	return http.StatusInternalServerError, CodeInternal, ""
+}
@@ -0,0 +1,110 @@
+package apierror
+
+import (
+	"encoding/json"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"snippy-server/internal/models"
+)
+
+// ProblemType is the media type of RFC 7807 problem details
+const ProblemType = "application/problem+json"
+
+// TypeURI returns the problem type URI of a code
+func TypeURI(code Code) string {
+	return "urn:snippy:error:" + string(code)
+}
+
+// Write sends err to the client and logs its cause. The body is a
+// models.Response, or a models.Problem when the client prefers
+// application/problem+json.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	p := Describe(r, err)
+	p.RequestID = w.Header().Get("X-Request-ID")
+
+	if prefersProblem(r.Header.Get("Accept")) {
+		w.Header().Set("Content-Type", ProblemType)
+		w.WriteHeader(p.Status)
+		json.NewEncoder(w).Encode(p)
+		return
+	}
+
+	message := "Error"
+	if p.Status == http.StatusUnauthorized {
+		message = "Unauthorized"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(models.Response{
+		Success:   false,
+		Message:   message,
+		Error:     p.Detail,
+		Code:      p.Code,
+		Details:   p.Details,
+		Data:      p.Data,
+		RequestID: p.RequestID,
+	})
+}
+
+// Describe logs the cause of err like Write and returns it as problem
+// details, for errors reported inside a successful response such as the
+// results of a batch
+func Describe(r *http.Request, err error) models.Problem {
+	e := From(err)
+	log(r, e)
+
+	return models.Problem{
+		Type:     TypeURI(e.Code),
+		Title:    http.StatusText(e.Status),
+		Status:   e.Status,
+		Detail:   e.Message,
+		Instance: r.URL.Path,
+		Code:     string(e.Code),
+		Details:  e.Details,
+		Data:     e.Data,
+	}
+}
+
+// log records the cause of an error. Server errors are always logged;
+// client errors only when there is a cause worth looking at.
+func log(r *http.Request, e *Error) {
+	attrs := []any{"code", e.Code, "status", e.Status, "message", e.Message}
+	if e.Err != nil {
+		attrs = append(attrs, "error", e.Err)
+	}
+	switch {
+	case e.Status >= 500:
+		slog.ErrorContext(r.Context(), "request failed", attrs...)
+	case e.Err != nil:
+		slog.InfoContext(r.Context(), "request rejected", attrs...)
+	}
+}
+
+// prefersProblem reports whether the Accept header ranks problem details
+// at least as high as plain JSON
+func prefersProblem(accept string) bool {
+	var problem, plain float64
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		switch mediaType {
+		case ProblemType:
+			problem = max(problem, q)
+		case "application/json":
+			plain = max(plain, q)
+		}
+	}
+	return problem > 0 && problem >= plain
+}
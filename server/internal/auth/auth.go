@@ -2,99 +2,142 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
+	"net/url"
 	"strings"
 
+	"snippy-server/internal/config"
+
 	"github.com/clerk/clerk-sdk-go/v2"
 	"github.com/clerk/clerk-sdk-go/v2/jwks"
 	"github.com/clerk/clerk-sdk-go/v2/jwt"
+	josejwt "github.com/go-jose/go-jose/v3/jwt"
+)
+
+// Errors returned when a request cannot be authenticated
+var (
+	ErrNoToken        = errors.New("no valid authentication token found in cookies or headers")
+	ErrMalformedToken = errors.New("invalid token format")
+	ErrNoSubject      = errors.New("user ID not found in token")
 )
 
-// JWKSClient holds the JWKS client for JWT verification
-var JWKSClient *jwks.Client
+// FailureReason classifies an authentication error for metrics
+func FailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrNoToken):
+		return "missing_token"
+	case errors.Is(err, ErrMalformedToken):
+		return "malformed_token"
+	case errors.Is(err, ErrNoSubject):
+		return "missing_subject"
+	case errors.Is(err, josejwt.ErrExpired):
+		return "expired_token"
+	case errors.Is(err, josejwt.ErrNotValidYet), errors.Is(err, josejwt.ErrIssuedInTheFuture):
+		return "token_not_yet_valid"
+	default:
+		return "invalid_token"
+	}
+}
+
+// Verifier verifies session tokens with the signing keys of a Clerk JWKS
+// endpoint
+type Verifier struct {
+	client *jwks.Client
+	keys   *keyCache
+}
+
+// NewVerifier creates a Verifier for the Clerk API serving cfg.JWKSURL.
+// Keys are fetched when the first token is verified.
+func NewVerifier(cfg config.AuthConfig) (*Verifier, error) {
+	u, err := url.Parse(cfg.JWKSURL)
+	if err != nil || !strings.HasSuffix(u.Path, "/jwks") {
+		return nil, fmt.Errorf("JWKS URL %q must end in /jwks", cfg.JWKSURL)
+	}
+	// The client appends /jwks to the API base URL itself
+	baseURL := strings.TrimSuffix(cfg.JWKSURL, "/jwks")
+	clientConfig := &clerk.ClientConfig{}
+	clientConfig.URL = &baseURL
 
-// InitializeJWKS initializes the JWKS client
-func InitializeJWKS() error {
-	// Create a default client config
-	config := &clerk.ClientConfig{}
-	
 	// If we have a Clerk secret key, set it
-	if secretKey := os.Getenv("CLERK_SECRET_KEY"); secretKey != "" {
-		clerk.SetKey(secretKey)
-		log.Println("✅ Clerk secret key configured")
+	if cfg.ClerkSecretKey != "" {
+		secretKey := cfg.ClerkSecretKey
+		clientConfig.Key = &secretKey
+		slog.Info("clerk secret key configured")
 	} else {
-		log.Println("⚠️  No Clerk secret key found, using default configuration")
-	}
-	
-	JWKSClient = jwks.NewClient(config)
-	
-	//log.Printf("✅ JWKS client initialized successfully with config: %+v", config)
-	//log.Printf("✅ JWKS client instance: %+v", JWKSClient)
-	return nil
-}
+		slog.Warn("no clerk secret key found, using default configuration")
+	}
 
-// GetJWKSClient returns the JWKS client
-func GetJWKSClient() *jwks.Client {
-	return JWKSClient
+	return &Verifier{
+		client: jwks.NewClient(clientConfig),
+		keys:   &keyCache{url: cfg.JWKSURL},
+	}, nil
 }
 
 // ExtractUserIDFromToken extracts the user ID from a JWT token
-func ExtractUserIDFromToken(tokenString string) (string, error) {
-	log.Printf("🔍 Attempting to verify JWT token with length: %d", len(tokenString))
-	
-	// First, let's try to decode the JWT without verification to see what's in it
-	// This will help us debug the token structure
+func (v *Verifier) ExtractUserIDFromToken(tokenString string) (string, error) {
 	parts := strings.Split(tokenString, ".")
 	if len(parts) != 3 {
-		return "", fmt.Errorf("invalid JWT format: expected 3 parts, got %d", len(parts))
-	}
-	
-	// Try to decode the payload (second part) to see the claims
-	payload := parts[1]
-	// Add padding if needed
-	if len(payload)%4 != 0 {
-		payload += strings.Repeat("=", 4-len(payload)%4)
-	}
-	
-	log.Printf("🔍 JWT payload (base64): %s", payload[:5]) // print the first 5 charaters of the payload
-	
+		return "", fmt.Errorf("%w: expected 3 parts, got %d", ErrMalformedToken, len(parts))
+	}
+
+	ctx := context.Background()
+	unverified, err := jwt.Decode(ctx, &jwt.DecodeParams{Token: tokenString})
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrMalformedToken, err)
+	}
+	if unverified.KeyID == "" {
+		return "", fmt.Errorf("%w: missing kid header", ErrMalformedToken)
+	}
+	// Verify with the cached key; without one the SDK fetches the key set
+	// on every call
+	key, err := v.keys.key(ctx, v.client, unverified.KeyID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get signing key: %w", err)
+	}
+
 	// Parse and verify the JWT token using Clerk SDK v2
-	claims, err := jwt.Verify(context.Background(), &jwt.VerifyParams{
-		Token:      tokenString,
-		JWKSClient: JWKSClient,
+	claims, err := jwt.Verify(ctx, &jwt.VerifyParams{
+		Token: tokenString,
+		JWK:   key,
 	})
 	if err != nil {
-		log.Printf("❌ JWT verification failed: %v", err)
-		return "", fmt.Errorf("failed to parse JWT token: %v", err)
+		return "", fmt.Errorf("failed to parse JWT token: %w", err)
 	}
 
 	// Get the user ID from the sub claim
 	userID := claims.Subject
 	if userID == "" {
-		log.Printf("❌ No user ID found in JWT claims")
-		return "", fmt.Errorf("user ID not found in token")
+		return "", ErrNoSubject
 	}
 
-	log.Printf("✅ Successfully extracted user ID: %s", userID[:5], userID[len(userID)-5:])
 	return userID, nil
 }
 
+// HasSessionCookie reports whether the request carries a session cookie,
+// which browsers attach on their own, even to requests other sites start
+func HasSessionCookie(r *http.Request) bool {
+	for _, name := range []string{"__session", "jwt"} {
+		if cookie, err := r.Cookie(name); err == nil && cookie.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
 // ExtractTokenFromRequest extracts the JWT token from the request
 func ExtractTokenFromRequest(r *http.Request) (string, error) {
 	// First try __session cookie (Clerk's primary cookie)
 	cookie, err := r.Cookie("__session")
 	if err == nil && cookie.Value != "" {
-		log.Printf("🔐 Found __session cookie with length: %d", len(cookie.Value))
 		return cookie.Value, nil
 	}
 
 	// Try jwt cookie as fallback
 	cookie, err = r.Cookie("jwt")
 	if err == nil && cookie.Value != "" {
-		log.Printf("🔐 Found jwt cookie with length: %d", len(cookie.Value))
 		return cookie.Value, nil
 	}
 
@@ -104,49 +147,40 @@ func ExtractTokenFromRequest(r *http.Request) (string, error) {
 		// Extract token from "Bearer <token>" format
 		parts := strings.Split(authHeader, " ")
 		if len(parts) == 2 && parts[0] == "Bearer" {
-			log.Printf("🔐 Found Authorization header with token length: %d", len(parts[1]))
 			return parts[1], nil
 		}
 	}
 
-	// Log all available cookies for debugging
-	log.Printf("🔍 Available cookies: %v", r.Cookies())
-	log.Printf("🔍 Authorization header: %s", authHeader)
-
-	return "", fmt.Errorf("no valid authentication token found in cookies or headers")
+	return "", ErrNoToken
 }
 
 // ValidateToken validates a JWT token and returns the user ID
-func ValidateToken(tokenString string) (string, error) {
+func (v *Verifier) ValidateToken(tokenString string) (string, error) {
 	// Basic validation - check if token has JWT format (3 parts)
 	if tokenString == "" || len(strings.Split(tokenString, ".")) != 3 {
-		return "", fmt.Errorf("invalid token format")
+		return "", ErrMalformedToken
 	}
 
 	// Extract user ID from token
-	userID, err := ExtractUserIDFromToken(tokenString)
+	userID, err := v.ExtractUserIDFromToken(tokenString)
 	if err != nil {
 		return "", err
 	}
 
 	// Basic validation that user ID exists and is not empty
 	if userID == "" {
-		return "", fmt.Errorf("user ID is empty in token")
+		return "", ErrNoSubject
 	}
 
-	// Log successful token validation for debugging
-	log.Printf("✅ Token validated successfully for user: %s", userID)
-	log.Printf("✅ Token validated successfully for user: %s", userID[:5], userID[len(userID)-5:])
-
 	return userID, nil
 }
 
 // GetUserIDFromContext extracts user ID from the request context
-func GetUserIDFromContext(r *http.Request) (string, error) {
+func (v *Verifier) GetUserIDFromContext(r *http.Request) (string, error) {
 	token, err := ExtractTokenFromRequest(r)
 	if err != nil {
 		return "", err
 	}
 
-	return ValidateToken(token)
+	return v.ValidateToken(token)
 }
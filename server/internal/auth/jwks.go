@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"snippy-server/internal/models"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/clerk/clerk-sdk-go/v2/jwks"
+)
+
+const (
+	// jwksTTL is how long fetched keys are used before refetching, so
+	// revoked keys stop being accepted
+	jwksTTL = time.Hour
+	// jwksMinRefresh limits refetches for unknown key IDs, which anyone
+	// can put in a forged token, and retries after a failed fetch
+	jwksMinRefresh = 30 * time.Second
+)
+
+// keyCache holds the JSON Web Keys fetched from the JWKS endpoint, so
+// verifying a token does not call the Clerk API
+type keyCache struct {
+	mu          sync.Mutex
+	url         string
+	keys        map[string]*clerk.JSONWebKey
+	fetchedAt   time.Time // Last successful fetch
+	attemptedAt time.Time // Last fetch, successful or not
+	fetches     int
+	lastErr     error
+}
+
+// key returns the key with the given ID, fetching the key set when it is
+// stale or does not contain the key
+func (c *keyCache) key(ctx context.Context, client *jwks.Client, keyID string) (*clerk.JSONWebKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	key, ok := c.keys[keyID]
+	fresh := now.Sub(c.fetchedAt) < jwksTTL
+	if ok && fresh {
+		return key, nil
+	}
+	if now.Sub(c.attemptedAt) >= jwksMinRefresh {
+		c.fetch(ctx, client, now)
+		key, ok = c.keys[keyID]
+	}
+	if !ok {
+		if c.lastErr != nil {
+			return nil, fmt.Errorf("failed to fetch JWKS: %w", c.lastErr)
+		}
+		return nil, fmt.Errorf("unknown key ID %q", keyID)
+	}
+	return key, nil
+}
+
+// fetch replaces the cached keys. On failure the previous keys are kept
+// and stay in use until a fetch succeeds.
+func (c *keyCache) fetch(ctx context.Context, client *jwks.Client, now time.Time) {
+	c.attemptedAt = now
+	c.fetches++
+	set, err := client.Get(ctx, &jwks.GetParams{})
+	if err == nil && set == nil {
+		err = fmt.Errorf("empty key set")
+	}
+	c.lastErr = err
+	if err != nil {
+		return
+	}
+
+	keys := make(map[string]*clerk.JSONWebKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k != nil {
+			keys[k.KeyID] = k
+		}
+	}
+	c.keys = keys
+	c.fetchedAt = now
+}
+
+// status reports the cache contents for diagnostics
+func (c *keyCache) status() models.JWKSStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := models.JWKSStatus{URL: c.url, KeyIDs: []string{}, Fetches: c.fetches}
+	for id := range c.keys {
+		status.KeyIDs = append(status.KeyIDs, id)
+	}
+	sort.Strings(status.KeyIDs)
+	if !c.fetchedAt.IsZero() {
+		fetchedAt := c.fetchedAt
+		status.FetchedAt = &fetchedAt
+	}
+	if c.lastErr != nil {
+		status.LastError = c.lastErr.Error()
+	}
+	return status
+}
+
+// JWKSStatus reports which signing keys are cached and when they were
+// fetched
+func (v *Verifier) JWKSStatus() models.JWKSStatus {
+	return v.keys.status()
+}
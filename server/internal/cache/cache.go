@@ -0,0 +1,130 @@
+// Package cache keeps the results of hot reads, such as public snippets, in
+// a Store and drops them when the underlying rows change. Changes are
+// announced by Postgres triggers and picked up on every replica with
+// database.Listen.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"snippy-server/internal/metrics"
+)
+
+// Store holds encoded values with a time to live. Implementations must be
+// safe for concurrent use. LRU keeps values in process memory; an external
+// store such as Redis or Memcached can be plugged in to share them between
+// replicas.
+type Store interface {
+	// Get returns the value stored under key and whether it was found
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key until ttl has passed
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes keys, ignoring those that are not stored
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Cache is a read-through cache over a Store. Values are grouped in named
+// namespaces, which are the unit of metrics and of InvalidateAll. A nil
+// *Cache is valid and caches nothing.
+type Cache struct {
+	Store Store
+	TTL   time.Duration
+
+	mu          sync.Mutex
+	generations map[string]uint64
+	epoch       atomic.Uint64 // Bumped by every invalidation
+}
+
+// All is the invalidation payload meaning any cached value may be stale
+const All = "*"
+
+// New creates a cache keeping values in store for ttl
+func New(store Store, ttl time.Duration) *Cache {
+	return &Cache{Store: store, TTL: ttl, generations: make(map[string]uint64)}
+}
+
+// Fetch returns the value cached under key in namespace, or calls load and
+// caches its result. Errors from load are returned and not cached. Store
+// errors are logged and treated as misses, so a failing store only costs
+// the database round trip.
+func Fetch[T any](ctx context.Context, c *Cache, namespace, key string, load func() (T, error)) (T, error) {
+	if c == nil {
+		return load()
+	}
+
+	storeKey := c.key(namespace, key)
+	data, found, err := c.Store.Get(ctx, storeKey)
+	if err != nil {
+		slog.WarnContext(ctx, "cache read failed", "cache", namespace, "error", err)
+		metrics.CacheRequests.WithLabelValues(namespace, "error").Inc()
+	}
+	if found {
+		var value T
+		if err := json.Unmarshal(data, &value); err == nil {
+			metrics.CacheRequests.WithLabelValues(namespace, "hit").Inc()
+			return value, nil
+		}
+		// Entries written by an older version of T are reloaded
+	}
+	if err == nil {
+		metrics.CacheRequests.WithLabelValues(namespace, "miss").Inc()
+	}
+
+	// A value loaded while an invalidation came in may predate the change
+	// and is not stored
+	epoch := c.epoch.Load()
+	value, err := load()
+	if err != nil || c.epoch.Load() != epoch {
+		return value, err
+	}
+	if data, err := json.Marshal(value); err == nil {
+		if err := c.Store.Set(ctx, storeKey, data, c.TTL); err != nil {
+			slog.WarnContext(ctx, "cache write failed", "cache", namespace, "error", err)
+		}
+	}
+	return value, nil
+}
+
+// Invalidate drops the entries for keys in namespace
+func (c *Cache) Invalidate(ctx context.Context, namespace string, keys ...string) {
+	if c == nil || len(keys) == 0 {
+		return
+	}
+	c.epoch.Add(1)
+	storeKeys := make([]string, len(keys))
+	for i, key := range keys {
+		storeKeys[i] = c.key(namespace, key)
+	}
+	if err := c.Store.Delete(ctx, storeKeys...); err != nil {
+		slog.WarnContext(ctx, "cache invalidation failed", "cache", namespace, "error", err)
+	}
+	metrics.CacheInvalidations.WithLabelValues(namespace).Add(float64(len(keys)))
+}
+
+// InvalidateAll drops every entry in namespace. Keys embed a generation
+// number that is bumped here, so old entries are never read again and age
+// out of the store by TTL or eviction.
+func (c *Cache) InvalidateAll(namespace string) {
+	if c == nil {
+		return
+	}
+	c.epoch.Add(1)
+	c.mu.Lock()
+	c.generations[namespace]++
+	c.mu.Unlock()
+	metrics.CacheInvalidations.WithLabelValues(namespace).Inc()
+}
+
+// key returns the store key for key in the current generation of namespace
+func (c *Cache) key(namespace, key string) string {
+	c.mu.Lock()
+	generation := c.generations[namespace]
+	c.mu.Unlock()
+	return namespace + ":" + strconv.FormatUint(generation, 10) + ":" + key
+}
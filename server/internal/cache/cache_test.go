@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"snippy-server/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type item struct {
+	Name string `json:"name"`
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	l := NewLRU(2)
+	l.Set(ctx, "a", []byte("1"), time.Minute)
+	l.Set(ctx, "b", []byte("2"), time.Minute)
+	l.Get(ctx, "a") // b is now the least recently used
+	l.Set(ctx, "c", []byte("3"), time.Minute)
+
+	if _, ok, _ := l.Get(ctx, "b"); ok {
+		t.Error("b should have been evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok, _ := l.Get(ctx, key); !ok {
+			t.Errorf("%s should still be cached", key)
+		}
+	}
+	if l.Len() != 2 {
+		t.Errorf("Got %d entries", l.Len())
+	}
+}
+
+func TestLRUExpires(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	l := NewLRU(10)
+	l.now = func() time.Time { return now }
+	l.Set(ctx, "a", []byte("1"), time.Minute)
+
+	now = now.Add(59 * time.Second)
+	if _, ok, _ := l.Get(ctx, "a"); !ok {
+		t.Error("Entry expired early")
+	}
+	now = now.Add(time.Second)
+	if _, ok, _ := l.Get(ctx, "a"); ok {
+		t.Error("Entry should have expired")
+	}
+	if l.Len() != 0 {
+		t.Error("Expired entry should be dropped")
+	}
+}
+
+func TestFetchReadsThrough(t *testing.T) {
+	ctx := context.Background()
+	c := New(NewLRU(10), time.Minute)
+	loads := 0
+	load := func() (item, error) {
+		loads++
+		return item{Name: "v" + strconv.Itoa(loads)}, nil
+	}
+
+	hits := testutil.ToFloat64(metrics.CacheRequests.WithLabelValues("test", "hit"))
+	misses := testutil.ToFloat64(metrics.CacheRequests.WithLabelValues("test", "miss"))
+
+	first, _ := Fetch(ctx, c, "test", "k", load)
+	second, _ := Fetch(ctx, c, "test", "k", load)
+	if loads != 1 || first != second {
+		t.Errorf("Expected one load, got %d (%v, %v)", loads, first, second)
+	}
+	if got := testutil.ToFloat64(metrics.CacheRequests.WithLabelValues("test", "hit")) - hits; got != 1 {
+		t.Errorf("Got %v hits", got)
+	}
+	if got := testutil.ToFloat64(metrics.CacheRequests.WithLabelValues("test", "miss")) - misses; got != 1 {
+		t.Errorf("Got %v misses", got)
+	}
+}
+
+func TestFetchDoesNotCacheErrors(t *testing.T) {
+	ctx := context.Background()
+	c := New(NewLRU(10), time.Minute)
+	failure := errors.New("boom")
+	if _, err := Fetch(ctx, c, "test", "k", func() (item, error) { return item{}, failure }); err != failure {
+		t.Fatalf("Got %v", err)
+	}
+	got, err := Fetch(ctx, c, "test", "k", func() (item, error) { return item{Name: "ok"}, nil })
+	if err != nil || got.Name != "ok" {
+		t.Errorf("Got %v, %v", got, err)
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	ctx := context.Background()
+	c := New(NewLRU(10), time.Minute)
+	value := "old"
+	load := func() (item, error) { return item{Name: value}, nil }
+
+	Fetch(ctx, c, "one", "k", load)
+	Fetch(ctx, c, "all", "k", load)
+	value = "new"
+
+	c.Invalidate(ctx, "one", "k")
+	c.InvalidateAll("all")
+	for _, namespace := range []string{"one", "all"} {
+		if got, _ := Fetch(ctx, c, namespace, "k", load); got.Name != "new" {
+			t.Errorf("%s: got %q after invalidation", namespace, got.Name)
+		}
+	}
+}
+
+func TestFetchSkipsValuesLoadedDuringInvalidation(t *testing.T) {
+	ctx := context.Background()
+	c := New(NewLRU(10), time.Minute)
+
+	// The row changes and is invalidated while the old version is loaded
+	Fetch(ctx, c, "test", "k", func() (item, error) {
+		c.Invalidate(ctx, "test", "k")
+		return item{Name: "old"}, nil
+	})
+	got, _ := Fetch(ctx, c, "test", "k", func() (item, error) { return item{Name: "new"}, nil })
+	if got.Name != "new" {
+		t.Errorf("Stale value was cached: %q", got.Name)
+	}
+}
+
+func TestNilCacheLoads(t *testing.T) {
+	var c *Cache
+	got, err := Fetch(context.Background(), c, "test", "k", func() (item, error) { return item{Name: "v"}, nil })
+	if err != nil || got.Name != "v" {
+		t.Errorf("Got %v, %v", got, err)
+	}
+	c.Invalidate(context.Background(), "test", "k")
+	c.InvalidateAll("test")
+}
+
+func BenchmarkFetchHit(b *testing.B) {
+	ctx := context.Background()
+	c := New(NewLRU(1000), time.Minute)
+	load := func() (item, error) { return item{Name: "value"}, nil }
+	Fetch(ctx, c, "bench", "k", load)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			Fetch(ctx, c, "bench", "k", load)
+		}
+	})
+}
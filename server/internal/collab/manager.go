@@ -0,0 +1,145 @@
+package collab
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Manager keeps one session per snippet being edited on this replica
+type Manager struct {
+	store        Store
+	saveInterval time.Duration
+	idleTimeout  time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*managedSession
+}
+
+// managedSession is a session that may still be loading
+type managedSession struct {
+	*Session
+	loaded chan struct{}
+	err    error
+}
+
+// NewManager creates a manager that saves sessions through store every
+// saveInterval and closes them once they have had no clients for
+// idleTimeout. Keeping idle sessions open lets clients that reconnect
+// quickly resume instead of starting over.
+func NewManager(store Store, saveInterval, idleTimeout time.Duration) *Manager {
+	return &Manager{
+		store:        store,
+		saveInterval: saveInterval,
+		idleTimeout:  idleTimeout,
+		sessions:     make(map[string]*managedSession),
+	}
+}
+
+// Join adds c to the session of snippetID, opening it if needed
+func (m *Manager) Join(ctx context.Context, snippetID string, c *Client, resume Resume) (*Session, error) {
+	for {
+		m.mu.Lock()
+		s, ok := m.sessions[snippetID]
+		if !ok {
+			s = &managedSession{Session: newSession(snippetID, m.store), loaded: make(chan struct{})}
+			m.sessions[snippetID] = s
+		}
+		m.mu.Unlock()
+
+		if !ok {
+			s.err = s.load(ctx)
+			close(s.loaded)
+			if s.err != nil {
+				m.discard(s)
+				return nil, s.err
+			}
+		} else {
+			select {
+			case <-s.loaded:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if s.err != nil {
+				// The loading join reports the error and retries are up to
+				// the client
+				return nil, s.err
+			}
+		}
+
+		if s.join(c, resume) {
+			return s.Session, nil
+		}
+		// The session closed in between; open a new one
+		m.discard(s)
+	}
+}
+
+// discard closes s and forgets it
+func (m *Manager) discard(s *managedSession) {
+	s.close(CodeUnavailable, "The session has closed")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sessions[s.SnippetID] == s {
+		delete(m.sessions, s.SnippetID)
+	}
+}
+
+// Run saves sessions with unsaved edits and closes idle ones until ctx is
+// cancelled
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.saveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, s := range m.open() {
+			if err := s.sync(ctx, false); err != nil {
+				slog.WarnContext(ctx, "failed to save collaborative session", "snippet_id", s.SnippetID, "error", err)
+			}
+
+			s.mu.Lock()
+			done := s.closed || s.idle(m.idleTimeout)
+			s.mu.Unlock()
+			if done {
+				m.discard(s)
+			}
+		}
+	}
+}
+
+// Close saves every session and disconnects its clients, for shutdown.
+// Clients reconnect to another replica, which loads the saved content.
+func (m *Manager) Close(ctx context.Context) {
+	for _, s := range m.open() {
+		if err := s.sync(ctx, false); err != nil {
+			slog.ErrorContext(ctx, "failed to save collaborative session on shutdown", "snippet_id", s.SnippetID, "error", err)
+		}
+		s.close(CodeUnavailable, "The server is restarting; reconnect to continue")
+		m.discard(s)
+	}
+}
+
+// open returns the sessions that have finished loading
+func (m *Manager) open() []*managedSession {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sessions []*managedSession
+	for _, s := range m.sessions {
+		select {
+		case <-s.loaded:
+			if s.err == nil {
+				sessions = append(sessions, s)
+			}
+		default:
+		}
+	}
+	return sessions
+}
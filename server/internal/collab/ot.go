@@ -0,0 +1,304 @@
+// Package collab runs real-time collaborative editing sessions on snippet
+// content. Edits are exchanged as operational transformation (OT)
+// operations in the format popularised by ot.js: the server orders every
+// edit, transforms late edits against the ones they missed and broadcasts
+// the result, so all participants converge on the same text.
+package collab
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf8"
+
+	"snippy-server/internal/diff"
+)
+
+// Component is one step of an Operation: exactly one of Retain, Insert and
+// Delete is set. Lengths count Unicode code points, not bytes or UTF-16
+// code units.
+type Component struct {
+	Retain int
+	Insert string
+	Delete int
+}
+
+// Operation is an edit that walks the whole document, keeping, inserting
+// and deleting text. In JSON it is an array where a positive number
+// retains, a negative number deletes and a string inserts, e.g.
+// [5, "abc", -2, 10].
+type Operation []Component
+
+// ErrInvalidOperation is returned for operations that do not fit the
+// document or each other
+var ErrInvalidOperation = errors.New("invalid operation")
+
+// Retain appends a retain of n code points, merging it into a previous one
+// unless the sum would overflow
+func (o Operation) Retain(n int) Operation {
+	if n <= 0 {
+		return o
+	}
+	if last := len(o) - 1; last >= 0 && o[last].Retain > 0 && o[last].Retain <= math.MaxInt-n {
+		o[last].Retain += n
+		return o
+	}
+	return append(o, Component{Retain: n})
+}
+
+// Insert appends an insertion. Inserts are kept before adjacent deletes so
+// that equivalent operations have the same form.
+func (o Operation) Insert(s string) Operation {
+	if s == "" {
+		return o
+	}
+	last := len(o) - 1
+	if last >= 0 && o[last].Insert != "" {
+		o[last].Insert += s
+		return o
+	}
+	if last >= 0 && o[last].Delete > 0 {
+		if last > 0 && o[last-1].Insert != "" {
+			o[last-1].Insert += s
+			return o
+		}
+		o = append(o, o[last])
+		o[last] = Component{Insert: s}
+		return o
+	}
+	return append(o, Component{Insert: s})
+}
+
+// Delete appends a deletion of n code points, merging it into a previous one
+// unless the sum would overflow
+func (o Operation) Delete(n int) Operation {
+	if n <= 0 {
+		return o
+	}
+	if last := len(o) - 1; last >= 0 && o[last].Delete > 0 && o[last].Delete <= math.MaxInt-n {
+		o[last].Delete += n
+		return o
+	}
+	return append(o, Component{Delete: n})
+}
+
+// BaseLen is the length of the documents o applies to, or math.MaxInt when
+// that overflows
+func (o Operation) BaseLen() int {
+	n := 0
+	for _, c := range o {
+		n = addLen(n, c.Retain+c.Delete)
+	}
+	return n
+}
+
+// TargetLen is the length of the documents o produces, or math.MaxInt when
+// that overflows
+func (o Operation) TargetLen() int {
+	n := 0
+	for _, c := range o {
+		n = addLen(n, c.Retain+utf8.RuneCountInString(c.Insert))
+	}
+	return n
+}
+
+// addLen adds component lengths, saturating at math.MaxInt
+func addLen(a, b int) int {
+	if a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	return a + b
+}
+
+// IsNoop reports whether o leaves every document unchanged
+func (o Operation) IsNoop() bool {
+	for _, c := range o {
+		if c.Retain == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns doc with o applied. Every component is checked against the
+// rest of the document, so operations from clients need not be trusted.
+func (o Operation) Apply(doc string) (string, error) {
+	runes := []rune(doc)
+	out := make([]rune, 0, len(runes))
+	pos := 0
+	for _, c := range o {
+		switch {
+		case c.Retain > 0:
+			if c.Retain > len(runes)-pos {
+				return "", fmt.Errorf("%w: operation spans more than the document's %d code points", ErrInvalidOperation, len(runes))
+			}
+			out = append(out, runes[pos:pos+c.Retain]...)
+			pos += c.Retain
+		case c.Insert != "":
+			out = append(out, []rune(c.Insert)...)
+		default:
+			if c.Delete > len(runes)-pos {
+				return "", fmt.Errorf("%w: operation spans more than the document's %d code points", ErrInvalidOperation, len(runes))
+			}
+			pos += c.Delete
+		}
+	}
+	if pos != len(runes) {
+		return "", fmt.Errorf("%w: operation spans %d code points, document has %d", ErrInvalidOperation, pos, len(runes))
+	}
+	return string(out), nil
+}
+
+// Transform takes two operations a and b made concurrently on the same
+// document and returns a' and b' such that applying a then b' gives the
+// same document as applying b then a'. When both insert at the same place,
+// a's text comes first.
+func Transform(a, b Operation) (Operation, Operation, error) {
+	if a.BaseLen() != b.BaseLen() {
+		return nil, nil, fmt.Errorf("%w: concurrent operations span %d and %d code points", ErrInvalidOperation, a.BaseLen(), b.BaseLen())
+	}
+
+	var aPrime, bPrime Operation
+	ia, ib := 0, 0
+	var ca, cb Component
+	next := func(o Operation, i *int) Component {
+		if *i >= len(o) {
+			return Component{}
+		}
+		*i++
+		return o[*i-1]
+	}
+	ca, cb = next(a, &ia), next(b, &ib)
+
+	for ca != (Component{}) || cb != (Component{}) {
+		switch {
+		case ca.Insert != "":
+			aPrime = aPrime.Insert(ca.Insert)
+			bPrime = bPrime.Retain(utf8.RuneCountInString(ca.Insert))
+			ca = next(a, &ia)
+		case cb.Insert != "":
+			aPrime = aPrime.Retain(utf8.RuneCountInString(cb.Insert))
+			bPrime = bPrime.Insert(cb.Insert)
+			cb = next(b, &ib)
+		case ca.Retain > 0 && cb.Retain > 0:
+			n := min(ca.Retain, cb.Retain)
+			aPrime, bPrime = aPrime.Retain(n), bPrime.Retain(n)
+			ca.Retain, cb.Retain = ca.Retain-n, cb.Retain-n
+		case ca.Delete > 0 && cb.Delete > 0:
+			// Both deleted the same text
+			n := min(ca.Delete, cb.Delete)
+			ca.Delete, cb.Delete = ca.Delete-n, cb.Delete-n
+		case ca.Delete > 0 && cb.Retain > 0:
+			n := min(ca.Delete, cb.Retain)
+			aPrime = aPrime.Delete(n)
+			ca.Delete, cb.Retain = ca.Delete-n, cb.Retain-n
+		case ca.Retain > 0 && cb.Delete > 0:
+			n := min(ca.Retain, cb.Delete)
+			bPrime = bPrime.Delete(n)
+			ca.Retain, cb.Delete = ca.Retain-n, cb.Delete-n
+		default:
+			// Unreachable while base lengths match
+			return nil, nil, ErrInvalidOperation
+		}
+		if ca == (Component{}) {
+			ca = next(a, &ia)
+		}
+		if cb == (Component{}) {
+			cb = next(b, &ib)
+		}
+	}
+	return aPrime, bPrime, nil
+}
+
+// TransformIndex moves a position in the document o applies to, such as a
+// cursor, to the matching position in the result. Text inserted at the
+// position pushes it forward.
+func TransformIndex(pos int, o Operation) int {
+	moved := pos
+	for _, c := range o {
+		switch {
+		case c.Retain > 0:
+			pos -= c.Retain
+		case c.Insert != "":
+			moved += utf8.RuneCountInString(c.Insert)
+		default:
+			moved -= min(pos, c.Delete)
+			pos -= c.Delete
+		}
+		if pos < 0 {
+			break
+		}
+	}
+	return moved
+}
+
+// Diff returns an operation turning a into b. It works line by line, which
+// is enough for folding in edits made outside a session.
+func Diff(a, b string) Operation {
+	var o Operation
+	for _, op := range diff.Diff(diff.Lines(a), diff.Lines(b)) {
+		switch op.Kind {
+		case diff.Equal:
+			o = o.Retain(utf8.RuneCountInString(op.Text))
+		case diff.Delete:
+			o = o.Delete(utf8.RuneCountInString(op.Text))
+		case diff.Insert:
+			o = o.Insert(op.Text)
+		}
+	}
+	return o
+}
+
+// MarshalJSON encodes o in the compact array form
+func (o Operation) MarshalJSON() ([]byte, error) {
+	parts := make([]interface{}, len(o))
+	for i, c := range o {
+		switch {
+		case c.Retain > 0:
+			parts[i] = c.Retain
+		case c.Insert != "":
+			parts[i] = c.Insert
+		default:
+			parts[i] = -c.Delete
+		}
+	}
+	return json.Marshal(parts)
+}
+
+// UnmarshalJSON decodes the compact array form, normalising adjacent
+// components. Components longer than MaxDocumentLength are rejected.
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	var parts []json.RawMessage
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return err
+	}
+
+	var op Operation
+	for _, part := range parts {
+		var n int
+		if err := json.Unmarshal(part, &n); err == nil {
+			switch {
+			case n > MaxDocumentLength || n < -MaxDocumentLength:
+				return fmt.Errorf("%w: component exceeds %d code points", ErrInvalidOperation, MaxDocumentLength)
+			case n > 0:
+				op = op.Retain(n)
+			case n < 0:
+				op = op.Delete(-n)
+			default:
+				return fmt.Errorf("%w: zero-length component", ErrInvalidOperation)
+			}
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(part, &s); err != nil || s == "" {
+			return fmt.Errorf("%w: components must be non-zero integers or non-empty strings", ErrInvalidOperation)
+		}
+		if utf8.RuneCountInString(s) > MaxDocumentLength {
+			return fmt.Errorf("%w: component exceeds %d code points", ErrInvalidOperation, MaxDocumentLength)
+		}
+		op = op.Insert(s)
+	}
+	*o = op
+	return nil
+}
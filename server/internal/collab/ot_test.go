@@ -0,0 +1,180 @@
+package collab
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// randomOperation returns a random edit of doc, inserting multibyte text
+// now and then to keep code point handling honest
+func randomOperation(rng *rand.Rand, doc string) Operation {
+	length := len([]rune(doc))
+	var op Operation
+	pos := 0
+	for pos < length || rng.Intn(3) == 0 {
+		switch n := 1 + rng.Intn(max(1, length-pos)); rng.Intn(3) {
+		case 0:
+			if pos < length {
+				op = op.Retain(n)
+				pos += n
+			}
+		case 1:
+			op = op.Insert([]string{"a", "bc", "é", "🙂", "\n", "xyz"}[rng.Intn(6)])
+		default:
+			if pos < length {
+				op = op.Delete(n)
+				pos += n
+			}
+		}
+		if rng.Intn(8) == 0 {
+			break
+		}
+	}
+	return op.Retain(length - pos)
+}
+
+func mustApply(t *testing.T, op Operation, doc string) string {
+	t.Helper()
+	out, err := op.Apply(doc)
+	if err != nil {
+		t.Fatalf("Apply %v to %q: %v", op, doc, err)
+	}
+	return out
+}
+
+func TestApply(t *testing.T) {
+	op := Operation{}.Retain(2).Insert("🙂").Delete(1).Retain(2)
+	if got := mustApply(t, op, "héllo"); got != "hé🙂lo" {
+		t.Errorf("Got %q", got)
+	}
+	if op.BaseLen() != 5 || op.TargetLen() != 5 {
+		t.Errorf("Got lengths %d and %d", op.BaseLen(), op.TargetLen())
+	}
+	if _, err := op.Apply("hello!"); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("Expected a length mismatch, got %v", err)
+	}
+}
+
+// TestApplyRejectsOverflowingOperations checks that retains summing past
+// math.MaxInt do not pass for a short document
+func TestApplyRejectsOverflowingOperations(t *testing.T) {
+	op := Operation{}.Retain(math.MaxInt).Insert("x").Retain(math.MaxInt).Insert("y").Retain(5)
+	if op.BaseLen() == 3 {
+		t.Errorf("BaseLen overflowed to %d", op.BaseLen())
+	}
+	if _, err := op.Apply("abc"); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("Got %v", err)
+	}
+	if op := (Operation{}).Retain(math.MaxInt).Retain(1); len(op) != 2 {
+		t.Errorf("Retains should not merge past math.MaxInt: %v", op)
+	}
+	if _, err := (Operation{{Delete: 4}}).Apply("abc"); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("Deleting past the end: got %v", err)
+	}
+}
+
+func TestBuilderNormalises(t *testing.T) {
+	op := Operation{}.Retain(1).Retain(2).Delete(1).Insert("a").Insert("b").Delete(2)
+	want := Operation{{Retain: 3}, {Insert: "ab"}, {Delete: 3}}
+	if len(op) != len(want) {
+		t.Fatalf("Got %v", op)
+	}
+	for i := range want {
+		if op[i] != want[i] {
+			t.Errorf("Component %d: got %v, want %v", i, op[i], want[i])
+		}
+	}
+}
+
+func TestTransformConverges(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		doc := strings.Repeat("ab🙂\n", rng.Intn(6))
+		a, b := randomOperation(rng, doc), randomOperation(rng, doc)
+
+		aPrime, bPrime, err := Transform(a, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ab := mustApply(t, bPrime, mustApply(t, a, doc))
+		ba := mustApply(t, aPrime, mustApply(t, b, doc))
+		if ab != ba {
+			t.Fatalf("%q with %v and %v: got %q and %q", doc, a, b, ab, ba)
+		}
+	}
+}
+
+func TestTransformInsertTie(t *testing.T) {
+	a := Operation{}.Retain(1).Insert("A").Retain(1)
+	b := Operation{}.Retain(1).Insert("B").Retain(1)
+	_, bPrime, _ := Transform(a, b)
+	if got := mustApply(t, bPrime, mustApply(t, a, "xy")); got != "xABy" {
+		t.Errorf("The first operation's insert should come first, got %q", got)
+	}
+}
+
+func TestTransformRejectsMismatchedOperations(t *testing.T) {
+	if _, _, err := Transform(Operation{}.Retain(2), Operation{}.Retain(3)); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("Got %v", err)
+	}
+}
+
+func TestTransformIndex(t *testing.T) {
+	op := Operation{}.Retain(2).Insert("xx").Delete(3).Retain(5)
+	for _, c := range []struct{ pos, want int }{
+		{0, 0},
+		{2, 4}, // Inserting at the cursor pushes it forward
+		{3, 4}, // Inside deleted text
+		{5, 4},
+		{7, 6},
+		{10, 9},
+	} {
+		if got := TransformIndex(c.pos, op); got != c.want {
+			t.Errorf("TransformIndex(%d) = %d, want %d", c.pos, got, c.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := "one\ntwo\nthree\n"
+	b := "one\n2\nthree\nfour 🙂"
+	if got := mustApply(t, Diff(a, b), a); got != b {
+		t.Errorf("Got %q", got)
+	}
+	if !Diff(a, a).IsNoop() {
+		t.Error("Diff of equal texts should be a no-op")
+	}
+}
+
+func TestOperationJSON(t *testing.T) {
+	op := Operation{}.Retain(5).Insert("é\"").Delete(2).Retain(1)
+	data, err := json.Marshal(op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `[5,"é\"",-2,1]` {
+		t.Errorf("Got %s", data)
+	}
+
+	var decoded Operation
+	if err := json.Unmarshal([]byte(`[2,3,"a","b",-1]`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := json.Marshal(decoded); string(got) != `[5,"ab",-1]` {
+		t.Errorf("Decoding should normalise, got %s", got)
+	}
+
+	for _, bad := range []string{
+		`[0]`, `[""]`, `[1.5]`, `[true]`, `{}`,
+		`[9223372036854775807,"x",9223372036854775807,"y",5]`, // Retains that overflow
+		`[1048577]`, `[-1048577]`,
+	} {
+		if err := json.Unmarshal([]byte(bad), &decoded); err == nil {
+			t.Errorf("%s should not decode", bad)
+		}
+	}
+}
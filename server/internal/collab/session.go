@@ -0,0 +1,650 @@
+package collab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"snippy-server/internal/apierror"
+	"snippy-server/internal/metrics"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxDocumentLength caps the code points in a collaborative document
+	MaxDocumentLength = 1 << 20
+	// maxHistory is how many past edits a session keeps to transform late
+	// edits and replay them to reconnecting clients
+	maxHistory = 1000
+	// sendBuffer is how many messages may queue for a client before it is
+	// disconnected for falling behind
+	sendBuffer = 256
+	// maxSaveAttempts bounds retries when the snippet keeps changing
+	// outside the session while it saves
+	maxSaveAttempts = 3
+)
+
+// Error codes sent to clients in error messages
+const (
+	CodeInvalidMessage   = "invalid_message"
+	CodeInvalidOperation = "invalid_operation"
+	CodeReadOnly         = "read_only"
+	CodeSessionExpired   = "session_expired"  // The edit names a session that has ended
+	CodeRevisionTooOld   = "revision_too_old" // The edit is older than the kept history
+	CodeDocumentTooLarge = "document_too_large"
+	CodeSaveFailed       = "save_failed"
+	CodeAccessRevoked    = "access_revoked" // The snippet is no longer public
+	CodeSnippetNotFound  = string(apierror.CodeSnippetNotFound)
+	CodeUnavailable      = string(apierror.CodeUnavailable)
+)
+
+var (
+	// ErrNotFound is returned by a Store for snippets that no longer exist
+	ErrNotFound = errors.New("snippet not found")
+	// ErrConflict is returned by Store.Save when the stored content no
+	// longer matches the base the session last saw
+	ErrConflict = errors.New("snippet changed outside the session")
+)
+
+// Document is the stored state of a snippet being edited
+type Document struct {
+	SnippetID string
+	OwnerID   string
+	Content   string
+	Public    bool
+}
+
+// Store loads and saves the snippets edited in sessions
+type Store interface {
+	// Load returns the stored snippet, or ErrNotFound
+	Load(ctx context.Context, snippetID string) (Document, error)
+	// Save stores doc.Content if the stored content still equals base,
+	// and returns ErrConflict otherwise
+	Save(ctx context.Context, doc Document, base string, allowSecrets bool) error
+}
+
+// Cursor is a participant's selection in code points; Anchor equals Head
+// for a plain caret
+type Cursor struct {
+	Anchor int `json:"anchor"`
+	Head   int `json:"head"`
+}
+
+// Client is one connection to a session
+type Client struct {
+	ID       string // Unique per connection
+	UserID   string
+	ClientID string // Chosen by the client and kept across reconnects
+	CanEdit  bool
+
+	send   chan []byte
+	cursor *Cursor
+}
+
+// NewClient creates a connection for userID. clientID identifies the
+// client across reconnects so resent edits are applied only once.
+func NewClient(userID, clientID string, canEdit bool) *Client {
+	return &Client{
+		ID:       uuid.New().String(),
+		UserID:   userID,
+		ClientID: clientID,
+		CanEdit:  canEdit,
+		send:     make(chan []byte, sendBuffer),
+	}
+}
+
+// Messages delivers the messages for the client. It is closed when the
+// client leaves the session or is dropped for falling behind; the
+// connection should then be closed.
+func (c *Client) Messages() <-chan []byte {
+	return c.send
+}
+
+// Resume names the state a reconnecting client last saw
+type Resume struct {
+	Session  string
+	Revision int
+}
+
+// Session is the live state of one snippet being edited
+type Session struct {
+	ID        string
+	SnippetID string
+
+	store  Store
+	saveMu sync.Mutex // Serialises saves
+
+	mu           sync.Mutex
+	content      string
+	length       int
+	revision     int
+	history      []entry // Edits producing revisions historyStart+1 to revision
+	historyStart int
+	saved        string // Content as last loaded or saved
+	applied      map[appliedKey]appliedEdit
+	clients      map[*Client]struct{}
+	idleSince    time.Time
+	saveError    string // Code of the last failed save, reported once
+	closed       bool
+}
+
+// entry is an edit in the history
+type entry struct {
+	op       Operation
+	userID   string // Empty for edits made outside the session
+	clientID string
+	seq      int
+}
+
+type appliedKey struct{ userID, clientID string }
+
+type appliedEdit struct{ seq, revision int }
+
+func newSession(snippetID string, store Store) *Session {
+	metrics.CollabSessions.Inc()
+	return &Session{
+		ID:        uuid.New().String(),
+		SnippetID: snippetID,
+		store:     store,
+		applied:   make(map[appliedKey]appliedEdit),
+		clients:   make(map[*Client]struct{}),
+		idleSince: time.Now(),
+	}
+}
+
+// load reads the snippet the session edits
+func (s *Session) load(ctx context.Context) error {
+	doc, err := s.store.Load(ctx, s.SnippetID)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.content = doc.Content
+	s.length = len([]rune(doc.Content))
+	s.saved = doc.Content
+	return nil
+}
+
+// Messages exchanged with clients
+type (
+	inbound struct {
+		Type         string    `json:"type"`
+		Session      string    `json:"session"`
+		Revision     int       `json:"revision"`
+		Seq          int       `json:"seq"`
+		Ops          Operation `json:"ops"`
+		Cursor       *Cursor   `json:"cursor"`
+		AllowSecrets bool      `json:"allow_secrets"`
+	}
+
+	participant struct {
+		Connection string  `json:"connection"`
+		UserID     string  `json:"user_id"`
+		CanEdit    bool    `json:"can_edit"`
+		Cursor     *Cursor `json:"cursor"`
+	}
+
+	initMessage struct {
+		Type         string        `json:"type"`
+		Session      string        `json:"session"`
+		Revision     int           `json:"revision"`
+		Content      *string       `json:"content,omitempty"` // Omitted when resuming
+		Missed       []opMessage   `json:"missed,omitempty"`
+		Connection   string        `json:"connection"`
+		CanEdit      bool          `json:"can_edit"`
+		Participants []participant `json:"participants"`
+	}
+
+	opMessage struct {
+		Type     string    `json:"type"`
+		Revision int       `json:"revision"` // The revision the edit produced
+		Ops      Operation `json:"ops"`
+		UserID   string    `json:"user_id,omitempty"`
+		ClientID string    `json:"client_id,omitempty"`
+		Seq      int       `json:"seq,omitempty"`
+	}
+
+	ackMessage struct {
+		Type     string `json:"type"`
+		Seq      int    `json:"seq"`
+		Revision int    `json:"revision"`
+	}
+
+	cursorMessage struct {
+		Type       string  `json:"type"`
+		Connection string  `json:"connection"`
+		UserID     string  `json:"user_id"`
+		Revision   int     `json:"revision"`
+		Cursor     *Cursor `json:"cursor"`
+	}
+
+	joinMessage struct {
+		Type        string      `json:"type"`
+		Participant participant `json:"participant"`
+	}
+
+	leaveMessage struct {
+		Type       string `json:"type"`
+		Connection string `json:"connection"`
+	}
+
+	savedMessage struct {
+		Type     string `json:"type"`
+		Revision int    `json:"revision"`
+	}
+
+	errorMessage struct {
+		Type    string      `json:"type"`
+		Code    string      `json:"code"`
+		Message string      `json:"message"`
+		Seq     int         `json:"seq,omitempty"`
+		Data    interface{} `json:"data,omitempty"`
+	}
+)
+
+// join adds c to the session and sends it the document, or the edits it
+// missed when resuming. It returns false if the session has closed.
+func (s *Session) join(c *Client, resume Resume) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+
+	init := initMessage{
+		Type:         "init",
+		Session:      s.ID,
+		Revision:     s.revision,
+		Connection:   c.ID,
+		CanEdit:      c.CanEdit,
+		Participants: []participant{},
+	}
+	if resume.Session == s.ID && resume.Revision >= s.historyStart && resume.Revision <= s.revision {
+		for i, e := range s.history[resume.Revision-s.historyStart:] {
+			init.Missed = append(init.Missed, e.message(resume.Revision+i+1))
+		}
+	} else {
+		content := s.content
+		init.Content = &content
+	}
+	for other := range s.clients {
+		init.Participants = append(init.Participants, other.participant())
+	}
+
+	s.clients[c] = struct{}{}
+	metrics.CollabParticipants.Inc()
+	s.send(c, init)
+	s.broadcast(joinMessage{Type: "join", Participant: c.participant()}, c)
+	return true
+}
+
+// Leave removes c from the session
+func (s *Session) Leave(c *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(c)
+}
+
+// Receive handles a message from c
+func (s *Session) Receive(ctx context.Context, c *Client, data []byte) {
+	var m inbound
+	if err := json.Unmarshal(data, &m); err != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.sendError(c, CodeInvalidMessage, "Invalid message: "+err.Error(), 0)
+		return
+	}
+
+	if m.Type == "save" {
+		s.save(ctx, c, m.AllowSecrets)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[c]; !ok {
+		return
+	}
+	switch m.Type {
+	case "op":
+		s.applyEdit(c, m)
+	case "cursor":
+		s.moveCursor(c, m)
+	default:
+		s.sendError(c, CodeInvalidMessage, "Unknown message type "+m.Type, 0)
+	}
+}
+
+// applyEdit transforms an edit against the ones it missed, applies it and
+// broadcasts it
+func (s *Session) applyEdit(c *Client, m inbound) {
+	reject := func(code, message string) {
+		metrics.CollabOperations.WithLabelValues("rejected").Inc()
+		s.sendError(c, code, message, m.Seq)
+	}
+
+	switch {
+	case !c.CanEdit:
+		reject(CodeReadOnly, "Only the owner can edit this snippet")
+		return
+	case m.Session != s.ID:
+		reject(CodeSessionExpired, "The session has ended; rebase local changes on the current content")
+		return
+	case m.Seq <= 0:
+		reject(CodeInvalidMessage, "seq must be a positive number")
+		return
+	}
+
+	// Acknowledge edits resent after a reconnect without applying them again
+	key := appliedKey{c.UserID, c.ClientID}
+	if last, ok := s.applied[key]; ok && m.Seq <= last.seq {
+		metrics.CollabOperations.WithLabelValues("duplicate").Inc()
+		s.send(c, ackMessage{Type: "ack", Seq: m.Seq, Revision: last.revision})
+		return
+	}
+
+	if m.Revision < s.historyStart || m.Revision > s.revision {
+		reject(CodeRevisionTooOld, "The edit is based on a revision the session no longer has")
+		return
+	}
+
+	op := m.Ops
+	for _, e := range s.history[m.Revision-s.historyStart:] {
+		var err error
+		if op, _, err = Transform(op, e.op); err != nil {
+			reject(CodeInvalidOperation, err.Error())
+			return
+		}
+	}
+	if op.BaseLen() != s.length {
+		reject(CodeInvalidOperation, "The edit does not fit the document")
+		return
+	}
+	if op.TargetLen() > MaxDocumentLength {
+		reject(CodeDocumentTooLarge, "The document would exceed the size limit")
+		return
+	}
+
+	e := entry{op: op, userID: c.UserID, clientID: c.ClientID, seq: m.Seq}
+	if err := s.record(e); err != nil {
+		reject(CodeInvalidOperation, err.Error())
+		return
+	}
+	s.applied[key] = appliedEdit{seq: m.Seq, revision: s.revision}
+	metrics.CollabOperations.WithLabelValues("applied").Inc()
+
+	s.send(c, ackMessage{Type: "ack", Seq: m.Seq, Revision: s.revision})
+	s.broadcast(e.message(s.revision), c)
+}
+
+// record applies op to the document and appends it to the history
+func (s *Session) record(e entry) error {
+	content, err := e.op.Apply(s.content)
+	if err != nil {
+		return err
+	}
+	s.content = content
+	s.length = e.op.TargetLen()
+	s.revision++
+
+	s.history = append(s.history, e)
+	if len(s.history) > maxHistory+maxHistory/4 {
+		// Trim in batches so the backing array is not copied on every edit
+		drop := len(s.history) - maxHistory
+		s.history = append([]entry(nil), s.history[drop:]...)
+		s.historyStart += drop
+	}
+
+	for c := range s.clients {
+		if c.cursor != nil {
+			c.cursor = &Cursor{Anchor: TransformIndex(c.cursor.Anchor, e.op), Head: TransformIndex(c.cursor.Head, e.op)}
+		}
+	}
+	return nil
+}
+
+// moveCursor updates c's selection, given at m.Revision, and broadcasts it
+// at the current revision. A null cursor hides it.
+func (s *Session) moveCursor(c *Client, m inbound) {
+	if m.Session != s.ID || m.Revision < s.historyStart || m.Revision > s.revision {
+		// Cursors are advisory; the client will send a current one
+		return
+	}
+
+	cursor := m.Cursor
+	if cursor != nil {
+		anchor, head := cursor.Anchor, cursor.Head
+		for _, e := range s.history[m.Revision-s.historyStart:] {
+			anchor, head = TransformIndex(anchor, e.op), TransformIndex(head, e.op)
+		}
+		cursor = &Cursor{Anchor: clamp(anchor, s.length), Head: clamp(head, s.length)}
+	}
+	c.cursor = cursor
+
+	s.broadcast(cursorMessage{Type: "cursor", Connection: c.ID, UserID: c.UserID, Revision: s.revision, Cursor: cursor}, c)
+}
+
+// save syncs the session with the store at a client's request, with its
+// choice to save content flagged as containing secrets
+func (s *Session) save(ctx context.Context, c *Client, allowSecrets bool) {
+	s.mu.Lock()
+	if _, ok := s.clients[c]; !ok {
+		s.mu.Unlock()
+		return
+	}
+	if !c.CanEdit {
+		s.sendError(c, CodeReadOnly, "Only the owner can save this snippet", 0)
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	if err := s.sync(ctx, allowSecrets); err != nil {
+		slog.WarnContext(ctx, "failed to save collaborative session", "snippet_id", s.SnippetID, "error", err)
+	}
+}
+
+// sync folds in changes made to the snippet outside the session and saves
+// the session's content through the store. Saves happen without blocking
+// edits; if the snippet changes in between, the store refuses the save and
+// sync merges again.
+func (s *Session) sync(ctx context.Context, allowSecrets bool) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	for attempt := 0; attempt < maxSaveAttempts; attempt++ {
+		doc, err := s.store.Load(ctx, s.SnippetID)
+		if errors.Is(err, ErrNotFound) {
+			s.close(CodeSnippetNotFound, "The snippet was deleted")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		s.refresh(doc)
+		content, revision := s.content, s.revision
+		s.mu.Unlock()
+		if content == doc.Content {
+			return nil
+		}
+
+		base := doc.Content
+		doc.Content = content
+		err = s.store.Save(ctx, doc, base, allowSecrets)
+		if errors.Is(err, ErrConflict) {
+			continue
+		}
+
+		s.mu.Lock()
+		if err != nil {
+			s.reportSaveError(err)
+			s.mu.Unlock()
+			return err
+		}
+		s.saved = content
+		s.saveError = ""
+		s.broadcast(savedMessage{Type: "saved", Revision: revision}, nil)
+		s.mu.Unlock()
+		return nil
+	}
+	return ErrConflict
+}
+
+// refresh applies the stored state of the snippet: viewers lose access
+// when it stops being public, and edits made elsewhere since the last
+// save are merged in as an edit of their own
+func (s *Session) refresh(doc Document) {
+	if !doc.Public {
+		for c := range s.clients {
+			if !c.CanEdit {
+				s.sendError(c, CodeAccessRevoked, "The snippet is no longer public", 0)
+				s.remove(c)
+			}
+		}
+	}
+
+	if doc.Content == s.saved {
+		return
+	}
+	ours := Diff(s.saved, s.content)
+	theirs := Diff(s.saved, doc.Content)
+	_, external, err := Transform(ours, theirs)
+	if err == nil && !external.IsNoop() {
+		err = s.record(entry{op: external})
+	}
+	if err != nil {
+		// Both diffs start from saved, so this means a bug rather than bad input
+		slog.Error("failed to merge external snippet changes", "snippet_id", s.SnippetID, "error", err)
+		return
+	}
+	s.saved = doc.Content
+	if !external.IsNoop() {
+		s.broadcast(s.history[len(s.history)-1].message(s.revision), nil)
+	}
+}
+
+// reportSaveError tells editors why the session could not be saved, once
+// per distinct problem
+func (s *Session) reportSaveError(err error) {
+	code, message := CodeSaveFailed, "Failed to save the snippet"
+	var data interface{}
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) && apiErr.Status < 500 {
+		code, message, data = string(apiErr.Code), apiErr.Message, apiErr.Data
+	}
+	if code == s.saveError {
+		return
+	}
+	s.saveError = code
+
+	for c := range s.clients {
+		if c.CanEdit {
+			s.send(c, errorMessage{Type: "error", Code: code, Message: message, Data: data})
+		}
+	}
+}
+
+// close ends the session, disconnecting every client
+func (s *Session) close(code, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shutdown(code, message)
+}
+
+func (s *Session) shutdown(code, message string) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	metrics.CollabSessions.Dec()
+	for c := range s.clients {
+		s.sendError(c, code, message, 0)
+		s.remove(c)
+	}
+}
+
+// idle reports whether the session has had no clients for at least
+// timeout and holds no unsaved edits
+func (s *Session) idle(timeout time.Duration) bool {
+	return len(s.clients) == 0 && time.Since(s.idleSince) >= timeout && s.content == s.saved
+}
+
+// remove disconnects c and tells the others it left
+func (s *Session) remove(c *Client) {
+	if _, ok := s.clients[c]; !ok {
+		return
+	}
+	delete(s.clients, c)
+	close(c.send)
+	metrics.CollabParticipants.Dec()
+	if len(s.clients) == 0 {
+		s.idleSince = time.Now()
+	}
+	s.broadcast(leaveMessage{Type: "leave", Connection: c.ID}, nil)
+}
+
+func (s *Session) sendError(c *Client, code, message string, seq int) {
+	s.send(c, errorMessage{Type: "error", Code: code, Message: message, Seq: seq})
+}
+
+// send queues a message for c
+func (s *Session) send(c *Client, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("failed to encode collaboration message", "error", err)
+		return
+	}
+	s.deliver(c, data)
+}
+
+// broadcast queues a message for every client except one
+func (s *Session) broadcast(v interface{}, except *Client) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("failed to encode collaboration message", "error", err)
+		return
+	}
+	for c := range s.clients {
+		if c != except {
+			s.deliver(c, data)
+		}
+	}
+}
+
+// deliver queues data for c, dropping c if it has fallen too far behind to
+// keep up. It reconnects and resumes from where it was.
+func (s *Session) deliver(c *Client, data []byte) {
+	if _, ok := s.clients[c]; !ok {
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+		s.remove(c)
+	}
+}
+
+func (c *Client) participant() participant {
+	return participant{Connection: c.ID, UserID: c.UserID, CanEdit: c.CanEdit, Cursor: c.cursor}
+}
+
+func (e entry) message(revision int) opMessage {
+	return opMessage{Type: "op", Revision: revision, Ops: e.op, UserID: e.userID, ClientID: e.clientID, Seq: e.seq}
+}
+
+func clamp(n, max int) int {
+	if n < 0 {
+		return 0
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
@@ -0,0 +1,608 @@
+package collab
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore is a Store holding one snippet
+type memoryStore struct {
+	mu      sync.Mutex
+	doc     Document
+	deleted bool
+	saves   int
+	// beforeSave runs once, before the next save, to simulate an edit made
+	// elsewhere at the worst moment
+	beforeSave func(*Document)
+}
+
+func newMemoryStore(content string) *memoryStore {
+	return &memoryStore{doc: Document{SnippetID: "s1", OwnerID: "owner", Content: content, Public: true}}
+}
+
+func (m *memoryStore) Load(ctx context.Context, snippetID string) (Document, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.deleted {
+		return Document{}, ErrNotFound
+	}
+	return m.doc, nil
+}
+
+func (m *memoryStore) Save(ctx context.Context, doc Document, base string, allowSecrets bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.beforeSave != nil {
+		m.beforeSave(&m.doc)
+		m.beforeSave = nil
+	}
+	if m.doc.Content != base {
+		return ErrConflict
+	}
+	m.doc.Content = doc.Content
+	m.saves++
+	return nil
+}
+
+func (m *memoryStore) content() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.doc.Content
+}
+
+// message is any message sent to clients
+type message struct {
+	Type         string        `json:"type"`
+	Session      string        `json:"session"`
+	Revision     int           `json:"revision"`
+	Content      *string       `json:"content"`
+	Missed       []message     `json:"missed"`
+	Ops          Operation     `json:"ops"`
+	UserID       string        `json:"user_id"`
+	ClientID     string        `json:"client_id"`
+	Seq          int           `json:"seq"`
+	Code         string        `json:"code"`
+	Connection   string        `json:"connection"`
+	Cursor       *Cursor       `json:"cursor"`
+	Participants []participant `json:"participants"`
+}
+
+// testClient follows the client side of the protocol as an editor would:
+// one edit awaits acknowledgement at a time while later ones are buffered,
+// and both are transformed against edits from others as they arrive
+type testClient struct {
+	t        *testing.T
+	session  *Session
+	conn     *Client
+	id       string
+	doc      string
+	revision int
+	seq      int
+	pending  *message // Sent and not yet acknowledged
+	buffer   []Operation
+	errors   []message
+}
+
+func connect(t *testing.T, m *Manager, userID, clientID string, canEdit bool) *testClient {
+	t.Helper()
+	c := &testClient{t: t, id: clientID}
+	c.join(m, userID, canEdit, Resume{})
+	return c
+}
+
+// join opens a connection and reads the init message
+func (c *testClient) join(m *Manager, userID string, canEdit bool, resume Resume) message {
+	c.t.Helper()
+	c.conn = NewClient(userID, c.id, canEdit)
+	session, err := m.Join(context.Background(), "s1", c.conn, resume)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.session = session
+
+	init := c.next()
+	if init.Type != "init" {
+		c.t.Fatalf("Expected init, got %+v", init)
+	}
+	if init.Content != nil {
+		c.doc = *init.Content
+		c.pending, c.buffer = nil, nil
+	}
+	c.revision = init.Revision - len(init.Missed)
+	for _, missed := range init.Missed {
+		c.handle(missed)
+	}
+	c.revision = init.Revision
+	return init
+}
+
+// next reads one message, failing if none arrives
+func (c *testClient) next() message {
+	c.t.Helper()
+	select {
+	case data, ok := <-c.conn.Messages():
+		if !ok {
+			c.t.Fatal("Connection closed")
+		}
+		var m message
+		if err := json.Unmarshal(data, &m); err != nil {
+			c.t.Fatal(err)
+		}
+		return m
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("Timed out waiting for a message")
+		return message{}
+	}
+}
+
+// poll handles every message already received
+func (c *testClient) poll() {
+	for {
+		select {
+		case data, ok := <-c.conn.Messages():
+			if !ok {
+				return
+			}
+			var m message
+			if err := json.Unmarshal(data, &m); err != nil {
+				c.t.Error(err)
+				return
+			}
+			c.handle(m)
+		default:
+			return
+		}
+	}
+}
+
+func (c *testClient) handle(m message) {
+	switch m.Type {
+	case "ack":
+		c.acknowledged(m.Revision)
+	case "op":
+		if c.pending != nil && m.UserID != "" && m.ClientID == c.id && m.Seq == c.pending.Seq {
+			// Our own edit, replayed after a reconnect
+			c.acknowledged(m.Revision)
+			return
+		}
+		op := m.Ops
+		var err error
+		if c.pending != nil {
+			if c.pending.Ops, op, err = Transform(c.pending.Ops, op); err != nil {
+				c.t.Error(err)
+				return
+			}
+		}
+		for i := range c.buffer {
+			if c.buffer[i], op, err = Transform(c.buffer[i], op); err != nil {
+				c.t.Error(err)
+				return
+			}
+		}
+		if c.doc, err = op.Apply(c.doc); err != nil {
+			c.t.Error(err)
+		}
+		c.revision = m.Revision
+	case "error":
+		c.errors = append(c.errors, m)
+	}
+}
+
+func (c *testClient) acknowledged(revision int) {
+	c.pending = nil
+	c.revision = revision
+	if len(c.buffer) > 0 {
+		op := c.buffer[0]
+		c.buffer = c.buffer[1:]
+		c.send(op)
+	}
+}
+
+// edit applies op locally and sends it when nothing else is in flight
+func (c *testClient) edit(op Operation) {
+	doc, err := op.Apply(c.doc)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.doc = doc
+	if c.pending != nil {
+		c.buffer = append(c.buffer, op)
+		return
+	}
+	c.send(op)
+}
+
+func (c *testClient) send(op Operation) {
+	c.seq++
+	c.pending = &message{Type: "op", Session: c.session.ID, Revision: c.revision, Seq: c.seq, Ops: op}
+	c.resend()
+}
+
+// resend sends the pending edit again, as after a reconnect
+func (c *testClient) resend() {
+	data, err := json.Marshal(inbound{Type: "op", Session: c.pending.Session, Revision: c.revision, Seq: c.pending.Seq, Ops: c.pending.Ops})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.session.Receive(context.Background(), c.conn, data)
+}
+
+func (c *testClient) settled() bool {
+	return c.pending == nil && len(c.buffer) == 0
+}
+
+func (s *Session) snapshot() (string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.content, s.revision
+}
+
+func TestConcurrentEditsConverge(t *testing.T) {
+	store := newMemoryStore("shared\ndocument\n")
+	m := NewManager(store, time.Hour, time.Hour)
+
+	const editors, edits = 5, 40
+	clients := make([]*testClient, editors)
+	for i := range clients {
+		clients[i] = connect(t, m, "owner", string(rune('a'+i)), true)
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		wg.Add(1)
+		go func(c *testClient, seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for n := 0; n < edits; n++ {
+				c.edit(randomOperation(rng, c.doc))
+				if rng.Intn(3) == 0 {
+					time.Sleep(time.Duration(rng.Intn(200)) * time.Microsecond)
+				}
+				c.poll()
+			}
+			for !c.settled() {
+				c.handle(c.next())
+			}
+		}(c, int64(i))
+	}
+	wg.Wait()
+
+	content, revision := clients[0].session.snapshot()
+	if revision != editors*edits {
+		t.Errorf("Got revision %d, want %d", revision, editors*edits)
+	}
+	for _, c := range clients {
+		for c.revision < revision {
+			c.handle(c.next())
+		}
+		if c.doc != content {
+			t.Errorf("Client %s diverged:\n%q\nserver:\n%q", c.id, c.doc, content)
+		}
+		if len(c.errors) > 0 {
+			t.Errorf("Client %s got errors: %+v", c.id, c.errors)
+		}
+	}
+
+	if err := clients[0].session.sync(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if store.content() != content {
+		t.Error("The session was not saved")
+	}
+}
+
+func TestResumeReplaysMissedEdits(t *testing.T) {
+	m := NewManager(newMemoryStore("hello"), time.Hour, time.Hour)
+	a := connect(t, m, "owner", "a", true)
+	b := connect(t, m, "owner", "b", true)
+	a.next() // b joined
+
+	// a's edit is applied but the connection drops before the ack arrives
+	a.edit(Operation{}.Retain(5).Insert(" world"))
+	lastSeen := a.revision
+	a.session.Leave(a.conn)
+
+	b.edit(Operation{}.Insert(">> ").Retain(5))
+	for !b.settled() {
+		b.handle(b.next())
+	}
+
+	init := a.join(m, "owner", true, Resume{Session: a.session.ID, Revision: lastSeen})
+	if init.Content != nil || len(init.Missed) != 2 {
+		t.Fatalf("Expected only the missed edits, got %+v", init)
+	}
+	if !a.settled() {
+		t.Error("The replayed edit should acknowledge the pending one")
+	}
+
+	for b.revision < a.revision {
+		b.handle(b.next())
+	}
+	content, _ := a.session.snapshot()
+	if a.doc != content || b.doc != content || content != ">> hello world" {
+		t.Errorf("Got %q, %q and server %q", a.doc, b.doc, content)
+	}
+}
+
+func TestResentEditAppliesOnce(t *testing.T) {
+	m := NewManager(newMemoryStore("abc"), time.Hour, time.Hour)
+	a := connect(t, m, "owner", "a", true)
+
+	a.edit(Operation{}.Retain(3).Insert("d"))
+	pending := *a.pending
+	a.handle(a.next())
+
+	// A client unsure whether its edit arrived sends it again
+	a.pending = &pending
+	a.revision = pending.Revision
+	a.resend()
+	if ack := a.next(); ack.Type != "ack" || ack.Seq != pending.Seq {
+		t.Errorf("Expected the duplicate to be acknowledged, got %+v", ack)
+	}
+	if content, revision := a.session.snapshot(); content != "abcd" || revision != 1 {
+		t.Errorf("Got %q at revision %d", content, revision)
+	}
+}
+
+func TestResumeSendsLostEditAgain(t *testing.T) {
+	m := NewManager(newMemoryStore("0123"), time.Hour, time.Hour)
+	a := connect(t, m, "owner", "a", true)
+	b := connect(t, m, "owner", "b", true)
+	a.next() // b joined
+
+	// a edits while disconnected, so the server never sees the edit
+	a.session.Leave(a.conn)
+	lastSeen := a.revision
+	a.seq++
+	a.pending = &message{Session: a.session.ID, Revision: a.revision, Seq: a.seq, Ops: Operation{}.Retain(4).Insert("A")}
+	a.doc = "0123A"
+
+	b.edit(Operation{}.Delete(1).Retain(3))
+	for !b.settled() {
+		b.handle(b.next())
+	}
+
+	a.join(m, "owner", true, Resume{Session: a.session.ID, Revision: lastSeen})
+	if a.doc != "123A" {
+		t.Fatalf("Missed edit not applied: %q", a.doc)
+	}
+	a.resend()
+	a.handle(a.next())
+
+	for b.revision < a.revision {
+		b.handle(b.next())
+	}
+	content, _ := a.session.snapshot()
+	if !a.settled() || a.doc != content || b.doc != content || content != "123A" {
+		t.Errorf("Got %q, %q and server %q", a.doc, b.doc, content)
+	}
+}
+
+func TestResumeFromUnknownSessionSendsContent(t *testing.T) {
+	m := NewManager(newMemoryStore("text"), time.Hour, time.Hour)
+	c := &testClient{t: t, id: "a"}
+	init := c.join(m, "owner", true, Resume{Session: "ended", Revision: 3})
+	if init.Content == nil || *init.Content != "text" {
+		t.Errorf("Expected the full content, got %+v", init)
+	}
+
+	// Edits against the old session are refused
+	c.pending = &message{Session: "ended", Seq: 1, Ops: Operation{}.Retain(4)}
+	c.resend()
+	if e := c.next(); e.Code != CodeSessionExpired {
+		t.Errorf("Got %+v", e)
+	}
+}
+
+func TestViewersCannotEdit(t *testing.T) {
+	m := NewManager(newMemoryStore("text"), time.Hour, time.Hour)
+	viewer := connect(t, m, "someone", "v", false)
+	viewer.edit(Operation{}.Insert("x").Retain(4))
+	if e := viewer.next(); e.Code != CodeReadOnly || e.Seq != 1 {
+		t.Errorf("Got %+v", e)
+	}
+	if content, _ := viewer.session.snapshot(); content != "text" {
+		t.Errorf("Got %q", content)
+	}
+}
+
+func TestInvalidEditsAreRejected(t *testing.T) {
+	m := NewManager(newMemoryStore("text"), time.Hour, time.Hour)
+	c := connect(t, m, "owner", "a", true)
+
+	c.session.Receive(context.Background(), c.conn, []byte(`{"type":"op","ops":[0]}`))
+	if e := c.next(); e.Code != CodeInvalidMessage {
+		t.Errorf("Got %+v", e)
+	}
+
+	c.pending = &message{Session: c.session.ID, Seq: 1, Ops: Operation{}.Retain(10)}
+	c.resend()
+	if e := c.next(); e.Code != CodeInvalidOperation {
+		t.Errorf("Got %+v", e)
+	}
+
+	c.pending = &message{Session: c.session.ID, Seq: 2, Ops: Operation{}.Retain(4)}
+	c.revision = 7
+	c.resend()
+	if e := c.next(); e.Code != CodeRevisionTooOld {
+		t.Errorf("Got %+v", e)
+	}
+}
+
+func TestCursorsFollowEdits(t *testing.T) {
+	m := NewManager(newMemoryStore("hello world"), time.Hour, time.Hour)
+	a := connect(t, m, "owner", "a", true)
+	b := connect(t, m, "owner", "b", true)
+	a.next() // b joined
+
+	// b moves its cursor without having seen a's edit
+	a.edit(Operation{}.Insert(">> ").Retain(11))
+	cursor, _ := json.Marshal(inbound{Type: "cursor", Session: b.session.ID, Revision: 0, Cursor: &Cursor{Anchor: 6, Head: 11}})
+	b.session.Receive(context.Background(), b.conn, cursor)
+
+	a.handle(a.next()) // ack
+	if moved := a.next(); moved.Type != "cursor" || *moved.Cursor != (Cursor{Anchor: 9, Head: 14}) || moved.Revision != 1 {
+		t.Errorf("Got %+v", moved)
+	}
+
+	a.edit(Operation{}.Delete(3).Retain(11))
+	a.handle(a.next())
+	viewer := &testClient{t: t, id: "v"}
+	init := viewer.join(m, "someone", false, Resume{})
+	if len(init.Participants) != 2 {
+		t.Fatalf("Got participants %+v", init.Participants)
+	}
+	for _, p := range init.Participants {
+		if p.Connection == b.conn.ID && *p.Cursor != (Cursor{Anchor: 6, Head: 11}) {
+			t.Errorf("Stored cursor did not follow the edit: %+v", p.Cursor)
+		}
+	}
+}
+
+func TestPresence(t *testing.T) {
+	m := NewManager(newMemoryStore(""), time.Hour, time.Hour)
+	a := connect(t, m, "owner", "a", true)
+	b := connect(t, m, "viewer", "b", false)
+
+	if joined := a.next(); joined.Type != "join" {
+		t.Errorf("Got %+v", joined)
+	}
+	b.session.Leave(b.conn)
+	if left := a.next(); left.Type != "leave" || left.Connection != b.conn.ID {
+		t.Errorf("Got %+v", left)
+	}
+	if _, ok := <-b.conn.Messages(); ok {
+		t.Error("The connection should be closed after leaving")
+	}
+}
+
+func TestSyncMergesOutsideChanges(t *testing.T) {
+	store := newMemoryStore("one\ntwo\nthree\n")
+	m := NewManager(store, time.Hour, time.Hour)
+	c := connect(t, m, "owner", "a", true)
+
+	// Edit the last line in the session and the first one elsewhere, with
+	// another change landing while the session saves
+	c.edit(Operation{}.Retain(8).Insert("THREE\n").Delete(6))
+	c.handle(c.next())
+	store.mu.Lock()
+	store.doc.Content = "ONE\ntwo\nthree\n"
+	store.beforeSave = func(doc *Document) { doc.Content = "ONE\ntwo\nthree\nfour\n" }
+	store.mu.Unlock()
+
+	if err := c.session.sync(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	want := "ONE\ntwo\nTHREE\nfour\n"
+	if got := store.content(); got != want {
+		t.Errorf("Saved %q, want %q", got, want)
+	}
+	for c.doc != want {
+		m := c.next()
+		if m.Type == "op" && m.UserID != "" {
+			t.Errorf("Outside changes should not be attributed: %+v", m)
+		}
+		c.handle(m)
+	}
+	if saved := c.next(); saved.Type != "saved" {
+		t.Errorf("Got %+v", saved)
+	}
+}
+
+func TestSyncRevokesViewersOfPrivateSnippets(t *testing.T) {
+	store := newMemoryStore("text")
+	m := NewManager(store, time.Hour, time.Hour)
+	owner := connect(t, m, "owner", "a", true)
+	viewer := connect(t, m, "someone", "v", false)
+
+	store.mu.Lock()
+	store.doc.Public = false
+	store.mu.Unlock()
+	if err := owner.session.sync(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if e := viewer.next(); e.Code != CodeAccessRevoked {
+		t.Errorf("Got %+v", e)
+	}
+	if _, ok := <-viewer.conn.Messages(); ok {
+		t.Error("The viewer should be disconnected")
+	}
+}
+
+func TestDeletedSnippetClosesSession(t *testing.T) {
+	store := newMemoryStore("text")
+	m := NewManager(store, time.Hour, time.Hour)
+	c := connect(t, m, "owner", "a", true)
+
+	store.mu.Lock()
+	store.deleted = true
+	store.mu.Unlock()
+	c.session.sync(context.Background(), false)
+	if e := c.next(); e.Code != CodeSnippetNotFound {
+		t.Errorf("Got %+v", e)
+	}
+	if _, ok := <-c.conn.Messages(); ok {
+		t.Error("The client should be disconnected")
+	}
+}
+
+func TestManagerSharesAndClosesSessions(t *testing.T) {
+	store := newMemoryStore("text")
+	m := NewManager(store, 10*time.Millisecond, 0)
+	a := connect(t, m, "owner", "a", true)
+	b := connect(t, m, "owner", "b", true)
+	if a.session != b.session {
+		t.Fatal("Clients of one snippet should share a session")
+	}
+
+	a.edit(Operation{}.Retain(4).Insert("!"))
+	a.handle(a.next())
+	a.session.Leave(a.conn)
+	b.session.Leave(b.conn)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(m.open()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if len(m.open()) != 0 {
+		t.Error("The idle session should have closed")
+	}
+	if store.content() != "text!" {
+		t.Errorf("Got %q", store.content())
+	}
+}
+
+func TestCloseSavesSessions(t *testing.T) {
+	store := newMemoryStore("text")
+	m := NewManager(store, time.Hour, time.Hour)
+	c := connect(t, m, "owner", "a", true)
+	c.edit(Operation{}.Insert("> ").Retain(4))
+	c.handle(c.next())
+
+	m.Close(context.Background())
+	if store.content() != "> text" {
+		t.Errorf("Got %q", store.content())
+	}
+	if saved := c.next(); saved.Type != "saved" {
+		t.Errorf("Got %+v", saved)
+	}
+	if e := c.next(); e.Code != CodeUnavailable {
+		t.Errorf("Got %+v", e)
+	}
+	if len(m.open()) != 0 {
+		t.Error("Sessions should be closed")
+	}
+}
@@ -1,81 +1,451 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
-// Config holds all configuration values
+// Config holds all configuration values. Values come from the defaults,
+// then an optional YAML file, then environment variables, so a deployment
+// can keep most settings in a file and inject secrets through the
+// environment.
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Auth     AuthConfig
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Auth      AuthConfig      `yaml:"auth"`
+	CORS      CORSConfig      `yaml:"cors"`
+	Admin     AdminConfig     `yaml:"admin"`
+	Features  FeaturesConfig  `yaml:"features"`
+	Sandbox   SandboxConfig   `yaml:"sandbox"`
+	Embed     EmbedConfig     `yaml:"embed"`
+	Render    RenderConfig    `yaml:"render"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Logging   LoggingConfig   `yaml:"logging"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Cache     CacheConfig     `yaml:"cache"`
+	Events    EventsConfig    `yaml:"events"`
+	Collab    CollabConfig    `yaml:"collab"`
+	Sync      SyncConfig      `yaml:"sync"`
 }
 
-// ServerConfig holds server-related configuration
+// ServerConfig holds server-related configuration. Timeouts are in seconds.
 type ServerConfig struct {
-	Port         string
-	ReadTimeout  int
-	WriteTimeout int
-	IdleTimeout  int
+	Port         string    `yaml:"port"`
+	ReadTimeout  int       `yaml:"read_timeout"`
+	WriteTimeout int       `yaml:"write_timeout"`
+	IdleTimeout  int       `yaml:"idle_timeout"`
+	TLS          TLSConfig `yaml:"tls"`
+}
+
+// TLSConfig holds the certificate the server terminates TLS with. Leaving
+// both files empty serves plain HTTP, e.g. behind a TLS-terminating proxy.
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
 }
 
-// DatabaseConfig holds database-related configuration
+// Enabled reports whether the server should serve HTTPS
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// DatabaseConfig holds database-related configuration. URL takes
+// precedence over the individual connection settings.
 type DatabaseConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	Name     string
-	SSLMode  string
+	URL             string        `yaml:"url"`
+	Host            string        `yaml:"host"`
+	Port            string        `yaml:"port"`
+	User            string        `yaml:"user"`
+	Password        string        `yaml:"password"`
+	Name            string        `yaml:"name"`
+	SSLMode         string        `yaml:"ssl_mode"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"` // 0 keeps connections open indefinitely
+}
+
+// ConnString returns the connection string for lib/pq
+func (c DatabaseConfig) ConnString() string {
+	if c.URL != "" {
+		return c.URL
+	}
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		quoteConnValue(c.Host), quoteConnValue(c.Port), quoteConnValue(c.User),
+		quoteConnValue(c.Password), quoteConnValue(c.Name), quoteConnValue(c.SSLMode))
+}
+
+// quoteConnValue quotes a keyword/value connection string value when it is
+// empty or contains characters that would end it early
+func quoteConnValue(s string) string {
+	if s != "" && !strings.ContainsAny(s, ` '\`) {
+		return s
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
 }
 
 // AuthConfig holds authentication-related configuration
 type AuthConfig struct {
-	JWKSURL string
-	ClerkSecretKey string
-	ClerkPublishableKey string
+	Backend             string `yaml:"backend"` // Only "clerk" is supported
+	JWKSURL             string `yaml:"jwks_url"`
+	ClerkSecretKey      string `yaml:"clerk_secret_key"`
+	ClerkPublishableKey string `yaml:"clerk_publishable_key"`
+}
+
+// CORSConfig holds the origins allowed to call the API from a browser with
+// the user's cookies. An origin's host may start with "*." to allow any of
+// its subdomains. When empty, Load allows the origin of Embed.AppURL.
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// AdminConfig holds who may use the admin diagnostics API
+type AdminConfig struct {
+	UserIDs []string `yaml:"user_ids"` // Clerk user IDs; empty disables the admin API
+}
+
+// FeaturesConfig switches optional subsystems on or off
+type FeaturesConfig struct {
+	Collab        bool `yaml:"collab"`         // Collaborative editing over WebSockets
+	CodeExecution bool `yaml:"code_execution"` // Running snippets in the sandbox, which needs root
+}
+
+// SandboxConfig holds limits for snippet execution
+type SandboxConfig struct {
+	TimeoutSeconds      int    `yaml:"timeout_seconds"`
+	CPUSeconds          int    `yaml:"cpu_seconds"`
+	MemoryMB            int    `yaml:"memory_mb"`
+	OutputKB            int    `yaml:"output_kb"`
+	MaxConcurrent       int    `yaml:"max_concurrent"`
+	MaxPerUser          int    `yaml:"max_per_user"`
+	QueueTimeoutSeconds int    `yaml:"queue_timeout_seconds"` // How long a run waits for a free slot
+	CacheDir            string `yaml:"cache_dir"`             // Shared Go build cache, read-only to runs
+}
+
+// EmbedConfig holds settings for embeddable snippet widgets
+type EmbedConfig struct {
+	PublicURL      string `yaml:"public_url"`      // Base URL of this API as seen by browsers
+	AppURL         string `yaml:"app_url"`         // Base URL of the web app, for links back to snippets
+	FrameAncestors string `yaml:"frame_ancestors"` // CSP frame-ancestors for embed pages
+}
+
+// RenderConfig holds settings for rendered snippet images
+type RenderConfig struct {
+	ImageCacheDir string `yaml:"image_cache_dir"`
+	ImageCacheMB  int    `yaml:"image_cache_mb"` // Least recently used images are removed past this; 0 disables the cache
+}
+
+// MetricsConfig controls where Prometheus metrics are served. Addr is a
+// separate listener kept off the public port; Token additionally serves
+// /metrics on the API port to scrapers presenting it as a bearer token.
+type MetricsConfig struct {
+	Addr  string `yaml:"addr"` // "off" disables the separate listener
+	Token string `yaml:"token"`
+}
+
+// CacheConfig holds settings for the read-through cache of public snippets.
+// Entries are dropped when snippets change; TTL bounds how stale they get
+// if a change notification is missed.
+type CacheConfig struct {
+	Size int           `yaml:"size"` // Maximum entries per replica; 0 disables caching
+	TTL  time.Duration `yaml:"ttl"`
+}
+
+// EventsConfig holds settings for the change event stream
+type EventsConfig struct {
+	Retention time.Duration `yaml:"retention"` // How long events can be replayed with Last-Event-ID
+}
+
+// CollabConfig holds settings for collaborative editing sessions
+type CollabConfig struct {
+	SaveInterval time.Duration `yaml:"save_interval"` // How often sessions with edits are saved
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`  // How long a session without clients stays open for reconnects
+}
+
+// SyncConfig holds settings for delta sync
+type SyncConfig struct {
+	TombstoneRetention time.Duration `yaml:"tombstone_retention"` // How long deletions are kept for clients that have not synced
+}
+
+// LoggingConfig holds log output configuration
+type LoggingConfig struct {
+	Format string `yaml:"format"` // json or text
+	Level  string `yaml:"level"`  // debug, info, warn or error
+}
+
+// RateLimit allows Requests per Period, refilled continuously, with bursts
+// of up to Requests. A zero limit disables limiting.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Rate returns the refill rate in tokens per second
+func (l RateLimit) Rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// String formats the limit the way ParseRateLimit reads it
+func (l RateLimit) String() string {
+	if l.Requests == 0 {
+		return "off"
+	}
+	period := l.Period.String()
+	if strings.HasSuffix(period, "m0s") {
+		period = strings.TrimSuffix(period, "0s")
+	}
+	if strings.HasSuffix(period, "h0m") {
+		period = strings.TrimSuffix(period, "0m")
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, period)
+}
+
+// UnmarshalYAML reads limits written as "requests/period"
+func (l *RateLimit) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	limit, err := ParseRateLimit(s)
+	if err != nil {
+		return err
+	}
+	*l = limit
+	return nil
+}
+
+// MarshalYAML writes limits as "requests/period"
+func (l RateLimit) MarshalYAML() (interface{}, error) {
+	return l.String(), nil
+}
+
+// ParseRateLimit parses limits written as "requests/period", e.g. "120/1m".
+// "0" or "off" disables the limit.
+func ParseRateLimit(s string) (RateLimit, error) {
+	s = strings.TrimSpace(s)
+	if s == "0" || s == "off" {
+		return RateLimit{}, nil
+	}
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("rate limit %q must look like 120/1m", s)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(requests))
+	if err != nil || n < 0 {
+		return RateLimit{}, fmt.Errorf("rate limit %q has an invalid request count", s)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil || d <= 0 {
+		return RateLimit{}, fmt.Errorf("rate limit %q has an invalid period", s)
+	}
+	return RateLimit{Requests: n, Period: d}, nil
+}
+
+// RateLimitConfig holds the rate limit of each route group
+type RateLimitConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	Store      string `yaml:"store"`       // "memory" (per replica) or "postgres" (shared)
+	TrustProxy bool   `yaml:"trust_proxy"` // Use X-Forwarded-For set by a reverse proxy for client IPs
+
+	Public        RateLimit `yaml:"public"`        // Anonymous routes, per IP
+	PublicList    RateLimit `yaml:"public_list"`   // Public snippet listing, per IP
+	Render        RateLimit `yaml:"render"`        // Rendering, embeds and images, per IP
+	Authenticated RateLimit `yaml:"authenticated"` // All authenticated routes, per user
+	Write         RateLimit `yaml:"write"`         // Creating snippets, forks and suggestions, per user
+	Run           RateLimit `yaml:"run"`           // Code execution, per user
 }
 
-// Load loads configuration from environment variables
-func Load() *Config {
+// DefaultRateLimits returns the limits used when nothing is configured
+func DefaultRateLimits() RateLimitConfig {
+	return RateLimitConfig{
+		Enabled:       true,
+		Store:         "memory",
+		Public:        RateLimit{Requests: 120, Period: time.Minute},
+		PublicList:    RateLimit{Requests: 30, Period: time.Minute},
+		Render:        RateLimit{Requests: 60, Period: time.Minute},
+		Authenticated: RateLimit{Requests: 600, Period: time.Minute},
+		Write:         RateLimit{Requests: 300, Period: time.Hour},
+		Run:           RateLimit{Requests: 30, Period: time.Minute},
+	}
+}
+
+// Default returns the configuration used when nothing is configured
+func Default() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Port:         getEnv("PORT", "8080"),
-			ReadTimeout:  getEnvAsInt("READ_TIMEOUT", 15),
-			WriteTimeout: getEnvAsInt("WRITE_TIMEOUT", 15),
-			IdleTimeout:  getEnvAsInt("IDLE_TIMEOUT", 60),
+			Port:         "8080",
+			ReadTimeout:  15,
+			WriteTimeout: 15,
+			IdleTimeout:  60,
 		},
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "5432"),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", ""),
-			Name:     getEnv("DB_NAME", "snippy"),
-			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+			Host:         "localhost",
+			Port:         "5432",
+			User:         "postgres",
+			Name:         "snippy",
+			SSLMode:      "disable",
+			MaxOpenConns: 25,
+			MaxIdleConns: 25,
 		},
 		Auth: AuthConfig{
-			JWKSURL: getEnv("JWKS_URL", "https://api.clerk.com/v1/jwks"),
-			ClerkSecretKey: getEnv("CLERK_SECRET_KEY", ""),
-			ClerkPublishableKey: getEnv("CLERK_PUBLISHABLE_KEY", ""),
+			Backend: "clerk",
+			JWKSURL: "https://api.clerk.com/v1/jwks",
+		},
+		Features: FeaturesConfig{
+			Collab:        true,
+			CodeExecution: false,
+		},
+		Sandbox: SandboxConfig{
+			TimeoutSeconds:      10,
+			CPUSeconds:          5,
+			MemoryMB:            256,
+			OutputKB:            64,
+			MaxConcurrent:       4,
+			MaxPerUser:          1,
+			QueueTimeoutSeconds: 5,
+		},
+		Embed: EmbedConfig{
+			AppURL:         "http://localhost:3000",
+			FrameAncestors: "*",
+		},
+		Render: RenderConfig{
+			ImageCacheMB: 256,
+		},
+		RateLimit: DefaultRateLimits(),
+		Metrics: MetricsConfig{
+			Addr: "127.0.0.1:9090",
+		},
+		Cache: CacheConfig{
+			Size: 10000,
+			TTL:  5 * time.Minute,
+		},
+		Events: EventsConfig{
+			Retention: 24 * time.Hour,
+		},
+		Collab: CollabConfig{
+			SaveInterval: 10 * time.Second,
+			IdleTimeout:  time.Minute,
+		},
+		Sync: SyncConfig{
+			TombstoneRetention: 30 * 24 * time.Hour,
 		},
+		Logging: LoggingConfig{
+			Format: "json",
+			Level:  "info",
+		},
+	}
+}
+
+// Load reads the YAML file at path over the defaults, applies environment
+// overrides and validates the result. An empty path reads no file.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		if err := cfg.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
 	}
+	// Without an allowlist, only the web app may call the API from a browser
+	if len(cfg.CORS.AllowedOrigins) == 0 {
+		if u, err := url.Parse(cfg.Embed.AppURL); err == nil && u.Scheme != "" && u.Host != "" {
+			cfg.CORS.AllowedOrigins = []string{u.Scheme + "://" + u.Host}
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
 
-// getEnv gets an environment variable or returns a default value
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// readFile decodes the YAML file at path over cfg. Unknown keys are
+// rejected so a misspelt setting is not silently ignored.
+func (c *Config) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
 	}
-	return defaultValue
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
 }
 
-// getEnvAsInt gets an environment variable as an integer or returns a default value
-func getEnvAsInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
+// redacted replaces secrets in printed configuration
+const redacted = "REDACTED"
+
+// connPasswordPattern finds the password in a keyword/value connection string
+var connPasswordPattern = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// Redacted returns a copy of the configuration with secrets replaced, for
+// printing and diagnostics. Secrets that are not set stay empty so it is
+// still clear whether they are configured.
+func (c *Config) Redacted() *Config {
+	out := *c
+	out.CORS.AllowedOrigins = append([]string(nil), c.CORS.AllowedOrigins...)
+	out.Admin.UserIDs = append([]string(nil), c.Admin.UserIDs...)
+	if out.Database.Password != "" {
+		out.Database.Password = redacted
+	}
+	if out.Database.URL != "" {
+		if u, err := url.Parse(out.Database.URL); err == nil && u.Scheme != "" {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), redacted)
+			}
+			query := u.Query()
+			if query.Has("password") {
+				query.Set("password", redacted)
+				u.RawQuery = query.Encode()
+			}
+			out.Database.URL = u.String()
+		} else {
+			out.Database.URL = connPasswordPattern.ReplaceAllString(out.Database.URL, "${1}"+redacted)
 		}
 	}
-	return defaultValue
+	if out.Auth.ClerkSecretKey != "" {
+		out.Auth.ClerkSecretKey = redacted
+	}
+	if out.Metrics.Token != "" {
+		out.Metrics.Token = redacted
+	}
+	return &out
+}
+
+// Print writes the configuration as YAML with secrets redacted, in the
+// format Load reads
+func (c *Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Settings returns the redacted configuration as a map keyed like the
+// YAML file, for JSON output
+func (c *Config) Settings() (map[string]interface{}, error) {
+	data, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return nil, err
+	}
+	var settings map[string]interface{}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
 }
@@ -0,0 +1,294 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envMap looks variables up in a map instead of the process environment
+func envMap(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := vars[key]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "snippy.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDefaultsAreValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileThenEnvironment(t *testing.T) {
+	path := writeFile(t, `
+server:
+  port: "9000"
+database:
+  host: db.internal
+  ssl_mode: verify-full
+  max_open_conns: 50
+  max_idle_conns: 10
+  conn_max_lifetime: 30m
+cors:
+  allowed_origins: [https://snippy.dev, "https://*.snippy.dev"]
+rate_limit:
+  run: 10/1m
+features:
+  collab: false
+  code_execution: true
+`)
+	cfg := Default()
+	if err := cfg.readFile(path); err != nil {
+		t.Fatal(err)
+	}
+	err := cfg.applyEnv(envMap(map[string]string{
+		"DB_HOST":     "override.internal",
+		"DB_PASSWORD": "hunter2",
+		"PORT":        "", // Empty variables do not override
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Server.Port != "9000" {
+		t.Errorf("Got port %q", cfg.Server.Port)
+	}
+	if cfg.Database.Host != "override.internal" || cfg.Database.Password != "hunter2" {
+		t.Errorf("The environment should override the file: %+v", cfg.Database)
+	}
+	if cfg.Database.MaxOpenConns != 50 || cfg.Database.MaxIdleConns != 10 || cfg.Database.ConnMaxLifetime != 30*time.Minute {
+		t.Errorf("Got pool settings %+v", cfg.Database)
+	}
+	if cfg.Database.Name != "snippy" {
+		t.Error("Settings missing from the file should keep their defaults")
+	}
+	if len(cfg.CORS.AllowedOrigins) != 2 {
+		t.Errorf("Got origins %v", cfg.CORS.AllowedOrigins)
+	}
+	if cfg.RateLimit.Run != (RateLimit{Requests: 10, Period: time.Minute}) || cfg.RateLimit.Public != DefaultRateLimits().Public {
+		t.Errorf("Got rate limits %+v", cfg.RateLimit)
+	}
+	if cfg.Features.Collab || !cfg.Features.CodeExecution {
+		t.Errorf("Got features %+v", cfg.Features)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReadFileRejectsUnknownKeys(t *testing.T) {
+	path := writeFile(t, "database:\n  hots: db.internal\n")
+	err := Default().readFile(path)
+	if err == nil || !strings.Contains(err.Error(), "hots") {
+		t.Errorf("Got %v", err)
+	}
+}
+
+func TestApplyEnvReportsEveryBadValue(t *testing.T) {
+	err := Default().applyEnv(envMap(map[string]string{
+		"READ_TIMEOUT":      "soon",
+		"CACHE_TTL":         "5",
+		"RATE_LIMIT_PUBLIC": "lots",
+		"FEATURE_COLLAB":    "maybe",
+	}))
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	for _, key := range []string{"READ_TIMEOUT", "CACHE_TTL", "RATE_LIMIT_PUBLIC", "FEATURE_COLLAB"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("%s is missing from %v", key, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Port = "http"
+	cfg.Database.SSLMode = "sometimes"
+	cfg.Database.MaxIdleConns = 100
+	cfg.Auth.JWKSURL = "https://api.clerk.com/v1"
+	cfg.CORS.AllowedOrigins = []string{"https://snippy.dev", "snippy.dev", "https://snippy.dev/app"}
+	cfg.Server.TLS.CertFile = "cert.pem"
+	cfg.Logging.Level = "verbose"
+
+	err := cfg.Validate()
+	invalid, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Got %v", err)
+	}
+	want := []string{
+		"server.port",
+		"server.tls.cert_file",
+		"server.tls.key_file",
+		"database.ssl_mode",
+		"database.max_idle_conns",
+		"auth.jwks_url",
+		"cors.allowed_origins[1]",
+		"cors.allowed_origins[2]",
+		"logging.level",
+	}
+	var got []string
+	for _, problem := range invalid.Problems {
+		field, _, _ := strings.Cut(problem, ":")
+		got = append(got, field)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got problems %q", invalid.Problems)
+	}
+}
+
+func TestDatabaseURLReplacesConnectionSettings(t *testing.T) {
+	cfg := Default()
+	cfg.Database = DatabaseConfig{URL: "postgres://localhost/snippy", MaxOpenConns: 5}
+	if err := cfg.Validate(); err != nil {
+		t.Error(err)
+	}
+	if cfg.Database.ConnString() != cfg.Database.URL {
+		t.Errorf("Got %q", cfg.Database.ConnString())
+	}
+}
+
+func TestConnString(t *testing.T) {
+	db := Default().Database
+	db.Password = `it's a secret`
+	db.SSLMode = "require"
+	want := `host=localhost port=5432 user=postgres password='it\'s a secret' dbname=snippy sslmode=require`
+	if got := db.ConnString(); got != want {
+		t.Errorf("Got %s", got)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Password = "hunter2"
+	cfg.Auth.ClerkSecretKey = "sk_live_abc"
+	cfg.Metrics.Token = "scrape"
+
+	for _, c := range []struct{ url, want string }{
+		{"postgres://app:hunter2@db/snippy?sslmode=require", "postgres://app:REDACTED@db/snippy?sslmode=require"},
+		{"postgres://db/snippy?password=hunter2", "postgres://db/snippy?password=REDACTED"},
+		{"host=db password='hunter 2' dbname=snippy", "host=db password=REDACTED dbname=snippy"},
+		{"host=db password=hunter2", "host=db password=REDACTED"},
+	} {
+		cfg.Database.URL = c.url
+		if got := cfg.Redacted().Database.URL; got != c.want {
+			t.Errorf("Got %q, want %q", got, c.want)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"hunter", "sk_live_abc", "scrape"} {
+		if strings.Contains(out.String(), secret) {
+			t.Errorf("%q leaked into\n%s", secret, out.String())
+		}
+	}
+	if cfg.Auth.ClerkSecretKey != "sk_live_abc" {
+		t.Error("Redacted should not modify the original")
+	}
+}
+
+func TestPrintRoundTrips(t *testing.T) {
+	cfg := Default()
+	cfg.CORS.AllowedOrigins = []string{"https://snippy.dev"}
+	cfg.Admin.UserIDs = []string{"user_2abc"}
+	cfg.RateLimit.Write = RateLimit{Requests: 90, Period: 90 * time.Minute}
+	cfg.RateLimit.Run = RateLimit{}
+
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "write: 90/1h30m") || !strings.Contains(out.String(), `run: "off"`) {
+		t.Errorf("Rate limits should print as request/period:\n%s", out.String())
+	}
+
+	loaded := Default()
+	if err := loaded.readFile(writeFile(t, out.String())); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, cfg) {
+		t.Errorf("Got %+v, want %+v", loaded, cfg)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.ClerkSecretKey = "sk_live_abc"
+
+	settings, err := cfg.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		t.Fatalf("Settings should encode as JSON: %v", err)
+	}
+	if strings.Contains(string(data), "sk_live_abc") {
+		t.Errorf("Secret leaked into %s", data)
+	}
+	if !strings.Contains(string(data), `"write":"300/1h"`) || !strings.Contains(string(data), `"max_open_conns":25`) {
+		t.Errorf("Settings should use the file's keys and formats: %s", data)
+	}
+}
+
+func TestRateLimitString(t *testing.T) {
+	for _, c := range []struct {
+		limit RateLimit
+		want  string
+	}{
+		{RateLimit{Requests: 120, Period: time.Minute}, "120/1m"},
+		{RateLimit{Requests: 300, Period: time.Hour}, "300/1h"},
+		{RateLimit{Requests: 5, Period: 90 * time.Second}, "5/1m30s"},
+		{RateLimit{}, "off"},
+	} {
+		if got := c.limit.String(); got != c.want {
+			t.Errorf("Got %q, want %q", got, c.want)
+		}
+		if parsed, err := ParseRateLimit(c.want); err != nil || parsed != c.limit {
+			t.Errorf("%q parsed to %+v, %v", c.want, parsed, err)
+		}
+	}
+}
+
+// TestExampleFileMatchesDefaults keeps config.example.yaml in step with
+// Default as settings are added
+func TestExampleFileMatchesDefaults(t *testing.T) {
+	example := Default()
+	if err := example.readFile("../../config.example.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	var got, want bytes.Buffer
+	if err := example.Print(&got); err != nil {
+		t.Fatal(err)
+	}
+	if err := Default().Print(&want); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("config.example.yaml differs from the defaults:\n%s", got.String())
+	}
+
+	// Metrics are only reachable from the host unless configured otherwise
+	if host, _, _ := net.SplitHostPort(example.Metrics.Addr); host != "127.0.0.1" {
+		t.Errorf("metrics.addr defaults to %q, want a loopback address", example.Metrics.Addr)
+	}
+}
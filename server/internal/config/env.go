@@ -0,0 +1,169 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// applyEnv overrides settings with the environment variables that are set
+// and not empty. Every malformed value is reported, not just the first.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	env := envReader{lookup: lookup}
+
+	env.str(&c.Server.Port, "PORT")
+	env.integer(&c.Server.ReadTimeout, "READ_TIMEOUT")
+	env.integer(&c.Server.WriteTimeout, "WRITE_TIMEOUT")
+	env.integer(&c.Server.IdleTimeout, "IDLE_TIMEOUT")
+	env.str(&c.Server.TLS.CertFile, "TLS_CERT_FILE")
+	env.str(&c.Server.TLS.KeyFile, "TLS_KEY_FILE")
+
+	env.str(&c.Database.URL, "DATABASE_URL")
+	env.str(&c.Database.Host, "DB_HOST")
+	env.str(&c.Database.Port, "DB_PORT")
+	env.str(&c.Database.User, "DB_USER")
+	env.str(&c.Database.Password, "DB_PASSWORD")
+	env.str(&c.Database.Name, "DB_NAME")
+	env.str(&c.Database.SSLMode, "DB_SSLMODE")
+	env.integer(&c.Database.MaxOpenConns, "DB_MAX_OPEN_CONNS")
+	env.integer(&c.Database.MaxIdleConns, "DB_MAX_IDLE_CONNS")
+	env.duration(&c.Database.ConnMaxLifetime, "DB_CONN_MAX_LIFETIME")
+
+	env.str(&c.Auth.Backend, "AUTH_BACKEND")
+	env.str(&c.Auth.JWKSURL, "JWKS_URL")
+	env.str(&c.Auth.ClerkSecretKey, "CLERK_SECRET_KEY")
+	env.str(&c.Auth.ClerkPublishableKey, "CLERK_PUBLISHABLE_KEY")
+
+	env.list(&c.CORS.AllowedOrigins, "CORS_ALLOWED_ORIGINS")
+
+	env.list(&c.Admin.UserIDs, "ADMIN_USER_IDS")
+
+	env.boolean(&c.Features.Collab, "FEATURE_COLLAB")
+	env.boolean(&c.Features.CodeExecution, "FEATURE_CODE_EXECUTION")
+
+	env.integer(&c.Sandbox.TimeoutSeconds, "SANDBOX_TIMEOUT")
+	env.integer(&c.Sandbox.CPUSeconds, "SANDBOX_CPU_SECONDS")
+	env.integer(&c.Sandbox.MemoryMB, "SANDBOX_MEMORY_MB")
+	env.integer(&c.Sandbox.OutputKB, "SANDBOX_OUTPUT_KB")
+	env.integer(&c.Sandbox.MaxConcurrent, "SANDBOX_MAX_CONCURRENT")
+	env.integer(&c.Sandbox.MaxPerUser, "SANDBOX_MAX_PER_USER")
+	env.integer(&c.Sandbox.QueueTimeoutSeconds, "SANDBOX_QUEUE_TIMEOUT")
+	env.str(&c.Sandbox.CacheDir, "SANDBOX_CACHE_DIR")
+
+	env.str(&c.Embed.PublicURL, "PUBLIC_URL")
+	env.str(&c.Embed.AppURL, "APP_URL")
+	env.str(&c.Embed.FrameAncestors, "EMBED_FRAME_ANCESTORS")
+
+	env.str(&c.Render.ImageCacheDir, "IMAGE_CACHE_DIR")
+	env.integer(&c.Render.ImageCacheMB, "IMAGE_CACHE_MB")
+
+	env.boolean(&c.RateLimit.Enabled, "RATE_LIMIT_ENABLED")
+	env.str(&c.RateLimit.Store, "RATE_LIMIT_STORE")
+	env.boolean(&c.RateLimit.TrustProxy, "RATE_LIMIT_TRUST_PROXY")
+	env.rateLimit(&c.RateLimit.Public, "RATE_LIMIT_PUBLIC")
+	env.rateLimit(&c.RateLimit.PublicList, "RATE_LIMIT_PUBLIC_LIST")
+	env.rateLimit(&c.RateLimit.Render, "RATE_LIMIT_RENDER")
+	env.rateLimit(&c.RateLimit.Authenticated, "RATE_LIMIT_AUTHENTICATED")
+	env.rateLimit(&c.RateLimit.Write, "RATE_LIMIT_WRITE")
+	env.rateLimit(&c.RateLimit.Run, "RATE_LIMIT_RUN")
+
+	env.str(&c.Metrics.Addr, "METRICS_ADDR")
+	env.str(&c.Metrics.Token, "METRICS_TOKEN")
+
+	env.integer(&c.Cache.Size, "CACHE_SIZE")
+	env.duration(&c.Cache.TTL, "CACHE_TTL")
+
+	env.duration(&c.Events.Retention, "EVENTS_RETENTION")
+
+	env.duration(&c.Collab.SaveInterval, "COLLAB_SAVE_INTERVAL")
+	env.duration(&c.Collab.IdleTimeout, "COLLAB_IDLE_TIMEOUT")
+
+	env.duration(&c.Sync.TombstoneRetention, "SYNC_TOMBSTONE_RETENTION")
+
+	env.str(&c.Logging.Format, "LOG_FORMAT")
+	env.str(&c.Logging.Level, "LOG_LEVEL")
+
+	return errors.Join(env.errs...)
+}
+
+// envReader parses environment variables into settings, collecting errors
+type envReader struct {
+	lookup func(string) (string, bool)
+	errs   []error
+}
+
+// get returns the variable's value and whether it is set and not empty
+func (e *envReader) get(key string) (string, bool) {
+	value, ok := e.lookup(key)
+	return value, ok && value != ""
+}
+
+func (e *envReader) fail(key, value, format string) {
+	e.errs = append(e.errs, fmt.Errorf("%s=%q: "+format, key, value))
+}
+
+func (e *envReader) str(dst *string, key string) {
+	if value, ok := e.get(key); ok {
+		*dst = value
+	}
+}
+
+func (e *envReader) integer(dst *int, key string) {
+	if value, ok := e.get(key); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			e.fail(key, value, "must be an integer")
+			return
+		}
+		*dst = n
+	}
+}
+
+func (e *envReader) boolean(dst *bool, key string) {
+	if value, ok := e.get(key); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			e.fail(key, value, "must be true or false")
+			return
+		}
+		*dst = b
+	}
+}
+
+// duration reads durations such as "30s" or "24h"
+func (e *envReader) duration(dst *time.Duration, key string) {
+	if value, ok := e.get(key); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			e.fail(key, value, "must be a duration such as 30s or 24h")
+			return
+		}
+		*dst = d
+	}
+}
+
+func (e *envReader) rateLimit(dst *RateLimit, key string) {
+	if value, ok := e.get(key); ok {
+		limit, err := ParseRateLimit(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s: %w", key, err))
+			return
+		}
+		*dst = limit
+	}
+}
+
+// list reads comma-separated values, ignoring blanks
+func (e *envReader) list(dst *[]string, key string) {
+	if value, ok := e.get(key); ok {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*dst = items
+	}
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValidationError lists every problem found in a configuration, each
+// naming the setting by its path in the config file
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// problems collects validation failures
+type problems []string
+
+func (p *problems) add(field, format string, args ...interface{}) {
+	*p = append(*p, field+": "+fmt.Sprintf(format, args...))
+}
+
+func (p *problems) positive(field string, n int) {
+	if n <= 0 {
+		p.add(field, "must be positive, got %d", n)
+	}
+}
+
+func (p *problems) nonNegative(field string, n int) {
+	if n < 0 {
+		p.add(field, "must not be negative, got %d", n)
+	}
+}
+
+func (p *problems) positiveDuration(field string, d time.Duration) {
+	if d <= 0 {
+		p.add(field, "must be a positive duration, got %s", d)
+	}
+}
+
+func (p *problems) oneOf(field, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	p.add(field, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+// absoluteURL checks for an http or https URL. Empty values are allowed.
+func (p *problems) absoluteURL(field, value string) {
+	if value == "" {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		p.add(field, "must be an absolute http or https URL, got %q", value)
+	}
+}
+
+func (p *problems) port(field, value string) {
+	if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 65535 {
+		p.add(field, "must be a port number, got %q", value)
+	}
+}
+
+func (p *problems) readableFile(field, path string) {
+	if path == "" {
+		p.add(field, "must be set")
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		p.add(field, "%v", err)
+	}
+}
+
+// Validate checks that the configuration is complete and consistent
+func (c *Config) Validate() error {
+	var p problems
+
+	p.port("server.port", c.Server.Port)
+	p.nonNegative("server.read_timeout", c.Server.ReadTimeout)
+	p.nonNegative("server.write_timeout", c.Server.WriteTimeout)
+	p.nonNegative("server.idle_timeout", c.Server.IdleTimeout)
+	if c.Server.TLS.Enabled() {
+		p.readableFile("server.tls.cert_file", c.Server.TLS.CertFile)
+		p.readableFile("server.tls.key_file", c.Server.TLS.KeyFile)
+	}
+
+	if c.Database.URL == "" {
+		if c.Database.Host == "" {
+			p.add("database.host", "must be set unless database.url is")
+		}
+		if c.Database.Name == "" {
+			p.add("database.name", "must be set unless database.url is")
+		}
+		if c.Database.User == "" {
+			p.add("database.user", "must be set unless database.url is")
+		}
+		p.port("database.port", c.Database.Port)
+		p.oneOf("database.ssl_mode", c.Database.SSLMode, "disable", "require", "verify-ca", "verify-full")
+	}
+	p.positive("database.max_open_conns", c.Database.MaxOpenConns)
+	if c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		p.add("database.max_idle_conns", "must be between 0 and database.max_open_conns, got %d", c.Database.MaxIdleConns)
+	}
+	if c.Database.ConnMaxLifetime < 0 {
+		p.add("database.conn_max_lifetime", "must not be negative, got %s", c.Database.ConnMaxLifetime)
+	}
+
+	p.oneOf("auth.backend", c.Auth.Backend, "clerk")
+	if u, err := url.Parse(c.Auth.JWKSURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || !strings.HasSuffix(u.Path, "/jwks") {
+		p.add("auth.jwks_url", "must be the absolute URL of the Clerk API's /jwks endpoint, got %q", c.Auth.JWKSURL)
+	}
+
+	for i, origin := range c.CORS.AllowedOrigins {
+		if err := checkOrigin(origin); err != nil {
+			p.add(fmt.Sprintf("cors.allowed_origins[%d]", i), "%v", err)
+		}
+	}
+
+	p.positive("sandbox.timeout_seconds", c.Sandbox.TimeoutSeconds)
+	p.positive("sandbox.cpu_seconds", c.Sandbox.CPUSeconds)
+	p.positive("sandbox.memory_mb", c.Sandbox.MemoryMB)
+	p.positive("sandbox.output_kb", c.Sandbox.OutputKB)
+	p.positive("sandbox.max_concurrent", c.Sandbox.MaxConcurrent)
+	p.positive("sandbox.max_per_user", c.Sandbox.MaxPerUser)
+	p.positive("sandbox.queue_timeout_seconds", c.Sandbox.QueueTimeoutSeconds)
+
+	p.absoluteURL("embed.public_url", c.Embed.PublicURL)
+	p.absoluteURL("embed.app_url", c.Embed.AppURL)
+
+	p.nonNegative("render.image_cache_mb", c.Render.ImageCacheMB)
+
+	p.oneOf("rate_limit.store", c.RateLimit.Store, "memory", "postgres")
+
+	p.oneOf("logging.format", c.Logging.Format, "json", "text")
+	p.oneOf("logging.level", c.Logging.Level, "debug", "info", "warn", "error")
+
+	if c.Metrics.Addr != "off" {
+		if _, _, err := net.SplitHostPort(c.Metrics.Addr); err != nil {
+			p.add("metrics.addr", "must be host:port or off, got %q", c.Metrics.Addr)
+		}
+	}
+
+	p.nonNegative("cache.size", c.Cache.Size)
+	p.positiveDuration("cache.ttl", c.Cache.TTL)
+	p.positiveDuration("events.retention", c.Events.Retention)
+	p.positiveDuration("collab.save_interval", c.Collab.SaveInterval)
+	p.positiveDuration("collab.idle_timeout", c.Collab.IdleTimeout)
+	p.positiveDuration("sync.tombstone_retention", c.Sync.TombstoneRetention)
+
+	if len(p) > 0 {
+		return &ValidationError{Problems: p}
+	}
+	return nil
+}
+
+// checkOrigin accepts scheme://host[:port] with no path, where the host may
+// start with "*." to match its subdomains
+func checkOrigin(origin string) error {
+	u, err := url.Parse(strings.Replace(origin, "://*.", "://wildcard.", 1))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return fmt.Errorf("must look like https://example.com or https://*.example.com, got %q", origin)
+	}
+	return nil
+}
@@ -3,79 +3,37 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+
+	"snippy-server/internal/config"
 
 	_ "github.com/lib/pq" // PostgreSQL driver
 )
 
-// DB holds the database connection
-var DB *sql.DB
-
-// Connect establishes a connection to the PostgreSQL database
-func Connect() error {
-	var connStr string
-
-	// First, try to use DATABASE_URL if it exists
-	if databaseURL := os.Getenv("DATABASE_URL"); databaseURL != "" {
-		log.Println("🔗 Using DATABASE_URL for connection")
-		connStr = databaseURL
-	} else {
-		// Fall back to individual environment variables
-		dbHost := os.Getenv("DB_HOST")
-		dbPort := os.Getenv("DB_PORT")
-		dbUser := os.Getenv("DB_USER")
-		dbPassword := os.Getenv("DB_PASSWORD")
-		dbName := os.Getenv("DB_NAME")
-
-		// Use default values if environment variables are not set
-		if dbHost == "" {
-			dbHost = "localhost"
-		}
-		if dbPort == "" {
-			dbPort = "5432"
-		}
-		if dbUser == "" {
-			dbUser = "postgres"
-		}
-		if dbName == "" {
-			dbName = "snippy"
-		}
-
-		// Build connection string
-		connStr = fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-			dbHost, dbPort, dbUser, dbPassword, dbName)
+// Connect opens a connection pool to the PostgreSQL database and checks
+// that it is reachable
+func Connect(cfg config.DatabaseConfig) (*sql.DB, error) {
+	if cfg.URL != "" {
+		slog.Info("using DATABASE_URL for connection")
 	}
 
 	// Open database connection
-	var err error
-	DB, err = sql.Open("postgres", connStr)
+	db, err := sql.Open("postgres", cfg.ConnString())
 	if err != nil {
-		return fmt.Errorf("failed to open database connection: %v", err)
+		return nil, fmt.Errorf("failed to open database connection: %v", err)
 	}
 
 	// Test the connection
-	if err := DB.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %v", err)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %v", err)
 	}
 
 	// Set connection pool settings
-	DB.SetMaxOpenConns(25)
-	DB.SetMaxIdleConns(25)
-
-	log.Println("✅ Database connection established successfully")
-	return nil
-}
-
-// Close closes the database connection
-func Close() error {
-	if DB != nil {
-		return DB.Close()
-	}
-	return nil
-}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
-// GetDB returns the database connection
-func GetDB() *sql.DB {
-	return DB
+	slog.Info("database connection established", "max_open_conns", cfg.MaxOpenConns)
+	return db, nil
 }
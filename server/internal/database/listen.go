@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Listen connects with connStr and calls onNotify with the payload of every
+// notification on channel until ctx is done. Notifications sent while the
+// connection was down are lost, so onReconnect is called after reconnecting
+// to let the caller catch up. Listen blocks until the first connection
+// succeeds.
+func Listen(ctx context.Context, connStr, channel string, onNotify func(payload string), onReconnect func()) error {
+	listener := pq.NewListener(connStr, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+			slog.Warn("notification listener disconnected", "channel", channel, "error", err)
+		case pq.ListenerEventReconnected:
+			slog.Info("notification listener reconnected", "channel", channel)
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(channel); err != nil {
+		return err
+	}
+
+	// Ping now and then so a silently dropped connection is noticed
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// A nil notification follows a reconnect
+			if n == nil {
+				onReconnect()
+				continue
+			}
+			onNotify(n.Extra)
+		case <-ping.C:
+			go listener.Ping()
+		}
+	}
+}
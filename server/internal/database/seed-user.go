@@ -1,100 +1,89 @@
 package database
 
 import (
+	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
 	"os"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/joho/godotenv"
 	"github.com/lib/pq"
 )
 
 // SeedUserData seeds the database with test data for a specific user from .env file
-func SeedUserData() error {
-	// Load .env file
-	if err := godotenv.Load(); err != nil {
-		return fmt.Errorf("failed to load .env file: %w", err)
-	}
-
-	// Initialize database connection
-	if err := Connect(); err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
-	}
-	defer Close()
-
+func SeedUserData(db *sql.DB) error {
 	// Get user ID from environment variable
 	userID := os.Getenv("USER_ID")
 	if userID == "" {
 		return fmt.Errorf("USER_ID environment variable is not set in .env file")
 	}
 
-	log.Printf("🌱 Starting to seed data for user: %s", userID)
+	slog.Info("starting to seed user data")
 
 	// Clear existing data for this user
-	if err := clearUserData(userID); err != nil {
+	if err := clearUserData(db, userID); err != nil {
 		return fmt.Errorf("failed to clear existing data: %w", err)
 	}
 
 	// Seed collections (12+ items)
-	collectionIDs, err := seedUserCollections(userID)
+	collectionIDs, err := seedUserCollections(db, userID)
 	if err != nil {
 		return fmt.Errorf("failed to seed collections: %w", err)
 	}
 
 	// Seed tags (15+ items)
-	tagIDs, err := seedUserTags(userID)
+	tagIDs, err := seedUserTags(db, userID)
 	if err != nil {
 		return fmt.Errorf("failed to seed tags: %w", err)
 	}
 
 	// Seed snippets (13+ items)
-	snippetIDs, err := seedUserSnippets(userID, collectionIDs, tagIDs)
+	snippetIDs, err := seedUserSnippets(db, userID, collectionIDs, tagIDs)
 	if err != nil {
 		return fmt.Errorf("failed to seed snippets: %w", err)
 	}
 
 	// Seed collection positions
-	if err := seedUserCollectionPositions(userID, collectionIDs); err != nil {
+	if err := seedUserCollectionPositions(db, userID, collectionIDs); err != nil {
 		return fmt.Errorf("failed to seed collection positions: %w", err)
 	}
 
 	// Seed collection snippet positions
-	if err := seedUserCollectionSnippetPositions(userID, collectionIDs, snippetIDs); err != nil {
+	if err := seedUserCollectionSnippetPositions(db, userID, collectionIDs, snippetIDs); err != nil {
 		return fmt.Errorf("failed to seed collection snippet positions: %w", err)
 	}
 
-	log.Printf("✅ Successfully seeded data for user: %s", userID)
+	slog.Info("seeded user data")
 	return nil
 }
 
-func clearUserData(userID string) error {
-	log.Printf("   - Clearing existing data for user: %s", userID)
+func clearUserData(db *sql.DB, userID string) error {
+	slog.Info("clearing existing user data")
 
 	// Delete in order to respect foreign key constraints
-	if _, err := GetDB().Exec("DELETE FROM collection_snippet_positions WHERE user_id = $1", userID); err != nil {
+	if _, err := db.Exec("DELETE FROM collection_snippet_positions WHERE user_id = $1", userID); err != nil {
 		return err
 	}
-	if _, err := GetDB().Exec("DELETE FROM collection_positions WHERE user_id = $1", userID); err != nil {
+	if _, err := db.Exec("DELETE FROM collection_positions WHERE user_id = $1", userID); err != nil {
 		return err
 	}
-	if _, err := GetDB().Exec("DELETE FROM snippets WHERE user_id = $1", userID); err != nil {
+	if _, err := db.Exec("DELETE FROM snippets WHERE user_id = $1", userID); err != nil {
 		return err
 	}
-	if _, err := GetDB().Exec("DELETE FROM collections WHERE user_id = $1", userID); err != nil {
+	if _, err := db.Exec("DELETE FROM collections WHERE user_id = $1", userID); err != nil {
 		return err
 	}
-	if _, err := GetDB().Exec("DELETE FROM tags WHERE user_id = $1", userID); err != nil {
+	if _, err := db.Exec("DELETE FROM tags WHERE user_id = $1", userID); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func seedUserCollections(userID string) ([]string, error) {
-	log.Printf("   - Seeding collections for user: %s", userID)
+func seedUserCollections(db *sql.DB, userID string) ([]string, error) {
+	slog.Info("seeding collections")
 
 	collections := []struct {
 		name  string
@@ -118,7 +107,7 @@ func seedUserCollections(userID string) ([]string, error) {
 
 	for _, c := range collections {
 		id := uuid.New().String()
-		_, err := GetDB().Exec(`
+		_, err := db.Exec(`
 			INSERT INTO collections (id, user_id, name, color, created_at, updated_at) 
 			VALUES ($1, $2, $3, $4, $5, $6)`,
 			id, userID, c.name, c.color, time.Now(), time.Now())
@@ -127,14 +116,14 @@ func seedUserCollections(userID string) ([]string, error) {
 			return nil, err
 		}
 		collectionIDs = append(collectionIDs, id)
-		log.Printf("     ✓ Created collection: %s", c.name)
+		slog.Info("created collection", "name", c.name)
 	}
 
 	return collectionIDs, nil
 }
 
-func seedUserTags(userID string) ([]string, error) {
-	log.Printf("   - Seeding tags for user: %s", userID)
+func seedUserTags(db *sql.DB, userID string) ([]string, error) {
+	slog.Info("seeding tags")
 
 	tags := []struct {
 		name  string
@@ -161,7 +150,7 @@ func seedUserTags(userID string) ([]string, error) {
 
 	for _, t := range tags {
 		id := uuid.New().String()
-		_, err := GetDB().Exec(`
+		_, err := db.Exec(`
 			INSERT INTO tags (id, user_id, name, color, created_at, updated_at) 
 			VALUES ($1, $2, $3, $4, $5, $6)`,
 			id, userID, t.name, t.color, time.Now(), time.Now())
@@ -170,14 +159,14 @@ func seedUserTags(userID string) ([]string, error) {
 			return nil, err
 		}
 		tagIDs = append(tagIDs, id)
-		log.Printf("     ✓ Created tag: %s", t.name)
+		slog.Info("created tag", "name", t.name)
 	}
 
 	return tagIDs, nil
 }
 
-func seedUserSnippets(userID string, collectionIDs, tagIDs []string) ([]string, error) {
-	log.Printf("   - Seeding snippets for user: %s", userID)
+func seedUserSnippets(db *sql.DB, userID string, collectionIDs, tagIDs []string) ([]string, error) {
+	slog.Info("seeding snippets")
 
 	snippets := []struct {
 		title   string
@@ -493,7 +482,7 @@ CREATE INDEX idx_user_preferences_user_id ON user_preferences(user_id);
 		isPublic := rand.Float32() < 0.3   // 30% chance of being public
 		isFavorite := rand.Float32() < 0.2 // 20% chance of being favorite
 
-		_, err := GetDB().Exec(`
+		_, err := db.Exec(`
 			INSERT INTO snippets (id, user_id, title, content, collection_ids, tag_ids, is_public, is_favorite, fork_count, created_at, updated_at) 
 			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
 			id, userID, s.title, s.content, pq.Array(selectedCollections), pq.Array(selectedTags),
@@ -503,17 +492,17 @@ CREATE INDEX idx_user_preferences_user_id ON user_preferences(user_id);
 			return nil, err
 		}
 		snippetIDs = append(snippetIDs, id)
-		log.Printf("     ✓ Created snippet: %s", s.title)
+		slog.Info("created snippet", "title", s.title)
 	}
 
 	return snippetIDs, nil
 }
 
-func seedUserCollectionPositions(userID string, collectionIDs []string) error {
-	log.Printf("   - Seeding collection positions for user: %s", userID)
+func seedUserCollectionPositions(db *sql.DB, userID string, collectionIDs []string) error {
+	slog.Info("seeding collection positions")
 
 	for i, collectionID := range collectionIDs {
-		_, err := GetDB().Exec(`
+		_, err := db.Exec(`
 			INSERT INTO collection_positions (id, collection_id, user_id, position, created_at, updated_at) 
 			VALUES ($1, $2, $3, $4, $5, $6)`,
 			uuid.New().String(), collectionID, userID, i, time.Now(), time.Now())
@@ -523,18 +512,18 @@ func seedUserCollectionPositions(userID string, collectionIDs []string) error {
 		}
 	}
 
-	log.Printf("     ✓ Created %d collection positions", len(collectionIDs))
+	slog.Info("created collection positions", "count", len(collectionIDs))
 	return nil
 }
 
-func seedUserCollectionSnippetPositions(userID string, collectionIDs, snippetIDs []string) error {
-	log.Printf("   - Seeding collection snippet positions for user: %s", userID)
+func seedUserCollectionSnippetPositions(db *sql.DB, userID string, collectionIDs, snippetIDs []string) error {
+	slog.Info("seeding collection snippet positions")
 
 	// For each snippet, create position entries for its collections
 	for snippetIndex, snippetID := range snippetIDs {
 		// Get the collections this snippet belongs to
 		var collectionIDsForSnippet []string
-		err := GetDB().QueryRow(`
+		err := db.QueryRow(`
 			SELECT collection_ids FROM snippets WHERE id = $1`, snippetID).Scan(pq.Array(&collectionIDsForSnippet))
 		if err != nil {
 			return err
@@ -542,7 +531,7 @@ func seedUserCollectionSnippetPositions(userID string, collectionIDs, snippetIDs
 
 		// Create position entries for each collection
 		for collectionIndex, collectionID := range collectionIDsForSnippet {
-			_, err := GetDB().Exec(`
+			_, err := db.Exec(`
 				INSERT INTO collection_snippet_positions (id, collection_id, snippet_id, user_id, position, created_at, updated_at) 
 				VALUES ($1, $2, $3, $4, $5, $6, $7)`,
 				uuid.New().String(), collectionID, snippetID, userID,
@@ -554,6 +543,6 @@ func seedUserCollectionSnippetPositions(userID string, collectionIDs, snippetIDs
 		}
 	}
 
-	log.Printf("     ✓ Created collection snippet positions")
+	slog.Info("created collection snippet positions")
 	return nil
 }
@@ -1,73 +1,74 @@
 package database
 
 import (
-	"log"
+	"database/sql"
+	"log/slog"
 	"time"
 
 	"github.com/lib/pq"
 )
 
 // SeedDatabase seeds the database with initial test data
-func SeedDatabase() error {
-	log.Println("🌱 Starting database seeding...")
+func SeedDatabase(db *sql.DB) error {
+	slog.Info("starting database seeding")
 
 	// Clear existing data
-	if err := clearData(); err != nil {
+	if err := clearData(db); err != nil {
 		return err
 	}
 
 	// Seed collections
-	if err := seedCollections(); err != nil {
+	if err := seedCollections(db); err != nil {
 		return err
 	}
 
 	// Seed tags
-	if err := seedTags(); err != nil {
+	if err := seedTags(db); err != nil {
 		return err
 	}
 
 	// Seed snippets
-	if err := seedSnippets(); err != nil {
+	if err := seedSnippets(db); err != nil {
 		return err
 	}
 
 	// Seed position tables
-	if err := seedCollectionPositions(); err != nil {
+	if err := seedCollectionPositions(db); err != nil {
 		return err
 	}
 
-	if err := seedCollectionSnippetPositions(); err != nil {
+	if err := seedCollectionSnippetPositions(db); err != nil {
 		return err
 	}
 
-	log.Println("✅ Database seeding completed successfully")
+	slog.Info("database seeding completed")
 	return nil
 }
 
 // clearData removes all existing data from tables
-func clearData() error {
+func clearData(db *sql.DB) error {
 	// Delete in order to respect foreign key constraints
-	if _, err := GetDB().Exec("DELETE FROM collection_snippet_positions"); err != nil {
+	if _, err := db.Exec("DELETE FROM collection_snippet_positions"); err != nil {
 		return err
 	}
-	if _, err := GetDB().Exec("DELETE FROM collection_positions"); err != nil {
+	if _, err := db.Exec("DELETE FROM collection_positions"); err != nil {
 		return err
 	}
-	if _, err := GetDB().Exec("DELETE FROM snippets"); err != nil {
+	if _, err := db.Exec("DELETE FROM snippets"); err != nil {
 		return err
 	}
-	if _, err := GetDB().Exec("DELETE FROM collections"); err != nil {
+	if _, err := db.Exec("DELETE FROM collections"); err != nil {
 		return err
 	}
-	if _, err := GetDB().Exec("DELETE FROM tags"); err != nil {
+	if _, err := db.Exec("DELETE FROM tags"); err != nil {
 		return err
 	}
-	log.Println("   - Cleared existing data")
+	slog.Info("cleared existing data")
 	return nil
 }
 
 // seedCollections inserts test collections
-func seedCollections() error {
+func seedCollections(db *sql.DB) error {
 	collections := []struct {
 		id        string
 		userID    string
@@ -89,7 +90,7 @@ func seedCollections() error {
 	}
 
 	for _, c := range collections {
-		_, err := GetDB().Exec(`
+		_, err := db.Exec(`
 			INSERT INTO collections (id, user_id, name, color, created_at, updated_at) 
 			VALUES ($1, $2, $3, $4, $5, $6)`,
 			c.id, c.userID, c.name, c.color, c.createdAt, c.updatedAt)
@@ -97,14 +98,14 @@ func seedCollections() error {
 		if err != nil {
 			return err
 		}
-		log.Printf("   ✓ Created collection: %s", c.name)
+		slog.Info("created collection", "name", c.name)
 	}
 
 	return nil
 }
 
 // seedTags inserts test tags
-func seedTags() error {
+func seedTags(db *sql.DB) error {
 	tags := []struct {
 		id        string
 		userID    string
@@ -126,7 +127,7 @@ func seedTags() error {
 	}
 
 	for _, t := range tags {
-		_, err := GetDB().Exec(`
+		_, err := db.Exec(`
 			INSERT INTO tags (id, user_id, name, color, created_at, updated_at) 
 			VALUES ($1, $2, $3, $4, $5, $6)`,
 			t.id, t.userID, t.name, t.color, t.createdAt, t.updatedAt)
@@ -134,14 +135,14 @@ func seedTags() error {
 		if err != nil {
 			return err
 		}
-		log.Printf("   ✓ Created tag: %s", t.name)
+		slog.Info("created tag", "name", t.name)
 	}
 
 	return nil
 }
 
 // seedSnippets inserts test code snippets
-func seedSnippets() error {
+func seedSnippets(db *sql.DB) error {
 	snippets := []struct {
 		id            string
 		userID        string
@@ -393,7 +394,7 @@ const closeModal = () => {
 	}
 
 	for _, s := range snippets {
-		_, err := GetDB().Exec(`
+		_, err := db.Exec(`
 					INSERT INTO snippets (id, user_id, title, content, collection_ids, tag_ids, is_public, is_favorite, fork_count, forked_from, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
 			s.id, s.userID, s.title, s.content, pq.Array(s.collectionIDs), pq.Array(s.tagIDs), s.isPublic, s.isFavorite, s.forkCount, s.forkedFrom, s.createdAt, s.updatedAt)
@@ -401,7 +402,7 @@ const closeModal = () => {
 		if err != nil {
 			return err
 		}
-		log.Printf("   ✓ Created snippet: %s", s.title)
+		slog.Info("created snippet", "title", s.title)
 	}
 
 	return nil
@@ -411,7 +412,7 @@ const closeModal = () => {
 func parseTime(timeStr string) time.Time {
 	t, err := time.Parse("2006-01-02 15:04:05", timeStr)
 	if err != nil {
-		log.Printf("Warning: failed to parse time '%s': %v", timeStr, err)
+		slog.Warn("failed to parse time", "value", timeStr, "error", err)
 		return time.Now()
 	}
 	return t
@@ -423,7 +424,7 @@ func stringPtr(s string) *string {
 }
 
 // seedCollectionPositions inserts position data for collections
-func seedCollectionPositions() error {
+func seedCollectionPositions(db *sql.DB) error {
 	positions := []struct {
 		collectionID string
 		userID       string
@@ -451,7 +452,7 @@ func seedCollectionPositions() error {
 	}
 
 	for _, p := range positions {
-		_, err := GetDB().Exec(`
+		_, err := db.Exec(`
 			INSERT INTO collection_positions (collection_id, user_id, position, created_at, updated_at) 
 			VALUES ($1, $2, $3, $4, $5)`,
 			p.collectionID, p.userID, p.position, p.createdAt, p.updatedAt)
@@ -459,14 +460,14 @@ func seedCollectionPositions() error {
 		if err != nil {
 			return err
 		}
-		log.Printf("   ✓ Created collection position: %s for user %s at position %d", p.collectionID, p.userID, p.position)
+		slog.Info("created collection position", "collection_id", p.collectionID, "position", p.position)
 	}
 
 	return nil
 }
 
 // seedCollectionSnippetPositions inserts position data for snippets within collections
-func seedCollectionSnippetPositions() error {
+func seedCollectionSnippetPositions(db *sql.DB) error {
 	positions := []struct {
 		collectionID string
 		snippetID    string
@@ -505,7 +506,7 @@ func seedCollectionSnippetPositions() error {
 	}
 
 	for _, p := range positions {
-		_, err := GetDB().Exec(`
+		_, err := db.Exec(`
 			INSERT INTO collection_snippet_positions (collection_id, snippet_id, user_id, position, created_at, updated_at) 
 			VALUES ($1, $2, $3, $4, $5, $6)`,
 			p.collectionID, p.snippetID, p.userID, p.position, p.createdAt, p.updatedAt)
@@ -513,7 +514,7 @@ func seedCollectionSnippetPositions() error {
 		if err != nil {
 			return err
 		}
-		log.Printf("   ✓ Created snippet position: %s in collection %s for user %s at position %d", p.snippetID, p.collectionID, p.userID, p.position)
+		slog.Info("created snippet position", "snippet_id", p.snippetID, "collection_id", p.collectionID, "position", p.position)
 	}
 
 	return nil
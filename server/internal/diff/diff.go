@@ -0,0 +1,236 @@
+// Package diff provides line-based diffs, unified diff output and
+// three-way merging of snippet content.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op kinds used in an edit script
+const (
+	Equal  = '='
+	Delete = '-'
+	Insert = '+'
+)
+
+// Op is a single line of an edit script turning a into b
+type Op struct {
+	Kind byte
+	Text string // The line including its trailing newline, if any
+}
+
+// Lines splits text into lines, keeping each line's trailing newline so
+// that joining the result reproduces text exactly
+func Lines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Diff returns the shortest edit script turning a into b
+func Diff(a, b []string) []Op {
+	// Common prefix and suffix never need the full search
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]Op, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, Op{Equal, line})
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, Op{Equal, line})
+	}
+	return ops
+}
+
+// myers implements Myers' O(ND) difference algorithm
+func myers(a, b []string) []Op {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+search:
+	for d := 0; d <= max; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk the trace backwards to recover the edit script
+	var reversed []Op
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY && x > 0 && y > 0 {
+			reversed = append(reversed, Op{Equal, a[x-1]})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, Op{Insert, b[y-1]})
+				y--
+			} else {
+				reversed = append(reversed, Op{Delete, a[x-1]})
+				x--
+			}
+		}
+	}
+
+	ops := make([]Op, len(reversed))
+	for i, op := range reversed {
+		ops[len(reversed)-1-i] = op
+	}
+	return ops
+}
+
+// HasChanges reports whether an edit script contains any insertion or deletion
+func HasChanges(ops []Op) bool {
+	for _, op := range ops {
+		if op.Kind != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+// Unified renders the difference between oldText and newText as a unified
+// diff with the given number of context lines. It returns an empty string
+// when the texts are identical.
+func Unified(oldName, newName, oldText, newText string, context int) string {
+	ops := Diff(Lines(oldText), Lines(newText))
+	if !HasChanges(ops) {
+		return ""
+	}
+
+	// Line numbers in a and b at the start of every op
+	aPos := make([]int, len(ops)+1)
+	bPos := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if op.Kind != Insert {
+			aPos[i+1]++
+		}
+		if op.Kind != Delete {
+			bPos[i+1]++
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	i := 0
+	for i < len(ops) {
+		// Find the next change
+		for i < len(ops) && ops[i].Kind == Equal {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+
+		// Extend the hunk while changes are within 2*context of each other
+		end := i
+		for end < len(ops) {
+			for end < len(ops) && ops[end].Kind != Equal {
+				end++
+			}
+			run := end
+			for run < len(ops) && ops[run].Kind == Equal {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				break
+			}
+			end = run
+		}
+		stop := end + context
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		oldLen := aPos[stop] - aPos[start]
+		newLen := bPos[stop] - bPos[start]
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aPos[start], oldLen), hunkRange(bPos[start], newLen))
+		for _, op := range ops[start:stop] {
+			if op.Kind == Equal {
+				sb.WriteByte(' ')
+			} else {
+				sb.WriteByte(op.Kind)
+			}
+			sb.WriteString(op.Text)
+			if !strings.HasSuffix(op.Text, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		i = stop
+	}
+
+	return sb.String()
+}
+
+// hunkRange formats the "start,length" part of a hunk header
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
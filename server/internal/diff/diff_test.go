@@ -0,0 +1,81 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+// apply rebuilds the new text from an edit script
+func apply(ops []Op) (string, string) {
+	var oldText, newText strings.Builder
+	for _, op := range ops {
+		if op.Kind != Insert {
+			oldText.WriteString(op.Text)
+		}
+		if op.Kind != Delete {
+			newText.WriteString(op.Text)
+		}
+	}
+	return oldText.String(), newText.String()
+}
+
+func TestDiffRoundTrip(t *testing.T) {
+	cases := [][2]string{
+		{"", ""},
+		{"", "a\nb\n"},
+		{"a\nb\n", ""},
+		{"a\nb\nc\n", "a\nc\n"},
+		{"a\nb\nc\n", "x\na\nb\ny\nc\nz"},
+		{"one\ntwo\nthree", "one\n2\nthree\nfour\n"},
+	}
+	for _, c := range cases {
+		ops := Diff(Lines(c[0]), Lines(c[1]))
+		gotOld, gotNew := apply(ops)
+		if gotOld != c[0] || gotNew != c[1] {
+			t.Errorf("Diff(%q, %q) does not round-trip: got %q, %q", c[0], c[1], gotOld, gotNew)
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	got := Unified("a", "b", "one\ntwo\nthree\n", "one\n2\nthree\n", 3)
+	want := "--- a\n+++ b\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n"
+	if got != want {
+		t.Errorf("Unified mismatch:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	if Unified("a", "b", "same\n", "same\n", 3) != "" {
+		t.Error("Expected empty diff for identical input")
+	}
+}
+
+func TestMerge3Clean(t *testing.T) {
+	base := "func a() {}\n\nfunc b() {}\n\nfunc c() {}\n"
+	ours := "func a() { return }\n\nfunc b() {}\n\nfunc c() {}\n"
+	theirs := "func a() {}\n\nfunc b() {}\n\nfunc c() { panic(1) }\n"
+
+	got := Merge3(base, ours, theirs, "fork", "upstream")
+	want := "func a() { return }\n\nfunc b() {}\n\nfunc c() { panic(1) }\n"
+	if got.Conflicts != 0 || got.Content != want {
+		t.Errorf("Merge3 = %q (%d conflicts), want %q", got.Content, got.Conflicts, want)
+	}
+}
+
+func TestMerge3Conflict(t *testing.T) {
+	base := "a\nb\nc\n"
+	ours := "a\nB1\nc\n"
+	theirs := "a\nB2\nc\n"
+
+	got := Merge3(base, ours, theirs, "fork", "upstream")
+	want := "a\n<<<<<<< fork\nB1\n=======\nB2\n>>>>>>> upstream\nc\n"
+	if got.Conflicts != 1 || got.Content != want {
+		t.Errorf("Merge3 = %q (%d conflicts), want %q", got.Content, got.Conflicts, want)
+	}
+}
+
+func TestMerge3SameChangeOnBothSides(t *testing.T) {
+	got := Merge3("a\nb\n", "a\nc\n", "a\nc\n", "fork", "upstream")
+	if got.Conflicts != 0 || got.Content != "a\nc\n" {
+		t.Errorf("Merge3 = %q (%d conflicts)", got.Content, got.Conflicts)
+	}
+}
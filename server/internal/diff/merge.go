@@ -0,0 +1,115 @@
+package diff
+
+import "strings"
+
+// MergeResult is the outcome of a three-way merge
+type MergeResult struct {
+	Content   string `json:"content"`
+	Conflicts int    `json:"conflicts"` // Number of conflict blocks in Content
+}
+
+// Merge3 merges the changes made in ours and theirs relative to base. Blocks
+// changed differently on both sides are written with git-style conflict
+// markers labelled with oursLabel and theirsLabel.
+func Merge3(base, ours, theirs, oursLabel, theirsLabel string) MergeResult {
+	o, a, b := Lines(base), Lines(ours), Lines(theirs)
+	matchA := matches(o, a)
+	matchB := matches(o, b)
+
+	var sb strings.Builder
+	conflicts := 0
+	i, ia, ib := 0, 0, 0
+
+	for i < len(o) || ia < len(a) || ib < len(b) {
+		// Copy the run of lines that is unchanged on both sides
+		n := 0
+		for i+n < len(o) && matchA[i+n] == ia+n && matchB[i+n] == ib+n {
+			n++
+		}
+		if n > 0 {
+			for _, line := range o[i : i+n] {
+				sb.WriteString(line)
+			}
+			i, ia, ib = i+n, ia+n, ib+n
+			continue
+		}
+
+		// Find the next base line both sides still have
+		k := i + 1
+		for k < len(o) && (matchA[k] < 0 || matchB[k] < 0) {
+			k++
+		}
+		endA, endB := len(a), len(b)
+		if k < len(o) {
+			endA, endB = matchA[k], matchB[k]
+		} else {
+			k = len(o)
+		}
+
+		chunkO, chunkA, chunkB := o[i:k], a[ia:endA], b[ib:endB]
+		switch {
+		case equalLines(chunkA, chunkO):
+			writeLines(&sb, chunkB)
+		case equalLines(chunkB, chunkO), equalLines(chunkA, chunkB):
+			writeLines(&sb, chunkA)
+		default:
+			conflicts++
+			sb.WriteString("<<<<<<< " + oursLabel + "\n")
+			writeLines(&sb, chunkA)
+			sb.WriteString("=======\n")
+			writeLines(&sb, chunkB)
+			sb.WriteString(">>>>>>> " + theirsLabel + "\n")
+		}
+
+		i, ia, ib = k, endA, endB
+	}
+
+	return MergeResult{Content: sb.String(), Conflicts: conflicts}
+}
+
+// matches maps every line of base to the index of the line it is matched
+// with in other, or -1 when the line was deleted
+func matches(base, other []string) []int {
+	m := make([]int, len(base))
+	for i := range m {
+		m[i] = -1
+	}
+	x, y := 0, 0
+	for _, op := range Diff(base, other) {
+		switch op.Kind {
+		case Equal:
+			m[x] = y
+			x++
+			y++
+		case Delete:
+			x++
+		case Insert:
+			y++
+		}
+	}
+	return m
+}
+
+// writeLines writes lines and makes sure the block ends with a newline so
+// that following conflict markers start on their own line
+func writeLines(sb *strings.Builder, lines []string) {
+	for _, line := range lines {
+		sb.WriteString(line)
+	}
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		sb.WriteString("\n")
+	}
+}
+
+// equalLines reports whether two line slices are identical
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,57 @@
+// Package events streams changes to users' snippets, collections and tags.
+// Triggers append every change to the change_events table and announce it
+// with NOTIFY; each API replica listens and fans the events out to the
+// streams of their owners through a Hub.
+package events
+
+import (
+	"encoding/json"
+	"log/slog"
+
+	"snippy-server/internal/fanout"
+	"snippy-server/internal/models"
+)
+
+// Channel is the Postgres notification channel carrying new change events
+// as JSON
+const Channel = "change_events"
+
+// Subscription receives the change events of one user
+type Subscription = fanout.Subscription[models.ChangeEvent]
+
+// Hub fans out change events to the streams of their owners
+type Hub struct {
+	hub *fanout.Hub[models.ChangeEvent]
+}
+
+// NewHub creates an empty hub
+func NewHub() *Hub {
+	return &Hub{hub: fanout.NewHub[models.ChangeEvent](64)}
+}
+
+// Subscribe registers a stream for userID. The returned function must be
+// called to release the subscription when the stream closes.
+func (h *Hub) Subscribe(userID string) (*Subscription, func()) {
+	return h.hub.Subscribe(userID)
+}
+
+// Publish delivers e to every stream of its owner
+func (h *Hub) Publish(e models.ChangeEvent) {
+	h.hub.Publish(e.UserID, e)
+}
+
+// PublishPayload publishes an event received as a notification payload
+func (h *Hub) PublishPayload(payload string) {
+	var e models.ChangeEvent
+	if err := json.Unmarshal([]byte(payload), &e); err != nil {
+		slog.Warn("ignoring malformed change event", "error", err)
+		return
+	}
+	h.Publish(e)
+}
+
+// Resync tells every stream to catch up from the event log, for when
+// notifications may have been missed
+func (h *Hub) Resync() {
+	h.hub.Resync()
+}
@@ -0,0 +1,42 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestHubScopesEventsToOwner(t *testing.T) {
+	h := NewHub()
+	alice, unsubscribe := h.Subscribe("alice")
+	defer unsubscribe()
+	bob, unsubscribeBob := h.Subscribe("bob")
+	defer unsubscribeBob()
+
+	h.PublishPayload(`{"id":7,"user_id":"alice","type":"snippet.updated","entity_type":"snippet","entity_id":"s1"}`)
+
+	select {
+	case e := <-alice.Items:
+		if e.ID != 7 || e.Type != "snippet.updated" || e.EntityID != "s1" {
+			t.Errorf("Unexpected event %+v", e)
+		}
+	default:
+		t.Fatal("Owner did not receive the event")
+	}
+	select {
+	case e := <-bob.Items:
+		t.Errorf("Other user received %+v", e)
+	default:
+	}
+}
+
+func TestHubIgnoresMalformedPayloads(t *testing.T) {
+	h := NewHub()
+	sub, unsubscribe := h.Subscribe("alice")
+	defer unsubscribe()
+
+	h.PublishPayload(`{"id":`)
+	select {
+	case e := <-sub.Items:
+		t.Errorf("Got %+v", e)
+	default:
+	}
+}
@@ -0,0 +1,81 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"snippy-server/internal/models"
+)
+
+// Since returns up to limit events of userID with IDs above afterID,
+// oldest first. Event IDs are the owner's sequence numbers, which become
+// visible in commit order, so no event can later appear below afterID.
+func Since(ctx context.Context, db *sql.DB, userID string, afterID int64, limit int) ([]models.ChangeEvent, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT seq, user_id, entity_type || '.' || action, entity_type, entity_id, created_at
+		FROM change_events
+		WHERE user_id = $1 AND seq > $2
+		ORDER BY seq
+		LIMIT $3`, userID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read change events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.ChangeEvent
+	for rows.Next() {
+		var e models.ChangeEvent
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Type, &e.EntityType, &e.EntityID, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan change event: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// Bounds returns the IDs of userID's oldest logged event and newest event.
+// When every event has been pruned oldest is one past newest. Streams
+// resuming before the oldest event may have missed pruned events.
+func Bounds(ctx context.Context, db *sql.DB, userID string) (oldest, newest int64, err error) {
+	err = db.QueryRowContext(ctx, `
+		SELECT COALESCE((SELECT MIN(seq) FROM change_events WHERE user_id = $1), c.seq + 1), c.seq
+		FROM (SELECT COALESCE((SELECT seq FROM change_event_counters WHERE user_id = $1), 0) AS seq) c`,
+		userID).Scan(&oldest, &newest)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read change event bounds: %w", err)
+	}
+	return oldest, newest, nil
+}
+
+// Pruner deletes events older than Retention, keeping the log bounded
+type Pruner struct {
+	DB        *sql.DB
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+// NewPruner creates a pruner that runs every ten minutes
+func NewPruner(db *sql.DB, retention time.Duration) *Pruner {
+	return &Pruner{DB: db, Retention: retention, Interval: 10 * time.Minute}
+}
+
+// Run prunes the log until ctx is cancelled
+func (p *Pruner) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.DB.ExecContext(ctx, `DELETE FROM change_events WHERE created_at < $1`, time.Now().Add(-p.Retention)); err != nil {
+			slog.ErrorContext(ctx, "failed to prune change events", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Package fanout delivers messages to the open streams of a user. Each
+// replica runs its own Hub, fed by a Postgres LISTEN connection, so a
+// message reaches the user's streams on every replica.
+package fanout
+
+import "sync"
+
+// Subscription receives the messages of one user
+type Subscription[T any] struct {
+	// Items delivers new messages in the order they were published
+	Items <-chan T
+	// Lagged is signalled when messages were dropped because the
+	// subscriber fell behind, or may have been missed while the listener
+	// reconnected. The subscriber should then catch up from the database.
+	Lagged <-chan struct{}
+
+	items  chan T
+	lagged chan struct{}
+}
+
+// Hub fans out messages to the subscriptions of their recipients
+type Hub[T any] struct {
+	mu          sync.Mutex
+	buffer      int
+	subscribers map[string]map[*Subscription[T]]struct{}
+}
+
+// NewHub creates an empty hub whose subscriptions buffer up to buffer
+// messages
+func NewHub[T any](buffer int) *Hub[T] {
+	return &Hub[T]{buffer: buffer, subscribers: make(map[string]map[*Subscription[T]]struct{})}
+}
+
+// Subscribe registers a stream for userID. The returned function must be
+// called to release the subscription when the stream closes.
+func (h *Hub[T]) Subscribe(userID string) (*Subscription[T], func()) {
+	items := make(chan T, h.buffer)
+	lagged := make(chan struct{}, 1)
+	sub := &Subscription[T]{Items: items, Lagged: lagged, items: items, lagged: lagged}
+
+	h.mu.Lock()
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[*Subscription[T]]struct{})
+	}
+	h.subscribers[userID][sub] = struct{}{}
+	h.mu.Unlock()
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers[userID], sub)
+		if len(h.subscribers[userID]) == 0 {
+			delete(h.subscribers, userID)
+		}
+	}
+
+	return sub, unsubscribe
+}
+
+// Publish delivers item to every stream of userID. A stream whose buffer
+// is full is told it lagged instead of blocking the publisher.
+func (h *Hub[T]) Publish(userID string, item T) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers[userID] {
+		select {
+		case sub.items <- item:
+		default:
+			sub.signalLagged()
+		}
+	}
+}
+
+// Resync tells every stream to catch up, for when messages may have been
+// missed
+func (h *Hub[T]) Resync() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, subs := range h.subscribers {
+		for sub := range subs {
+			sub.signalLagged()
+		}
+	}
+}
+
+func (s *Subscription[T]) signalLagged() {
+	select {
+	case s.lagged <- struct{}{}:
+	default:
+	}
+}
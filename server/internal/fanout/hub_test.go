@@ -0,0 +1,60 @@
+package fanout
+
+import "testing"
+
+func TestHubScopesToRecipient(t *testing.T) {
+	h := NewHub[int](4)
+	alice, unsubscribe := h.Subscribe("alice")
+	defer unsubscribe()
+	bob, unsubscribeBob := h.Subscribe("bob")
+	defer unsubscribeBob()
+
+	h.Publish("alice", 7)
+
+	select {
+	case got := <-alice.Items:
+		if got != 7 {
+			t.Errorf("Got %d", got)
+		}
+	default:
+		t.Fatal("Recipient did not receive the message")
+	}
+	select {
+	case got := <-bob.Items:
+		t.Errorf("Other user received %d", got)
+	default:
+	}
+}
+
+func TestHubSignalsLaggingSubscribers(t *testing.T) {
+	h := NewHub[int](4)
+	sub, unsubscribe := h.Subscribe("alice")
+	defer unsubscribe()
+
+	for i := 0; i < cap(sub.items)+1; i++ {
+		h.Publish("alice", i)
+	}
+	select {
+	case <-sub.Lagged:
+	default:
+		t.Error("A full subscriber should be told to catch up")
+	}
+}
+
+func TestHubResync(t *testing.T) {
+	h := NewHub[int](4)
+	sub, unsubscribe := h.Subscribe("alice")
+	h.Resync()
+	h.Resync() // Signals coalesce
+	select {
+	case <-sub.Lagged:
+	default:
+		t.Error("Resync should signal every subscriber")
+	}
+
+	unsubscribe()
+	h.Publish("alice", 1)
+	if len(sub.items) != 0 || len(h.subscribers) != 0 {
+		t.Error("Unsubscribed stream still receives messages")
+	}
+}
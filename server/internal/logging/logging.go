@@ -0,0 +1,120 @@
+// Package logging configures structured logging with log/slog. Every record
+// logged with a request context carries the request ID and user ID, and
+// credentials are redacted before anything is written.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Config selects the log format and level
+type Config struct {
+	Format string // "json" (default) or "text"
+	Level  string // debug, info, warn or error
+}
+
+// Setup installs the default slog logger. The standard log package writes
+// through it as well, so remaining log.Printf calls are structured too.
+func Setup(cfg Config) *slog.Logger {
+	logger := New(os.Stderr, cfg)
+	slog.SetDefault(logger)
+	return logger
+}
+
+// New creates a logger writing to w
+func New(w io.Writer, cfg Config) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level:       parseLevel(cfg.Level),
+		ReplaceAttr: RedactAttr,
+	}
+
+	var handler slog.Handler
+	if strings.EqualFold(cfg.Format, "text") {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(&contextHandler{handler})
+}
+
+// parseLevel maps a level name to a slog level, defaulting to info
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// requestState is shared by all contexts derived from a request, so the user
+// ID set by the auth middleware is visible to the outer access log
+type requestState struct {
+	id string
+
+	mu     sync.Mutex
+	userID string
+}
+
+func (s *requestState) user() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.userID
+}
+
+type stateKey struct{}
+
+// WithRequestID returns a context that tags log records with id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, stateKey{}, &requestState{id: id})
+}
+
+// RequestID returns the request ID stored in ctx, or ""
+func RequestID(ctx context.Context) string {
+	if state, ok := ctx.Value(stateKey{}).(*requestState); ok {
+		return state.id
+	}
+	return ""
+}
+
+// SetUserID records the authenticated user for the rest of the request,
+// including the access log line written after the handler returns
+func SetUserID(ctx context.Context, userID string) {
+	if state, ok := ctx.Value(stateKey{}).(*requestState); ok {
+		state.mu.Lock()
+		state.userID = userID
+		state.mu.Unlock()
+	}
+}
+
+// contextHandler adds the request ID and user ID from the context to records
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if state, ok := ctx.Value(stateKey{}).(*requestState); ok {
+		r.AddAttrs(slog.String("request_id", state.id))
+		if userID := state.user(); userID != "" {
+			r.AddAttrs(slog.String("user_id", userID))
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
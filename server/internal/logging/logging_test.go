@@ -0,0 +1,132 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"snippy-server/internal/webhooks"
+)
+
+func decodeLine(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Log line is not JSON: %v\n%s", err, buf.String())
+	}
+	return record
+}
+
+func TestContextAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, Config{})
+
+	ctx := WithRequestID(context.Background(), "req-123")
+	SetUserID(ctx, "user_abc")
+	logger.InfoContext(ctx, "request", "status", 200)
+
+	record := decodeLine(t, &buf)
+	if record["request_id"] != "req-123" {
+		t.Errorf("request_id = %v, want req-123", record["request_id"])
+	}
+	if record["user_id"] != "user_abc" {
+		t.Errorf("user_id = %v, want user_abc", record["user_id"])
+	}
+	if got := RequestID(ctx); got != "req-123" {
+		t.Errorf("RequestID() = %q, want req-123", got)
+	}
+}
+
+func TestNoContextAttributesWithoutRequest(t *testing.T) {
+	var buf bytes.Buffer
+	New(&buf, Config{}).Info("startup")
+
+	record := decodeLine(t, &buf)
+	if _, ok := record["request_id"]; ok {
+		t.Errorf("Unexpected request_id in %v", record)
+	}
+}
+
+func TestRedactsSensitiveKeys(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, Config{})
+
+	logger.Info("login",
+		"authorization", "Bearer abc.def.ghi",
+		"Cookie", "__session=xyz",
+		"webhook_secret", "whsec_123",
+		"path", "/api/snippets")
+
+	record := decodeLine(t, &buf)
+	for _, key := range []string{"authorization", "Cookie", "webhook_secret"} {
+		if record[key] != Redacted {
+			t.Errorf("%s = %v, want %s", key, record[key], Redacted)
+		}
+	}
+	if record["path"] != "/api/snippets" {
+		t.Errorf("path = %v, want it unchanged", record["path"])
+	}
+}
+
+func TestRedactsValues(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Authorization: Bearer abc123.def", "Authorization: Bearer [REDACTED]"},
+		{"cookie __session=eyJhbGciOi.eyJzdWIi.c2ln; theme=dark", "cookie __session=[REDACTED]; theme=dark"},
+		{"token eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxIn0.sig", "token [REDACTED]"},
+		{"key sk_live_abcdef123456", "key [REDACTED]"},
+		{"clerk whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw", "clerk [REDACTED]"},
+		{"nothing secret here", "nothing secret here"},
+	}
+
+	for _, tt := range tests {
+		if got := Redact(tt.in); got != tt.want {
+			t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactsWebhookSecrets(t *testing.T) {
+	secret, err := webhooks.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := Redact("delivery failed for secret " + secret + ": timeout")
+	if got != "delivery failed for secret [REDACTED]: timeout" {
+		t.Errorf("Redact left %q", got)
+	}
+}
+
+func TestRedactsErrors(t *testing.T) {
+	var buf bytes.Buffer
+	New(&buf, Config{}).Error("auth failed", "error", errors.New("bad header Bearer abc123"))
+
+	if strings.Contains(buf.String(), "abc123") {
+		t.Errorf("Token leaked into log: %s", buf.String())
+	}
+}
+
+func TestLevelAndFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, Config{Format: "text", Level: "warn"})
+
+	logger.Info("hidden")
+	if buf.Len() != 0 {
+		t.Fatalf("Info logged at warn level: %s", buf.String())
+	}
+
+	logger.Warn("shown")
+	if !strings.Contains(buf.String(), "level=WARN") {
+		t.Errorf("Expected text output, got %s", buf.String())
+	}
+
+	if parseLevel("debug") != slog.LevelDebug || parseLevel("bogus") != slog.LevelInfo {
+		t.Error("Unexpected level parsing")
+	}
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces sensitive values in log output
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute names whose values are never logged
+var sensitiveKeys = []string{
+	"authorization", "cookie", "set-cookie", "token", "secret", "password",
+	"api_key", "apikey", "session", "jwt", "signature",
+}
+
+// sensitiveValues match credentials that end up inside other values, such as
+// an error message quoting a header
+var sensitiveValues = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(Bearer|Basic)\s+[A-Za-z0-9._~+/=-]+`),
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*`),
+	regexp.MustCompile(`(?i)\b(__session|__client|jwt)=[^;\s]+`),
+	regexp.MustCompile(`\b(sk|pk)_(test|live)_[A-Za-z0-9]+`),
+	// Webhook signing secrets: our own whsec_<hex> and Clerk's base64 ones
+	regexp.MustCompile(`\bwhsec_[A-Za-z0-9_+/]+`),
+}
+
+// RedactAttr is a slog ReplaceAttr function that hides credentials
+func RedactAttr(groups []string, a slog.Attr) slog.Attr {
+	if isSensitiveKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(a.Value.String()))
+	case slog.KindAny:
+		// Errors and other values are logged through their string form
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+	}
+	return a
+}
+
+// Redact removes tokens, cookies and keys from free text
+func Redact(s string) string {
+	for _, re := range sensitiveValues {
+		s = re.ReplaceAllStringFunc(s, func(match string) string {
+			// Keep the scheme or cookie name so the line stays readable
+			if i := strings.IndexAny(match, " ="); i > 0 && !strings.HasPrefix(match, "eyJ") {
+				return match[:i+1] + Redacted
+			}
+			return Redacted
+		})
+	}
+	return s
+}
+
+// isSensitiveKey reports whether an attribute name suggests a credential
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+// Package metrics exposes Prometheus metrics for the API: HTTP traffic per
+// route, database pool usage, authentication failures and business counters.
+package metrics
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "snippy"
+
+// Registry holds every metric served by Handler. A private registry keeps
+// metrics registered by dependencies out of the output.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts requests by method, route template and status code
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPDuration observes request latency by method and route template
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method and route template.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"method", "route"})
+
+	// AuthFailures counts rejected authentication attempts by reason
+	AuthFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "failures_total",
+		Help:      "Rejected authentication attempts by reason.",
+	}, []string{"reason"})
+
+	// SnippetsCreated counts snippets created directly or from a template
+	SnippetsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "snippets_created_total",
+		Help:      "Snippets created, by source.",
+	}, []string{"source"})
+
+	// SnippetForks counts forks of public snippets
+	SnippetForks = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "snippet_forks_total",
+		Help:      "Snippets forked.",
+	})
+
+	// PublicReads counts reads of public snippets by the format served
+	PublicReads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "public_snippet_reads_total",
+		Help:      "Public snippet reads, by format served.",
+	}, []string{"format"})
+
+	// CacheRequests counts read-through cache lookups by cache and result
+	CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "requests_total",
+		Help:      "Cache lookups by cache and result (hit, miss or error).",
+	}, []string{"cache", "result"})
+
+	// CacheInvalidations counts entries dropped because the data changed
+	CacheInvalidations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "invalidations_total",
+		Help:      "Cache invalidations by cache.",
+	}, []string{"cache"})
+
+	// CollabSessions tracks open collaborative editing sessions
+	CollabSessions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "collab",
+		Name:      "sessions",
+		Help:      "Open collaborative editing sessions.",
+	})
+
+	// CollabParticipants tracks connections to collaborative sessions
+	CollabParticipants = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "collab",
+		Name:      "participants",
+		Help:      "Connections to collaborative editing sessions.",
+	})
+
+	// CollabOperations counts edits received by collaborative sessions
+	CollabOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "collab",
+		Name:      "operations_total",
+		Help:      "Collaborative edits by result (applied, duplicate or rejected).",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		AuthFailures,
+		SnippetsCreated,
+		SnippetForks,
+		PublicReads,
+		CacheRequests,
+		CacheInvalidations,
+		CollabSessions,
+		CollabParticipants,
+		CollabOperations,
+	)
+}
+
+// RegisterDB exports the connection pool statistics of db
+func RegisterDB(db *sql.DB) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// Handler serves the registry in the Prometheus exposition format. When
+// token is set, scrapes must send it as a bearer token.
+func Handler(token string) http.Handler {
+	metrics := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return metrics
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		metrics.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, h http.Handler, token string) (int, string) {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	body, _ := io.ReadAll(w.Body)
+	return w.Code, string(body)
+}
+
+func TestHandlerRequiresToken(t *testing.T) {
+	h := Handler("s3cret")
+
+	if code, _ := scrape(t, h, ""); code != http.StatusUnauthorized {
+		t.Errorf("No token: status %d, want 401", code)
+	}
+	if code, _ := scrape(t, h, "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("Wrong token: status %d, want 401", code)
+	}
+	if code, _ := scrape(t, h, "s3cret"); code != http.StatusOK {
+		t.Errorf("Valid token: status %d, want 200", code)
+	}
+}
+
+func TestHandlerExposesCounters(t *testing.T) {
+	SnippetForks.Inc()
+	PublicReads.WithLabelValues("raw").Inc()
+	HTTPRequests.WithLabelValues("GET", "/api/snippets/{id}", "200").Inc()
+
+	code, body := scrape(t, Handler(""), "")
+	if code != http.StatusOK {
+		t.Fatalf("Status %d, want 200", code)
+	}
+
+	for _, want := range []string{
+		"snippy_snippet_forks_total",
+		`snippy_public_snippet_reads_total{format="raw"}`,
+		`snippy_http_requests_total{method="GET",route="/api/snippets/{id}",status="200"}`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Missing %s in output", want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -16,6 +17,17 @@ type Collection struct {
 	Position     *int      `json:"position,omitempty"`      // Optional field for ordering
 }
 
+// PositionUpdate - The new position of a collection or snippet
+type PositionUpdate struct {
+	ID       string `json:"id" openapi:"required"`
+	Position int    `json:"position" openapi:"required"`
+}
+
+// UpdatePositionsRequest - Payload for reordering collections or the snippets in a collection
+type UpdatePositionsRequest struct {
+	Positions []PositionUpdate `json:"positions" openapi:"required,minItems=1"`
+}
+
 // Snippet - A single code snippet with metadata
 type Snippet struct {
 	ID            string   `json:"id"`
@@ -30,13 +42,15 @@ type Snippet struct {
 
 	ForkCount  int       `json:"fork_count"`  // Number of forks
 	ForkedFrom *string   `json:"forked_from"` // Original snippet ID if forked
+	Version    int       `json:"version"`     // Incremented whenever the snippet is edited
+	TemplateID *string   `json:"template_id"` // Template snippet ID if created from a template
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
 }
 
 // CreateCollectionRequest - Payload for creating collections
 type CreateCollectionRequest struct {
-	Name  string `json:"name"`
+	Name  string `json:"name" openapi:"required,minLength=1"`
 	Color string `json:"color"`
 }
 
@@ -52,11 +66,12 @@ type CreateSnippetRequest struct {
 	ID            *string  `json:"id,omitempty"`             // Optional - frontend may send this
 	UserID        *string  `json:"user_id,omitempty"`        // Optional - frontend may send this
 	CollectionIDs []string `json:"collection_ids,omitempty"` // Array of collection UUIDs (will use first one)
-	Title         string   `json:"title"`
-	Content       string   `json:"content"`
+	Title         string   `json:"title" openapi:"required,minLength=1"`
+	Content       string   `json:"content" openapi:"required,minLength=1"`
 	TagIDs        []string `json:"tag_ids,omitempty"` // Array of tag UUIDs
 	IsPublic      bool     `json:"is_public"`         // Frontend sends this
 	IsFavorite    bool     `json:"is_favorite"`       // Frontend sends this
+	AllowSecrets  bool     `json:"allow_secrets"`     // Publish even if the secret scanner reports findings
 
 	ForkCount  *int       `json:"fork_count,omitempty"`  // Optional - frontend may send this
 	ForkedFrom *string    `json:"forked_from,omitempty"` // Optional - frontend may send this
@@ -72,6 +87,7 @@ type UpdateSnippetRequest struct {
 	IsPublic      *bool    `json:"is_public,omitempty"`
 	IsFavorite    *bool    `json:"is_favorite,omitempty"`
 	CollectionIDs []string `json:"collection_ids,omitempty"`
+	AllowSecrets  bool     `json:"allow_secrets"` // Publish even if the secret scanner reports findings
 }
 
 // Tag - A tag that can be assigned to snippets
@@ -85,12 +101,12 @@ type Tag struct {
 
 // CreateTagRequest - Payload for creating tags
 type CreateTagRequest struct {
-	Name string `json:"name"`
+	Name string `json:"name" openapi:"required,minLength=1"`
 }
 
 // UpdateTagRequest - Payload for updating tags
 type UpdateTagRequest struct {
-	Name string `json:"name"`
+	Name string `json:"name" openapi:"required,minLength=1"`
 }
 
 // AssignTagsRequest - Payload for assigning tags to snippets
@@ -100,13 +116,351 @@ type AssignTagsRequest struct {
 
 // ForkSnippetRequest - Payload for forking snippets (no user_id needed - from auth)
 type ForkSnippetRequest struct {
-	// User ID will be extracted from authentication context
+	ID           string `json:"id" openapi:"required"`   // Snippet to fork
+	CollectionID string `json:"collection_id,omitempty"` // Forker's collection to place the fork in
+	AllowSecrets bool   `json:"allow_secrets"`           // Fork even if the secret scanner reports findings
+}
+
+// ForkNode - A snippet in a fork lineage tree
+type ForkNode struct {
+	ID         string      `json:"id"`
+	UserID     string      `json:"user_id"`
+	Title      string      `json:"title"`
+	IsPublic   bool        `json:"is_public"`
+	ForkCount  int         `json:"fork_count"`
+	ForkedFrom *string     `json:"forked_from"`
+	CreatedAt  time.Time   `json:"created_at"`
+	Forks      []*ForkNode `json:"forks"`
+}
+
+// UpstreamDiff - Differences between a fork and the snippet it was forked from
+type UpstreamDiff struct {
+	SnippetID       string     `json:"snippet_id"`
+	UpstreamID      string     `json:"upstream_id"`
+	UpstreamChanged bool       `json:"upstream_changed"` // Upstream changed since the fork was created or last synced
+	LocalChanged    bool       `json:"local_changed"`    // Fork changed since it was created or last synced
+	UpstreamDiff    string     `json:"upstream_diff"`    // Unified diff: sync base -> current upstream
+	LocalDiff       string     `json:"local_diff"`       // Unified diff: sync base -> current fork
+	UpstreamTitle   string     `json:"upstream_title"`
+	SyncedAt        *time.Time `json:"synced_at"`
+}
+
+// SyncSnippetRequest - Payload for merging upstream changes into a fork
+type SyncSnippetRequest struct {
+	AllowConflicts bool `json:"allow_conflicts"` // Save the merge even if it contains conflict markers
+	AllowSecrets   bool `json:"allow_secrets"`   // Save a public fork even if the secret scanner reports findings
+}
+
+// Suggestion - A proposed edit to someone else's public snippet
+type Suggestion struct {
+	ID              string     `json:"id"`
+	SnippetID       string     `json:"snippet_id"`
+	OwnerID         string     `json:"owner_id"`    // Owner of the snippet
+	ProposerID      string     `json:"proposer_id"` // User who proposed the edit
+	Title           string     `json:"title"`
+	Content         string     `json:"content"`
+	Message         string     `json:"message"`      // Proposer's description of the change
+	BaseVersion     int        `json:"base_version"` // Snippet version the edit was made against
+	Diff            string     `json:"diff"`         // Unified diff: base content -> proposed content
+	IsStale         bool       `json:"is_stale"`     // The snippet changed after the proposal was made
+	Status          string     `json:"status"`       // open, accepted, rejected or withdrawn
+	ResponseMessage *string    `json:"response_message"`
+	ResolvedAt      *time.Time `json:"resolved_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// CreateSuggestionRequest - Payload for proposing an edit (omitted fields keep the current value)
+type CreateSuggestionRequest struct {
+	Title       *string `json:"title,omitempty"`
+	Content     *string `json:"content,omitempty"`
+	Message     string  `json:"message"`
+	BaseVersion int     `json:"base_version" openapi:"required,minimum=1"`
+}
+
+// ResolveSuggestionRequest - Payload for accepting or rejecting a suggestion
+type ResolveSuggestionRequest struct {
+	Message      string `json:"message"`
+	AllowSecrets bool   `json:"allow_secrets"` // Accept even if the secret scanner reports findings
+}
+
+// Contributor - A user credited on a snippet through an accepted suggestion
+type Contributor struct {
+	UserID       string    `json:"user_id"`
+	SuggestionID string    `json:"suggestion_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// RenderTemplateRequest - Payload for expanding a snippet's placeholders
+type RenderTemplateRequest struct {
+	Values   map[string]interface{} `json:"values"`
+	Language string                 `json:"language"` // Escaping rules for string values, e.g. "bash" or "python"
+}
+
+// CreateFromTemplateRequest - Payload for creating a snippet from a template
+type CreateFromTemplateRequest struct {
+	Values       map[string]interface{} `json:"values"`
+	Language     string                 `json:"language"`
+	Title        string                 `json:"title,omitempty"`         // Defaults to the template title
+	CollectionID string                 `json:"collection_id,omitempty"` // Caller's collection to place the snippet in
+	IsPublic     bool                   `json:"is_public"`
+	AllowSecrets bool                   `json:"allow_secrets"` // Publish even if the secret scanner reports findings
+}
+
+// RunSnippetRequest - Payload for executing a stored snippet
+type RunSnippetRequest struct {
+	Language string `json:"language" openapi:"required"` // go, python, shell or node
+	Stdin    string `json:"stdin"`
+}
+
+// RunCodeRequest - Payload for executing ad-hoc code
+type RunCodeRequest struct {
+	Language string `json:"language" openapi:"required"`
+	Code     string `json:"code" openapi:"required,minLength=1"`
+	Stdin    string `json:"stdin"`
+}
+
+// SnippetRun - A stored execution of a snippet
+type SnippetRun struct {
+	ID              string    `json:"id"`
+	SnippetID       string    `json:"snippet_id"`
+	UserID          string    `json:"user_id"`
+	Language        string    `json:"language"`
+	Stdin           string    `json:"stdin"`
+	Stdout          string    `json:"stdout"`
+	Stderr          string    `json:"stderr"`
+	ExitCode        int       `json:"exit_code"`
+	Phase           string    `json:"phase"` // "build" if compilation failed, otherwise "run"
+	DurationMs      int64     `json:"duration_ms"`
+	TimedOut        bool      `json:"timed_out"`
+	OutputTruncated bool      `json:"output_truncated"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// Notification - An in-app notification about activity on the user's snippets
+type Notification struct {
+	ID        string                 `json:"id"`
+	UserID    string                 `json:"user_id"`  // Recipient
+	ActorID   string                 `json:"actor_id"` // User who triggered the event
+	Type      string                 `json:"type"`     // e.g. "snippet.forked"
+	SnippetID *string                `json:"snippet_id"`
+	Data      map[string]interface{} `json:"data"` // Type-specific details (snippet title, fork ID...)
+	IsRead    bool                   `json:"is_read"`
+	ReadAt    *time.Time             `json:"read_at"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// NotificationPreference - Whether the user wants notifications of a given type
+type NotificationPreference struct {
+	Type    string `json:"type" openapi:"required"`
+	Enabled bool   `json:"enabled" openapi:"required"`
+}
+
+// UpdateNotificationPreferencesRequest - Payload for updating notification preferences
+type UpdateNotificationPreferencesRequest struct {
+	Preferences []NotificationPreference `json:"preferences" openapi:"required,minItems=1"`
+}
+
+// ChangeEvent - A change to one of the user's snippets, collections or tags.
+// IDs increase with every change, so a stream can resume after the last one seen.
+type ChangeEvent struct {
+	ID         int64     `json:"id"`
+	UserID     string    `json:"user_id"`
+	Type       string    `json:"type"`        // <entity_type>.<action>, e.g. "snippet.updated"
+	EntityType string    `json:"entity_type"` // snippet, collection or tag
+	EntityID   string    `json:"entity_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// SyncChanges - What changed for the user after a sync token, oldest first
+type SyncChanges struct {
+	Token   string       `json:"token"`    // Pass as since to fetch the changes that follow
+	HasMore bool         `json:"has_more"` // More changes are waiting; fetch again with token
+	Reset   bool         `json:"reset"`    // A full snapshot: drop local data missing from it once has_more is false
+	Changes []SyncChange `json:"changes"`
+}
+
+// SyncChange - The current state of one entity, or its deletion
+type SyncChange struct {
+	Seq        int64         `json:"seq"`         // Pass as base_seq when pushing changes to this entity
+	EntityType string        `json:"entity_type"` // snippet, collection, tag, collection_position or snippet_position
+	EntityID   string        `json:"entity_id"`
+	Deleted    bool          `json:"deleted"`
+	Snippet    *Snippet      `json:"snippet,omitempty"`
+	Collection *Collection   `json:"collection,omitempty"`
+	Tag        *Tag          `json:"tag,omitempty"`
+	Position   *SyncPosition `json:"position,omitempty"` // For collection_position and snippet_position
+}
+
+// SyncPosition - Where a collection, or a snippet within a collection, is ordered
+type SyncPosition struct {
+	CollectionID string  `json:"collection_id" openapi:"required,format=uuid"`
+	SnippetID    *string `json:"snippet_id,omitempty" openapi:"format=uuid"` // Set for snippet positions
+	Position     int     `json:"position" openapi:"required"`
+}
+
+// PushSyncRequest - Changes made offline, applied in order
+type PushSyncRequest struct {
+	Mutations []SyncMutation `json:"mutations" openapi:"required,minItems=1"`
+}
+
+// SyncMutation - One change made offline. Data is the body the matching
+// create or update endpoint takes, or a SyncPosition for positions.
+// OnConflict defaults to server_wins.
+type SyncMutation struct {
+	EntityType string          `json:"entity_type" openapi:"required,enum=snippet|collection|tag|collection_position|snippet_position"`
+	EntityID   string          `json:"entity_id" openapi:"format=uuid"` // Generated by the client for creates; unused for positions
+	Action     string          `json:"action" openapi:"required,enum=create|update|delete"`
+	BaseSeq    int64           `json:"base_seq"` // seq of the entity the change was made to, for updates and deletes
+	OnConflict string          `json:"on_conflict" openapi:"enum=server_wins|client_wins|keep_both"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// SyncResult - The outcome of one mutation
+type SyncResult struct {
+	EntityType string      `json:"entity_type"`
+	EntityID   string      `json:"entity_id"`
+	Status     string      `json:"status"`               // applied, conflict or failed
+	Resolution string      `json:"resolution,omitempty"` // How a conflict was settled: server_wins, client_wins or keep_both
+	Change     *SyncChange `json:"change,omitempty"`     // The entity on the server afterwards
+	Copy       *SyncChange `json:"copy,omitempty"`       // The copy holding the client's version, with keep_both
+	Error      *Problem    `json:"error,omitempty"`      // Why the mutation failed
+}
+
+// Diagnostics - The state of one server process, for administrators
+type Diagnostics struct {
+	Build     BuildInfo              `json:"build"`
+	StartedAt time.Time              `json:"started_at"`
+	Uptime    string                 `json:"uptime"`
+	Runtime   RuntimeStats           `json:"runtime"`
+	Database  DatabaseStats          `json:"database"`
+	JWKS      JWKSStatus             `json:"jwks"`
+	Config    map[string]interface{} `json:"config"` // Effective configuration, secrets redacted
+}
+
+// BuildInfo - The version the server was built from
+type BuildInfo struct {
+	GoVersion string `json:"go_version"`
+	Module    string `json:"module"`
+	Version   string `json:"version"`
+	Revision  string `json:"revision,omitempty"` // VCS commit, when built from a checkout
+	Time      string `json:"time,omitempty"`     // Commit time
+	Modified  bool   `json:"modified"`           // Built with uncommitted changes
+}
+
+// RuntimeStats - Go runtime figures
+type RuntimeStats struct {
+	Goroutines int    `json:"goroutines"`
+	GOMAXPROCS int    `json:"gomaxprocs"`
+	NumCPU     int    `json:"num_cpu"`
+	HeapAlloc  uint64 `json:"heap_alloc_bytes"`
+	HeapSys    uint64 `json:"heap_sys_bytes"`
+	NumGC      uint32 `json:"num_gc"`
+}
+
+// DatabaseStats - The schema version and connection pool
+type DatabaseStats struct {
+	MigrationVersion  *int64 `json:"migration_version"` // Null before the first migration
+	MigrationDirty    bool   `json:"migration_dirty"`   // A migration failed partway
+	MaxOpen           int    `json:"max_open"`
+	Open              int    `json:"open"`
+	InUse             int    `json:"in_use"`
+	Idle              int    `json:"idle"`
+	WaitCount         int64  `json:"wait_count"`
+	WaitDuration      string `json:"wait_duration"`
+	MaxIdleClosed     int64  `json:"max_idle_closed"`
+	MaxLifetimeClosed int64  `json:"max_lifetime_closed"`
+	Error             string `json:"error,omitempty"` // Why the migration version could not be read
+}
+
+// JWKSStatus - The cached keys used to verify session tokens
+type JWKSStatus struct {
+	URL       string     `json:"url"`
+	KeyIDs    []string   `json:"key_ids"`
+	FetchedAt *time.Time `json:"fetched_at"` // Null until the first successful fetch
+	Fetches   int        `json:"fetches"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// Webhook - An external endpoint that receives signed event deliveries
+type Webhook struct {
+	ID           string     `json:"id"`
+	UserID       string     `json:"user_id"`
+	URL          string     `json:"url"`
+	Secret       string     `json:"secret,omitempty"` // Only returned when the webhook is created
+	Events       []string   `json:"events"`           // e.g. "snippet.created", "collection.*"
+	IsActive     bool       `json:"is_active"`
+	FailureCount int        `json:"failure_count"` // Consecutive failed deliveries
+	DisabledAt   *time.Time `json:"disabled_at"`   // Set when auto-disabled after repeated failures
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// WebhookDelivery - A single event delivery attempt record for a webhook
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	WebhookID      string          `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"` // pending, succeeded or failed
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastError      *string         `json:"last_error"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+// CreateWebhookRequest - Payload for registering a webhook
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" openapi:"required,format=uri"`
+	Events []string `json:"events" openapi:"required,minItems=1"`
+}
+
+// UpdateWebhookRequest - Payload for updating webhooks (partial updates)
+type UpdateWebhookRequest struct {
+	URL      *string  `json:"url,omitempty"`
+	Events   []string `json:"events,omitempty"`
+	IsActive *bool    `json:"is_active,omitempty"` // Re-enabling resets the failure count
 }
 
 // Response - Standard API response format for all endpoints
 type Response struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Success   bool         `json:"success"`
+	Message   string       `json:"message"`
+	Data      interface{}  `json:"data,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	Code      string       `json:"code,omitempty"`       // Stable error code clients can branch on, e.g. snippet_not_found
+	Details   []FieldError `json:"details,omitempty"`    // Per-field problems of a validation_failed error
+	Page      *PageInfo    `json:"page,omitempty"`       // Set on paginated lists
+	RequestID string       `json:"request_id,omitempty"` // Set on errors, for support requests and log lookups
+}
+
+// PageInfo describes one page of a cursor-paginated list. Pass NextCursor
+// as the cursor parameter to fetch the following page.
+type PageInfo struct {
+	Limit      int     `json:"limit"`
+	HasMore    bool    `json:"has_more"`
+	NextCursor *string `json:"next_cursor"`
+	Total      *int    `json:"total,omitempty"` // Only with include_total=true
+}
+
+// FieldError describes why one field of a request was rejected
+type FieldError struct {
+	Field   string `json:"field"` // Dotted path such as positions.0.id, empty for the whole body
+	Message string `json:"message"`
+}
+
+// Problem is an RFC 7807 problem details object. It replaces Response for
+// errors when the client accepts application/problem+json.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	Details   []FieldError `json:"details,omitempty"`
+	Data      interface{}  `json:"data,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
 }
@@ -0,0 +1,55 @@
+package notifications
+
+import (
+	"encoding/json"
+	"log/slog"
+
+	"snippy-server/internal/fanout"
+)
+
+// Channel is the Postgres notification channel announcing new
+// notifications. Payloads carry only the IDs, since notification data may
+// not fit the 8000-byte NOTIFY limit; streams load the rest.
+const Channel = "notifications"
+
+// announcement is the payload sent on Channel
+type announcement struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+}
+
+// Subscription receives the IDs of a user's new notifications
+type Subscription = fanout.Subscription[string]
+
+// Hub fans out newly created notifications to the streaming connections
+// of their recipients
+type Hub struct {
+	hub *fanout.Hub[string]
+}
+
+// NewHub creates an empty hub
+func NewHub() *Hub {
+	return &Hub{hub: fanout.NewHub[string](16)}
+}
+
+// Subscribe registers a stream for userID. The returned function must be
+// called to release the subscription when the connection closes.
+func (h *Hub) Subscribe(userID string) (*Subscription, func()) {
+	return h.hub.Subscribe(userID)
+}
+
+// PublishPayload delivers a notification announced on Channel to every
+// stream of its recipient
+func (h *Hub) PublishPayload(payload string) {
+	var a announcement
+	if err := json.Unmarshal([]byte(payload), &a); err != nil || a.ID == "" {
+		slog.Warn("ignoring malformed notification announcement", "error", err)
+		return
+	}
+	h.hub.Publish(a.UserID, a.ID)
+}
+
+// Resync tells every stream that notifications may have been missed
+func (h *Hub) Resync() {
+	h.hub.Resync()
+}
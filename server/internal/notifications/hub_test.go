@@ -0,0 +1,31 @@
+package notifications
+
+import "testing"
+
+func TestHubDeliversAnnouncedNotifications(t *testing.T) {
+	h := NewHub()
+	alice, unsubscribe := h.Subscribe("alice")
+	defer unsubscribe()
+	bob, unsubscribeBob := h.Subscribe("bob")
+	defer unsubscribeBob()
+
+	h.PublishPayload(`{"id":"n1","user_id":"alice"}`)
+	h.PublishPayload(`{"user_id":"alice"}`)
+	h.PublishPayload(`not json`)
+
+	select {
+	case id := <-alice.Items:
+		if id != "n1" {
+			t.Errorf("Got %q", id)
+		}
+	default:
+		t.Fatal("Recipient did not receive the notification")
+	}
+	select {
+	case id := <-alice.Items:
+		t.Errorf("Malformed announcement delivered %q", id)
+	case id := <-bob.Items:
+		t.Errorf("Other user received %q", id)
+	default:
+	}
+}
@@ -0,0 +1,108 @@
+package notifications
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"snippy-server/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Notification types produced by the API
+const (
+	TypeSnippetForked = "snippet.forked"
+
+	TypeSuggestionCreated  = "suggestion.created"
+	TypeSuggestionAccepted = "suggestion.accepted"
+	TypeSuggestionRejected = "suggestion.rejected"
+
+	TypeSecretsDetected = "snippet.secrets_detected"
+)
+
+// Types lists every notification type a user can toggle in their preferences
+var Types = []string{
+	TypeSnippetForked,
+	TypeSuggestionCreated,
+	TypeSuggestionAccepted,
+	TypeSuggestionRejected,
+	TypeSecretsDetected,
+}
+
+// IsValidType reports whether t is a known notification type
+func IsValidType(t string) bool {
+	for _, known := range Types {
+		if known == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Querier is implemented by both *sql.DB and *sql.Tx so producers can
+// create notifications inside the transaction of the triggering event
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Create stores a notification for recipientID unless the actor is the
+// recipient or the recipient has disabled this notification type, and
+// announces it on Channel once the transaction of q commits.
+// It returns nil when no notification was created.
+func Create(q Querier, recipientID, actorID, notificationType string, snippetID *string, data map[string]interface{}) (*models.Notification, error) {
+	if recipientID == "" || recipientID == actorID {
+		return nil, nil
+	}
+
+	// Notifications are enabled unless the user explicitly turned them off
+	var enabled bool
+	err := q.QueryRow(`
+		SELECT enabled FROM notification_preferences
+		WHERE user_id = $1 AND type = $2`,
+		recipientID, notificationType).Scan(&enabled)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to check notification preferences: %v", err)
+	}
+	if err == nil && !enabled {
+		return nil, nil
+	}
+
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode notification data: %v", err)
+	}
+
+	n := &models.Notification{
+		ID:        uuid.New().String(),
+		UserID:    recipientID,
+		ActorID:   actorID,
+		Type:      notificationType,
+		SnippetID: snippetID,
+		Data:      data,
+		CreatedAt: time.Now(),
+	}
+
+	_, err = q.Exec(`
+		INSERT INTO notifications (id, user_id, actor_id, type, snippet_id, data, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		n.ID, n.UserID, n.ActorID, n.Type, n.SnippetID, payload, n.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notification: %v", err)
+	}
+
+	announced, err := json.Marshal(announcement{ID: n.ID, UserID: n.UserID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode notification announcement: %v", err)
+	}
+	if _, err := q.Exec(`SELECT pg_notify($1, $2)`, Channel, string(announced)); err != nil {
+		return nil, fmt.Errorf("failed to announce notification: %v", err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,229 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Handler serves the document as JSON
+func Handler() http.Handler {
+	body, err := json.MarshalIndent(Spec(), "", "  ")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, "Failed to encode OpenAPI document", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.Write(body)
+	})
+}
+
+// DocsHandler serves a self-contained HTML reference generated from the
+// document, with no scripts or external assets
+func DocsHandler() http.Handler {
+	var buf bytes.Buffer
+	err := docsTemplate.Execute(&buf, docsPage(Spec()))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, "Failed to render API docs", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; base-uri 'none'; form-action 'none'; frame-ancestors 'none'")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.Write(buf.Bytes())
+	})
+}
+
+type docsGroup struct {
+	Tag        Tag
+	Operations []docsOperation
+}
+
+type docsOperation struct {
+	Method string
+	Class  string // Lowercase method, for styling
+	Path   string
+	*Operation
+	Request  string // Component name of the request body
+	Response string // Description of the success response
+}
+
+type docsSchema struct {
+	Name       string
+	Properties []docsProperty
+}
+
+type docsProperty struct {
+	Name     string
+	Type     string
+	Required bool
+}
+
+type docsData struct {
+	Info    Info
+	Groups  []docsGroup
+	Schemas []docsSchema
+}
+
+// docsPage arranges the document for the docs template
+func docsPage(d *Document) docsData {
+	data := docsData{Info: d.Info}
+
+	byTag := make(map[string][]docsOperation)
+	for _, path := range d.sortedPaths() {
+		item := d.Paths[path]
+		for _, method := range item.Methods() {
+			op := d.Operation(method, path)
+			entry := docsOperation{Method: method, Class: strings.ToLower(method), Path: path, Operation: op}
+			if schema := op.RequestSchema(); schema != nil {
+				entry.Request = refName(schema)
+			}
+			for status, resp := range op.Responses {
+				if status == "default" {
+					continue
+				}
+				entry.Response = status + " " + resp.Description
+				for contentType, media := range resp.Content {
+					entry.Response += " · " + contentType
+					if data := dataSchema(media.Schema); data != "" {
+						entry.Response += " · data: " + data
+					}
+				}
+			}
+			byTag[op.Tags[0]] = append(byTag[op.Tags[0]], entry)
+		}
+	}
+	for _, tag := range d.Tags {
+		data.Groups = append(data.Groups, docsGroup{Tag: tag, Operations: byTag[tag.Name]})
+	}
+
+	names := make([]string, 0, len(d.Components.Schemas))
+	for name := range d.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		schema := d.Components.Schemas[name]
+		entry := docsSchema{Name: name}
+		props := make([]string, 0, len(schema.Properties))
+		for prop := range schema.Properties {
+			props = append(props, prop)
+		}
+		sort.Strings(props)
+		for _, prop := range props {
+			entry.Properties = append(entry.Properties, docsProperty{
+				Name:     prop,
+				Type:     typeName(schema.Properties[prop]),
+				Required: contains(schema.Required, prop),
+			})
+		}
+		data.Schemas = append(data.Schemas, entry)
+	}
+	return data
+}
+
+// dataSchema names the type of the "data" field of a response envelope
+func dataSchema(s *Schema) string {
+	if s == nil {
+		return ""
+	}
+	for _, sub := range s.AllOf {
+		if data, ok := sub.Properties["data"]; ok {
+			return typeName(data)
+		}
+	}
+	return ""
+}
+
+// refName returns the component name a schema references
+func refName(s *Schema) string {
+	return strings.TrimPrefix(s.Ref, "#/components/schemas/")
+}
+
+// typeName describes a schema in a few words for the docs table
+func typeName(s *Schema) string {
+	switch {
+	case s.Ref != "":
+		return refName(s)
+	case len(s.AnyOf) > 0:
+		parts := make([]string, len(s.AnyOf))
+		for i, sub := range s.AnyOf {
+			parts[i] = typeName(sub)
+		}
+		return strings.Join(parts, " | ")
+	}
+
+	// Copy, schemaTypes may return the schema's own slice
+	types := append([]string(nil), schemaTypes(s)...)
+	for i, t := range types {
+		switch {
+		case t == "array" && s.Items != nil:
+			types[i] = typeName(s.Items) + "[]"
+		case t == "string" && s.Format != "":
+			types[i] = s.Format
+		}
+	}
+	if len(types) == 0 {
+		return "any"
+	}
+	return strings.Join(types, " | ")
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+var docsTemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Info.Title}}</title>
+<style>
+body{margin:0 auto;max-width:960px;padding:24px;font:15px/1.5 system-ui,sans-serif;color:#1f2328}
+h1{margin-bottom:0}h2{margin-top:40px;border-bottom:1px solid #d0d7de}
+code,.path{font-family:ui-monospace,monospace}
+.op{border:1px solid #d0d7de;border-radius:6px;margin:12px 0;padding:10px 14px}
+.method{display:inline-block;min-width:56px;font-weight:600;font-family:ui-monospace,monospace}
+.get{color:#0969da}.head{color:#6e7781}.post{color:#1a7f37}.put{color:#9a6700}.delete{color:#cf222e}
+.lock{color:#6e7781;font-size:13px}.meta{color:#57606a;font-size:13px;margin:4px 0}
+table{border-collapse:collapse;margin:6px 0;font-size:13px}td,th{border:1px solid #d0d7de;padding:3px 8px;text-align:left}
+</style>
+</head>
+<body>
+<h1>{{.Info.Title}} <small>{{.Info.Version}}</small></h1>
+<p>{{.Info.Description}} The machine-readable document is at <a href="/openapi.json">/openapi.json</a>.</p>
+{{range .Groups}}{{if .Operations}}
+<h2 id="{{.Tag.Name}}">{{.Tag.Name}}</h2>
+{{with .Tag.Description}}<p>{{.}}</p>{{end}}
+{{range .Operations}}<div class="op" id="{{.OperationID}}">
+<div><span class="method {{.Class}}">{{.Method}}</span> <span class="path">{{.Path}}</span>{{if .Security}} <span class="lock">· requires authentication</span>{{end}}</div>
+<div>{{.Summary}}</div>
+{{with .Description}}<div class="meta">{{.}}</div>{{end}}
+{{if .Parameters}}<table><tr><th>Parameter</th><th>In</th><th>Type</th><th>Description</th></tr>
+{{range .Parameters}}<tr><td><code>{{.Name}}</code></td><td>{{.In}}</td><td>{{.Schema.Type}}</td><td>{{.Description}}</td></tr>
+{{end}}</table>{{end}}
+{{with .Request}}<div class="meta">Body: <a href="#schema-{{.}}">{{.}}</a></div>{{end}}
+<div class="meta">Response: {{.Response}}</div>
+</div>
+{{end}}{{end}}{{end}}
+<h2 id="schemas">Schemas</h2>
+{{range .Schemas}}<h3 id="schema-{{.Name}}">{{.Name}}</h3>
+<table><tr><th>Field</th><th>Type</th><th>Required</th></tr>
+{{range .Properties}}<tr><td><code>{{.Name}}</code></td><td>{{.Type}}</td><td>{{if .Required}}yes{{end}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,376 @@
+// Package openapi builds the OpenAPI 3.1 description of the API. Schemas are
+// generated from the Go types in internal/models and operations from the
+// table in operations.go, so the document is the source of truth for both
+// the docs page and request validation.
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	"snippy-server/internal/models"
+)
+
+// Document is an OpenAPI 3.1 document
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Tags       []Tag                `json:"tags,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Tag groups operations in the docs
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations on one path
+type PathItem struct {
+	Get    *Operation `json:"get,omitempty"`
+	Head   *Operation `json:"head,omitempty"`
+	Post   *Operation `json:"post,omitempty"`
+	Put    *Operation `json:"put,omitempty"`
+	Delete *Operation `json:"delete,omitempty"`
+}
+
+// Operation describes one method on a path
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security"`
+}
+
+// Parameter is a path, query or header parameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody describes the payload an operation accepts
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response describes one response status
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema for one content type
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Components holds reusable schemas and security schemes
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+// SecurityScheme describes how clients authenticate
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// Operation returns the operation for a method on an OpenAPI path, or nil
+func (d *Document) Operation(method, path string) *Operation {
+	item := d.Paths[path]
+	if item == nil {
+		return nil
+	}
+	switch method {
+	case http.MethodGet:
+		return item.Get
+	case http.MethodHead:
+		return item.Head
+	case http.MethodPost:
+		return item.Post
+	case http.MethodPut:
+		return item.Put
+	case http.MethodDelete:
+		return item.Delete
+	}
+	return nil
+}
+
+// RequestSchema returns the JSON body schema of an operation, or nil
+func (o *Operation) RequestSchema() *Schema {
+	if o.RequestBody == nil {
+		return nil
+	}
+	return o.RequestBody.Content["application/json"].Schema
+}
+
+// muxPattern matches the regular expression of a mux path variable
+var muxPattern = regexp.MustCompile(`\{([^:}]+):[^}]*\}`)
+
+// PathFromTemplate converts a mux path template such as
+// /raw/{id:[0-9a-fA-F-]+} to its OpenAPI form /raw/{id}
+func PathFromTemplate(template string) string {
+	return muxPattern.ReplaceAllString(template, "{$1}")
+}
+
+// ModelTypes lists every type in internal/models. Each becomes a component
+// schema even when no operation references it yet.
+var ModelTypes = []interface{}{
+	models.Collection{},
+	models.Snippet{},
+	models.CreateCollectionRequest{},
+	models.UpdateCollectionRequest{},
+	models.PositionUpdate{},
+	models.UpdatePositionsRequest{},
+	models.CreateSnippetRequest{},
+	models.UpdateSnippetRequest{},
+	models.Tag{},
+	models.CreateTagRequest{},
+	models.UpdateTagRequest{},
+	models.AssignTagsRequest{},
+	models.ForkSnippetRequest{},
+	models.ForkNode{},
+	models.UpstreamDiff{},
+	models.SyncSnippetRequest{},
+	models.Suggestion{},
+	models.CreateSuggestionRequest{},
+	models.ResolveSuggestionRequest{},
+	models.Contributor{},
+	models.RenderTemplateRequest{},
+	models.CreateFromTemplateRequest{},
+	models.RunSnippetRequest{},
+	models.RunCodeRequest{},
+	models.SnippetRun{},
+	models.Notification{},
+	models.NotificationPreference{},
+	models.UpdateNotificationPreferencesRequest{},
+	models.ChangeEvent{},
+	models.SyncChanges{},
+	models.SyncChange{},
+	models.SyncPosition{},
+	models.PushSyncRequest{},
+	models.SyncMutation{},
+	models.SyncResult{},
+	models.Diagnostics{},
+	models.BuildInfo{},
+	models.RuntimeStats{},
+	models.DatabaseStats{},
+	models.JWKSStatus{},
+	models.Webhook{},
+	models.WebhookDelivery{},
+	models.CreateWebhookRequest{},
+	models.UpdateWebhookRequest{},
+	models.Response{},
+	models.FieldError{},
+	models.PageInfo{},
+	models.Problem{},
+}
+
+var (
+	specOnce sync.Once
+	spec     *Document
+)
+
+// Spec returns the API document, built on first use
+func Spec() *Document {
+	specOnce.Do(func() { spec = Build() })
+	return spec
+}
+
+// Build generates the API document from the model types and operations
+func Build() *Document {
+	gen := newSchemas()
+	for _, v := range ModelTypes {
+		gen.ref(v)
+	}
+
+	doc := &Document{
+		OpenAPI: "3.1.0",
+		Info: Info{
+			Title:       "Snippy API",
+			Version:     "1.0.0",
+			Description: "REST API for managing code snippets, collections and tags.",
+		},
+		Tags:  apiTags,
+		Paths: make(map[string]*PathItem),
+		Components: Components{
+			SecuritySchemes: map[string]SecurityScheme{
+				"session": {Type: "apiKey", In: "cookie", Name: "__session", Description: "Clerk session cookie"},
+				"bearer":  {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "Clerk session token"},
+			},
+		},
+	}
+
+	for _, op := range operations {
+		for _, method := range op.methods {
+			item := doc.Paths[op.path]
+			if item == nil {
+				item = &PathItem{}
+				doc.Paths[op.path] = item
+			}
+			operation := op.build(gen, method)
+			switch method {
+			case http.MethodGet:
+				item.Get = operation
+			case http.MethodHead:
+				item.Head = operation
+			case http.MethodPost:
+				item.Post = operation
+			case http.MethodPut:
+				item.Put = operation
+			case http.MethodDelete:
+				item.Delete = operation
+			}
+		}
+	}
+
+	doc.Components.Schemas = gen.components
+	return doc
+}
+
+// pathParam matches a variable in an OpenAPI path
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+// build creates the OpenAPI operation for one method of op
+func (op operation) build(gen *schemas, method string) *Operation {
+	id := op.id
+	if method == http.MethodHead {
+		id += "Head"
+	}
+	o := &Operation{
+		OperationID: id,
+		Summary:     op.summary,
+		Description: op.description,
+		Tags:        []string{op.tag},
+		Responses:   make(map[string]*Response),
+		Security:    []map[string][]string{},
+	}
+	if op.auth {
+		o.Security = []map[string][]string{{"session": {}}, {"bearer": {}}}
+	}
+
+	for _, m := range pathParam.FindAllStringSubmatch(op.path, -1) {
+		o.Parameters = append(o.Parameters, Parameter{Name: m[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+	for _, q := range op.query {
+		o.Parameters = append(o.Parameters, Parameter{Name: q.name, In: "query", Description: q.description, Schema: &Schema{Type: q.typ}})
+	}
+	if op.etag {
+		switch method {
+		case http.MethodGet:
+			o.Parameters = append(o.Parameters, Parameter{Name: "If-None-Match", In: "header", Description: "ETag of a cached copy", Schema: &Schema{Type: "string"}})
+		case http.MethodPut:
+			o.Parameters = append(o.Parameters, Parameter{Name: "If-Match", In: "header", Description: "ETag of the copy being changed", Schema: &Schema{Type: "string"}})
+		}
+	}
+
+	if op.request != nil {
+		o.RequestBody = &RequestBody{
+			Required: !op.optionalBody,
+			Content:  map[string]MediaType{"application/json": {Schema: gen.ref(op.request)}},
+		}
+	}
+
+	status := op.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := &Response{Description: http.StatusText(status)}
+	switch {
+	case status == http.StatusSwitchingProtocols:
+		// The connection switches to another protocol; there is no body
+	case op.produces != "":
+		success.Content = map[string]MediaType{op.produces: {Schema: &Schema{Type: "string"}}}
+	default:
+		envelope := gen.ref(models.Response{})
+		if op.response != nil {
+			data := op.responseSchema(gen)
+			envelope = &Schema{AllOf: []*Schema{envelope, {Type: "object", Properties: map[string]*Schema{"data": data}}}}
+		}
+		success.Content = map[string]MediaType{"application/json": {Schema: envelope}}
+	}
+	if method == http.MethodHead {
+		success.Content = nil
+	}
+	o.Responses[strconv.Itoa(status)] = success
+	if op.etag {
+		switch method {
+		case http.MethodGet:
+			o.Responses["304"] = &Response{Description: "Not Modified: the If-None-Match ETag is current"}
+		case http.MethodPut:
+			o.Responses["412"] = &Response{
+				Description: "Precondition Failed: the If-Match ETag is outdated; data holds the current copy",
+				Content:     map[string]MediaType{"application/json": {Schema: gen.ref(models.Response{})}},
+			}
+		}
+	}
+	o.Responses["default"] = &Response{
+		Description: "Error. Clients that accept application/problem+json get RFC 7807 problem details.",
+		Content: map[string]MediaType{
+			"application/json":         {Schema: gen.ref(models.Response{})},
+			"application/problem+json": {Schema: gen.ref(models.Problem{})},
+		},
+	}
+	return o
+}
+
+// responseSchema returns the schema of the response data
+func (op operation) responseSchema(gen *schemas) *Schema {
+	if s, ok := op.response.(*Schema); ok {
+		return s
+	}
+	t := reflect.TypeOf(op.response)
+	if t.Kind() == reflect.Slice {
+		return &Schema{Type: "array", Items: gen.of(t.Elem())}
+	}
+	return gen.of(t)
+}
+
+// sortedPaths returns the document paths in order
+func (d *Document) sortedPaths() []string {
+	paths := make([]string, 0, len(d.Paths))
+	for p := range d.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Methods lists the HTTP methods defined on a path item
+func (p *PathItem) Methods() []string {
+	var methods []string
+	for _, m := range []struct {
+		name string
+		op   *Operation
+	}{{"GET", p.Get}, {"HEAD", p.Head}, {"POST", p.Post}, {"PUT", p.Put}, {"DELETE", p.Delete}} {
+		if m.op != nil {
+			methods = append(methods, m.name)
+		}
+	}
+	return methods
+}
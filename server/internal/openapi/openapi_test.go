@@ -0,0 +1,107 @@
+package openapi
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestModelsDocumented fails when a struct is added to internal/models
+// without being listed in ModelTypes
+func TestModelsDocumented(t *testing.T) {
+	files, err := filepath.Glob("../models/*.go")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("Failed to find model sources: %v", err)
+	}
+
+	schemas := Spec().Components.Schemas
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			spec, ok := n.(*ast.TypeSpec)
+			if !ok || !spec.Name.IsExported() {
+				return true
+			}
+			if _, ok := spec.Type.(*ast.StructType); ok && schemas[spec.Name.Name] == nil {
+				t.Errorf("models.%s has no component schema", spec.Name.Name)
+			}
+			return true
+		})
+	}
+}
+
+func TestPathFromTemplate(t *testing.T) {
+	got := PathFromTemplate("/raw/{id:[0-9a-fA-F-]+}/{filename}")
+	if got != "/raw/{id}/{filename}" {
+		t.Errorf("Got %q", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	spec := Spec()
+	tests := []struct {
+		name   string
+		op     string
+		path   string
+		body   string
+		errors []string
+	}{
+		{"valid snippet", "POST", "/api/snippets/create", `{"title":"a","content":"b","tags":null}`, nil},
+		{"missing title", "POST", "/api/snippets/create", `{"content":"b"}`, []string{"/title: is required"}},
+		{"empty title", "POST", "/api/snippets/create", `{"title":"","content":"b"}`, []string{"/title: must not be empty"}},
+		{"wrong type", "POST", "/api/snippets/create", `{"title":"a","content":"b","is_public":"yes"}`, []string{"/is_public: expected boolean, got string"}},
+		{"nullable id", "POST", "/api/snippets/create", `{"title":"a","content":"b","collection_id":null}`, nil},
+		{"not an object", "POST", "/api/tags/create", `[]`, []string{"expected object, got array"}},
+		{"no positions", "PUT", "/api/collections/positions", `{"positions":[]}`, []string{"/positions: must have at least 1 items"}},
+		{"bad position", "PUT", "/api/collections/positions", `{"positions":[{"id":"x","position":1.5}]}`, []string{"/positions/0/position: expected integer, got number"}},
+		{"wrong item type", "POST", "/api/webhooks/create", `{"url":"https://example.com","events":[1]}`, []string{"/events/0: expected string, got number"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := spec.Operation(tt.op, tt.path)
+			if op == nil || op.RequestSchema() == nil {
+				t.Fatalf("%s %s has no request schema", tt.op, tt.path)
+			}
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.body), &value); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, err := range spec.Validate(op.RequestSchema(), value) {
+				got = append(got, err.Error())
+			}
+			if strings.Join(got, "; ") != strings.Join(tt.errors, "; ") {
+				t.Errorf("Got %q, want %q", got, tt.errors)
+			}
+		})
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	var doc map[string]interface{}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &doc) != nil || doc["openapi"] != "3.1.0" {
+		t.Errorf("Unexpected document response %d: %.100s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	DocsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/docs", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/api/snippets/create") {
+		t.Errorf("Unexpected docs response %d", w.Code)
+	}
+}
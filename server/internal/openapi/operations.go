@@ -0,0 +1,318 @@
+package openapi
+
+import (
+	"net/http"
+
+	"snippy-server/internal/models"
+	"snippy-server/internal/sandbox"
+)
+
+// operation declares one route of the API. Every route registered in
+// api.SetupRoutes must have an entry; a test walks the router to check.
+type operation struct {
+	methods      []string
+	path         string // OpenAPI form, e.g. /api/snippets/{id}
+	id           string // operationId, named after the handler
+	tag          string
+	summary      string
+	description  string
+	auth         bool
+	query        []queryParam
+	request      interface{} // Model decoded from the JSON body
+	optionalBody bool
+	status       int         // Success status, 200 when zero
+	response     interface{} // Model, slice of models or *Schema returned in "data"
+	produces     string      // Content type for responses that are not JSON envelopes
+	etag         bool        // Sends an ETag; GET honors If-None-Match, PUT honors If-Match
+}
+
+type queryParam struct {
+	name        string
+	typ         string
+	description string
+}
+
+var apiTags = []Tag{
+	{Name: "Health", Description: "Service status"},
+	{Name: "Docs", Description: "This API description"},
+	{Name: "Public", Description: "Public snippets, no authentication required"},
+	{Name: "Embeds", Description: "Embeddable widgets, share images and raw content"},
+	{Name: "Collections"},
+	{Name: "Snippets"},
+	{Name: "Forks"},
+	{Name: "Suggestions", Description: "Suggested edits to other users' public snippets"},
+	{Name: "Templates", Description: "Snippets with placeholders"},
+	{Name: "Runs", Description: "Sandboxed code execution"},
+	{Name: "Tags"},
+	{Name: "Webhooks"},
+	{Name: "Notifications"},
+	{Name: "Events", Description: "Real-time changes to the user's data"},
+	{Name: "Sync", Description: "Delta sync for offline clients"},
+	{Name: "Admin", Description: "Server diagnostics, limited to the user IDs in admin.user_ids"},
+}
+
+// object is the schema of ad-hoc response data
+var object = &Schema{Type: "object"}
+
+// Shared query parameters
+var (
+	pageQuery = []queryParam{
+		{"limit", "integer", "Page size, 50 by default and at most 100"},
+		{"cursor", "string", "next_cursor of the previous page"},
+		{"include_total", "boolean", "Count all matching items in page.total"},
+	}
+	paginationQuery = append([]queryParam{
+		{"search", "string", "Search in titles and content"},
+		{"sort", "string", "created, updated, title or forks"},
+		{"order", "string", "asc or desc; title sorts ascending by default, the others descending"},
+	}, pageQuery...)
+	renderQuery = []queryParam{
+		{"lang", "string", "Language for highlighting, detected when omitted"},
+		{"theme", "string", "Theme name from /api/render/themes"},
+		{"line_numbers", "boolean", "Show line numbers (default true)"},
+		{"lines", "string", "Line ranges to include, e.g. 1-5,10"},
+	}
+)
+
+var operations = []operation{
+	// Health and docs
+	{methods: []string{"GET"}, path: "/health", id: "healthCheck", tag: "Health",
+		summary: "Check server and database health", response: object},
+	{methods: []string{"GET"}, path: "/openapi.json", id: "getOpenAPI", tag: "Docs",
+		summary: "This OpenAPI document", produces: "application/json"},
+	{methods: []string{"GET"}, path: "/docs", id: "getDocs", tag: "Docs",
+		summary: "Human-readable API reference", produces: "text/html"},
+
+	// Public snippets
+	{methods: []string{"GET"}, path: "/api/snippets/public", id: "getPublicSnippets", tag: "Public",
+		summary: "List public snippets",
+		query: append([]queryParam{
+			{"shuffle", "boolean", "Return a random sample as a single page"},
+			{"user_id", "string", "Only snippets of this user"},
+		}, paginationQuery...),
+		response: []models.Snippet{}, etag: true},
+	{methods: []string{"GET"}, path: "/api/snippets/public/{id}", id: "getPublicSnippet", tag: "Public",
+		summary: "Get a public snippet", response: models.Snippet{}, etag: true},
+	{methods: []string{"GET"}, path: "/api/snippets/public/{id}/contributors", id: "getSnippetContributors", tag: "Public",
+		summary: "List users credited on a public snippet", response: []models.Contributor{}},
+	{methods: []string{"GET"}, path: "/api/snippets/public/{id}/render", id: "renderPublicSnippet", tag: "Public",
+		summary: "Render a public snippet as highlighted HTML or SVG",
+		query: append([]queryParam{
+			{"format", "string", "html (default) or svg"},
+			{"standalone", "boolean", "Return a full HTML document"},
+		}, renderQuery...),
+		produces: "text/html"},
+	{methods: []string{"GET"}, path: "/api/render/themes", id: "getRenderThemes", tag: "Public",
+		summary: "List render themes", response: object},
+
+	// Embeds, raw content and images
+	{methods: []string{"GET"}, path: "/embed/{id}.js", id: "embedSnippetScript", tag: "Embeds",
+		summary: "Script that inserts an embed iframe", query: renderQuery, produces: "text/javascript"},
+	{methods: []string{"GET"}, path: "/embed/{id}", id: "embedSnippet", tag: "Embeds",
+		summary: "Embeddable page for a public snippet", query: renderQuery, produces: "text/html"},
+	{methods: []string{"GET"}, path: "/oembed", id: "oEmbed", tag: "Embeds",
+		summary: "oEmbed provider for snippet URLs",
+		query: []queryParam{
+			{"url", "string", "Snippet or embed URL"},
+			{"format", "string", "Only json is supported"},
+			{"maxwidth", "integer", "Maximum embed width"},
+			{"maxheight", "integer", "Maximum embed height"},
+		},
+		produces: "application/json"},
+	{methods: []string{"GET", "HEAD"}, path: "/raw/{id}", id: "getRawSnippet", tag: "Embeds",
+		summary:     "Snippet content as a plain file",
+		description: "Public snippets need no authentication; private ones need a bearer token of the owner.",
+		query:       []queryParam{{"download", "boolean", "Serve as an attachment"}}, produces: "text/plain"},
+	{methods: []string{"GET", "HEAD"}, path: "/raw/{id}/{filename}", id: "getRawSnippetFile", tag: "Embeds",
+		summary: "Snippet content with an explicit filename",
+		query:   []queryParam{{"download", "boolean", "Serve as an attachment"}}, produces: "text/plain"},
+	{methods: []string{"GET", "HEAD"}, path: "/img/{id}.png", id: "getSnippetImage", tag: "Embeds",
+		summary: "PNG share image of a public snippet", query: renderQuery, produces: "image/png"},
+
+	// Collections
+	{methods: []string{"GET"}, path: "/api/collections", id: "getCollections", tag: "Collections", auth: true,
+		summary: "List collections", response: []models.Collection{}, etag: true},
+	{methods: []string{"POST"}, path: "/api/collections/create", id: "createCollection", tag: "Collections", auth: true,
+		summary: "Create a collection", request: models.CreateCollectionRequest{}, status: 201, response: models.Collection{}},
+	{methods: []string{"GET"}, path: "/api/collections/{id}", id: "getCollection", tag: "Collections", auth: true,
+		summary: "Get a collection", response: models.Collection{}, etag: true},
+	{methods: []string{"PUT"}, path: "/api/collections/positions", id: "updateCollectionPositions", tag: "Collections", auth: true,
+		summary: "Reorder collections", request: models.UpdatePositionsRequest{}},
+	{methods: []string{"PUT"}, path: "/api/collections/{id}", id: "updateCollection", tag: "Collections", auth: true,
+		summary: "Update a collection", request: models.UpdateCollectionRequest{}, response: models.Collection{}, etag: true},
+	{methods: []string{"DELETE"}, path: "/api/collections/{id}", id: "deleteCollection", tag: "Collections", auth: true,
+		summary: "Delete a collection", response: models.Collection{}},
+	{methods: []string{"GET"}, path: "/api/collections/{id}/snippets", id: "getCollectionSnippets", tag: "Collections", auth: true,
+		summary: "List the snippets of a collection in order", response: object},
+	{methods: []string{"PUT"}, path: "/api/collections/{id}/snippets/positions", id: "updateCollectionSnippetPositions", tag: "Collections", auth: true,
+		summary: "Reorder snippets within a collection", request: models.UpdatePositionsRequest{}},
+
+	// Snippets
+	{methods: []string{"GET"}, path: "/api/snippets", id: "getSnippets", tag: "Snippets", auth: true,
+		summary:  "List the user's snippets",
+		query:    append([]queryParam{{"collection_id", "string", "Only snippets in this collection"}}, paginationQuery...),
+		response: []models.Snippet{}, etag: true},
+	{methods: []string{"GET"}, path: "/api/snippets/my-public", id: "getUserPublicSnippets", tag: "Snippets", auth: true,
+		summary: "List the user's public snippets", query: paginationQuery, response: []models.Snippet{}, etag: true},
+	{methods: []string{"POST"}, path: "/api/snippets/create", id: "createSnippet", tag: "Snippets", auth: true,
+		summary:     "Create a snippet",
+		description: "Public snippets are scanned for secrets; findings are rejected with 422 unless allow_secrets is set.",
+		request:     models.CreateSnippetRequest{}, status: 201, response: models.Snippet{}, etag: true},
+	{methods: []string{"POST"}, path: "/api/snippets/fork", id: "forkSnippetByBody", tag: "Forks", auth: true,
+		summary: "Fork a public snippet", request: models.ForkSnippetRequest{}, status: 201, response: models.Snippet{}},
+	{methods: []string{"POST"}, path: "/api/snippets/run", id: "runCode", tag: "Runs", auth: true,
+		summary: "Run ad-hoc code", request: models.RunCodeRequest{}, response: sandbox.Result{}},
+	{methods: []string{"GET"}, path: "/api/snippets/{id}", id: "getSnippet", tag: "Snippets", auth: true,
+		summary:     "Get a snippet",
+		description: "Honors Accept for text/plain, text/markdown and text/html representations.",
+		response:    models.Snippet{}, etag: true},
+	{methods: []string{"PUT"}, path: "/api/snippets/{id}", id: "updateSnippet", tag: "Snippets", auth: true,
+		summary:     "Update a snippet",
+		description: "With If-Match, changes to an outdated copy are refused with 412 and the current snippet in data.",
+		request:     models.UpdateSnippetRequest{}, response: models.Snippet{}, etag: true},
+	{methods: []string{"DELETE"}, path: "/api/snippets/{id}", id: "deleteSnippet", tag: "Snippets", auth: true,
+		summary: "Delete a snippet", response: object},
+	{methods: []string{"GET"}, path: "/api/snippets/{id}/forks", id: "getSnippetForks", tag: "Forks", auth: true,
+		summary: "Get the fork tree of a snippet", response: object},
+	{methods: []string{"GET"}, path: "/api/snippets/{id}/upstream-diff", id: "getUpstreamDiff", tag: "Forks", auth: true,
+		summary: "Show upstream and local changes since a fork was synced", response: models.UpstreamDiff{}},
+	{methods: []string{"POST"}, path: "/api/snippets/{id}/sync", id: "syncSnippetFromUpstream", tag: "Forks", auth: true,
+		summary: "Merge upstream changes into a fork", request: models.SyncSnippetRequest{}, optionalBody: true, response: object},
+	{methods: []string{"GET"}, path: "/api/snippets/{id}/suggestions", id: "getSnippetSuggestions", tag: "Suggestions", auth: true,
+		summary:  "List suggestions on a snippet",
+		query:    []queryParam{{"status", "string", "open, accepted, rejected or withdrawn"}},
+		response: []models.Suggestion{}},
+	{methods: []string{"POST"}, path: "/api/snippets/{id}/suggestions", id: "createSuggestion", tag: "Suggestions", auth: true,
+		summary: "Suggest an edit to a public snippet", request: models.CreateSuggestionRequest{}, status: 201, response: models.Suggestion{}},
+	{methods: []string{"GET"}, path: "/api/snippets/{id}/placeholders", id: "getSnippetPlaceholders", tag: "Templates", auth: true,
+		summary: "List the placeholders of a template snippet", response: object},
+	{methods: []string{"POST"}, path: "/api/snippets/{id}/render", id: "renderSnippet", tag: "Templates", auth: true,
+		summary: "Expand a template with values", request: models.RenderTemplateRequest{}, response: object},
+	{methods: []string{"POST"}, path: "/api/snippets/{id}/instantiate", id: "createSnippetFromTemplate", tag: "Templates", auth: true,
+		summary: "Create a snippet from a template", request: models.CreateFromTemplateRequest{}, status: 201, response: models.Snippet{}},
+	{methods: []string{"POST"}, path: "/api/snippets/{id}/run", id: "runSnippet", tag: "Runs", auth: true,
+		summary: "Run a snippet and store the result", request: models.RunSnippetRequest{}, response: models.SnippetRun{}},
+	{methods: []string{"GET"}, path: "/api/snippets/{id}/runs", id: "getSnippetRuns", tag: "Runs", auth: true,
+		summary:  "List past runs of a snippet",
+		query:    []queryParam{{"limit", "integer", "Maximum number of runs"}},
+		response: []models.SnippetRun{}},
+	{methods: []string{"GET"}, path: "/api/snippets/{id}/scan", id: "getSnippetScan", tag: "Snippets", auth: true,
+		summary: "Scan a snippet for secrets", response: object},
+	{methods: []string{"GET"}, path: "/api/snippets/{id}/collab", id: "collaborateOnSnippet", tag: "Snippets", auth: true,
+		summary: "Join the snippet's collaborative editing session over a WebSocket",
+		description: "The owner edits; other users may follow public snippets read-only. " +
+			"Edits are operational transformation operations; see the API reference for the message protocol.",
+		query: []queryParam{
+			{"client_id", "string", "Stable ID of the client, so edits resent after a reconnect apply once"},
+			{"session", "string", "Session the client last saw, to resume after a reconnect"},
+			{"revision", "integer", "Revision the client last saw, to resume after a reconnect"},
+		},
+		status: http.StatusSwitchingProtocols},
+
+	// Sandbox
+	{methods: []string{"GET"}, path: "/api/sandbox/languages", id: "getSandboxLanguages", tag: "Runs", auth: true,
+		summary: "List languages that can be executed", response: object},
+
+	// Suggestions
+	{methods: []string{"GET"}, path: "/api/suggestions", id: "getSuggestions", tag: "Suggestions", auth: true,
+		summary: "List suggestions received or made",
+		query: []queryParam{
+			{"role", "string", "received (default) or sent"},
+			{"status", "string", "open, accepted, rejected or withdrawn"},
+		},
+		response: []models.Suggestion{}},
+	{methods: []string{"POST"}, path: "/api/suggestions/{id}/accept", id: "acceptSuggestion", tag: "Suggestions", auth: true,
+		summary: "Apply a suggestion", request: models.ResolveSuggestionRequest{}, optionalBody: true, response: object},
+	{methods: []string{"POST"}, path: "/api/suggestions/{id}/reject", id: "rejectSuggestion", tag: "Suggestions", auth: true,
+		summary: "Reject a suggestion", request: models.ResolveSuggestionRequest{}, optionalBody: true, response: models.Suggestion{}},
+	{methods: []string{"DELETE"}, path: "/api/suggestions/{id}", id: "withdrawSuggestion", tag: "Suggestions", auth: true,
+		summary: "Withdraw your own suggestion", response: models.Suggestion{}},
+
+	// Tags
+	{methods: []string{"GET"}, path: "/api/tags", id: "getTags", tag: "Tags", auth: true,
+		summary: "List tags", response: []models.Tag{}},
+	{methods: []string{"POST"}, path: "/api/tags/create", id: "createTag", tag: "Tags", auth: true,
+		summary: "Create a tag", request: models.CreateTagRequest{}, status: 201, response: models.Tag{}},
+	{methods: []string{"PUT"}, path: "/api/tags/{id}", id: "updateTag", tag: "Tags", auth: true,
+		summary: "Rename a tag", request: models.UpdateTagRequest{}, response: models.Tag{}},
+	{methods: []string{"DELETE"}, path: "/api/tags/{id}", id: "deleteTag", tag: "Tags", auth: true,
+		summary: "Delete a tag and remove it from all snippets", response: object},
+
+	// Webhooks
+	{methods: []string{"GET"}, path: "/api/webhooks", id: "getWebhooks", tag: "Webhooks", auth: true,
+		summary: "List webhooks", response: []models.Webhook{}},
+	{methods: []string{"POST"}, path: "/api/webhooks/create", id: "createWebhook", tag: "Webhooks", auth: true,
+		summary:     "Register a webhook",
+		description: "The signing secret is only returned in this response.",
+		request:     models.CreateWebhookRequest{}, status: 201, response: models.Webhook{}},
+	{methods: []string{"PUT"}, path: "/api/webhooks/{id}", id: "updateWebhook", tag: "Webhooks", auth: true,
+		summary: "Update a webhook", request: models.UpdateWebhookRequest{}, response: models.Webhook{}},
+	{methods: []string{"DELETE"}, path: "/api/webhooks/{id}", id: "deleteWebhook", tag: "Webhooks", auth: true,
+		summary: "Delete a webhook and its delivery history", response: object},
+	{methods: []string{"GET"}, path: "/api/webhooks/{id}/deliveries", id: "getWebhookDeliveries", tag: "Webhooks", auth: true,
+		summary:  "List deliveries, newest first",
+		query:    pageQuery,
+		response: []models.WebhookDelivery{}},
+	{methods: []string{"POST"}, path: "/api/webhooks/{id}/deliveries/{delivery_id}/redeliver", id: "redeliverWebhookDelivery", tag: "Webhooks", auth: true,
+		summary: "Queue a delivery to be sent again", status: 202, response: object},
+
+	// Notifications
+	{methods: []string{"GET"}, path: "/api/notifications", id: "getNotifications", tag: "Notifications", auth: true,
+		summary: "List notifications with the unread count",
+		query: append([]queryParam{
+			{"unread", "boolean", "Only unread notifications"},
+		}, pageQuery...),
+		response: object},
+	{methods: []string{"GET"}, path: "/api/notifications/unread-count", id: "getUnreadNotificationCount", tag: "Notifications", auth: true,
+		summary: "Get the unread count", response: object},
+	{methods: []string{"GET"}, path: "/api/notifications/stream", id: "streamNotifications", tag: "Notifications", auth: true,
+		summary: "Stream new notifications as Server-Sent Events", produces: "text/event-stream"},
+	{methods: []string{"PUT"}, path: "/api/notifications/read-all", id: "markAllNotificationsRead", tag: "Notifications", auth: true,
+		summary: "Mark all notifications as read", response: object},
+	{methods: []string{"GET"}, path: "/api/notifications/preferences", id: "getNotificationPreferences", tag: "Notifications", auth: true,
+		summary: "Get notification preferences", response: []models.NotificationPreference{}},
+	{methods: []string{"PUT"}, path: "/api/notifications/preferences", id: "updateNotificationPreferences", tag: "Notifications", auth: true,
+		summary: "Update notification preferences", request: models.UpdateNotificationPreferencesRequest{}, response: []models.NotificationPreference{}},
+	{methods: []string{"PUT"}, path: "/api/notifications/{id}/read", id: "markNotificationRead", tag: "Notifications", auth: true,
+		summary: "Mark a notification as read", response: object},
+
+	// Events
+	{methods: []string{"GET"}, path: "/api/events", id: "streamEvents", tag: "Events", auth: true,
+		summary: "Stream changes to snippets, collections and tags as Server-Sent Events",
+		description: "Each message is a ChangeEvent named after its type, e.g. snippet.updated. " +
+			"Resume with Last-Event-ID; a reset event means the log no longer covers the gap and the client should reload.",
+		query:    []queryParam{{"last_event_id", "integer", "Resume after this event, for clients that cannot set Last-Event-ID"}},
+		produces: "text/event-stream"},
+
+	// Sync
+	{methods: []string{"GET"}, path: "/api/sync", id: "getSyncChanges", tag: "Sync", auth: true,
+		summary: "List changes to snippets, collections, tags and positions after a sync token",
+		description: "Changes are ordered by a per-user sequence and include tombstones for deletions. " +
+			"Without since, or when since is older than the retained tombstones, reset is set and the changes are a full snapshot.",
+		query: []queryParam{
+			{"since", "string", "token of the previous response"},
+			{"limit", "integer", "Maximum changes, 500 by default and at most 1000"},
+		},
+		response: models.SyncChanges{}},
+	{methods: []string{"POST"}, path: "/api/sync", id: "pushSyncChanges", tag: "Sync", auth: true,
+		summary: "Apply changes made offline",
+		description: "Mutations are applied in order, each on its own. Updates and deletes of entities changed after base_seq " +
+			"conflict and are settled by on_conflict: server_wins, client_wins or keep_both.",
+		request: models.PushSyncRequest{}, response: []models.SyncResult{}},
+
+	// Admin
+	{methods: []string{"GET"}, path: "/api/admin/diagnostics", id: "getDiagnostics", tag: "Admin", auth: true,
+		summary:     "Build, runtime, database, JWKS and configuration details of this instance",
+		description: "Secrets in the configuration are redacted. Returns 403 unless the user is an admin.",
+		response:    models.Diagnostics{}},
+	{methods: []string{"GET"}, path: "/api/admin/pprof/{profile}", id: "getProfile", tag: "Admin", auth: true,
+		summary: "Runtime profile for go tool pprof",
+		description: "profile is a CPU profile, trace an execution trace, and heap, allocs, goroutine, block, mutex or " +
+			"threadcreate a snapshot. CPU profiles and traces must be shorter than the server's write timeout.",
+		query: []queryParam{
+			{"seconds", "integer", "Duration of profile and trace, or of a delta for snapshot profiles"},
+			{"debug", "integer", "1 or 2 for a text snapshot instead of the protobuf format"},
+			{"gc", "integer", "1 runs a garbage collection before a heap profile"},
+		},
+		produces: "application/octet-stream"},
+}
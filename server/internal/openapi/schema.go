@@ -0,0 +1,179 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of JSON Schema 2020-12 used by the spec and enforced
+// by Validate
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 interface{}        `json:"type,omitempty"` // A type name or a list of names
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemas generates component schemas from Go types. Named structs become
+// components referenced with $ref; everything else is inlined.
+type schemas struct {
+	components map[string]*Schema
+}
+
+func newSchemas() *schemas {
+	return &schemas{components: make(map[string]*Schema)}
+}
+
+// ref returns a reference to the component for v's type, generating it and
+// the components it depends on
+func (s *schemas) ref(v interface{}) *Schema {
+	return s.of(reflect.TypeOf(v))
+}
+
+// of returns the schema for t
+func (s *schemas) of(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawType:
+		return &Schema{Description: "Any JSON value"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return nullable(s.of(t.Elem()))
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		// Go encodes nil slices as null
+		return &Schema{Type: []string{"array", "null"}, Items: s.of(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.of(t.Elem())}
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name := componentName(t)
+		if _, ok := s.components[name]; !ok {
+			// Reserve the name first so recursive types terminate
+			s.components[name] = nil
+			s.components[name] = s.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{}
+}
+
+// object builds the schema of a struct from its json and openapi tags
+func (s *schemas) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := s.of(field.Type)
+		if applyTag(prop, field.Tag.Get("openapi")) {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = prop
+	}
+	return schema
+}
+
+// applyTag applies the constraints in an openapi struct tag, for example
+// `openapi:"required,minLength=1"`, and reports whether the field is required
+func applyTag(schema *Schema, tag string) bool {
+	required := false
+	for _, part := range strings.Split(tag, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "required":
+			required = true
+		case "enum":
+			for _, v := range strings.Split(value, "|") {
+				schema.Enum = append(schema.Enum, v)
+			}
+		case "format":
+			schema.Format = value
+		case "minLength":
+			schema.MinLength = intPtr(value)
+		case "maxLength":
+			schema.MaxLength = intPtr(value)
+		case "minItems":
+			schema.MinItems = intPtr(value)
+		case "minimum":
+			n, _ := strconv.ParseFloat(value, 64)
+			schema.Minimum = &n
+		case "maximum":
+			n, _ := strconv.ParseFloat(value, 64)
+			schema.Maximum = &n
+		}
+	}
+	return required
+}
+
+func intPtr(s string) *int {
+	n, _ := strconv.Atoi(s)
+	return &n
+}
+
+// nullable allows null in addition to the values schema accepts
+func nullable(schema *Schema) *Schema {
+	if name, ok := schema.Type.(string); ok {
+		schema.Type = []string{name, "null"}
+		return schema
+	}
+	if schema.Ref != "" {
+		return &Schema{AnyOf: []*Schema{schema, {Type: "null"}}}
+	}
+	return schema
+}
+
+// componentName names a component after its Go type. Types outside the
+// models package are prefixed with their package name to avoid clashes.
+func componentName(t reflect.Type) string {
+	pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+	if pkg == "models" {
+		return t.Name()
+	}
+	return strings.ToUpper(pkg[:1]) + pkg[1:] + t.Name()
+}
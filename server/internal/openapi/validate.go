@@ -0,0 +1,186 @@
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidationError describes one place where a value does not match its schema
+type ValidationError struct {
+	Path    string `json:"path"` // JSON pointer to the offending value, "" for the root
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Validate checks a decoded JSON value (as produced by encoding/json into an
+// interface{}) against schema, resolving references in d
+func (d *Document) Validate(schema *Schema, value interface{}) []ValidationError {
+	var errs []ValidationError
+	d.validate(schema, value, "", &errs)
+	return errs
+}
+
+func (d *Document) validate(schema *Schema, value interface{}, path string, errs *[]ValidationError) {
+	if schema == nil {
+		return
+	}
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+		d.validate(d.Components.Schemas[name], value, path, errs)
+		return
+	}
+
+	for _, sub := range schema.AllOf {
+		d.validate(sub, value, path, errs)
+	}
+	if len(schema.AnyOf) > 0 {
+		matched := false
+		for _, sub := range schema.AnyOf {
+			var subErrs []ValidationError
+			d.validate(sub, value, path, &subErrs)
+			if len(subErrs) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("does not match any allowed schema")
+			return
+		}
+	}
+
+	if types := schemaTypes(schema); len(types) > 0 {
+		actual := jsonType(value)
+		if !typeAllowed(types, actual, value) {
+			fail("expected %s, got %s", strings.Join(types, " or "), actual)
+			return
+		}
+	}
+
+	if len(schema.Enum) > 0 {
+		found := false
+		for _, allowed := range schema.Enum {
+			if allowed == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %v", schema.Enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		n := utf8.RuneCountInString(v)
+		if schema.MinLength != nil && n < *schema.MinLength {
+			if *schema.MinLength == 1 {
+				fail("must not be empty")
+			} else {
+				fail("must be at least %d characters", *schema.MinLength)
+			}
+		}
+		if schema.MaxLength != nil && n > *schema.MaxLength {
+			fail("must be at most %d characters", *schema.MaxLength)
+		}
+	case float64:
+		if schema.Minimum != nil && v < *schema.Minimum {
+			fail("must be at least %v", *schema.Minimum)
+		}
+		if schema.Maximum != nil && v > *schema.Maximum {
+			fail("must be at most %v", *schema.Maximum)
+		}
+	case []interface{}:
+		if schema.MinItems != nil && len(v) < *schema.MinItems {
+			fail("must have at least %d items", *schema.MinItems)
+		}
+		for i, item := range v {
+			d.validate(schema.Items, item, fmt.Sprintf("%s/%d", path, i), errs)
+		}
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, ValidationError{Path: path + "/" + name, Message: "is required"})
+			}
+		}
+		// Sorted, so the first error reported is stable
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			item := v[name]
+			if prop, ok := schema.Properties[name]; ok {
+				d.validate(prop, item, path+"/"+name, errs)
+			} else if schema.AdditionalProperties != nil {
+				d.validate(schema.AdditionalProperties, item, path+"/"+name, errs)
+			}
+		}
+	}
+}
+
+// schemaTypes returns the type names a schema allows
+func schemaTypes(schema *Schema) []string {
+	switch t := schema.Type.(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, name := range t {
+			if s, ok := name.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+func typeAllowed(types []string, actual string, value interface{}) bool {
+	for _, t := range types {
+		if t == actual {
+			return true
+		}
+		if t == "integer" && actual == "number" {
+			if f := value.(float64); f == math.Trunc(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,462 @@
+package render
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// imageVersion is part of every cache key; bump it when the layout changes
+const imageVersion = "png-v1"
+
+// Image layout in pixels
+const (
+	imageFontSize     = 15
+	imageLineHeight   = 22
+	imageOuterPadding = 48
+	imageHeaderHeight = 40
+	imageCodePaddingX = 24
+	imageCodePaddingY = 12
+	imageRadius       = 10
+	imageShadowOffset = 8
+	imageMinWidth     = 480
+	imageMaxLines     = 80
+	imageMaxColumns   = 120
+)
+
+// Window control colours, drawn left to right
+var windowButtons = []color.RGBA{
+	{0xff, 0x5f, 0x56, 0xff},
+	{0xff, 0xbd, 0x2e, 0xff},
+	{0x27, 0xc9, 0x3f, 0xff},
+}
+
+// fonts holds the embedded Go Mono fonts, parsed once. Faces cache glyphs
+// and are not safe for concurrent use, so every render creates its own.
+type fonts struct {
+	regular, bold, italic *opentype.Font
+}
+
+// fontFaces holds the faces drawing one image
+type fontFaces struct {
+	regular, bold, italic font.Face
+	advance               int
+}
+
+var (
+	fontsOnce sync.Once
+	parsed    *fonts
+	fontsErr  error
+)
+
+func loadFonts() (*fonts, error) {
+	fontsOnce.Do(func() {
+		parsed = &fonts{}
+		if parsed.regular, fontsErr = opentype.Parse(gomono.TTF); fontsErr != nil {
+			return
+		}
+		if parsed.bold, fontsErr = opentype.Parse(gomonobold.TTF); fontsErr != nil {
+			return
+		}
+		parsed.italic, fontsErr = opentype.Parse(gomonoitalic.TTF)
+	})
+	if fontsErr != nil {
+		return nil, fmt.Errorf("failed to load embedded fonts: %v", fontsErr)
+	}
+	return parsed, nil
+}
+
+// loadFaces creates faces for one render from the embedded fonts
+func loadFaces() (*fontFaces, error) {
+	f, err := loadFonts()
+	if err != nil {
+		return nil, err
+	}
+	newFace := func(f *opentype.Font) (font.Face, error) {
+		return opentype.NewFace(f, &opentype.FaceOptions{Size: imageFontSize, DPI: 72, Hinting: font.HintingFull})
+	}
+
+	ff := &fontFaces{}
+	if ff.regular, err = newFace(f.regular); err != nil {
+		return nil, fmt.Errorf("failed to load embedded fonts: %v", err)
+	}
+	if ff.bold, err = newFace(f.bold); err != nil {
+		return nil, fmt.Errorf("failed to load embedded fonts: %v", err)
+	}
+	if ff.italic, err = newFace(f.italic); err != nil {
+		return nil, fmt.Errorf("failed to load embedded fonts: %v", err)
+	}
+	advance, _ := ff.regular.GlyphAdvance('M')
+	ff.advance = advance.Round()
+	return ff, nil
+}
+
+// PNG renders content as a window-framed share image. Options.Filename is
+// shown as the window title.
+func PNG(content string, opts Options) ([]byte, error) {
+	img, err := Image(content, opts)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode image: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Image renders content as a window-framed share image
+func Image(content string, opts Options) (*image.RGBA, error) {
+	ff, err := loadFaces()
+	if err != nil {
+		return nil, err
+	}
+	lines, err := Lines(content, opts)
+	if err != nil {
+		return nil, err
+	}
+	truncated := len(lines) > imageMaxLines
+	if truncated {
+		lines = lines[:imageMaxLines]
+	}
+
+	style := Style(opts.Theme)
+	palette := ThemePalette(style)
+
+	// Lay out the window around the widest line
+	columns := 0
+	for _, line := range lines {
+		width := 0
+		for _, token := range line {
+			width += utf8.RuneCountInString(expandTabs(strings.TrimRight(token.Value, "\n"), width))
+		}
+		columns = max(columns, width)
+	}
+	columns = min(columns, imageMaxColumns)
+
+	gutter := 0
+	if opts.LineNumbers {
+		gutter = (len(fmt.Sprint(len(lines))) + 2) * ff.advance
+	}
+	rows := len(lines)
+	if truncated {
+		rows++
+	}
+
+	windowWidth := max(imageMinWidth, 2*imageCodePaddingX+gutter+columns*ff.advance)
+	windowHeight := imageHeaderHeight + 2*imageCodePaddingY + rows*imageLineHeight
+	width := windowWidth + 2*imageOuterPadding
+	height := windowHeight + 2*imageOuterPadding
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(rgba(palette.Background.BrightenOrDarken(0.25))), image.Point{}, draw.Src)
+
+	window := image.Rect(imageOuterPadding, imageOuterPadding, imageOuterPadding+windowWidth, imageOuterPadding+windowHeight)
+	fillRoundedRect(img, window.Add(image.Pt(0, imageShadowOffset)), imageRadius, color.RGBA{0, 0, 0, 0x50})
+	fillRoundedRect(img, window, imageRadius, rgba(palette.Background))
+
+	// Title bar
+	for i, c := range windowButtons {
+		fillCircle(img, float64(window.Min.X+20+i*20), float64(window.Min.Y+imageHeaderHeight/2), 6, c)
+	}
+	if title := strings.TrimSpace(opts.Filename); title != "" {
+		title = truncateColumns(title, (windowWidth-160)/ff.advance)
+		x := window.Min.X + (windowWidth-utf8.RuneCountInString(title)*ff.advance)/2
+		drawText(img, ff.regular, title, x, window.Min.Y+imageHeaderHeight/2+5, rgba(palette.LineNumber))
+	}
+
+	// Code
+	codeLeft := window.Min.X + imageCodePaddingX
+	top := window.Min.Y + imageHeaderHeight + imageCodePaddingY
+	for i, line := range lines {
+		number := i + 1
+		rowTop := top + i*imageLineHeight
+		baseline := rowTop + imageLineHeight - (imageLineHeight-imageFontSize)/2 - 3
+
+		if highlighted(opts.Highlight, number) {
+			draw.Draw(img, image.Rect(window.Min.X, rowTop, window.Max.X, rowTop+imageLineHeight),
+				image.NewUniform(rgba(palette.Highlight)), image.Point{}, draw.Over)
+		}
+		if opts.LineNumbers {
+			label := fmt.Sprint(number)
+			x := codeLeft + gutter - (utf8.RuneCountInString(label)+2)*ff.advance
+			drawText(img, ff.regular, label, x, baseline, rgba(palette.LineNumber))
+		}
+
+		column := 0
+		for _, token := range line {
+			text := expandTabs(strings.TrimRight(token.Value, "\n"), column)
+			if text == "" || column >= imageMaxColumns {
+				continue
+			}
+			if column+utf8.RuneCountInString(text) > imageMaxColumns {
+				text = truncateColumns(text, imageMaxColumns-column)
+			}
+
+			entry := style.Get(token.Type)
+			face := ff.regular
+			if entry.Bold == chroma.Yes {
+				face = ff.bold
+			} else if entry.Italic == chroma.Yes {
+				face = ff.italic
+			}
+			fg := palette.Text
+			if entry.Colour.IsSet() {
+				fg = entry.Colour
+			}
+
+			drawText(img, face, text, codeLeft+gutter+column*ff.advance, baseline, rgba(fg))
+			column += utf8.RuneCountInString(text)
+		}
+	}
+	if truncated {
+		baseline := top + len(lines)*imageLineHeight + imageLineHeight - (imageLineHeight-imageFontSize)/2 - 3
+		drawText(img, ff.regular, "…", codeLeft+gutter, baseline, rgba(palette.LineNumber))
+	}
+
+	return img, nil
+}
+
+// truncateColumns shortens text to n columns, marking the cut with an ellipsis
+func truncateColumns(text string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// drawText draws text with its baseline at y
+func drawText(img *image.RGBA, face font.Face, text string, x, y int, c color.RGBA) {
+	d := font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
+
+// rgba converts a chroma colour to an opaque colour
+func rgba(c chroma.Colour) color.RGBA {
+	return color.RGBA{c.Red(), c.Green(), c.Blue(), 0xff}
+}
+
+// fillRoundedRect fills r with anti-aliased corners of the given radius
+func fillRoundedRect(img *image.RGBA, r image.Rectangle, radius int, c color.RGBA) {
+	mask := image.NewAlpha(r)
+	rad := float64(radius)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			// Distance from the pixel centre to the nearest corner circle centre
+			cx := math.Max(0, math.Max(float64(r.Min.X)+rad-(float64(x)+0.5), (float64(x)+0.5)-(float64(r.Max.X)-rad)))
+			cy := math.Max(0, math.Max(float64(r.Min.Y)+rad-(float64(y)+0.5), (float64(y)+0.5)-(float64(r.Max.Y)-rad)))
+			coverage := math.Min(1, math.Max(0, rad+0.5-math.Hypot(cx, cy)))
+			mask.SetAlpha(x, y, color.Alpha{uint8(coverage * 0xff)})
+		}
+	}
+	draw.DrawMask(img, r, image.NewUniform(c), image.Point{}, mask, r.Min, draw.Over)
+}
+
+// fillCircle fills an anti-aliased circle
+func fillCircle(img *image.RGBA, cx, cy, radius float64, c color.RGBA) {
+	r := image.Rect(int(cx-radius)-1, int(cy-radius)-1, int(cx+radius)+2, int(cy+radius)+2)
+	mask := image.NewAlpha(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			d := math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy)
+			coverage := math.Min(1, math.Max(0, radius+0.5-d))
+			mask.SetAlpha(x, y, color.Alpha{uint8(coverage * 0xff)})
+		}
+	}
+	draw.DrawMask(img, r, image.NewUniform(c), image.Point{}, mask, r.Min, draw.Over)
+}
+
+// imageMaxVariants bounds how many option combinations are cached for one
+// snippet, so requests cycling through themes and line ranges cannot fill
+// the disk. Further combinations are rendered but not stored.
+const imageMaxVariants = 16
+
+// ImageCache stores rendered PNGs on disk keyed by content and options, so
+// each image is only rasterised once. Images are grouped by content, at most
+// imageMaxVariants to a directory. When the cache grows past MaxBytes the
+// least recently used images are removed.
+type ImageCache struct {
+	Dir      string
+	MaxBytes int64 // 0 disables storing images
+
+	mu      sync.Mutex
+	size    int64 // Bytes stored, once known
+	counted bool
+}
+
+// DefaultImageCacheBytes is the default bound on the images kept on disk
+const DefaultImageCacheBytes = 256 << 20
+
+// NewImageCache creates a cache in dir, defaulting to the user cache dir,
+// that keeps up to maxBytes of images
+func NewImageCache(dir string, maxBytes int64) *ImageCache {
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			base = os.TempDir()
+		}
+		dir = filepath.Join(base, "snippy-images")
+	}
+	return &ImageCache{Dir: dir, MaxBytes: maxBytes}
+}
+
+// ImageKey identifies an image by everything that affects its pixels.
+// Highlighted ranges are reduced to the lines an image shows, so requests
+// that differ only past the last line share an image.
+func ImageKey(content string, opts Options) string {
+	var lines []string
+	for n := 1; n <= imageMaxLines; n++ {
+		if highlighted(opts.Highlight, n) {
+			lines = append(lines, strconv.Itoa(n))
+		}
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		imageVersion, content, opts.Filename, opts.Language, strings.ToLower(opts.Theme),
+		fmt.Sprint(opts.LineNumbers), strings.Join(lines, ","),
+	}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// contentKey identifies the directory holding the images of content
+func contentKey(content string) string {
+	sum := sha256.Sum256([]byte(imageVersion + "\x00" + content))
+	return hex.EncodeToString(sum[:])
+}
+
+// path returns where the image for content and opts is stored
+func (c *ImageCache) path(content string, opts Options) string {
+	dir := contentKey(content)
+	return filepath.Join(c.Dir, dir[:2], dir, ImageKey(content, opts)+".png")
+}
+
+// PNG returns the cached image for content, rendering and storing it on a miss
+func (c *ImageCache) PNG(content string, opts Options) ([]byte, error) {
+	path := c.path(content, opts)
+
+	if data, err := os.ReadFile(path); err == nil {
+		// The modification time records use for eviction
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return data, nil
+	}
+
+	data, err := PNG(content, opts)
+	if err != nil {
+		return nil, err
+	}
+	if c.MaxBytes > 0 && c.store(path, data) {
+		c.stored(int64(len(data)))
+	}
+	return data, nil
+}
+
+// store writes data to path, unless the content already has its share of
+// images. It writes to a temporary file first so readers never see a
+// partial image. A failed write only costs a re-render next time.
+func (c *ImageCache) store(path string, data []byte) bool {
+	dir := filepath.Dir(path)
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) >= imageMaxVariants {
+		return false
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false
+	}
+	tmp, err := os.CreateTemp(dir, "tmp-*")
+	if err != nil {
+		return false
+	}
+	_, werr := tmp.Write(data)
+	cerr := tmp.Close()
+	if werr != nil || cerr != nil || os.Rename(tmp.Name(), path) != nil {
+		os.Remove(tmp.Name())
+		return false
+	}
+	return true
+}
+
+// stored accounts for an image of n bytes and evicts the least recently
+// used images, down to nine tenths of MaxBytes, once the cache is too big.
+// The size of images left by earlier processes is counted on first use.
+func (c *ImageCache) stored(n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.counted {
+		c.size, c.counted = 0, true
+		for _, f := range c.files() {
+			c.size += f.size
+		}
+	} else {
+		c.size += n
+	}
+	if c.size <= c.MaxBytes {
+		return
+	}
+
+	files := c.files()
+	sort.Slice(files, func(i, j int) bool { return files[i].used.Before(files[j].used) })
+	for _, f := range files {
+		if c.size <= c.MaxBytes/10*9 {
+			break
+		}
+		if err := os.Remove(f.path); err == nil || os.IsNotExist(err) {
+			c.size -= f.size
+			// Drops the content's directory once it is empty
+			os.Remove(filepath.Dir(f.path))
+		}
+	}
+}
+
+// cachedImage is an image file found in the cache directory
+type cachedImage struct {
+	path string
+	size int64
+	used time.Time
+}
+
+// files lists the images in the cache directory
+func (c *ImageCache) files() []cachedImage {
+	var files []cachedImage
+	filepath.WalkDir(c.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".png" {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			files = append(files, cachedImage{path: path, size: info.Size(), used: info.ModTime()})
+		}
+		return nil
+	})
+	return files
+}
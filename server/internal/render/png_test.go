@@ -0,0 +1,202 @@
+package render
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite golden images in testdata")
+
+func TestImageGolden(t *testing.T) {
+	cases := []struct {
+		name string
+		opts Options
+	}{
+		{"go-github", Options{Language: "go", Filename: "main.go", Theme: "github", LineNumbers: true}},
+		{"go-monokai-highlight", Options{Language: "go", Filename: "main.go", Theme: "monokai", Highlight: []LineRange{{3, 4}}}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := PNG(sample, tc.opts)
+			if err != nil {
+				t.Fatalf("PNG failed: %v", err)
+			}
+
+			golden := filepath.Join("testdata", tc.name+".png")
+			if *update {
+				if err := os.WriteFile(golden, data, 0644); err != nil {
+					t.Fatalf("Failed to update golden image: %v", err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("Failed to read golden image (run with -update to create it): %v", err)
+			}
+			// Compare pixels rather than bytes so encoder changes don't matter
+			if diff := pixelDiff(t, decodePNG(t, want), decodePNG(t, data)); diff != "" {
+				t.Errorf("Image differs from %s: %s", golden, diff)
+			}
+		})
+	}
+}
+
+// TestPNGConcurrent renders share images for several requests at once, as
+// the image endpoint does. Run it with -race.
+func TestPNGConcurrent(t *testing.T) {
+	opts := Options{Language: "go", Filename: "main.go", Theme: "monokai", LineNumbers: true}
+	want, err := PNG(sample, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := PNG(sample, opts)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !bytes.Equal(data, want) {
+				t.Error("Concurrent render differs from a serial one")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestImageTruncatesLongSnippets(t *testing.T) {
+	long := bytes.Repeat([]byte("x := 1 // "+string(bytes.Repeat([]byte("y"), 200))+"\n"), imageMaxLines+20)
+	img, err := Image(string(long), Options{Language: "go", Theme: DefaultTheme})
+	if err != nil {
+		t.Fatalf("Image failed: %v", err)
+	}
+
+	short, _ := Image("x := 1\n", Options{Language: "go", Theme: DefaultTheme})
+	maxHeight := short.Bounds().Dy() + imageMaxLines*imageLineHeight
+	if img.Bounds().Dy() > maxHeight {
+		t.Errorf("Height %d exceeds cap %d", img.Bounds().Dy(), maxHeight)
+	}
+	ff, _ := loadFaces()
+	if img.Bounds().Dx() > 2*imageOuterPadding+2*imageCodePaddingX+imageMaxColumns*ff.advance {
+		t.Errorf("Width %d was not capped", img.Bounds().Dx())
+	}
+}
+
+func TestImageCache(t *testing.T) {
+	cache := NewImageCache(t.TempDir(), DefaultImageCacheBytes)
+	opts := Options{Language: "go", Theme: DefaultTheme}
+
+	first, err := cache.PNG(sample, opts)
+	if err != nil {
+		t.Fatalf("PNG failed: %v", err)
+	}
+	key := ImageKey(sample, opts)
+	if _, err := os.Stat(cache.path(sample, opts)); err != nil {
+		t.Fatalf("Expected cached file: %v", err)
+	}
+
+	second, err := cache.PNG(sample, opts)
+	if err != nil || !bytes.Equal(first, second) {
+		t.Errorf("Expected the cached image on the second call")
+	}
+
+	opts.Theme = "monokai"
+	if ImageKey(sample, opts) == key {
+		t.Error("Expected the theme to change the cache key")
+	}
+
+	// Highlighting lines past the end of the image does not change it
+	opts.Theme = DefaultTheme
+	opts.Highlight = []LineRange{{imageMaxLines + 1, imageMaxLines + 50}}
+	if ImageKey(sample, opts) != key {
+		t.Error("Expected hidden highlights to share the cache key")
+	}
+}
+
+func TestImageCacheLimitsVariants(t *testing.T) {
+	cache := NewImageCache(t.TempDir(), DefaultImageCacheBytes)
+
+	for i := 1; i <= imageMaxVariants+2; i++ {
+		opts := Options{Language: "go", Theme: DefaultTheme, Highlight: []LineRange{{i, i}}}
+		if data, err := cache.PNG(sample, opts); err != nil || len(data) == 0 {
+			t.Fatalf("Variant %d: %v", i, err)
+		}
+	}
+	if n := len(cache.files()); n != imageMaxVariants {
+		t.Errorf("Stored %d variants, want %d", n, imageMaxVariants)
+	}
+}
+
+func TestImageCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewImageCache(t.TempDir(), DefaultImageCacheBytes)
+	contents := []string{"package a\n", "package b\n", "package c\n"}
+	opts := Options{Language: "go", Theme: DefaultTheme}
+
+	// Store two images a minute apart, then leave room for two and a half
+	var stored int64
+	for i, content := range contents[:2] {
+		data, err := cache.PNG(content, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		used := time.Now().Add(time.Duration(i-5) * time.Minute)
+		os.Chtimes(cache.path(content, opts), used, used)
+		stored += int64(len(data))
+	}
+	cache.MaxBytes = stored * 5 / 4
+
+	// Reading the first image makes the second the least recently used
+	if _, err := cache.PNG(contents[0], opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.PNG(contents[2], opts); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, content := range contents {
+		_, err := os.Stat(cache.path(content, opts))
+		if exists := err == nil; exists != (i != 1) {
+			t.Errorf("Image %d cached: %v", i, exists)
+		}
+	}
+}
+
+func decodePNG(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+	return img
+}
+
+func pixelDiff(t *testing.T, want, got image.Image) string {
+	t.Helper()
+	if want.Bounds() != got.Bounds() {
+		return "size " + got.Bounds().String() + ", want " + want.Bounds().String()
+	}
+	b := want.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			wr, wg, wb, wa := want.At(x, y).RGBA()
+			gr, gg, gb, ga := got.At(x, y).RGBA()
+			if wr != gr || wg != gg || wb != gb || wa != ga {
+				return "first difference at " + image.Pt(x, y).String()
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,153 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// DefaultTheme is used when no theme is requested
+const DefaultTheme = "github"
+
+// maxLines bounds how many lines are rendered into a single image or page
+const maxLines = 2000
+
+// LineRange is an inclusive range of 1-based line numbers
+type LineRange struct {
+	Start int
+	End   int
+}
+
+// Options controls how a snippet is rendered
+type Options struct {
+	Language    string      // Lexer name or alias; detected from the filename or content when empty
+	Filename    string      // Used to pick a lexer from the extension
+	Theme       string      // Chroma style name
+	LineNumbers bool        // Show a line number gutter
+	Highlight   []LineRange // Lines to emphasise
+	Standalone  bool        // HTML only: wrap the fragment in a full document
+}
+
+// Themes lists the available theme names
+func Themes() []string {
+	names := styles.Names()
+	sort.Strings(names)
+	return names
+}
+
+// IsValidTheme reports whether name is an available theme
+func IsValidTheme(name string) bool {
+	_, ok := styles.Registry[strings.ToLower(name)]
+	return ok
+}
+
+// Style returns the chroma style for a theme, falling back to the default
+func Style(theme string) *chroma.Style {
+	if theme == "" || !IsValidTheme(theme) {
+		theme = DefaultTheme
+	}
+	return styles.Get(strings.ToLower(theme))
+}
+
+// ParseLineRanges parses a list like "3-10,15" into line ranges
+func ParseLineRanges(s string) ([]LineRange, error) {
+	var ranges []LineRange
+	if strings.TrimSpace(s) == "" {
+		return ranges, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		bounds := strings.SplitN(part, "-", 2)
+
+		start, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid line range %q", part)
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil {
+				return nil, fmt.Errorf("invalid line range %q", part)
+			}
+		}
+		if start < 1 || end < start {
+			return nil, fmt.Errorf("invalid line range %q", part)
+		}
+		ranges = append(ranges, LineRange{Start: start, End: end})
+	}
+
+	return ranges, nil
+}
+
+// highlighted reports whether line is in one of the ranges
+func highlighted(ranges []LineRange, line int) bool {
+	for _, r := range ranges {
+		if line >= r.Start && line <= r.End {
+			return true
+		}
+	}
+	return false
+}
+
+// Lexer picks a lexer by explicit language, then filename, then by
+// analysing the content
+func Lexer(language, filename, content string) chroma.Lexer {
+	var lexer chroma.Lexer
+	if language != "" {
+		lexer = lexers.Get(language)
+	}
+	if lexer == nil && filename != "" && filepath.Ext(filename) != "" {
+		lexer = lexers.Match(filename)
+	}
+	if lexer == nil {
+		lexer = lexers.Analyse(content)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	return chroma.Coalesce(lexer)
+}
+
+// Lines tokenises content and splits the tokens into lines. Each line keeps
+// its trailing newline token, if any.
+func Lines(content string, opts Options) ([][]chroma.Token, error) {
+	iterator, err := Lexer(opts.Language, opts.Filename, content).Tokenise(nil, content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to tokenise snippet: %v", err)
+	}
+	lines := chroma.SplitTokensIntoLines(iterator.Tokens())
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+	}
+	return lines, nil
+}
+
+// HTML writes content as highlighted HTML with inline styles
+func HTML(w io.Writer, content string, opts Options) error {
+	iterator, err := Lexer(opts.Language, opts.Filename, content).Tokenise(nil, content)
+	if err != nil {
+		return fmt.Errorf("failed to tokenise snippet: %v", err)
+	}
+
+	ranges := make([][2]int, len(opts.Highlight))
+	for i, r := range opts.Highlight {
+		ranges[i] = [2]int{r.Start, r.End}
+	}
+
+	formatter := html.New(
+		html.WithClasses(false),
+		html.WithLineNumbers(opts.LineNumbers),
+		html.HighlightLines(ranges),
+		html.TabWidth(4),
+		html.Standalone(opts.Standalone),
+	)
+	return formatter.Format(w, Style(opts.Theme), iterator)
+}
@@ -0,0 +1,87 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+const sample = "package main\n\nfunc main() {\n\tprintln(\"<hi>\")\n}\n"
+
+func TestParseLineRanges(t *testing.T) {
+	got, err := ParseLineRanges("3-10, 15")
+	if err != nil {
+		t.Fatalf("ParseLineRanges failed: %v", err)
+	}
+	if len(got) != 2 || got[0] != (LineRange{3, 10}) || got[1] != (LineRange{15, 15}) {
+		t.Errorf("ParseLineRanges = %v", got)
+	}
+
+	for _, bad := range []string{"a", "0-2", "5-3", "1-x"} {
+		if _, err := ParseLineRanges(bad); err == nil {
+			t.Errorf("ParseLineRanges(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestLexerSelection(t *testing.T) {
+	if name := Lexer("python", "", sample).Config().Name; name != "Python" {
+		t.Errorf("Explicit language picked %s", name)
+	}
+	if name := Lexer("", "main.go", "x").Config().Name; name != "Go" {
+		t.Errorf("Filename picked %s", name)
+	}
+	if name := Lexer("", "Array Shuffle", "plain words").Config().Name; name == "" {
+		t.Error("Expected a fallback lexer")
+	}
+}
+
+func TestHTML(t *testing.T) {
+	var buf bytes.Buffer
+	opts := Options{Language: "go", Theme: "monokai", LineNumbers: true, Highlight: []LineRange{{4, 4}}}
+	if err := HTML(&buf, sample, opts); err != nil {
+		t.Fatalf("HTML failed: %v", err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "&lt;hi&gt;") || strings.Contains(out, "<hi>") {
+		t.Error("Expected token text to be escaped")
+	}
+	if !strings.Contains(out, "style=") {
+		t.Error("Expected inline styles")
+	}
+}
+
+func TestSVG(t *testing.T) {
+	var buf bytes.Buffer
+	opts := Options{Language: "go", Theme: "github", LineNumbers: true, Highlight: []LineRange{{3, 4}}}
+	if err := SVG(&buf, sample, opts); err != nil {
+		t.Fatalf("SVG failed: %v", err)
+	}
+
+	// The document must be well-formed XML
+	decoder := xml.NewDecoder(bytes.NewReader(buf.Bytes()))
+	for {
+		if _, err := decoder.Token(); err != nil {
+			if err != io.EOF {
+				t.Fatalf("SVG is not well-formed: %v", err)
+			}
+			break
+		}
+	}
+
+	out := buf.String()
+	if got := strings.Count(out, `height="20" fill=`); got != 2 {
+		t.Errorf("Expected 2 highlighted line backgrounds, got %d", got)
+	}
+	if !strings.Contains(out, ">5</text>") {
+		t.Error("Expected line numbers up to 5")
+	}
+	if !strings.Contains(out, "&#34;&lt;hi&gt;&#34;") {
+		t.Error("Expected escaped string token")
+	}
+	if !strings.Contains(out, "    ") {
+		t.Error("Expected tabs to be expanded")
+	}
+}
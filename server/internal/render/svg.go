@@ -0,0 +1,150 @@
+package render
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+)
+
+// SVG metrics in pixels. Glyph width assumes a monospace font at 0.6em.
+const (
+	svgFontSize   = 14
+	svgLineHeight = 20
+	svgCharWidth  = svgFontSize * 0.6
+	svgPadding    = 16
+	svgFontFamily = "ui-monospace, SFMono-Regular, Menlo, Consolas, 'Liberation Mono', monospace"
+)
+
+// Palette holds the colours a theme uses outside of individual tokens
+type Palette struct {
+	Background chroma.Colour
+	Text       chroma.Colour
+	LineNumber chroma.Colour
+	Highlight  chroma.Colour
+}
+
+// ThemePalette derives the frame colours of a theme, filling gaps from the
+// background so every theme renders legibly
+func ThemePalette(style *chroma.Style) Palette {
+	bg := style.Get(chroma.Background)
+	p := Palette{Background: bg.Background, Text: bg.Colour}
+	if !p.Background.IsSet() {
+		p.Background = chroma.MustParseColour("#ffffff")
+	}
+	if !p.Text.IsSet() {
+		p.Text = p.Background.BrightenOrDarken(0.9)
+	}
+
+	p.LineNumber = style.Get(chroma.LineNumbers).Colour
+	if !p.LineNumber.IsSet() || p.LineNumber == p.Text {
+		p.LineNumber = p.Background.BrightenOrDarken(0.5)
+	}
+	p.Highlight = style.Get(chroma.LineHighlight).Background
+	if !p.Highlight.IsSet() || p.Highlight == p.Background {
+		p.Highlight = p.Background.BrightenOrDarken(0.1)
+	}
+	return p
+}
+
+// expandTabs replaces tabs with spaces up to the next 4-column tab stop,
+// given the column the text starts at
+func expandTabs(text string, column int) string {
+	if !strings.Contains(text, "\t") {
+		return text
+	}
+	var sb strings.Builder
+	for _, r := range text {
+		if r == '\t' {
+			n := 4 - column%4
+			sb.WriteString(strings.Repeat(" ", n))
+			column += n
+			continue
+		}
+		sb.WriteRune(r)
+		column++
+	}
+	return sb.String()
+}
+
+// SVG writes content as a standalone SVG document
+func SVG(w io.Writer, content string, opts Options) error {
+	lines, err := Lines(content, opts)
+	if err != nil {
+		return err
+	}
+	style := Style(opts.Theme)
+	palette := ThemePalette(style)
+
+	// Measure the widest line after tab expansion
+	columns := 0
+	for _, line := range lines {
+		width := 0
+		for _, token := range line {
+			width += utf8.RuneCountInString(expandTabs(strings.TrimRight(token.Value, "\n"), width))
+		}
+		if width > columns {
+			columns = width
+		}
+	}
+
+	gutter := 0.0
+	if opts.LineNumbers {
+		gutter = float64(len(fmt.Sprint(len(lines))))*svgCharWidth + svgPadding
+	}
+	width := svgPadding*2 + gutter + float64(columns)*svgCharWidth
+	height := svgPadding*2 + len(lines)*svgLineHeight
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%d" viewBox="0 0 %.0f %d">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(bw, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", palette.Background)
+	fmt.Fprintf(bw, `<g font-family="%s" font-size="%d" xml:space="preserve">`+"\n", svgFontFamily, svgFontSize)
+
+	for i, line := range lines {
+		number := i + 1
+		top := svgPadding + i*svgLineHeight
+		baseline := top + svgLineHeight - (svgLineHeight-svgFontSize)/2 - 2
+
+		if highlighted(opts.Highlight, number) {
+			fmt.Fprintf(bw, `<rect x="0" y="%d" width="100%%" height="%d" fill="%s"/>`+"\n", top, svgLineHeight, palette.Highlight)
+		}
+		if opts.LineNumbers {
+			fmt.Fprintf(bw, `<text x="%.1f" y="%d" text-anchor="end" fill="%s">%d</text>`+"\n",
+				svgPadding+gutter-svgPadding, baseline, palette.LineNumber, number)
+		}
+
+		fmt.Fprintf(bw, `<text x="%.1f" y="%d" fill="%s">`, svgPadding+gutter, baseline, palette.Text)
+		column := 0
+		for _, token := range line {
+			text := expandTabs(strings.TrimRight(token.Value, "\n"), column)
+			if text == "" {
+				continue
+			}
+			column += utf8.RuneCountInString(text)
+
+			entry := style.Get(token.Type)
+			bw.WriteString("<tspan")
+			if entry.Colour.IsSet() && entry.Colour != palette.Text {
+				fmt.Fprintf(bw, ` fill="%s"`, entry.Colour)
+			}
+			if entry.Bold == chroma.Yes {
+				bw.WriteString(` font-weight="bold"`)
+			}
+			if entry.Italic == chroma.Yes {
+				bw.WriteString(` font-style="italic"`)
+			}
+			bw.WriteString(">")
+			xml.EscapeText(bw, []byte(text))
+			bw.WriteString("</tspan>")
+		}
+		bw.WriteString("</text>\n")
+	}
+
+	bw.WriteString("</g>\n</svg>\n")
+	return bw.Flush()
+}
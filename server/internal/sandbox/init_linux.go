@@ -0,0 +1,344 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// File descriptors passed to the sandbox init, in ExtraFiles order
+const (
+	statusFD = 3 // Setup failures are written here; closed on exec
+	exeFD    = 4 // The server binary, re-executed as the init
+)
+
+// systemPaths are mounted read-only into every sandbox so toolchains and
+// the libraries they load are available. Symlinks, as on merged-/usr
+// systems, are recreated instead of mounted.
+var systemPaths = []string{
+	"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32",
+	"/etc/alternatives", "/etc/ld.so.cache", "/etc/ld.so.conf", "/etc/ld.so.conf.d",
+	"/etc/ssl", "/etc/ca-certificates", "/etc/localtime",
+}
+
+// devices are the nodes mounted into the sandbox's /dev
+var devices = []string{"null", "zero", "full", "random", "urandom"}
+
+// setupFailure is what the init reports when it cannot start the program
+type setupFailure struct {
+	Exec    bool   `json:"exec"` // The sandbox was ready but exec failed
+	Message string `json:"message"`
+}
+
+// Init sets up the sandbox and runs the program when this process was
+// started as a sandbox init, and otherwise returns immediately. It must be
+// called at the very start of main, and of TestMain in tests that run code.
+func Init() {
+	if len(os.Args) == 0 || os.Args[0] != initName {
+		return
+	}
+
+	// Capabilities are per thread, so they must be dropped on the thread
+	// that calls exec
+	runtime.LockOSThread()
+
+	var s spec
+	err := json.Unmarshal([]byte(os.Getenv(specEnv)), &s)
+	if err == nil {
+		err = s.enter()
+	}
+
+	failure := setupFailure{Message: err.Error()}
+	var execErr *execError
+	if errors.As(err, &execErr) {
+		failure.Exec = true
+	}
+	json.NewEncoder(os.NewFile(statusFD, "status")).Encode(failure)
+	os.Exit(1)
+}
+
+// execError is a failure to exec the program in a ready sandbox
+type execError struct{ err error }
+
+func (e *execError) Error() string { return e.err.Error() }
+
+// enter builds the sandbox filesystem, applies the limits and execs the
+// program. It only returns on failure.
+func (s *spec) enter() error {
+	// Keep the mounts made below out of the host
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %w", err)
+	}
+	// The root filesystem is assembled in Root, then made the root
+	root := s.Root
+	if err := os.Mkdir(root, 0755); err != nil {
+		return fmt.Errorf("failed to create root: %w", err)
+	}
+	if err := unix.Mount("tmpfs", root, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755,size=1m"); err != nil {
+		return fmt.Errorf("failed to mount root: %w", err)
+	}
+
+	for _, path := range systemPaths {
+		if err := bindReadOnly(path, root+path); err != nil {
+			return err
+		}
+	}
+	if err := writeUserDB(root); err != nil {
+		return err
+	}
+	if err := mountDevices(root); err != nil {
+		return err
+	}
+
+	// The working directory is the only host directory programs can write
+	if err := mountPoint(root+"/work", true); err != nil {
+		return err
+	}
+	if err := unix.Mount(s.Dir, root+"/work", "", unix.MS_BIND, ""); err != nil {
+		return fmt.Errorf("failed to mount working directory: %w", err)
+	}
+	if err := remount(root+"/work", unix.MS_NOSUID|unix.MS_NODEV); err != nil {
+		return err
+	}
+
+	tmpOptions := fmt.Sprintf("mode=1777,size=%d", s.FileBytes)
+	if err := mountPoint(root+"/tmp", true); err != nil {
+		return err
+	}
+	if err := unix.Mount("tmpfs", root+"/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, tmpOptions); err != nil {
+		return fmt.Errorf("failed to mount /tmp: %w", err)
+	}
+	if s.CacheDir != "" {
+		if err := mountCache(root, s.CacheDir); err != nil {
+			return err
+		}
+	}
+
+	// A fresh /proc shows only the sandbox's own processes
+	if err := mountPoint(root+"/proc", true); err != nil {
+		return err
+	}
+	if err := unix.Mount("proc", root+"/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("failed to mount /proc: %w", err)
+	}
+
+	if err := pivot(root); err != nil {
+		return err
+	}
+	if err := unix.Chdir("/work"); err != nil {
+		return fmt.Errorf("failed to enter working directory: %w", err)
+	}
+
+	if err := s.setLimits(); err != nil {
+		return err
+	}
+	if err := dropPrivileges(); err != nil {
+		return err
+	}
+
+	for fd := statusFD; fd <= exeFD; fd++ {
+		unix.CloseOnExec(fd)
+	}
+	return &execError{unix.Exec(s.Argv[0], s.Argv, s.Env)}
+}
+
+// fdPath names a file descriptor passed by the server. The server binary is
+// executed through it since its directory may not be searchable by the
+// sandbox user.
+func fdPath(fd int) string {
+	return fmt.Sprintf("/proc/self/fd/%d", fd)
+}
+
+// mountPoint creates an empty directory or file to mount over
+func mountPoint(path string, dir bool) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if dir {
+		return os.MkdirAll(path, 0755)
+	}
+	return os.WriteFile(path, nil, 0644)
+}
+
+// bindReadOnly mounts the host path src read-only at dst. Missing paths
+// are skipped.
+func bindReadOnly(src, dst string) error {
+	info, err := os.Lstat(src)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	}
+
+	if err := mountPoint(dst, info.IsDir()); err != nil {
+		return err
+	}
+	if err := unix.Mount(src, dst, "", unix.MS_BIND, ""); err != nil {
+		return fmt.Errorf("failed to mount %s: %w", src, err)
+	}
+	return remount(dst, unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV)
+}
+
+// remount adds flags to the bind mount at path. Flags the mount already
+// has are kept, since a user namespace may not clear them.
+func remount(path string, flags uintptr) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return fmt.Errorf("failed to remount %s: %w", path, err)
+	}
+	for _, f := range []struct {
+		st int64
+		ms uintptr
+	}{
+		{unix.ST_RDONLY, unix.MS_RDONLY},
+		{unix.ST_NOSUID, unix.MS_NOSUID},
+		{unix.ST_NODEV, unix.MS_NODEV},
+		{unix.ST_NOEXEC, unix.MS_NOEXEC},
+		{unix.ST_NOATIME, unix.MS_NOATIME},
+		{unix.ST_NODIRATIME, unix.MS_NODIRATIME},
+		{unix.ST_RELATIME, unix.MS_RELATIME},
+	} {
+		if st.Flags&f.st != 0 {
+			flags |= f.ms
+		}
+	}
+	if err := unix.Mount("", path, "", unix.MS_REMOUNT|unix.MS_BIND|flags, ""); err != nil {
+		return fmt.Errorf("failed to remount %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeUserDB names the sandbox's only user instead of exposing the
+// host's account list
+func writeUserDB(root string) error {
+	if err := os.MkdirAll(root+"/etc", 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(root+"/etc/passwd", []byte("sandbox:x:0:0:sandbox:/work:/bin/sh\n"), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(root+"/etc/group", []byte("sandbox:x:0:\n"), 0644)
+}
+
+// mountDevices populates /dev with the harmless device nodes
+func mountDevices(root string) error {
+	for _, name := range devices {
+		dst := root + "/dev/" + name
+		if err := mountPoint(dst, false); err != nil {
+			return err
+		}
+		if err := unix.Mount("/dev/"+name, dst, "", unix.MS_BIND, ""); err != nil {
+			return fmt.Errorf("failed to mount /dev/%s: %w", name, err)
+		}
+	}
+	for name, target := range map[string]string{
+		"fd": "/proc/self/fd", "stdin": "/proc/self/fd/0", "stdout": "/proc/self/fd/1", "stderr": "/proc/self/fd/2",
+	} {
+		if err := os.Symlink(target, root+"/dev/"+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mountCache mounts the shared Go build cache at /cache under a writable
+// overlay kept in /tmp, so a run can add to the cache but its changes are
+// thrown away with it. Where overlays are not available the run gets an
+// empty private cache instead.
+func mountCache(root, cacheDir string) error {
+	upper, work := root+"/tmp/.cache/upper", root+"/tmp/.cache/work"
+	for _, dir := range []string{upper, work, root + "/cache"} {
+		if err := mountPoint(dir, true); err != nil {
+			return err
+		}
+	}
+	options := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", cacheDir, upper, work)
+	if err := unix.Mount("overlay", root+"/cache", "overlay", unix.MS_NOSUID|unix.MS_NODEV, options); err == nil {
+		return nil
+	}
+	if err := unix.Mount(upper, root+"/cache", "", unix.MS_BIND, ""); err != nil {
+		return fmt.Errorf("failed to mount build cache: %w", err)
+	}
+	return nil
+}
+
+// pivot makes root the root filesystem and detaches the host's
+func pivot(root string) error {
+	if err := unix.Chdir(root); err != nil {
+		return err
+	}
+	if err := os.Mkdir(".old", 0700); err != nil {
+		return err
+	}
+	if err := unix.PivotRoot(".", ".old"); err != nil {
+		return fmt.Errorf("failed to change root: %w", err)
+	}
+	if err := unix.Chdir("/"); err != nil {
+		return err
+	}
+	if err := unix.Unmount("/.old", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("failed to detach host filesystem: %w", err)
+	}
+	if err := os.Remove("/.old"); err != nil {
+		return err
+	}
+	return remount("/", unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV)
+}
+
+// setLimits applies the spec's resource limits, which the program inherits
+func (s *spec) setLimits() error {
+	for _, limit := range []struct {
+		resource int
+		value    uint64
+	}{
+		{unix.RLIMIT_CPU, s.CPUSeconds},
+		{unix.RLIMIT_DATA, s.MemoryBytes},
+		{unix.RLIMIT_FSIZE, s.FileBytes},
+		{unix.RLIMIT_NPROC, s.Processes},
+		{unix.RLIMIT_CORE, 0},
+	} {
+		rlimit := unix.Rlimit{Cur: limit.value, Max: limit.value}
+		if err := unix.Setrlimit(limit.resource, &rlimit); err != nil {
+			return fmt.Errorf("failed to set resource limit %d: %w", limit.resource, err)
+		}
+	}
+	return nil
+}
+
+// dropPrivileges leaves the program with no capabilities, even inside
+// the sandbox's user namespace. Emptying the bounding set also stops exec
+// from granting them again to uid 0.
+func dropPrivileges() error {
+	for c := 0; c <= unix.CAP_LAST_CAP; c++ {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil && err != unix.EINVAL {
+			return fmt.Errorf("failed to drop capability %d: %w", c, err)
+		}
+	}
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capset(&header, &data[0]); err != nil {
+		return fmt.Errorf("failed to drop capabilities: %w", err)
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set no_new_privs: %w", err)
+	}
+	return nil
+}
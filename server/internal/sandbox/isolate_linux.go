@@ -0,0 +1,111 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// nobody is the host user sandboxed programs run as. The sandbox's root
+// user is mapped onto it, so programs never run as the server's user.
+const nobody = 65534
+
+// errNotRoot explains why a server without root cannot run code: only
+// root may map the sandbox onto a user other than its own
+var errNotRoot = fmt.Errorf("%w: the server must run as root to run programs as an unprivileged user", ErrIsolationUnavailable)
+
+// isolated returns a command that runs s in a new sandbox, and the function
+// that starts it. The server binary is re-executed as the sandbox's init
+// (see Init) in fresh user, mount, PID, network, IPC, UTS and cgroup
+// namespaces. The init builds a private root filesystem, applies the
+// limits and replaces itself with the program; start returns once it has.
+func isolated(ctx context.Context, s spec) (*exec.Cmd, func() error, error) {
+	if os.Geteuid() != 0 {
+		return nil, nil, errNotRoot
+	}
+
+	exe, err := os.Open("/proc/self/exe")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open server binary: %v", err)
+	}
+	payload, err := json.Marshal(s)
+	if err != nil {
+		exe.Close()
+		return nil, nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, fdPath(exeFD))
+	cmd.Args = []string{initName}
+	cmd.Env = []string{specEnv + "=" + string(payload)}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET |
+			syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS | syscall.CLONE_NEWCGROUP,
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: nobody, Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: nobody, Size: 1}},
+		GidMappingsEnableSetgroups: true,
+		// Become the mapped user and drop the server's supplementary groups
+		Credential: &syscall.Credential{Uid: 0, Gid: 0},
+		Pdeathsig:  syscall.SIGKILL,
+	}
+	// The program is the first process of its PID namespace, so killing it
+	// kills everything it started
+	cmd.Cancel = func() error { return cmd.Process.Kill() }
+
+	start := func() error {
+		defer exe.Close()
+
+		status, statusWriter, err := os.Pipe()
+		if err != nil {
+			return fmt.Errorf("failed to start program: %v", err)
+		}
+		defer status.Close()
+		cmd.ExtraFiles = []*os.File{statusWriter, exe}
+
+		err = cmd.Start()
+		statusWriter.Close()
+		if err != nil {
+			return startError(err)
+		}
+
+		// The status pipe closes when the init execs the program
+		report, _ := io.ReadAll(status)
+		if len(report) == 0 {
+			return nil
+		}
+		cmd.Wait()
+
+		var failure setupFailure
+		if err := json.Unmarshal(report, &failure); err != nil {
+			failure.Message = string(report)
+		}
+		if failure.Exec {
+			return fmt.Errorf("failed to start program: %s", failure.Message)
+		}
+		return fmt.Errorf("%w: %s", ErrIsolationUnavailable, failure.Message)
+	}
+	return cmd, start, nil
+}
+
+// prepareDir hands a run's working directory to the user programs run as
+func prepareDir(dir string) error {
+	if os.Geteuid() != 0 {
+		return errNotRoot
+	}
+	if err := os.Chown(dir, nobody, nobody); err != nil {
+		return fmt.Errorf("failed to prepare working directory: %v", err)
+	}
+	return nil
+}
+
+// startError explains a failure to start the sandbox init
+func startError(err error) error {
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOSPC) {
+		return fmt.Errorf("%w: %v", ErrIsolationUnavailable, err)
+	}
+	return fmt.Errorf("failed to start program: %v", err)
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"context"
+	"os/exec"
+)
+
+// Init does nothing where programs cannot be sandboxed
+func Init() {}
+
+// isolated refuses to run code where Linux namespaces are not available
+func isolated(ctx context.Context, s spec) (*exec.Cmd, func() error, error) {
+	return nil, nil, ErrIsolationUnavailable
+}
+
+func prepareDir(dir string) error {
+	return ErrIsolationUnavailable
+}
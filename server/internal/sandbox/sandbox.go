@@ -0,0 +1,472 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Size limits for submitted code and stdin
+const (
+	MaxSourceBytes = 256 * 1024
+	MaxStdinBytes  = 64 * 1024
+)
+
+// Go programs are compiled in a separate step with these fixed limits; the
+// compiler is trusted code, so it gets more room than the program it builds
+const (
+	buildTimeout     = 60 * time.Second
+	buildCPUTime     = 60 * time.Second
+	buildMemoryBytes = 2 << 30
+	buildFileBytes   = 1 << 30
+	buildProcesses   = 1024
+)
+
+// sandboxPath is PATH inside the sandbox, where only system directories
+// are mounted
+const sandboxPath = "/usr/local/go/bin:/usr/local/bin:/usr/bin:/bin"
+
+// initName is argv[0] of the server binary re-executed as a sandbox init,
+// and specEnv carries the init's spec
+const (
+	initName = "snippy-sandbox-init"
+	specEnv  = "SNIPPY_SANDBOX_SPEC"
+)
+
+var (
+	ErrUnsupportedLanguage  = errors.New("unsupported language")
+	ErrIsolationUnavailable = errors.New("sandbox isolation is not available on this host")
+	ErrBusy                 = errors.New("all sandboxes are busy, try again later")
+	ErrUserBusy             = errors.New("you already have the maximum number of runs in progress")
+	ErrTooLarge             = errors.New("input too large")
+)
+
+// language describes how to build and run a source file
+type language struct {
+	binary   string   // Toolchain looked up on the sandbox's PATH
+	fileName string   // Name the source is written to
+	build    []string // Optional build command, run before the program
+	run      []string // Command line; the binary is resolved to an absolute path
+}
+
+var languages = map[string]language{
+	"go":     {binary: "go", fileName: "main.go", build: []string{"go", "build", "-o", "program", "main.go"}, run: []string{"./program"}},
+	"python": {binary: "python3", fileName: "main.py", run: []string{"python3", "-I", "main.py"}},
+	"shell":  {binary: "sh", fileName: "main.sh", run: []string{"sh", "main.sh"}},
+	"node":   {binary: "node", fileName: "main.js", run: []string{"node", "main.js"}},
+}
+
+var languageAliases = map[string]string{
+	"go":         "go",
+	"golang":     "go",
+	"python":     "python",
+	"python3":    "python",
+	"py":         "python",
+	"shell":      "shell",
+	"sh":         "shell",
+	"bash":       "shell",
+	"node":       "node",
+	"nodejs":     "node",
+	"javascript": "node",
+	"js":         "node",
+}
+
+// Normalize maps a language name or alias to the name used by the sandbox
+func Normalize(name string) (string, bool) {
+	lang, ok := languageAliases[strings.ToLower(strings.TrimSpace(name))]
+	return lang, ok
+}
+
+// Available lists the languages whose toolchain is installed on this host
+func Available() []string {
+	var names []string
+	for name, lang := range languages {
+		if _, err := lookPath(lang.binary); err == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookPath finds binary in the sandbox's PATH, so toolchains installed
+// elsewhere on the host, which programs could not reach, are not used
+func lookPath(binary string) (string, error) {
+	for _, dir := range filepath.SplitList(sandboxPath) {
+		path := filepath.Join(dir, binary)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0 {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found in %s", binary, sandboxPath)
+}
+
+// Limits bounds the resources a single run may use
+type Limits struct {
+	Timeout     time.Duration // Wall clock
+	CPUTime     time.Duration
+	MemoryBytes int64 // Data segment and writable mappings
+	FileBytes   int64 // Largest file the program may write, and the size of /tmp
+	Processes   int   // Processes and threads, including the program itself
+	OutputBytes int   // Per stream; the rest is discarded
+}
+
+// DefaultLimits are used when no configuration is supplied
+var DefaultLimits = Limits{
+	Timeout:     10 * time.Second,
+	CPUTime:     5 * time.Second,
+	MemoryBytes: 256 << 20,
+	FileBytes:   10 << 20,
+	Processes:   64,
+	OutputBytes: 64 << 10,
+}
+
+// DefaultCacheDir is the shared Go build cache used when none is configured
+const DefaultCacheDir = "/var/cache/snippy-sandbox/go-build"
+
+// Config configures a Runner
+type Config struct {
+	Limits        Limits
+	MaxConcurrent int           // Runs in progress across all users
+	MaxPerUser    int           // Runs in progress per user
+	QueueTimeout  time.Duration // How long a run waits for a free slot
+	CacheDir      string        // Go build cache shared read-only by runs; must be searchable by all users
+}
+
+// Request is code to execute
+type Request struct {
+	Language string
+	Code     string
+	Stdin    string
+}
+
+// spec describes one sandboxed process. It is passed to the sandbox init,
+// which builds the sandbox and then execs Argv.
+type spec struct {
+	Root     string `json:"root"`                // Empty host directory the sandbox's root is mounted on
+	Dir      string `json:"dir"`                 // Host working directory, mounted at /work
+	CacheDir string `json:"cache_dir,omitempty"` // Host Go build cache, if the process needs it
+
+	Argv        []string `json:"argv"`
+	Env         []string `json:"env"`
+	CPUSeconds  uint64   `json:"cpu_seconds"`
+	MemoryBytes uint64   `json:"memory_bytes"`
+	FileBytes   uint64   `json:"file_bytes"`
+	Processes   uint64   `json:"processes"`
+}
+
+// Result is the outcome of a run
+type Result struct {
+	Language        string `json:"language"`
+	Stdout          string `json:"stdout"`
+	Stderr          string `json:"stderr"`
+	ExitCode        int    `json:"exit_code"`        // -1 when the process was killed by a signal
+	Phase           string `json:"phase"`            // "build" when compilation failed, otherwise "run"
+	DurationMs      int64  `json:"duration_ms"`      // Wall clock time of the phase that finished last
+	TimedOut        bool   `json:"timed_out"`        // Killed for exceeding the wall clock limit
+	OutputTruncated bool   `json:"output_truncated"` // Stdout or stderr exceeded the output limit
+}
+
+// Runner executes code in throwaway sandboxes, with a global and per-user
+// limit on concurrent runs. Each program runs as an unprivileged user with
+// its own root filesystem, process tree and network, and sees the host only
+// through read-only system directories.
+type Runner struct {
+	limits       Limits
+	slots        chan struct{}
+	maxPerUser   int
+	queueTimeout time.Duration
+	cacheDir     string
+
+	mu      sync.Mutex
+	running map[string]int
+}
+
+// NewRunner creates a Runner, filling unset configuration with defaults
+func NewRunner(cfg Config) *Runner {
+	if cfg.Limits == (Limits{}) {
+		cfg.Limits = DefaultLimits
+	}
+	if cfg.Limits.Processes <= 0 {
+		cfg.Limits.Processes = DefaultLimits.Processes
+	}
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = 4
+	}
+	if cfg.MaxPerUser <= 0 {
+		cfg.MaxPerUser = 1
+	}
+	if cfg.QueueTimeout <= 0 {
+		cfg.QueueTimeout = 5 * time.Second
+	}
+	if cfg.CacheDir == "" {
+		cfg.CacheDir = DefaultCacheDir
+	}
+
+	return &Runner{
+		limits:       cfg.Limits,
+		slots:        make(chan struct{}, cfg.MaxConcurrent),
+		maxPerUser:   cfg.MaxPerUser,
+		queueTimeout: cfg.QueueTimeout,
+		cacheDir:     cfg.CacheDir,
+		running:      map[string]int{},
+	}
+}
+
+// Limits returns the per-run limits
+func (r *Runner) Limits() Limits {
+	return r.limits
+}
+
+// MaxDuration is the longest a single run can take, including compilation
+func (r *Runner) MaxDuration() time.Duration {
+	return r.queueTimeout + buildTimeout + r.limits.Timeout
+}
+
+// Run executes req on behalf of userID. Errors are returned for requests
+// that could not be run at all; a failing program is reported in the Result.
+func (r *Runner) Run(ctx context.Context, userID string, req Request) (*Result, error) {
+	name, ok := Normalize(req.Language)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedLanguage, req.Language)
+	}
+	lang := languages[name]
+	if _, err := lookPath(lang.binary); err != nil {
+		return nil, fmt.Errorf("%w %q: %s is not installed", ErrUnsupportedLanguage, req.Language, lang.binary)
+	}
+	if len(req.Code) > MaxSourceBytes {
+		return nil, fmt.Errorf("%w: code exceeds %d bytes", ErrTooLarge, MaxSourceBytes)
+	}
+	if len(req.Stdin) > MaxStdinBytes {
+		return nil, fmt.Errorf("%w: stdin exceeds %d bytes", ErrTooLarge, MaxStdinBytes)
+	}
+
+	release, err := r.acquire(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// The run directory holds the working directory and the mount point
+	// for the sandbox's root, and is only accessible to the sandbox user
+	runDir, err := os.MkdirTemp("", "snippy-run-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create working directory: %v", err)
+	}
+	defer os.RemoveAll(runDir)
+
+	dir := filepath.Join(runDir, "work")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create working directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, lang.fileName), []byte(req.Code), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write source file: %v", err)
+	}
+	for _, d := range []string{runDir, dir} {
+		if err := prepareDir(d); err != nil {
+			return nil, err
+		}
+	}
+
+	// Paths are as seen inside the sandbox
+	env := []string{
+		"PATH=" + sandboxPath,
+		"HOME=/work",
+		"TMPDIR=/tmp",
+		"LANG=C.UTF-8",
+	}
+
+	if lang.build != nil {
+		// Builds read the shared cache through a private writable layer,
+		// so one user's build cannot plant entries for another's
+		if err := os.MkdirAll(r.cacheDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create build cache: %v", err)
+		}
+
+		buildEnv := append(env,
+			"GOCACHE=/cache",
+			"GOPATH=/tmp/gopath",
+			"GOPROXY=off",
+			"GOTOOLCHAIN=local",
+			"CGO_ENABLED=0",
+		)
+		buildLimits := r.limits
+		buildLimits.Timeout = buildTimeout
+		buildLimits.CPUTime = buildCPUTime
+		buildLimits.MemoryBytes = buildMemoryBytes
+		buildLimits.FileBytes = buildFileBytes
+		buildLimits.Processes = buildProcesses
+
+		result, err := execute(ctx, spec{Root: filepath.Join(runDir, "build-root"), Dir: dir, CacheDir: r.cacheDir, Argv: lang.build, Env: buildEnv}, "", buildLimits)
+		if err != nil {
+			return nil, err
+		}
+		if result.ExitCode != 0 || result.TimedOut {
+			result.Language = name
+			result.Phase = "build"
+			return result, nil
+		}
+	}
+
+	result, err := execute(ctx, spec{Root: filepath.Join(runDir, "root"), Dir: dir, Argv: lang.run, Env: env}, req.Stdin, r.limits)
+	if err != nil {
+		return nil, err
+	}
+	result.Language = name
+	result.Phase = "run"
+	return result, nil
+}
+
+// WarmCache builds the standard library into the shared Go build cache, so
+// runs, which only read it, do not compile it every time. The server runs
+// the build itself; no user code is involved. It does nothing when Go is
+// not installed.
+func (r *Runner) WarmCache(ctx context.Context) error {
+	goBinary, err := lookPath("go")
+	if err != nil {
+		return nil
+	}
+	if err := os.MkdirAll(r.cacheDir, 0755); err != nil {
+		return fmt.Errorf("failed to create build cache: %v", err)
+	}
+
+	cmd := exec.CommandContext(ctx, goBinary, "build", "std")
+	cmd.Env = append(os.Environ(),
+		"GOCACHE="+r.cacheDir,
+		"GOTOOLCHAIN=local",
+		"CGO_ENABLED=0",
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to warm build cache: %v: %s", err, output)
+	}
+	return nil
+}
+
+// acquire reserves a run slot for userID and returns the function that
+// releases it
+func (r *Runner) acquire(ctx context.Context, userID string) (func(), error) {
+	r.mu.Lock()
+	if r.running[userID] >= r.maxPerUser {
+		r.mu.Unlock()
+		return nil, ErrUserBusy
+	}
+	r.running[userID]++
+	r.mu.Unlock()
+
+	done := func() {
+		r.mu.Lock()
+		r.running[userID]--
+		if r.running[userID] == 0 {
+			delete(r.running, userID)
+		}
+		r.mu.Unlock()
+	}
+
+	timer := time.NewTimer(r.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case r.slots <- struct{}{}:
+		return func() {
+			<-r.slots
+			done()
+		}, nil
+	case <-timer.C:
+		done()
+		return nil, ErrBusy
+	case <-ctx.Done():
+		done()
+		return nil, ctx.Err()
+	}
+}
+
+// execute runs s in a new sandbox under the given limits
+func execute(ctx context.Context, s spec, stdin string, limits Limits) (*Result, error) {
+	if !strings.HasPrefix(s.Argv[0], "./") {
+		binary, err := lookPath(s.Argv[0])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupportedLanguage, err)
+		}
+		s.Argv = append([]string{binary}, s.Argv[1:]...)
+	}
+
+	// CPU time is rounded up to whole seconds, the granularity of the limit
+	s.CPUSeconds = uint64((limits.CPUTime + time.Second - 1) / time.Second)
+	s.MemoryBytes = uint64(limits.MemoryBytes)
+	s.FileBytes = uint64(limits.FileBytes)
+	s.Processes = uint64(limits.Processes)
+
+	ctx, cancel := context.WithTimeout(ctx, limits.Timeout)
+	defer cancel()
+
+	cmd, startCmd, err := isolated(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdin = strings.NewReader(stdin)
+
+	stdout := &cappedBuffer{limit: limits.OutputBytes}
+	stderr := &cappedBuffer{limit: limits.OutputBytes}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	if err := startCmd(); err != nil {
+		return nil, err
+	}
+	err = cmd.Wait()
+	elapsed := time.Since(start)
+
+	result := &Result{
+		Stdout:          stdout.String(),
+		Stderr:          stderr.String(),
+		DurationMs:      elapsed.Milliseconds(),
+		TimedOut:        ctx.Err() == context.DeadlineExceeded,
+		OutputTruncated: stdout.truncated || stderr.truncated,
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	case errors.Is(err, exec.ErrWaitDelay):
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	default:
+		return nil, fmt.Errorf("failed to run program: %v", err)
+	}
+
+	return result, nil
+}
+
+// cappedBuffer keeps the first limit bytes written to it and discards the
+// rest, so a chatty program never blocks on a full pipe
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) String() string {
+	return b.buf.String()
+}
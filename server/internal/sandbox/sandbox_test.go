@@ -0,0 +1,192 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// The test binary is re-executed as the sandbox init
+	Init()
+	os.Exit(m.Run())
+}
+
+// run executes a shell script, skipping the test where isolation is missing
+func run(t *testing.T, r *Runner, userID, code, stdin string) *Result {
+	t.Helper()
+	result, err := r.Run(context.Background(), userID, Request{Language: "sh", Code: code, Stdin: stdin})
+	if errors.Is(err, ErrIsolationUnavailable) {
+		t.Skipf("Sandbox isolation unavailable: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	return result
+}
+
+func testRunner(limits Limits) *Runner {
+	return NewRunner(Config{Limits: limits, CacheDir: "unused"})
+}
+
+func TestRunShell(t *testing.T) {
+	r := testRunner(DefaultLimits)
+	result := run(t, r, "user", "read name\necho \"hello $name\"\necho oops >&2\nexit 3\n", "world\n")
+
+	if result.Stdout != "hello world\n" || result.Stderr != "oops\n" || result.ExitCode != 3 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if result.Phase != "run" || result.Language != "shell" {
+		t.Errorf("Unexpected phase or language: %+v", result)
+	}
+}
+
+func TestRunHasNoNetwork(t *testing.T) {
+	r := testRunner(DefaultLimits)
+	result := run(t, r, "user", "tail -n +3 /proc/net/dev | cut -d: -f1 | tr -d ' '\n", "")
+
+	if strings.TrimSpace(result.Stdout) != "lo" {
+		t.Errorf("Expected only a loopback interface, got %q", result.Stdout)
+	}
+}
+
+func TestRunIsolatesFilesystem(t *testing.T) {
+	r := testRunner(DefaultLimits)
+	result := run(t, r, "user", `cat /proc/self/uid_map
+ls /
+ls /proc | grep -c '^[0-9]'
+touch /usr/sandbox-test 2>/dev/null && echo usr is writable
+echo ok > /work/out && cat /work/out
+`, "")
+
+	lines := strings.Split(strings.TrimSpace(result.Stdout), "\n")
+	if len(lines) == 0 || strings.Join(strings.Fields(lines[0]), " ") != "0 65534 1" {
+		t.Errorf("Expected root in the sandbox to be nobody on the host, got %q", result.Stdout)
+	}
+	if strings.Contains(result.Stdout, "root\n") || strings.Contains(result.Stdout, "home\n") {
+		t.Errorf("Host directories are visible: %q", result.Stdout)
+	}
+	if strings.Contains(result.Stdout, "writable") {
+		t.Error("System directories are writable")
+	}
+	if !strings.HasSuffix(result.Stdout, "ok\n") {
+		t.Errorf("Working directory is not writable: %+v", result)
+	}
+}
+
+func TestRunProcessLimit(t *testing.T) {
+	limits := DefaultLimits
+	limits.Processes = 5
+	r := testRunner(limits)
+
+	result := run(t, r, "user", "i=0; while [ $i -lt 20 ]; do sleep 1 & i=$((i+1)); done; wait\n", "")
+
+	if !strings.Contains(strings.ToLower(result.Stderr), "fork") {
+		t.Errorf("Expected fork to fail, got %+v", result)
+	}
+}
+
+func TestRunGoUsesPrivateCacheLayer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Warming the build cache is slow")
+	}
+	if _, err := lookPath("go"); err != nil {
+		t.Skip("Go is not installed")
+	}
+	// The cache and its parent must be searchable by the sandbox user
+	cacheDir := t.TempDir()
+	for _, dir := range []string{cacheDir, filepath.Dir(cacheDir)} {
+		if err := os.Chmod(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := NewRunner(Config{Limits: DefaultLimits, CacheDir: cacheDir})
+	if err := r.WarmCache(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	before, err := filepath.Glob(filepath.Join(cacheDir, "*", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := r.Run(context.Background(), "user", Request{Language: "go", Code: "package main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(\"hi\") }\n"})
+	if errors.Is(err, ErrIsolationUnavailable) {
+		t.Skipf("Sandbox isolation unavailable: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Stdout != "hi\n" {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+
+	after, err := filepath.Glob(filepath.Join(cacheDir, "*", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Errorf("The run wrote %d entries to the shared cache", len(after)-len(before))
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	limits := DefaultLimits
+	limits.Timeout = 500 * time.Millisecond
+	r := testRunner(limits)
+
+	start := time.Now()
+	result := run(t, r, "user", "sleep 30 & sleep 30\n", "")
+
+	if !result.TimedOut || result.ExitCode == 0 {
+		t.Errorf("Expected a timeout, got %+v", result)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run took %v after the timeout", elapsed)
+	}
+}
+
+func TestRunTruncatesOutput(t *testing.T) {
+	limits := DefaultLimits
+	limits.OutputBytes = 100
+	r := testRunner(limits)
+
+	result := run(t, r, "user", "i=0; while [ $i -lt 1000 ]; do echo line $i; i=$((i+1)); done\n", "")
+
+	if !result.OutputTruncated || len(result.Stdout) != 100 || result.ExitCode != 0 {
+		t.Errorf("Expected 100 bytes of truncated output, got %d bytes: %+v", len(result.Stdout), result.OutputTruncated)
+	}
+}
+
+func TestRunConcurrencyLimits(t *testing.T) {
+	r := NewRunner(Config{Limits: DefaultLimits, MaxConcurrent: 1, MaxPerUser: 1, QueueTimeout: 50 * time.Millisecond})
+
+	release, err := r.acquire(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	if _, err := r.acquire(context.Background(), "alice"); !errors.Is(err, ErrUserBusy) {
+		t.Errorf("Expected ErrUserBusy, got %v", err)
+	}
+	if _, err := r.acquire(context.Background(), "bob"); !errors.Is(err, ErrBusy) {
+		t.Errorf("Expected ErrBusy, got %v", err)
+	}
+
+	release()
+	release, err = r.acquire(context.Background(), "bob")
+	if err != nil {
+		t.Fatalf("acquire after release failed: %v", err)
+	}
+	release()
+}
+
+func TestRunRejectsUnknownLanguage(t *testing.T) {
+	_, err := testRunner(DefaultLimits).Run(context.Background(), "user", Request{Language: "cobol", Code: "x"})
+	if !errors.Is(err, ErrUnsupportedLanguage) {
+		t.Errorf("Expected ErrUnsupportedLanguage, got %v", err)
+	}
+}
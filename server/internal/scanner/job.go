@@ -0,0 +1,169 @@
+package scanner
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"snippy-server/internal/notifications"
+)
+
+// SystemActor is the actor recorded on notifications raised by the scan job
+const SystemActor = "system"
+
+// Execer is implemented by both *sql.DB and *sql.Tx
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Record stores the scan result for the current version of a snippet, so the
+// background job does not scan it again. overridden marks findings the owner
+// chose to publish anyway.
+func Record(q Execer, snippetID string, findings []Finding, overridden bool) error {
+	if findings == nil {
+		findings = []Finding{}
+	}
+	payload, err := json.Marshal(findings)
+	if err != nil {
+		return fmt.Errorf("failed to encode scan findings: %v", err)
+	}
+
+	_, err = q.Exec(`
+		INSERT INTO snippet_secret_scans (snippet_id, version, findings, overridden, scanned_at)
+		SELECT id, version, $2, $3, now() FROM snippets WHERE id = $1
+		ON CONFLICT (snippet_id) DO UPDATE
+		SET version = EXCLUDED.version, findings = EXCLUDED.findings,
+		    overridden = EXCLUDED.overridden, scanned_at = EXCLUDED.scanned_at`,
+		snippetID, payload, overridden)
+	if err != nil {
+		return fmt.Errorf("failed to record secret scan: %v", err)
+	}
+	return nil
+}
+
+// Job scans public snippets that were published before scanning existed, or
+// changed without passing through the API checks, and notifies their owners
+type Job struct {
+	DB        *sql.DB
+	Interval  time.Duration
+	BatchSize int
+}
+
+// NewJob creates a job with the default batch size and interval
+func NewJob(db *sql.DB) *Job {
+	return &Job{
+		DB:        db,
+		Interval:  time.Minute,
+		BatchSize: 100,
+	}
+}
+
+// Run scans batches until ctx is cancelled. Full batches are followed
+// immediately by the next one so a backlog drains quickly.
+func (j *Job) Run(ctx context.Context) {
+	for {
+		n, err := j.ScanBatch(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "secret scan job failed", "error", err)
+		}
+
+		wait := j.Interval
+		if err == nil && n == j.BatchSize {
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// pendingSnippet is a public snippet whose current version has not been scanned
+type pendingSnippet struct {
+	id      string
+	userID  string
+	title   string
+	content string
+}
+
+// ScanBatch scans up to BatchSize unscanned public snippets. It returns the
+// number of snippets scanned successfully.
+func (j *Job) ScanBatch(ctx context.Context) (int, error) {
+	rows, err := j.DB.QueryContext(ctx, `
+		SELECT s.id, s.user_id, s.title, s.content
+		FROM snippets s
+		LEFT JOIN snippet_secret_scans sc ON sc.snippet_id = s.id
+		WHERE s.is_public = true AND (sc.snippet_id IS NULL OR sc.version <> s.version)
+		ORDER BY s.updated_at
+		LIMIT $1`,
+		j.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch unscanned snippets: %v", err)
+	}
+
+	var batch []pendingSnippet
+	for rows.Next() {
+		var s pendingSnippet
+		if err := rows.Scan(&s.id, &s.userID, &s.title, &s.content); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan snippet: %v", err)
+		}
+		batch = append(batch, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to iterate snippets: %v", err)
+	}
+
+	scanned := 0
+	for _, s := range batch {
+		if err := j.scan(ctx, s); err != nil {
+			slog.ErrorContext(ctx, "secret scan failed", "snippet_id", s.id, "error", err)
+			continue
+		}
+		scanned++
+	}
+
+	return scanned, nil
+}
+
+// scan records the result for one snippet and tells its owner about findings
+func (j *Job) scan(ctx context.Context, s pendingSnippet) error {
+	findings := Scan(s.content)
+
+	tx, err := j.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := Record(tx, s.id, findings, false); err != nil {
+		return err
+	}
+
+	if len(findings) == 0 {
+		return tx.Commit()
+	}
+
+	rules := make([]string, len(findings))
+	for i, f := range findings {
+		rules[i] = f.Rule
+	}
+	_, err = notifications.Create(tx, s.userID, SystemActor, notifications.TypeSecretsDetected, &s.id, map[string]interface{}{
+		"snippet_title": s.title,
+		"findings":      len(findings),
+		"rules":         rules,
+	})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,240 @@
+// Package scanner finds credentials and other secrets in snippet content
+// before it is shared.
+package scanner
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Finding is a suspected secret in scanned content
+type Finding struct {
+	Rule        string `json:"rule"`
+	Description string `json:"description"`
+	Line        int    `json:"line"`   // 1-based
+	Column      int    `json:"column"` // 1-based, in characters
+	Match       string `json:"match"`  // Redacted excerpt of the secret
+}
+
+// rule matches one kind of secret. When the pattern has a capture group, the
+// first group is the secret itself and the rest of the match is context.
+type rule struct {
+	id          string
+	description string
+	pattern     *regexp.Regexp
+	minEntropy  float64 // Skip matches that look too regular to be real keys
+	keepMatch   bool    // The match is not sensitive (e.g. a PEM header)
+}
+
+// rules are checked in order; a later rule never reports a span that an
+// earlier, more specific rule already reported
+var rules = []rule{
+	{
+		id:          "private-key",
+		description: "Private key block",
+		pattern:     regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----`),
+		keepMatch:   true,
+	},
+	{
+		id:          "aws-access-key-id",
+		description: "AWS access key ID",
+		pattern:     regexp.MustCompile(`\b((?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16})\b`),
+	},
+	{
+		id:          "aws-secret-access-key",
+		description: "AWS secret access key",
+		pattern:     regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`),
+	},
+	{
+		id:          "github-token",
+		description: "GitHub token",
+		pattern:     regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`),
+	},
+	{
+		id:          "gitlab-token",
+		description: "GitLab personal access token",
+		pattern:     regexp.MustCompile(`\b(glpat-[A-Za-z0-9_-]{20,})\b`),
+	},
+	{
+		id:          "slack-token",
+		description: "Slack token",
+		pattern:     regexp.MustCompile(`\b(xox[baprs]-[A-Za-z0-9-]{10,})\b`),
+	},
+	{
+		id:          "slack-webhook",
+		description: "Slack incoming webhook URL",
+		pattern:     regexp.MustCompile(`https://hooks\.slack\.com/services/(T[A-Za-z0-9]+/B[A-Za-z0-9]+/[A-Za-z0-9]+)`),
+	},
+	{
+		id:          "stripe-secret-key",
+		description: "Stripe live secret key",
+		pattern:     regexp.MustCompile(`\b((?:sk|rk)_live_[A-Za-z0-9]{20,})\b`),
+	},
+	{
+		id:          "google-api-key",
+		description: "Google API key",
+		pattern:     regexp.MustCompile(`\b(AIza[0-9A-Za-z_-]{35})\b`),
+	},
+	{
+		id:          "jwt",
+		description: "JSON Web Token",
+		pattern:     regexp.MustCompile(`\b(eyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,})`),
+	},
+	{
+		id:          "url-credentials",
+		description: "Password in connection URL",
+		pattern:     regexp.MustCompile(`\b[a-z][a-z0-9+.-]*://[^\s:/@'"]+:([^\s@/'"]{3,})@`),
+	},
+	{
+		// Covers .env files and config assignments such as DB_PASSWORD=... or
+		// "apiKey": "...". Values must look random so code like
+		// password = getPassword() is not reported.
+		id:          "secret-assignment",
+		description: "Secret assigned to a credential-like name",
+		pattern:     regexp.MustCompile(`(?i)[a-z0-9_.-]*(?:secret|token|passw(?:or)?d|pwd|api_?key|access_?key|private_?key|credentials?)[a-z0-9_.-]*["']?\s*[:=]\s*["']?([^\s"'` + "`" + `#;,(){}\[\]<>]{8,})`),
+		minEntropy:  3.0,
+	},
+	{
+		id:          "high-entropy-string",
+		description: "High-entropy string",
+		pattern:     regexp.MustCompile(`[A-Za-z0-9+/_=-]{32,}`),
+		minEntropy:  4.5,
+	},
+}
+
+// placeholders mark values that are obviously not real secrets
+var placeholders = []string{
+	"example", "sample", "xxxx", "your", "changeme", "change_me", "placeholder",
+	"dummy", "redacted", "****", "...", "${", "{{", "<", "process.env", "os.environ",
+}
+
+// defaultValues are well-known development credentials, matched exactly
+var defaultValues = map[string]bool{
+	"password": true, "passwd": true, "pass": true, "secret": true, "admin": true,
+	"root": true, "postgres": true, "test": true, "guest": true,
+}
+
+// Scan returns the suspected secrets in content in order of appearance
+func Scan(content string) []Finding {
+	type span struct{ start, end int }
+	var taken []span
+	overlaps := func(start, end int) bool {
+		for _, s := range taken {
+			if start < s.end && s.start < end {
+				return true
+			}
+		}
+		return false
+	}
+
+	var found []struct {
+		offset  int
+		finding Finding
+	}
+
+	for _, r := range rules {
+		for _, m := range r.pattern.FindAllStringSubmatchIndex(content, -1) {
+			start, end := m[0], m[1]
+			if len(m) > 2 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			secret := content[start:end]
+
+			if overlaps(start, end) || isPlaceholder(secret) {
+				continue
+			}
+			if r.minEntropy > 0 && (entropy(secret) < r.minEntropy || !looksRandom(secret)) {
+				continue
+			}
+
+			taken = append(taken, span{start, end})
+			line, column := position(content, start)
+			match := secret
+			if !r.keepMatch {
+				match = redact(secret)
+			}
+			found = append(found, struct {
+				offset  int
+				finding Finding
+			}{start, Finding{Rule: r.id, Description: r.description, Line: line, Column: column, Match: match}})
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool { return found[i].offset < found[j].offset })
+	findings := make([]Finding, len(found))
+	for i, f := range found {
+		findings[i] = f.finding
+	}
+	return findings
+}
+
+// isPlaceholder reports whether a matched value is documentation filler
+func isPlaceholder(value string) bool {
+	lower := strings.ToLower(value)
+	if defaultValues[lower] {
+		return true
+	}
+	for _, p := range placeholders {
+		if strings.Contains(lower, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// looksRandom requires a mix of character classes, which identifiers and
+// words rarely have
+func looksRandom(s string) bool {
+	var upper, lower, digit bool
+	for _, r := range s {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= '0' && r <= '9':
+			digit = true
+		}
+	}
+	return digit && (upper || lower)
+}
+
+// entropy returns the Shannon entropy of s in bits per character
+func entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// position converts a byte offset to a 1-based line and character column
+func position(content string, offset int) (int, int) {
+	before := content[:offset]
+	line := strings.Count(before, "\n") + 1
+	lineStart := strings.LastIndexByte(before, '\n') + 1
+	return line, utf8.RuneCountInString(before[lineStart:]) + 1
+}
+
+// redact keeps a short prefix so the user can recognise which value was found
+func redact(secret string) string {
+	runes := []rune(secret)
+	keep := 4
+	if len(runes) <= 8 {
+		keep = 2
+	}
+	return string(runes[:keep]) + strings.Repeat("*", 8)
+}
@@ -0,0 +1,120 @@
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// languageAliases maps the names clients commonly send to the escaping
+// rules used for them
+var languageAliases = map[string]string{
+	"":           "text",
+	"text":       "text",
+	"plaintext":  "text",
+	"markdown":   "text",
+	"md":         "text",
+	"shell":      "shell",
+	"sh":         "shell",
+	"bash":       "shell",
+	"zsh":        "shell",
+	"go":         "go",
+	"golang":     "go",
+	"javascript": "c",
+	"js":         "c",
+	"typescript": "c",
+	"ts":         "c",
+	"python":     "c",
+	"py":         "c",
+	"java":       "c",
+	"c":          "c",
+	"cpp":        "c",
+	"c++":        "c",
+	"csharp":     "c",
+	"c#":         "c",
+	"rust":       "c",
+	"php":        "c",
+	"ruby":       "c",
+	"json":       "json",
+	"sql":        "sql",
+	"html":       "html",
+	"xml":        "html",
+}
+
+// Languages lists the target languages accepted by Render
+func Languages() []string {
+	names := make([]string, 0, len(languageAliases))
+	for name := range languageAliases {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// escaperFor returns the function used to escape string values for language
+func escaperFor(language string) (func(string) string, error) {
+	rules, ok := languageAliases[strings.ToLower(strings.TrimSpace(language))]
+	if !ok {
+		return nil, fmt.Errorf("unsupported template language %q (supported: %s)", language, strings.Join(Languages(), ", "))
+	}
+
+	switch rules {
+	case "shell":
+		return escapeShell, nil
+	case "go":
+		return escapeGo, nil
+	case "c":
+		return escapeC, nil
+	case "json":
+		return escapeJSON, nil
+	case "sql":
+		return func(s string) string { return strings.ReplaceAll(s, "'", "''") }, nil
+	case "html":
+		return html.EscapeString, nil
+	}
+	return func(s string) string { return s }, nil
+}
+
+// shellSafe matches words that need no quoting in POSIX shells
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// escapeShell single-quotes values containing shell metacharacters
+func escapeShell(s string) string {
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// escapeGo escapes a value for use inside a Go interpreted string literal
+func escapeGo(s string) string {
+	quoted := strconv.Quote(s)
+	return quoted[1 : len(quoted)-1]
+}
+
+// cEscaper escapes a value for use inside single- or double-quoted string
+// literals in C-like languages
+var cEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	`'`, `\'`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+)
+
+func escapeC(s string) string {
+	return cEscaper.Replace(s)
+}
+
+// escapeJSON escapes a value for use inside a JSON string
+func escapeJSON(s string) string {
+	encoded, _ := json.Marshal(s)
+	return string(encoded[1 : len(encoded)-1])
+}
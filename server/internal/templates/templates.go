@@ -0,0 +1,309 @@
+package templates
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Placeholder types
+const (
+	TypeString = "string"
+	TypeInt    = "int"
+	TypeFloat  = "float"
+	TypeBool   = "bool"
+	TypeChoice = "choice"
+)
+
+// Placeholder is a typed value declared in snippet content, e.g. {{name}},
+// {{port:int=8080}} or {{env:dev|staging|prod=dev}}
+type Placeholder struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Choices  []string `json:"choices,omitempty"`
+	Default  *string  `json:"default,omitempty"`
+	Required bool     `json:"required"`
+
+	declared bool // Whether a type or default was given, rather than a bare reference
+}
+
+// Template is parsed snippet content
+type Template struct {
+	Placeholders []*Placeholder
+
+	segments []segment
+	byName   map[string]*Placeholder
+}
+
+// segment is either literal text or a reference to a placeholder
+type segment struct {
+	text        string
+	placeholder *Placeholder
+}
+
+// ValidationError lists the placeholders whose supplied values were rejected
+type ValidationError struct {
+	Fields map[string]string `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + ": " + e.Fields[name]
+	}
+	return "invalid template values: " + strings.Join(parts, "; ")
+}
+
+// placeholderPattern matches the inside of {{ ... }}: a name, an optional
+// type or choice list after ':' and an optional default after '='
+var placeholderPattern = regexp.MustCompile(`(?s)^([A-Za-z_][A-Za-z0-9_]*)\s*(?::([^=]*))?(?:=(.*))?$`)
+
+// Parse extracts the placeholders from content. Text between braces that is
+// not a valid placeholder name is left untouched, and \{{ produces a literal {{.
+func Parse(content string) (*Template, error) {
+	t := &Template{byName: map[string]*Placeholder{}}
+	var literal strings.Builder
+
+	rest := content
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			literal.WriteString(rest)
+			break
+		}
+
+		// An escaped opening brace is emitted without the backslash
+		if start > 0 && rest[start-1] == '\\' {
+			literal.WriteString(rest[:start-1])
+			literal.WriteString("{{")
+			rest = rest[start+2:]
+			continue
+		}
+
+		end := strings.Index(rest[start+2:], "}}")
+		if end < 0 {
+			literal.WriteString(rest)
+			break
+		}
+		end += start + 2
+
+		p, err := parsePlaceholder(rest[start+2 : end])
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			literal.WriteString(rest[:end+2])
+			rest = rest[end+2:]
+			continue
+		}
+
+		literal.WriteString(rest[:start])
+		t.flush(&literal)
+
+		p, err = t.declare(p)
+		if err != nil {
+			return nil, err
+		}
+		t.segments = append(t.segments, segment{placeholder: p})
+		rest = rest[end+2:]
+	}
+	t.flush(&literal)
+
+	return t, nil
+}
+
+// flush appends any pending literal text as a segment
+func (t *Template) flush(literal *strings.Builder) {
+	if literal.Len() > 0 {
+		t.segments = append(t.segments, segment{text: literal.String()})
+		literal.Reset()
+	}
+}
+
+// declare registers p, merging it with earlier occurrences of the same name.
+// A bare {{name}} refers to a declaration made anywhere else in the content.
+func (t *Template) declare(p *Placeholder) (*Placeholder, error) {
+	existing, ok := t.byName[p.Name]
+	if !ok {
+		t.byName[p.Name] = p
+		t.Placeholders = append(t.Placeholders, p)
+		return p, nil
+	}
+	if !p.declared {
+		return existing, nil
+	}
+	if !existing.declared {
+		*existing = *p
+		return existing, nil
+	}
+	if !samePlaceholder(existing, p) {
+		return nil, fmt.Errorf("placeholder %q is declared more than once with different types or defaults", p.Name)
+	}
+	return existing, nil
+}
+
+// parsePlaceholder parses the text between {{ and }}. It returns nil without
+// an error when the text is not meant as a placeholder.
+func parsePlaceholder(inner string) (*Placeholder, error) {
+	m := placeholderPattern.FindStringSubmatch(strings.TrimSpace(inner))
+	if m == nil {
+		return nil, nil
+	}
+
+	p := &Placeholder{Name: m[1], Type: TypeString}
+	spec := strings.TrimSpace(m[2])
+	hasDefault := strings.Contains(strings.TrimSpace(inner)[len(m[1]):], "=")
+
+	switch {
+	case spec == "":
+	case strings.Contains(spec, "|"):
+		p.Type = TypeChoice
+		for _, choice := range strings.Split(spec, "|") {
+			choice = strings.TrimSpace(choice)
+			if choice == "" {
+				return nil, fmt.Errorf("placeholder %q has an empty choice", p.Name)
+			}
+			p.Choices = append(p.Choices, choice)
+		}
+	case spec == TypeString, spec == TypeInt, spec == TypeFloat, spec == TypeBool:
+		p.Type = spec
+	default:
+		return nil, fmt.Errorf("placeholder %q has unknown type %q", p.Name, spec)
+	}
+
+	if hasDefault {
+		def := strings.TrimSpace(m[3])
+		normalized, err := p.validate(def)
+		if err != nil {
+			return nil, fmt.Errorf("placeholder %q has an invalid default: %v", p.Name, err)
+		}
+		p.Default = &normalized
+	}
+
+	p.Required = p.Default == nil
+	p.declared = spec != "" || hasDefault
+	return p, nil
+}
+
+// validate checks value against the placeholder type and returns it in
+// canonical form
+func (p *Placeholder) validate(value string) (string, error) {
+	switch p.Type {
+	case TypeInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("must be an integer")
+		}
+		return strconv.FormatInt(n, 10), nil
+	case TypeFloat:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", fmt.Errorf("must be a number")
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case TypeBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("must be true or false")
+		}
+		return strconv.FormatBool(b), nil
+	case TypeChoice:
+		for _, choice := range p.Choices {
+			if choice == value {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("must be one of %s", strings.Join(p.Choices, ", "))
+	}
+	return value, nil
+}
+
+// samePlaceholder reports whether two declarations agree
+func samePlaceholder(a, b *Placeholder) bool {
+	if a.Type != b.Type || strings.Join(a.Choices, "|") != strings.Join(b.Choices, "|") {
+		return false
+	}
+	if (a.Default == nil) != (b.Default == nil) {
+		return false
+	}
+	return a.Default == nil || *a.Default == *b.Default
+}
+
+// Render validates values and expands the template. String and choice
+// values are escaped for language; numbers and booleans are validated and
+// inserted as-is. Unknown or invalid values produce a *ValidationError.
+func (t *Template) Render(values map[string]interface{}, language string) (string, error) {
+	escape, err := escaperFor(language)
+	if err != nil {
+		return "", err
+	}
+
+	errs := map[string]string{}
+	resolved := make(map[string]string, len(t.Placeholders))
+
+	for name := range values {
+		if _, ok := t.byName[name]; !ok {
+			errs[name] = "unknown placeholder"
+		}
+	}
+
+	for _, p := range t.Placeholders {
+		raw, ok := values[p.Name]
+		if !ok || raw == nil {
+			if p.Default == nil {
+				errs[p.Name] = "is required"
+				continue
+			}
+			resolved[p.Name] = *p.Default
+			continue
+		}
+
+		value, err := p.validate(stringify(raw))
+		if err != nil {
+			errs[p.Name] = err.Error()
+			continue
+		}
+		resolved[p.Name] = value
+	}
+
+	if len(errs) > 0 {
+		return "", &ValidationError{Fields: errs}
+	}
+
+	var sb strings.Builder
+	for _, seg := range t.segments {
+		if seg.placeholder == nil {
+			sb.WriteString(seg.text)
+			continue
+		}
+		value := resolved[seg.placeholder.Name]
+		if seg.placeholder.Type == TypeString || seg.placeholder.Type == TypeChoice {
+			value = escape(value)
+		}
+		sb.WriteString(value)
+	}
+
+	return sb.String(), nil
+}
+
+// stringify converts a decoded JSON value to the text form validated by the
+// placeholder types
+func stringify(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,117 @@
+package templates
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParsePlaceholders(t *testing.T) {
+	tmpl, err := Parse("{{host}}:{{ port:int=8080 }} {{env:dev|staging|prod=dev}} {{host}} {{.Go}} \\{{literal}}")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(tmpl.Placeholders) != 3 {
+		t.Fatalf("Expected 3 placeholders, got %d", len(tmpl.Placeholders))
+	}
+
+	host, port, env := tmpl.Placeholders[0], tmpl.Placeholders[1], tmpl.Placeholders[2]
+	if host.Type != TypeString || !host.Required {
+		t.Errorf("host = %+v, want required string", host)
+	}
+	if port.Type != TypeInt || port.Default == nil || *port.Default != "8080" || port.Required {
+		t.Errorf("port = %+v, want int defaulting to 8080", port)
+	}
+	if env.Type != TypeChoice || len(env.Choices) != 3 || *env.Default != "dev" {
+		t.Errorf("env = %+v, want choice defaulting to dev", env)
+	}
+
+	got, err := tmpl.Render(map[string]interface{}{"host": "localhost", "port": float64(9000)}, "text")
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	want := "localhost:9000 dev localhost {{.Go}} {{literal}}"
+	if got != want {
+		t.Errorf("Render = %q, want %q", got, want)
+	}
+}
+
+func TestParseRejectsBadDeclarations(t *testing.T) {
+	for _, content := range []string{
+		"{{port:int=abc}}",
+		"{{port:integer}}",
+		"{{env:dev||prod}}",
+		"{{port:int=1}} {{port:int=2}}",
+	} {
+		if _, err := Parse(content); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", content)
+		}
+	}
+}
+
+func TestBareReferenceAdoptsLaterDeclaration(t *testing.T) {
+	tmpl, err := Parse("{{n}} then {{n:int=3}}")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	got, err := tmpl.Render(nil, "")
+	if err != nil || got != "3 then 3" {
+		t.Errorf("Render = %q, %v", got, err)
+	}
+}
+
+func TestRenderValidation(t *testing.T) {
+	tmpl, err := Parse("{{name}} {{port:int}} {{debug:bool=false}} {{env:dev|prod=dev}}")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	_, err = tmpl.Render(map[string]interface{}{"port": "eighty", "env": "qa", "extra": 1}, "text")
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+	for _, field := range []string{"name", "port", "env", "extra"} {
+		if _, ok := verr.Fields[field]; !ok {
+			t.Errorf("Expected an error for %q, got %v", field, verr.Fields)
+		}
+	}
+	if _, ok := verr.Fields["debug"]; ok {
+		t.Error("debug has a default and should not be reported")
+	}
+}
+
+func TestRenderEscaping(t *testing.T) {
+	tmpl, err := Parse("{{v}}")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	cases := []struct {
+		language string
+		value    string
+		want     string
+	}{
+		{"bash", "safe/path.txt", "safe/path.txt"},
+		{"bash", "it's $HOME", `'it'\''s $HOME'`},
+		{"python", "say \"hi\"\n", `say \"hi\"\n`},
+		{"go", "it's \"x\"", `it's \"x\"`},
+		{"json", "a\"b\\", `a\"b\\`},
+		{"sql", "O'Brien", "O''Brien"},
+		{"html", "<b>&</b>", "&lt;b&gt;&amp;&lt;/b&gt;"},
+		{"markdown", "<raw>", "<raw>"},
+	}
+	for _, c := range cases {
+		got, err := tmpl.Render(map[string]interface{}{"v": c.value}, c.language)
+		if err != nil {
+			t.Errorf("Render(%s) failed: %v", c.language, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("Render(%s, %q) = %q, want %q", c.language, c.value, got, c.want)
+		}
+	}
+
+	if _, err := tmpl.Render(map[string]interface{}{"v": "x"}, "cobol"); err == nil {
+		t.Error("Expected an error for an unsupported language")
+	}
+}
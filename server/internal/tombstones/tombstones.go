@@ -0,0 +1,76 @@
+// Package tombstones keeps the record of deleted rows that delta sync
+// reports to clients, and prunes it once it is old enough that clients
+// still behind are better off starting over.
+package tombstones
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Querier is implemented by both *sql.DB and *sql.Tx
+type Querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Bounds returns the sequence number of userID's latest change and the
+// highest of their pruned tombstones, both zero for users without changes.
+// Clients that last synced before pruned may have missed deletions.
+func Bounds(ctx context.Context, q Querier, userID string) (current, pruned int64, err error) {
+	err = q.QueryRowContext(ctx, `SELECT seq, pruned_seq FROM sync_counters WHERE user_id = $1`, userID).Scan(&current, &pruned)
+	if err == sql.ErrNoRows {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read sync bounds: %w", err)
+	}
+	return current, pruned, nil
+}
+
+// Pruner deletes tombstones older than Retention, raising each user's
+// horizon past them
+type Pruner struct {
+	DB        *sql.DB
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+// NewPruner creates a pruner that runs every hour
+func NewPruner(db *sql.DB, retention time.Duration) *Pruner {
+	return &Pruner{DB: db, Retention: retention, Interval: time.Hour}
+}
+
+// Run prunes tombstones until ctx is cancelled
+func (p *Pruner) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Prune(ctx); err != nil {
+			slog.ErrorContext(ctx, "failed to prune sync tombstones", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune deletes tombstones older than the retention in one transaction
+func (p *Pruner) Prune(ctx context.Context) error {
+	_, err := p.DB.ExecContext(ctx, `
+		WITH pruned AS (
+			DELETE FROM sync_tombstones WHERE deleted_at < $1
+			RETURNING user_id, seq
+		)
+		UPDATE sync_counters c
+		SET pruned_seq = GREATEST(c.pruned_seq, p.seq)
+		FROM (SELECT user_id, MAX(seq) AS seq FROM pruned GROUP BY user_id) p
+		WHERE c.user_id = p.user_id`, time.Now().Add(-p.Retention))
+	return err
+}
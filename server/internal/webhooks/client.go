@@ -0,0 +1,156 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrDestinationNotAllowed is returned for endpoints on loopback, private,
+// link-local and other non-public addresses, which would let users reach
+// the server's internal network
+var ErrDestinationNotAllowed = errors.New("destination address is not allowed")
+
+// blockedPrefixes are the special-purpose ranges webhooks may not target,
+// in addition to what the netip predicates cover
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "This network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),   // Benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),     // Reserved, and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, which maps to IPv4
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // Local-use NAT64
+	netip.MustParsePrefix("2002::/16"),       // 6to4, which embeds IPv4
+	netip.MustParsePrefix("fec0::/10"),       // Deprecated site-local
+	netip.MustParsePrefix("100::/64"),        // Discard-only
+	netip.MustParsePrefix("2001:db8::/32"),   // Documentation
+	netip.MustParsePrefix("192.0.2.0/24"),    // Documentation
+	netip.MustParsePrefix("198.51.100.0/24"), // Documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // Documentation
+}
+
+// IsPublicAddress reports whether webhooks may be delivered to addr
+func IsPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateURL requires an absolute http(s) URL whose host does not resolve
+// to a non-public address. The check is repeated for every connection,
+// since DNS answers can change after validation.
+func ValidateURL(ctx context.Context, raw string) error {
+	if raw == "" {
+		return fmt.Errorf("Webhook URL is required")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("Webhook URL must be an absolute http or https URL")
+	}
+	if u.User != nil {
+		return fmt.Errorf("Webhook URL must not contain credentials")
+	}
+
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil {
+		if !IsPublicAddress(addr) {
+			return fmt.Errorf("Webhook URL must not point to a private or local address")
+		}
+		return nil
+	}
+
+	// Hosts that do not resolve yet are accepted; deliveries fail until
+	// they do
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if !IsPublicAddress(addr) {
+			return fmt.Errorf("Webhook URL must not point to a private or local address")
+		}
+	}
+	return nil
+}
+
+// NewClient returns the HTTP client used for deliveries. It connects only
+// to public addresses, checked after DNS resolution so rebinding a name to
+// an internal address does not help, ignores proxy settings, which would
+// hide the destination, and does not follow redirects.
+func NewClient(timeout time.Duration) *http.Client {
+	return newClient(timeout, IsPublicAddress)
+}
+
+func newClient(timeout time.Duration, allowed func(netip.Addr) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !allowed(addrPort.Addr()) {
+				return ErrDestinationNotAllowed
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			// The 3xx response is returned and recorded as a failure
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// DeliveryError is a failed delivery. Error returns a generic reason that
+// is safe to show the webhook's owner; the underlying transport error,
+// which can reveal details of the network, is only logged.
+type DeliveryError struct {
+	Reason string
+	Err    error
+}
+
+func (e *DeliveryError) Error() string { return e.Reason }
+
+func (e *DeliveryError) Unwrap() error { return e.Err }
+
+// transportError classifies an error from sending a request
+func transportError(err error) *DeliveryError {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrDestinationNotAllowed):
+		return &DeliveryError{Reason: ErrDestinationNotAllowed.Error(), Err: err}
+	case errors.As(err, &dnsErr):
+		return &DeliveryError{Reason: "could not resolve host", Err: err}
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return &DeliveryError{Reason: "request timed out", Err: err}
+	default:
+		return &DeliveryError{Reason: "request failed", Err: err}
+	}
+}
@@ -0,0 +1,198 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Event types that can be delivered to webhooks
+const (
+	EventSnippetCreated    = "snippet.created"
+	EventSnippetUpdated    = "snippet.updated"
+	EventSnippetDeleted    = "snippet.deleted"
+	EventSnippetForked     = "snippet.forked"
+	EventCollectionCreated = "collection.created"
+	EventCollectionUpdated = "collection.updated"
+	EventCollectionDeleted = "collection.deleted"
+)
+
+// Events lists every event a webhook can subscribe to
+var Events = []string{
+	EventSnippetCreated,
+	EventSnippetUpdated,
+	EventSnippetDeleted,
+	EventSnippetForked,
+	EventCollectionCreated,
+	EventCollectionUpdated,
+	EventCollectionDeleted,
+}
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Snippy-Event"
+	HeaderDelivery  = "X-Snippy-Delivery"
+	HeaderSignature = "X-Snippy-Signature"
+)
+
+// Querier is implemented by both *sql.DB and *sql.Tx so events can be
+// written to the outbox in the same transaction as the change itself
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// IsValidSubscription reports whether pattern is a known event, a
+// "<resource>.*" wildcard or "*"
+func IsValidSubscription(pattern string) bool {
+	if pattern == "*" {
+		return true
+	}
+	for _, event := range Events {
+		if event == pattern || matches(pattern, event) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether a subscription pattern covers event
+func matches(pattern, event string) bool {
+	if pattern == "*" || pattern == event {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, ".*"); ok {
+		return strings.HasPrefix(event, prefix+".")
+	}
+	return false
+}
+
+// Envelope is the JSON body POSTed to webhook endpoints
+type Envelope struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Enqueue records a pending delivery of event for every active webhook of
+// userID that subscribes to it. Call it inside the transaction that makes
+// the change so the event is only sent if the change commits.
+func Enqueue(q Querier, userID, event string, data interface{}) error {
+	rows, err := q.Query(`
+		SELECT id, events FROM webhooks
+		WHERE user_id = $1 AND is_active = true`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch webhooks: %v", err)
+	}
+
+	var webhookIDs []string
+	for rows.Next() {
+		var id string
+		var patterns pq.StringArray
+		if err := rows.Scan(&id, &patterns); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan webhook: %v", err)
+		}
+		for _, pattern := range patterns {
+			if matches(pattern, event) {
+				webhookIDs = append(webhookIDs, id)
+				break
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate webhooks: %v", err)
+	}
+
+	for _, webhookID := range webhookIDs {
+		deliveryID := uuid.New().String()
+		payload, err := json.Marshal(Envelope{
+			ID:        deliveryID,
+			Event:     event,
+			CreatedAt: time.Now().UTC(),
+			Data:      data,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode webhook payload: %v", err)
+		}
+
+		_, err = q.Exec(`
+			INSERT INTO webhook_deliveries (id, webhook_id, event, payload)
+			VALUES ($1, $2, $3, $4)`,
+			deliveryID, webhookID, event, payload)
+		if err != nil {
+			return fmt.Errorf("failed to enqueue webhook delivery: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// GenerateSecret returns a random signing secret for a new webhook
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %v", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign computes the X-Snippy-Signature header value for body sent at
+// timestamp. The signed message is "<unix timestamp>.<body>" so receivers
+// can reject replayed deliveries.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + ts + ",v1=" + computeMAC(secret, ts, body)
+}
+
+// Verify checks a signature header produced by Sign and rejects it when the
+// timestamp is older than tolerance
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			sig = value
+		}
+	}
+	if ts == "" || sig == "" {
+		return fmt.Errorf("malformed signature header")
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid signature timestamp")
+	}
+	if tolerance > 0 && time.Since(time.Unix(unix, 0)) > tolerance {
+		return fmt.Errorf("signature timestamp is too old")
+	}
+
+	if !hmac.Equal([]byte(sig), []byte(computeMAC(secret, ts, body))) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// computeMAC returns the hex HMAC-SHA256 of "<ts>.<body>"
+func computeMAC(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
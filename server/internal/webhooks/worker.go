@@ -0,0 +1,233 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Delivery retry policy
+const (
+	DefaultMaxAttempts  = 8                // Attempts before a delivery is marked failed
+	DefaultDisableAfter = 15               // Consecutive failures before a webhook is disabled
+	backoffBase         = 30 * time.Second // Delay before the first retry
+	backoffMax          = 6 * time.Hour    // Upper bound for the retry delay
+	claimLease          = 5 * time.Minute  // How long a claimed delivery is hidden from other workers
+)
+
+// Worker sends pending deliveries from the outbox and schedules retries
+type Worker struct {
+	DB           *sql.DB
+	Client       *http.Client
+	PollInterval time.Duration
+	BatchSize    int
+	MaxAttempts  int
+	DisableAfter int
+}
+
+// NewWorker creates a worker with the default retry policy
+func NewWorker(db *sql.DB) *Worker {
+	return &Worker{
+		DB:           db,
+		Client:       NewClient(10 * time.Second),
+		PollInterval: 5 * time.Second,
+		BatchSize:    20,
+		MaxAttempts:  DefaultMaxAttempts,
+		DisableAfter: DefaultDisableAfter,
+	}
+}
+
+// Run processes due deliveries until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.ProcessDue(ctx); err != nil {
+			slog.ErrorContext(ctx, "webhook worker failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dueDelivery is a claimed outbox row together with its endpoint
+type dueDelivery struct {
+	id        string
+	webhookID string
+	event     string
+	payload   []byte
+	attempts  int
+	url       string
+	secret    string
+}
+
+// ProcessDue claims up to BatchSize due deliveries, sends them and records
+// the outcome. It returns the number of deliveries attempted.
+func (w *Worker) ProcessDue(ctx context.Context) (int, error) {
+	// Claim rows by pushing next_attempt_at into the future so that other
+	// replicas skip them while we are sending, without holding a transaction
+	rows, err := w.DB.QueryContext(ctx, `
+		WITH due AS (
+			SELECT d.id FROM webhook_deliveries d
+			JOIN webhooks wh ON wh.id = d.webhook_id
+			WHERE d.status = 'pending' AND d.next_attempt_at <= now() AND wh.is_active = true
+			ORDER BY d.next_attempt_at
+			LIMIT $1
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = now() + $2 * interval '1 second'
+		FROM due, webhooks wh
+		WHERE d.id = due.id AND wh.id = d.webhook_id
+		RETURNING d.id, d.webhook_id, d.event, d.payload, d.attempts, wh.url, wh.secret`,
+		w.BatchSize, int(claimLease.Seconds()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim deliveries: %v", err)
+	}
+
+	var batch []dueDelivery
+	for rows.Next() {
+		var d dueDelivery
+		if err := rows.Scan(&d.id, &d.webhookID, &d.event, &d.payload, &d.attempts, &d.url, &d.secret); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan delivery: %v", err)
+		}
+		batch = append(batch, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to iterate deliveries: %v", err)
+	}
+
+	for _, d := range batch {
+		statusCode, sendErr := Deliver(ctx, w.Client, d.url, d.secret, d.id, d.event, d.payload)
+		if sendErr != nil {
+			slog.InfoContext(ctx, "webhook delivery failed", "delivery_id", d.id, "webhook_id", d.webhookID, "error", errors.Unwrap(sendErr))
+		}
+		if err := w.record(ctx, d, statusCode, sendErr); err != nil {
+			slog.ErrorContext(ctx, "failed to record webhook delivery", "delivery_id", d.id, "error", err)
+		}
+	}
+
+	return len(batch), nil
+}
+
+// record stores the result of an attempt, schedules the next retry and
+// disables the webhook after too many consecutive failures
+func (w *Worker) record(ctx context.Context, d dueDelivery, statusCode int, sendErr error) error {
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+
+	tx, err := w.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if sendErr == nil {
+		_, err = tx.Exec(`
+			UPDATE webhook_deliveries
+			SET status = 'succeeded', attempts = attempts + 1, last_status_code = $1,
+			    last_error = NULL, delivered_at = now()
+			WHERE id = $2`, code, d.id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE webhooks SET failure_count = 0 WHERE id = $1", d.webhookID)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	attempts := d.attempts + 1
+	status := "pending"
+	if attempts >= w.MaxAttempts {
+		status = "failed"
+	}
+
+	_, err = tx.Exec(`
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, last_status_code = $3, last_error = $4,
+		    next_attempt_at = now() + $5 * interval '1 second'
+		WHERE id = $6`,
+		status, attempts, code, sendErr.Error(), int(Backoff(attempts).Seconds()), d.id)
+	if err != nil {
+		return err
+	}
+
+	var disabled bool
+	err = tx.QueryRow(`
+		UPDATE webhooks
+		SET failure_count = failure_count + 1,
+		    is_active = CASE WHEN failure_count + 1 >= $1 THEN false ELSE is_active END,
+		    disabled_at = CASE WHEN failure_count + 1 >= $1 THEN now() ELSE disabled_at END
+		WHERE id = $2
+		RETURNING NOT is_active`, w.DisableAfter, d.webhookID).Scan(&disabled)
+	if err != nil {
+		return err
+	}
+	if disabled {
+		slog.WarnContext(ctx, "webhook disabled after consecutive failures", "webhook_id", d.webhookID, "failures", w.DisableAfter)
+	}
+
+	return tx.Commit()
+}
+
+// Backoff returns the delay before the retry that follows the given
+// number of attempts: 30s, 1m, 2m, 4m... capped at 6h
+func Backoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	delay := backoffBase
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= backoffMax {
+			return backoffMax
+		}
+	}
+	return delay
+}
+
+// Deliver POSTs a signed payload to url. Any non-2xx response, redirects
+// included, is an error. Errors are *DeliveryError, whose message can be
+// shown to the webhook's owner. The returned status code is 0 when no
+// response was received.
+func Deliver(ctx context.Context, client *http.Client, url, secret, deliveryID, event string, payload []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, &DeliveryError{Reason: "invalid webhook URL", Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Snippy-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	req.Header.Set(HeaderSignature, Sign(secret, time.Now(), payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, transportError(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		reason := fmt.Sprintf("endpoint responded with status %d", resp.StatusCode)
+		return resp.StatusCode, &DeliveryError{Reason: reason, Err: errors.New(reason)}
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,30 @@
+-- Create notifications table
+CREATE TABLE IF NOT EXISTS notifications (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id TEXT NOT NULL,
+  actor_id TEXT NOT NULL,
+  type TEXT NOT NULL,
+  snippet_id UUID DEFAULT NULL,
+  data JSONB NOT NULL DEFAULT '{}',
+  read_at TIMESTAMP DEFAULT NULL,
+  created_at TIMESTAMP DEFAULT now()
+);
+
+-- Create notification preferences table
+CREATE TABLE IF NOT EXISTS notification_preferences (
+  user_id TEXT NOT NULL,
+  type TEXT NOT NULL,
+  enabled BOOLEAN NOT NULL DEFAULT true,
+  created_at TIMESTAMP DEFAULT now(),
+  updated_at TIMESTAMP DEFAULT now(),
+  PRIMARY KEY (user_id, type)
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id_created_at ON notifications(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications(user_id) WHERE read_at IS NULL;
+
+DROP TRIGGER IF EXISTS update_notification_preferences_updated_at ON notification_preferences;
+CREATE TRIGGER update_notification_preferences_updated_at
+    BEFORE UPDATE ON notification_preferences
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,4 @@
+-- Drop fork upstream tracking columns
+ALTER TABLE snippets DROP COLUMN IF EXISTS upstream_synced_at;
+ALTER TABLE snippets DROP COLUMN IF EXISTS upstream_base_content;
+ALTER TABLE snippets DROP COLUMN IF EXISTS upstream_base_title;
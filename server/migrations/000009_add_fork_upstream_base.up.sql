@@ -0,0 +1,5 @@
+-- Track the upstream content a fork was last synced with, used as the
+-- common ancestor when merging upstream changes into the fork
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS upstream_base_title TEXT DEFAULT NULL;
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS upstream_base_content TEXT DEFAULT NULL;
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS upstream_synced_at TIMESTAMP DEFAULT NULL;
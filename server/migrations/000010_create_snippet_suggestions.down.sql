@@ -0,0 +1,9 @@
+-- Drop snippet suggestion tables
+DROP TRIGGER IF EXISTS update_snippet_suggestions_updated_at ON snippet_suggestions;
+DROP TABLE IF EXISTS snippet_contributors CASCADE;
+DROP TABLE IF EXISTS snippet_suggestions CASCADE;
+
+-- Drop snippet version
+DROP TRIGGER IF EXISTS bump_snippets_version ON snippets;
+DROP FUNCTION IF EXISTS bump_snippet_version();
+ALTER TABLE snippets DROP COLUMN IF EXISTS version;
@@ -0,0 +1,60 @@
+-- Snippet version, bumped whenever user-visible snippet fields change
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION bump_snippet_version()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF ROW(NEW.title, NEW.content, NEW.collection_ids, NEW.tag_ids, NEW.is_public, NEW.is_favorite)
+       IS DISTINCT FROM ROW(OLD.title, OLD.content, OLD.collection_ids, OLD.tag_ids, OLD.is_public, OLD.is_favorite) THEN
+        NEW.version = OLD.version + 1;
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS bump_snippets_version ON snippets;
+CREATE TRIGGER bump_snippets_version
+    BEFORE UPDATE ON snippets
+    FOR EACH ROW EXECUTE FUNCTION bump_snippet_version();
+
+-- Create snippet suggestions table (proposed edits to public snippets)
+CREATE TABLE IF NOT EXISTS snippet_suggestions (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  snippet_id UUID NOT NULL,
+  owner_id TEXT NOT NULL,
+  proposer_id TEXT NOT NULL,
+  title TEXT NOT NULL,
+  content TEXT NOT NULL,
+  message TEXT NOT NULL DEFAULT '',
+  base_version INT NOT NULL,
+  base_title TEXT NOT NULL,
+  base_content TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'open',
+  response_message TEXT DEFAULT NULL,
+  resolved_at TIMESTAMP DEFAULT NULL,
+  created_at TIMESTAMP DEFAULT now(),
+  updated_at TIMESTAMP DEFAULT now(),
+  FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE
+);
+
+-- Create snippet contributors table (credited proposers of accepted suggestions)
+CREATE TABLE IF NOT EXISTS snippet_contributors (
+  snippet_id UUID NOT NULL,
+  user_id TEXT NOT NULL,
+  suggestion_id UUID NOT NULL,
+  created_at TIMESTAMP DEFAULT now(),
+  PRIMARY KEY (snippet_id, suggestion_id),
+  FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE,
+  FOREIGN KEY (suggestion_id) REFERENCES snippet_suggestions(id) ON DELETE CASCADE
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_snippet_suggestions_snippet_id ON snippet_suggestions(snippet_id);
+CREATE INDEX IF NOT EXISTS idx_snippet_suggestions_owner_id ON snippet_suggestions(owner_id, status);
+CREATE INDEX IF NOT EXISTS idx_snippet_suggestions_proposer_id ON snippet_suggestions(proposer_id);
+CREATE INDEX IF NOT EXISTS idx_snippet_contributors_user_id ON snippet_contributors(user_id);
+
+DROP TRIGGER IF EXISTS update_snippet_suggestions_updated_at ON snippet_suggestions;
+CREATE TRIGGER update_snippet_suggestions_updated_at
+    BEFORE UPDATE ON snippet_suggestions
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
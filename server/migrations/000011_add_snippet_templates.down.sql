@@ -0,0 +1,3 @@
+-- Drop template tracking
+DROP INDEX IF EXISTS idx_snippets_template_id;
+ALTER TABLE snippets DROP COLUMN IF EXISTS template_id;
@@ -0,0 +1,4 @@
+-- Snippets created from a template remember which template they came from
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS template_id UUID DEFAULT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_snippets_template_id ON snippets(template_id);
@@ -0,0 +1,2 @@
+-- Drop snippet runs table
+DROP TABLE IF EXISTS snippet_runs CASCADE;
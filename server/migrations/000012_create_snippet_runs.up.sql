@@ -0,0 +1,20 @@
+-- Create snippet runs table (execution history per snippet and user)
+CREATE TABLE IF NOT EXISTS snippet_runs (
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  snippet_id UUID NOT NULL,
+  user_id TEXT NOT NULL,
+  language TEXT NOT NULL,
+  stdin TEXT NOT NULL DEFAULT '',
+  stdout TEXT NOT NULL DEFAULT '',
+  stderr TEXT NOT NULL DEFAULT '',
+  exit_code INT NOT NULL,
+  phase TEXT NOT NULL DEFAULT 'run',
+  duration_ms INT NOT NULL,
+  timed_out BOOLEAN NOT NULL DEFAULT false,
+  output_truncated BOOLEAN NOT NULL DEFAULT false,
+  created_at TIMESTAMP DEFAULT now(),
+  FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_snippet_runs_snippet_user ON snippet_runs(snippet_id, user_id, created_at DESC);
@@ -0,0 +1,3 @@
+-- Drop snippet secret scans table
+DROP INDEX IF EXISTS idx_snippets_public_updated_at;
+DROP TABLE IF EXISTS snippet_secret_scans CASCADE;
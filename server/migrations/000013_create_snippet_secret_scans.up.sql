@@ -0,0 +1,12 @@
+-- Create snippet secret scans table (latest scan result per snippet version)
+CREATE TABLE IF NOT EXISTS snippet_secret_scans (
+  snippet_id UUID PRIMARY KEY,
+  version INT NOT NULL,
+  findings JSONB NOT NULL DEFAULT '[]',
+  overridden BOOLEAN NOT NULL DEFAULT false,
+  scanned_at TIMESTAMP DEFAULT now(),
+  FOREIGN KEY (snippet_id) REFERENCES snippets(id) ON DELETE CASCADE
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_snippets_public_updated_at ON snippets(updated_at) WHERE is_public = true;
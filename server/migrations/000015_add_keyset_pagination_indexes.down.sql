@@ -0,0 +1,17 @@
+-- Drop keyset pagination indexes
+DROP INDEX IF EXISTS idx_webhook_deliveries_webhook_created_id;
+DROP INDEX IF EXISTS idx_notifications_user_created_id;
+DROP INDEX IF EXISTS idx_snippets_public_title_id;
+DROP INDEX IF EXISTS idx_snippets_public_updated_id;
+DROP INDEX IF EXISTS idx_snippets_public_created_id;
+DROP INDEX IF EXISTS idx_snippets_public_forks_id;
+DROP INDEX IF EXISTS idx_snippets_user_title_id;
+DROP INDEX IF EXISTS idx_snippets_user_updated_id;
+DROP INDEX IF EXISTS idx_snippets_user_created_id;
+
+ALTER TABLE webhook_deliveries ALTER COLUMN created_at DROP NOT NULL;
+ALTER TABLE notifications ALTER COLUMN created_at DROP NOT NULL;
+ALTER TABLE snippets
+  ALTER COLUMN fork_count DROP NOT NULL,
+  ALTER COLUMN created_at DROP NOT NULL,
+  ALTER COLUMN updated_at DROP NOT NULL;
@@ -0,0 +1,26 @@
+-- Keyset pagination compares (sort columns, id) tuples, which needs the sort
+-- columns to be non-null
+UPDATE snippets SET fork_count = 0 WHERE fork_count IS NULL;
+UPDATE snippets SET created_at = now() WHERE created_at IS NULL;
+UPDATE snippets SET updated_at = created_at WHERE updated_at IS NULL;
+ALTER TABLE snippets
+  ALTER COLUMN fork_count SET NOT NULL,
+  ALTER COLUMN created_at SET NOT NULL,
+  ALTER COLUMN updated_at SET NOT NULL;
+
+UPDATE notifications SET created_at = now() WHERE created_at IS NULL;
+ALTER TABLE notifications ALTER COLUMN created_at SET NOT NULL;
+
+UPDATE webhook_deliveries SET created_at = now() WHERE created_at IS NULL;
+ALTER TABLE webhook_deliveries ALTER COLUMN created_at SET NOT NULL;
+
+-- Create indexes matching each sort order, with id as the tiebreaker
+CREATE INDEX IF NOT EXISTS idx_snippets_user_created_id ON snippets(user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_snippets_user_updated_id ON snippets(user_id, updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_snippets_user_title_id ON snippets(user_id, title, id);
+CREATE INDEX IF NOT EXISTS idx_snippets_public_forks_id ON snippets(fork_count, created_at, id) WHERE is_public = true;
+CREATE INDEX IF NOT EXISTS idx_snippets_public_created_id ON snippets(created_at, id) WHERE is_public = true;
+CREATE INDEX IF NOT EXISTS idx_snippets_public_updated_id ON snippets(updated_at, id) WHERE is_public = true;
+CREATE INDEX IF NOT EXISTS idx_snippets_public_title_id ON snippets(title, id) WHERE is_public = true;
+CREATE INDEX IF NOT EXISTS idx_notifications_user_created_id ON notifications(user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_created_id ON webhook_deliveries(webhook_id, created_at, id);
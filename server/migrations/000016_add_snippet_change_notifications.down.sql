@@ -0,0 +1,5 @@
+-- Drop snippet change notifications
+DROP TRIGGER IF EXISTS notify_snippets_change ON snippets;
+DROP TRIGGER IF EXISTS notify_tags_change ON tags;
+DROP FUNCTION IF EXISTS notify_snippet_change();
+DROP FUNCTION IF EXISTS notify_tag_change();
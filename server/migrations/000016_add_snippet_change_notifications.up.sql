@@ -0,0 +1,37 @@
+-- Notify API replicas when public snippet data changes so they can drop
+-- cached copies. The payload is the snippet ID, or * when any public snippet
+-- may be affected. Notifications are only sent when the transaction commits.
+CREATE OR REPLACE FUNCTION notify_snippet_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        IF OLD.is_public THEN
+            PERFORM pg_notify('snippet_changes', OLD.id::text);
+        END IF;
+        RETURN OLD;
+    END IF;
+    IF NEW.is_public OR (TG_OP = 'UPDATE' AND OLD.is_public) THEN
+        PERFORM pg_notify('snippet_changes', NEW.id::text);
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS notify_snippets_change ON snippets;
+CREATE TRIGGER notify_snippets_change
+    AFTER INSERT OR UPDATE OR DELETE ON snippets
+    FOR EACH ROW EXECUTE FUNCTION notify_snippet_change();
+
+-- Public snippets show tag names, so renaming or deleting a tag affects them
+CREATE OR REPLACE FUNCTION notify_tag_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('snippet_changes', '*');
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS notify_tags_change ON tags;
+CREATE TRIGGER notify_tags_change
+    AFTER UPDATE OF name OR DELETE ON tags
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_tag_change();
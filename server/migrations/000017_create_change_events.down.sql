@@ -0,0 +1,8 @@
+-- Drop change event triggers
+DROP TRIGGER IF EXISTS record_snippets_change ON snippets;
+DROP TRIGGER IF EXISTS record_collections_change ON collections;
+DROP TRIGGER IF EXISTS record_tags_change ON tags;
+DROP FUNCTION IF EXISTS record_change_event();
+
+-- Drop change events table
+DROP TABLE IF EXISTS change_events CASCADE;
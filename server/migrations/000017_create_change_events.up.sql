@@ -0,0 +1,61 @@
+-- Create change events table (log of changes to each user's snippets,
+-- collections and tags, read by GET /api/events to resume streams). Old
+-- events are pruned by the API server.
+CREATE TABLE IF NOT EXISTS change_events (
+  id BIGSERIAL PRIMARY KEY,
+  user_id TEXT NOT NULL,
+  entity_type TEXT NOT NULL CHECK (entity_type IN ('snippet', 'collection', 'tag')),
+  entity_id UUID NOT NULL,
+  action TEXT NOT NULL CHECK (action IN ('created', 'updated', 'deleted')),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_change_events_user_id_id ON change_events(user_id, id);
+CREATE INDEX IF NOT EXISTS idx_change_events_created_at ON change_events(created_at);
+
+-- Record every row change and announce it to all API replicas. The entity
+-- type is passed as the trigger argument; notifications are only sent when
+-- the transaction commits.
+CREATE OR REPLACE FUNCTION record_change_event()
+RETURNS TRIGGER AS $$
+DECLARE
+    changed RECORD;
+    event change_events;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD;
+    ELSE
+        changed := NEW;
+    END IF;
+
+    INSERT INTO change_events (user_id, entity_type, entity_id, action)
+    VALUES (changed.user_id, TG_ARGV[0], changed.id,
+            CASE TG_OP WHEN 'INSERT' THEN 'created' WHEN 'UPDATE' THEN 'updated' ELSE 'deleted' END)
+    RETURNING * INTO event;
+
+    PERFORM pg_notify('change_events', json_build_object(
+        'id', event.id,
+        'user_id', event.user_id,
+        'type', event.entity_type || '.' || event.action,
+        'entity_type', event.entity_type,
+        'entity_id', event.entity_id,
+        'created_at', event.created_at)::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS record_snippets_change ON snippets;
+CREATE TRIGGER record_snippets_change
+    AFTER INSERT OR UPDATE OR DELETE ON snippets
+    FOR EACH ROW EXECUTE FUNCTION record_change_event('snippet');
+
+DROP TRIGGER IF EXISTS record_collections_change ON collections;
+CREATE TRIGGER record_collections_change
+    AFTER INSERT OR UPDATE OR DELETE ON collections
+    FOR EACH ROW EXECUTE FUNCTION record_change_event('collection');
+
+DROP TRIGGER IF EXISTS record_tags_change ON tags;
+CREATE TRIGGER record_tags_change
+    AFTER INSERT OR UPDATE OR DELETE ON tags
+    FOR EACH ROW EXECUTE FUNCTION record_change_event('tag');
@@ -0,0 +1,25 @@
+-- Drop sync triggers
+DROP TRIGGER IF EXISTS record_collection_snippet_positions_tombstone ON collection_snippet_positions;
+DROP TRIGGER IF EXISTS record_collection_positions_tombstone ON collection_positions;
+DROP TRIGGER IF EXISTS record_tags_tombstone ON tags;
+DROP TRIGGER IF EXISTS record_collections_tombstone ON collections;
+DROP TRIGGER IF EXISTS record_snippets_tombstone ON snippets;
+DROP TRIGGER IF EXISTS stamp_collection_snippet_positions_sync_seq ON collection_snippet_positions;
+DROP TRIGGER IF EXISTS stamp_collection_positions_sync_seq ON collection_positions;
+DROP TRIGGER IF EXISTS stamp_tags_sync_seq ON tags;
+DROP TRIGGER IF EXISTS stamp_collections_sync_seq ON collections;
+DROP TRIGGER IF EXISTS stamp_snippets_sync_seq ON snippets;
+DROP FUNCTION IF EXISTS record_sync_tombstone();
+DROP FUNCTION IF EXISTS stamp_sync_seq();
+DROP FUNCTION IF EXISTS next_sync_seq(TEXT);
+
+-- Drop sequence columns (their indexes go with them)
+ALTER TABLE collection_snippet_positions DROP COLUMN IF EXISTS sync_seq;
+ALTER TABLE collection_positions DROP COLUMN IF EXISTS sync_seq;
+ALTER TABLE tags DROP COLUMN IF EXISTS sync_seq;
+ALTER TABLE collections DROP COLUMN IF EXISTS sync_seq;
+ALTER TABLE snippets DROP COLUMN IF EXISTS sync_seq;
+
+-- Drop sync tables
+DROP TABLE IF EXISTS sync_tombstones CASCADE;
+DROP TABLE IF EXISTS sync_counters CASCADE;
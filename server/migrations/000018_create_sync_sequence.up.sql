@@ -0,0 +1,158 @@
+-- Per-user change counters for delta sync (GET /api/sync). Every write to a
+-- synced row takes the next number from its owner's counter. The counter row
+-- stays locked until the writing transaction commits, so a user's numbers
+-- become visible in order and a client that has seen N has seen everything
+-- up to N. pruned_seq is the highest number of a pruned tombstone; clients
+-- that last synced before it must start over.
+CREATE TABLE IF NOT EXISTS sync_counters (
+  user_id TEXT PRIMARY KEY,
+  seq BIGINT NOT NULL DEFAULT 0,
+  pruned_seq BIGINT NOT NULL DEFAULT 0
+);
+
+-- Create sync tombstones table (deleted rows, kept until pruned by the API
+-- server so offline clients learn about deletions)
+CREATE TABLE IF NOT EXISTS sync_tombstones (
+  user_id TEXT NOT NULL,
+  entity_type TEXT NOT NULL CHECK (entity_type IN ('snippet', 'collection', 'tag', 'collection_position', 'snippet_position')),
+  entity_id UUID NOT NULL,
+  seq BIGINT NOT NULL,
+  deleted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (user_id, entity_type, entity_id)
+);
+
+-- Create indexes
+CREATE INDEX IF NOT EXISTS idx_sync_tombstones_user_id_seq ON sync_tombstones(user_id, seq);
+CREATE INDEX IF NOT EXISTS idx_sync_tombstones_deleted_at ON sync_tombstones(deleted_at);
+
+-- Add the sequence number of each row's last change
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS sync_seq BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE collections ADD COLUMN IF NOT EXISTS sync_seq BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS sync_seq BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE collection_positions ADD COLUMN IF NOT EXISTS sync_seq BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE collection_snippet_positions ADD COLUMN IF NOT EXISTS sync_seq BIGINT NOT NULL DEFAULT 0;
+
+-- Number existing rows so a first sync can page through them. Triggers are
+-- disabled meanwhile so updated_at, versions and change events stay as they
+-- are.
+ALTER TABLE snippets DISABLE TRIGGER USER;
+ALTER TABLE collections DISABLE TRIGGER USER;
+ALTER TABLE tags DISABLE TRIGGER USER;
+ALTER TABLE collection_positions DISABLE TRIGGER USER;
+ALTER TABLE collection_snippet_positions DISABLE TRIGGER USER;
+
+CREATE TEMPORARY TABLE sync_backfill AS
+SELECT entity_type, id, user_id,
+       ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY created_at, entity_type, id) AS seq
+FROM (
+  SELECT 'collection' AS entity_type, id, user_id, created_at FROM collections
+  UNION ALL SELECT 'tag', id, user_id, created_at FROM tags
+  UNION ALL SELECT 'snippet', id, user_id, created_at FROM snippets
+  UNION ALL SELECT 'collection_position', id, user_id, created_at FROM collection_positions
+  UNION ALL SELECT 'snippet_position', id, user_id, created_at FROM collection_snippet_positions
+) existing;
+
+UPDATE collections t SET sync_seq = b.seq FROM sync_backfill b WHERE b.entity_type = 'collection' AND b.id = t.id;
+UPDATE tags t SET sync_seq = b.seq FROM sync_backfill b WHERE b.entity_type = 'tag' AND b.id = t.id;
+UPDATE snippets t SET sync_seq = b.seq FROM sync_backfill b WHERE b.entity_type = 'snippet' AND b.id = t.id;
+UPDATE collection_positions t SET sync_seq = b.seq FROM sync_backfill b WHERE b.entity_type = 'collection_position' AND b.id = t.id;
+UPDATE collection_snippet_positions t SET sync_seq = b.seq FROM sync_backfill b WHERE b.entity_type = 'snippet_position' AND b.id = t.id;
+
+INSERT INTO sync_counters (user_id, seq)
+SELECT user_id, MAX(seq) FROM sync_backfill GROUP BY user_id
+ON CONFLICT (user_id) DO NOTHING;
+
+DROP TABLE sync_backfill;
+
+ALTER TABLE snippets ENABLE TRIGGER USER;
+ALTER TABLE collections ENABLE TRIGGER USER;
+ALTER TABLE tags ENABLE TRIGGER USER;
+ALTER TABLE collection_positions ENABLE TRIGGER USER;
+ALTER TABLE collection_snippet_positions ENABLE TRIGGER USER;
+
+CREATE INDEX IF NOT EXISTS idx_snippets_user_id_sync_seq ON snippets(user_id, sync_seq);
+CREATE INDEX IF NOT EXISTS idx_collections_user_id_sync_seq ON collections(user_id, sync_seq);
+CREATE INDEX IF NOT EXISTS idx_tags_user_id_sync_seq ON tags(user_id, sync_seq);
+CREATE INDEX IF NOT EXISTS idx_collection_positions_user_id_sync_seq ON collection_positions(user_id, sync_seq);
+CREATE INDEX IF NOT EXISTS idx_collection_snippet_positions_user_id_sync_seq ON collection_snippet_positions(user_id, sync_seq);
+
+-- Take the next number from owner's counter, locking it until commit
+CREATE OR REPLACE FUNCTION next_sync_seq(owner TEXT)
+RETURNS BIGINT AS $$
+    INSERT INTO sync_counters (user_id, seq) VALUES (owner, 1)
+    ON CONFLICT (user_id) DO UPDATE SET seq = sync_counters.seq + 1
+    RETURNING seq;
+$$ language 'sql';
+
+-- Stamp inserted and updated rows with the next number
+CREATE OR REPLACE FUNCTION stamp_sync_seq()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.sync_seq = next_sync_seq(NEW.user_id);
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+-- Leave a tombstone for deleted rows. The entity type is passed as the
+-- trigger argument; a row deleted again after being recreated moves its
+-- tombstone forward.
+CREATE OR REPLACE FUNCTION record_sync_tombstone()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO sync_tombstones (user_id, entity_type, entity_id, seq)
+    VALUES (OLD.user_id, TG_ARGV[0], OLD.id, next_sync_seq(OLD.user_id))
+    ON CONFLICT (user_id, entity_type, entity_id)
+    DO UPDATE SET seq = EXCLUDED.seq, deleted_at = now();
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS stamp_snippets_sync_seq ON snippets;
+CREATE TRIGGER stamp_snippets_sync_seq
+    BEFORE INSERT OR UPDATE ON snippets
+    FOR EACH ROW EXECUTE FUNCTION stamp_sync_seq();
+
+DROP TRIGGER IF EXISTS stamp_collections_sync_seq ON collections;
+CREATE TRIGGER stamp_collections_sync_seq
+    BEFORE INSERT OR UPDATE ON collections
+    FOR EACH ROW EXECUTE FUNCTION stamp_sync_seq();
+
+DROP TRIGGER IF EXISTS stamp_tags_sync_seq ON tags;
+CREATE TRIGGER stamp_tags_sync_seq
+    BEFORE INSERT OR UPDATE ON tags
+    FOR EACH ROW EXECUTE FUNCTION stamp_sync_seq();
+
+DROP TRIGGER IF EXISTS stamp_collection_positions_sync_seq ON collection_positions;
+CREATE TRIGGER stamp_collection_positions_sync_seq
+    BEFORE INSERT OR UPDATE ON collection_positions
+    FOR EACH ROW EXECUTE FUNCTION stamp_sync_seq();
+
+DROP TRIGGER IF EXISTS stamp_collection_snippet_positions_sync_seq ON collection_snippet_positions;
+CREATE TRIGGER stamp_collection_snippet_positions_sync_seq
+    BEFORE INSERT OR UPDATE ON collection_snippet_positions
+    FOR EACH ROW EXECUTE FUNCTION stamp_sync_seq();
+
+DROP TRIGGER IF EXISTS record_snippets_tombstone ON snippets;
+CREATE TRIGGER record_snippets_tombstone
+    AFTER DELETE ON snippets
+    FOR EACH ROW EXECUTE FUNCTION record_sync_tombstone('snippet');
+
+DROP TRIGGER IF EXISTS record_collections_tombstone ON collections;
+CREATE TRIGGER record_collections_tombstone
+    AFTER DELETE ON collections
+    FOR EACH ROW EXECUTE FUNCTION record_sync_tombstone('collection');
+
+DROP TRIGGER IF EXISTS record_tags_tombstone ON tags;
+CREATE TRIGGER record_tags_tombstone
+    AFTER DELETE ON tags
+    FOR EACH ROW EXECUTE FUNCTION record_sync_tombstone('tag');
+
+DROP TRIGGER IF EXISTS record_collection_positions_tombstone ON collection_positions;
+CREATE TRIGGER record_collection_positions_tombstone
+    AFTER DELETE ON collection_positions
+    FOR EACH ROW EXECUTE FUNCTION record_sync_tombstone('collection_position');
+
+DROP TRIGGER IF EXISTS record_collection_snippet_positions_tombstone ON collection_snippet_positions;
+CREATE TRIGGER record_collection_snippet_positions_tombstone
+    AFTER DELETE ON collection_snippet_positions
+    FOR EACH ROW EXECUTE FUNCTION record_sync_tombstone('snippet_position');
@@ -0,0 +1,2 @@
+-- The original errors are not kept, so there is nothing to restore
+SELECT 1;
@@ -0,0 +1,5 @@
+-- Replace stored transport errors, which could describe the server's
+-- internal network, with the generic reasons deliveries record now
+UPDATE webhook_deliveries
+SET last_error = 'request failed'
+WHERE last_error LIKE 'request failed:%' OR last_error LIKE 'invalid webhook request:%';
@@ -0,0 +1,36 @@
+-- Restore change event IDs from the shared sequence
+CREATE OR REPLACE FUNCTION record_change_event()
+RETURNS TRIGGER AS $$
+DECLARE
+    changed RECORD;
+    event change_events;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD;
+    ELSE
+        changed := NEW;
+    END IF;
+
+    INSERT INTO change_events (user_id, entity_type, entity_id, action)
+    VALUES (changed.user_id, TG_ARGV[0], changed.id,
+            CASE TG_OP WHEN 'INSERT' THEN 'created' WHEN 'UPDATE' THEN 'updated' ELSE 'deleted' END)
+    RETURNING * INTO event;
+
+    PERFORM pg_notify('change_events', json_build_object(
+        'id', event.id,
+        'user_id', event.user_id,
+        'type', event.entity_type || '.' || event.action,
+        'entity_type', event.entity_type,
+        'entity_id', event.entity_id,
+        'created_at', event.created_at)::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+DROP FUNCTION IF EXISTS next_change_event_seq(TEXT);
+
+DROP INDEX IF EXISTS idx_change_events_user_id_seq;
+CREATE INDEX IF NOT EXISTS idx_change_events_user_id_id ON change_events(user_id, id);
+ALTER TABLE change_events DROP COLUMN IF EXISTS seq;
+
+DROP TABLE IF EXISTS change_event_counters CASCADE;
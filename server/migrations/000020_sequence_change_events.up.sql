@@ -0,0 +1,67 @@
+-- Per-user change event counters. Event IDs used to come from a shared
+-- BIGSERIAL, whose values are taken at insert time and can commit out of
+-- order, so a stream resuming after ID N could miss an event numbered below
+-- N that committed later. Every event now takes the next number from its
+-- owner's counter, which stays locked until the writing transaction commits,
+-- so a user's events become visible in order.
+CREATE TABLE IF NOT EXISTS change_event_counters (
+  user_id TEXT PRIMARY KEY,
+  seq BIGINT NOT NULL DEFAULT 0
+);
+
+-- Number logged events per user in their old order
+ALTER TABLE change_events ADD COLUMN IF NOT EXISTS seq BIGINT;
+
+UPDATE change_events e SET seq = numbered.seq
+FROM (
+  SELECT id, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY id) AS seq
+  FROM change_events
+) numbered
+WHERE numbered.id = e.id;
+
+ALTER TABLE change_events ALTER COLUMN seq SET NOT NULL;
+
+INSERT INTO change_event_counters (user_id, seq)
+SELECT user_id, MAX(seq) FROM change_events GROUP BY user_id
+ON CONFLICT (user_id) DO NOTHING;
+
+DROP INDEX IF EXISTS idx_change_events_user_id_id;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_change_events_user_id_seq ON change_events(user_id, seq);
+
+-- Take the next event number from owner's counter, locking it until commit
+CREATE OR REPLACE FUNCTION next_change_event_seq(owner TEXT)
+RETURNS BIGINT AS $$
+    INSERT INTO change_event_counters (user_id, seq) VALUES (owner, 1)
+    ON CONFLICT (user_id) DO UPDATE SET seq = change_event_counters.seq + 1
+    RETURNING seq;
+$$ language 'sql';
+
+-- Record every row change and announce it to all API replicas. Streams see
+-- the owner's sequence number as the event ID.
+CREATE OR REPLACE FUNCTION record_change_event()
+RETURNS TRIGGER AS $$
+DECLARE
+    changed RECORD;
+    event change_events;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        changed := OLD;
+    ELSE
+        changed := NEW;
+    END IF;
+
+    INSERT INTO change_events (user_id, seq, entity_type, entity_id, action)
+    VALUES (changed.user_id, next_change_event_seq(changed.user_id), TG_ARGV[0], changed.id,
+            CASE TG_OP WHEN 'INSERT' THEN 'created' WHEN 'UPDATE' THEN 'updated' ELSE 'deleted' END)
+    RETURNING * INTO event;
+
+    PERFORM pg_notify('change_events', json_build_object(
+        'id', event.seq,
+        'user_id', event.user_id,
+        'type', event.entity_type || '.' || event.action,
+        'entity_type', event.entity_type,
+        'entity_id', event.entity_id,
+        'created_at', event.created_at)::text);
+    RETURN NULL;
+END;
+$$ language 'plpgsql';